@@ -41,14 +41,14 @@ to quickly create a Cobra application.`,
 
 		pdfService := service.NewPDFService(service.DefaultDocumentServiceConfig)
 
-		weaviateDb, err := database.NewWeaviateStore(cfg.WeaviateStoreConfig)
+		vectorDB, err := database.NewVectorDatabase(cfg.VectorStore, cfg.WeaviateStoreConfig, nil)
 		if err != nil {
-			log.Fatalf("Failed to connect to Weaviate database: %v", err)
+			log.Fatalf("Failed to open the vector database: %v", err)
 		}
 		if reinit {
-			err := weaviateDb.ReInit()
+			err := vectorDB.ReInit()
 			if err != nil {
-				log.Fatalf("Failed to reinitialize Weaviate database: %v", err)
+				log.Fatalf("Failed to reinitialize the vector database: %v", err)
 			}
 		}
 
@@ -66,7 +66,7 @@ to quickly create a Cobra application.`,
 				log.Printf("Failed to copy file %s: %v", file, err)
 				continue
 			}
-			err = upload(destPath, weaviateDb, pdfService, tags)
+			err = upload(destPath, vectorDB, pdfService, tags)
 			if err != nil {
 				log.Printf("Failed to upload document %s: %v", destPath, err)
 			}
@@ -93,7 +93,7 @@ func init() {
 	batchUploadDocumentCmd.Flags().StringSliceP("tags", "t", []string{}, "Tags to add to the document")
 }
 
-func upload(filePath string, weaviateDb *database.WeaviateStore, pdfService *service.PDFService, tags []string) error {
+func upload(filePath string, vectorDB database.VectorDatabase, pdfService *service.PDFService, tags []string) error {
 	chunkChan := make(chan types.DocumentChunk)
 	req := types.UploadRequest{
 		Title: service.GetFileNameWithoutExt(filePath),
@@ -112,7 +112,7 @@ func upload(filePath string, weaviateDb *database.WeaviateStore, pdfService *ser
 			},
 			CreatedAt: time.Now().Unix(),
 		}
-		err := weaviateDb.UpsertDocument(context.Background(), document, nil)
+		err := vectorDB.UpsertDocument(context.Background(), document, nil)
 		if err != nil {
 			log.Printf("Failed to upload document to Weaviate database: %v", err)
 			return err
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// exportUsersCmd writes the users to a CSV or XLSX file, without passwords
+var exportUsersCmd = &cobra.Command{
+	Use:   "export-users",
+	Short: "Export users to a CSV or XLSX file",
+	Long: `Writes the users to a CSV or XLSX file, picked from the file extension.
+The file has the same columns as import-users, except the password.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filePath, _ := cmd.Flags().GetString("file")
+		workspace, _ := cmd.Flags().GetString("workspace")
+		if filePath == "" {
+			log.Fatal("--file is required")
+		}
+
+		userService := newUserServiceForCommand()
+		rows, err := userService.ExportUsers(context.Background(), types.UserFilter{Workspace: workspace})
+		if err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		file, err := os.Create(filePath)
+		if err != nil {
+			log.Fatalf("Failed to create file: %v", err)
+		}
+		defer file.Close()
+		if err := utils.WriteSpreadsheet(filepath.Ext(filePath), file, rows); err != nil {
+			log.Fatalf("Failed to write file: %v", err)
+		}
+		log.Printf("Exported %d users to %s", len(rows)-1, filePath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportUsersCmd)
+	exportUsersCmd.Flags().StringP("file", "f", "users.csv", "Path to the .csv or .xlsx file to write")
+	exportUsersCmd.Flags().StringP("workspace", "w", "", "Only export users of this workspace")
+}
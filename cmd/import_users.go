@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// importUsersCmd upserts users by username from a CSV or XLSX file
+var importUsersCmd = &cobra.Command{
+	Use:   "import-users",
+	Short: "Import users from a CSV or XLSX file",
+	Long: "Creates or updates users by username from a CSV or XLSX file whose first row\n" +
+		"names the columns: " + strings.Join(service.UserImportColumns, ", ") + ".\n" +
+		"XLSX files must be written by the export. Invalid rows are reported and skipped.",
+	Run: func(cmd *cobra.Command, args []string) {
+		filePath, _ := cmd.Flags().GetString("file")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if filePath == "" {
+			log.Fatal("--file is required")
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			log.Fatalf("Failed to open file: %v", err)
+		}
+		defer file.Close()
+		rows, err := utils.ReadSpreadsheet(filePath, file)
+		if err != nil {
+			log.Fatalf("Failed to read file: %v", err)
+		}
+
+		userService := newUserServiceForCommand()
+		result, err := userService.ImportUsers(context.Background(), rows, dryRun)
+		if err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+		if result.Failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// newUserServiceForCommand wires the user service against the configured MongoDB
+func newUserServiceForCommand() service.UserService {
+	mongoClient := database.DefaultMongoClient
+	if err := mongoClient.Ping(context.Background(), nil); err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	mongoDb := mongoClient.Database("chatbot")
+	userRepo := repository.NewUserRepo(mongoDb.Collection("users"))
+	workspaceRepo := repository.NewWorkspaceRepo(mongoDb.Collection("workspaces"))
+	workspaceService := service.NewWorkspaceService(workspaceRepo, userRepo)
+	if err := workspaceService.EnsureDepartments(context.Background()); err != nil {
+		log.Fatalf("Failed to create department workspaces: %v", err)
+	}
+	return service.NewUserService(userRepo, workspaceService)
+}
+
+func init() {
+	rootCmd.AddCommand(importUsersCmd)
+	importUsersCmd.Flags().StringP("file", "f", "", "Path to the CSV or XLSX file")
+	importUsersCmd.Flags().Bool("dry-run", false, "Validate the file without writing anything")
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tieubaoca/chatbot-be/database"
+)
+
+// migrateCmd applies the pending MongoDB schema migrations
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending MongoDB migrations",
+	Long: `Creates the collections, validators and indexes the server relies on.
+Applied migrations are recorded in the schema_migrations collection, so running
+the command again only applies new ones. The server runs it on startup unless
+started with --skip-migrate.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		statusOnly, _ := cmd.Flags().GetBool("status")
+		mongoClient := database.DefaultMongoClient
+		if err := mongoClient.Ping(context.Background(), nil); err != nil {
+			log.Fatalf("Failed to connect to MongoDB: %v", err)
+		}
+		mongoDb := mongoClient.Database("chatbot")
+
+		if !statusOnly {
+			applied, err := database.Migrate(context.Background(), mongoDb)
+			if err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			fmt.Printf("Applied %d migration(s)\n", len(applied))
+		}
+		states, err := database.MigrationStatus(context.Background(), mongoDb)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt > 0 {
+				applied = time.Unix(state.AppliedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-25s  %s\n", state.Version, applied, state.Description)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().Bool("status", false, "Only list the migrations and whether they are applied")
+}
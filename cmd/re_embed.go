@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/database"
+)
+
+// reEmbedCmd rebuilds the vectors of the documents and FAQs with the configured embedding model
+var reEmbedCmd = &cobra.Command{
+	Use:   "re-embed",
+	Short: "Rebuild the document and FAQ vectors with the configured embedding model",
+	Long: `Embeds every document chunk and FAQ question with weaviate_store_config.embedding
+and stores the new vectors, keeping the objects. With Weaviate the Document and
+FAQ classes are recreated. Run it after changing the embedding model, the server
+should be stopped meanwhile. The objects are first saved with their new vectors
+as JSON lines to the backup file, ending with the number of objects per class,
+the store is then rebuilt from it. When that fails midway, run the command again
+with --restore and the backup file. Backups cut short are refused.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		backupPath, _ := cmd.Flags().GetString("backup")
+		restorePath, _ := cmd.Flags().GetString("restore")
+		if backupPath == "" {
+			backupPath = fmt.Sprintf("reembed-backup-%d.jsonl", time.Now().Unix())
+		}
+
+		cfg, err := config.LoadConfig("config/config.yaml")
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		if !cfg.WeaviateStoreConfig.Embedding.Enabled() {
+			log.Fatalf("No embedding model configured in weaviate_store_config.embedding")
+		}
+		vectorDB, err := database.NewVectorDatabase(cfg.VectorStore, cfg.WeaviateStoreConfig, nil)
+		if err != nil {
+			log.Fatalf("Failed to open the vector database: %v", err)
+		}
+
+		if restorePath != "" {
+			backup, err := os.Open(restorePath)
+			if err != nil {
+				log.Fatalf("Failed to open backup file: %v", err)
+			}
+			defer backup.Close()
+			counts, err := vectorDB.Restore(context.Background(), backup)
+			if err != nil {
+				log.Fatalf("Restoring %s failed, run the command again: %v", restorePath, err)
+			}
+			printCounts(counts)
+			fmt.Printf("Restored from %s\n", restorePath)
+			return
+		}
+
+		backup, err := os.OpenFile(backupPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			log.Fatalf("Failed to create backup file: %v", err)
+		}
+		defer backup.Close()
+		counts, err := vectorDB.ReEmbed(context.Background(), backup)
+		if err != nil {
+			log.Fatalf("Re-embedding failed, if the store was changed restore it with --restore %s, which only works once the backup was completed: %v", backupPath, err)
+		}
+		printCounts(counts)
+		fmt.Printf("Re-embedded with %s, backup in %s\n", cfg.WeaviateStoreConfig.Embedding.Model, backupPath)
+	},
+}
+
+func printCounts(counts map[string]int) {
+	for class, count := range counts {
+		fmt.Printf("%-10s %d objects\n", class, count)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(reEmbedCmd)
+	reEmbedCmd.Flags().String("backup", "", "File the objects are saved to before the classes are rebuilt (default reembed-backup-<unix time>.jsonl)")
+	reEmbedCmd.Flags().String("restore", "", "Rebuild the store from this backup of an earlier run instead of re-embedding")
+}
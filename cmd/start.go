@@ -6,6 +6,8 @@ package cmd
 import (
 	"context"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
@@ -15,6 +17,8 @@ import (
 	"github.com/tieubaoca/chatbot-be/middleware"
 	"github.com/tieubaoca/chatbot-be/repository"
 	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
 )
 
 // startServerCmd represents the startServer command
@@ -28,18 +32,18 @@ var startServerCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("Failed to load config: %v", err)
 		}
+		if err := utils.SetupJWT(cfg.JWT); err != nil {
+			log.Fatalf("Invalid JWT configuration: %v", err)
+		}
 		// Initialize services
 
 		pdfService := service.NewPDFService(service.DefaultDocumentServiceConfig)
 
-		weaviateDb, err := database.NewWeaviateStore(cfg.WeaviateStoreConfig)
+		vectorDB, err := database.NewVectorDatabase(cfg.VectorStore, cfg.WeaviateStoreConfig, nil)
 		if err != nil {
-			log.Fatalf("Failed to connect to Weaviate database: %v", err)
-		}
-		aiService := service.NewOpenAIService(cfg.AIEndpoint, cfg.OpenAIAPIKey, cfg.Model, weaviateDb)
-		if err := aiService.RegisterRAGFunctionCall(); err != nil {
-			log.Fatalf("Failed to register RAG function call: %v", err)
+			log.Fatalf("Failed to open the vector database: %v", err)
 		}
+		aiService := service.NewOpenAIService(cfg.AIEndpoint, cfg.OpenAIAPIKey, cfg.Model, vectorDB)
 
 		mongoClient := database.DefaultMongoClient
 
@@ -48,41 +52,183 @@ var startServerCmd = &cobra.Command{
 		}
 
 		mongoDb := mongoClient.Database("chatbot")
+		if skipMigrate, _ := cmd.Flags().GetBool("skip-migrate"); !skipMigrate {
+			if _, err := database.Migrate(context.Background(), mongoDb); err != nil {
+				log.Fatalf("Failed to migrate MongoDB: %v", err)
+			}
+		}
 
 		//init repo
 		userRepo := repository.NewUserRepo(mongoDb.Collection("users"))
+		middleware.SetupUserCheck(userRepo)
+		workspaceRepo := repository.NewWorkspaceRepo(mongoDb.Collection("workspaces"))
+		taskRepo := repository.NewTaskRepo(mongoDb.Collection("tasks"))
+		taskCommentRepo := repository.NewTaskCommentRepo(mongoDb.Collection("task_comments"))
+		notificationRepo := repository.NewNotificationRepo(mongoDb.Collection("notifications"))
+		documentRepo := repository.NewDocumentRepo(mongoDb.Collection("documents"))
+		usageRepo := repository.NewUsageRepo(mongoDb.Collection("usage"))
+		faqRepo := repository.NewFAQRepo(mongoDb.Collection("faqs"))
+		promptRepo := repository.NewPromptRepo(mongoDb.Collection("prompt_templates"))
+		answerRepo := repository.NewAnswerRepo(mongoDb.Collection("chat_answers"))
+		auditRepo := repository.NewAuditRepo(mongoDb.Collection("audit_events"))
+		loginAttemptRepo := repository.NewLoginAttemptRepo(mongoDb.Collection("login_attempts"), mongoDb.Collection("login_throttles"))
 		//init service
-		userService := service.NewUserService(userRepo)
-		uploadService := service.NewFileService(cfg.UploadDir, weaviateDb, pdfService)
+		auditService := service.NewAuditService(auditRepo)
+		usageService := service.NewUsageService(usageRepo, cfg.Usage)
+		feedbackService := service.NewFeedbackService(answerRepo, documentRepo, vectorDB)
+		workspaceService := service.NewWorkspaceService(workspaceRepo, userRepo)
+		if err := workspaceService.EnsureDepartments(context.Background()); err != nil {
+			log.Fatalf("Failed to create department workspaces: %v", err)
+		}
+		userService := service.NewUserService(userRepo, workspaceService)
+		faqService := service.NewFAQService(faqRepo, workspaceService, vectorDB, cfg.FAQ.MaxDistance)
+		promptService := service.NewPromptService(promptRepo, workspaceService)
+		retriever := service.NewRetriever(aiService, vectorDB, cfg.Retrieval)
+		taskService := service.NewTaskService(taskRepo, taskCommentRepo, userRepo)
+		taskTools := service.NewTaskTools(taskService, userRepo, service.NewPendingActionStore(15*time.Minute))
+		// setupBackend gives a chat model the RAG tool, the task tools and the shared services
+		setupBackend := func(name string, backend service.ChatBackend) {
+			if err := backend.RegisterRAGFunctionCall(); err != nil {
+				log.Fatalf("Failed to register RAG function call for %s: %v", name, err)
+			}
+			backend.SetUsageService(usageService)
+			backend.SetFAQService(faqService)
+			backend.SetPromptService(promptService)
+			backend.SetRetriever(retriever)
+			if err := taskTools.Register(backend); err != nil {
+				log.Fatalf("Failed to register task tools for %s: %v", name, err)
+			}
+		}
+		setupBackend(cfg.Model, aiService)
+		// The model of ai_endpoint also plans the searches, the other models only chat
+		backends := make(map[string]service.AIService, len(cfg.Router.Models))
+		for _, model := range cfg.Router.Models {
+			var backend service.ChatBackend
+			switch model.Provider {
+			case config.ModelProviderOpenAI:
+				if model.Endpoint == cfg.AIEndpoint && model.Model == cfg.Model {
+					backends[model.Name] = aiService
+					continue
+				}
+				backend = service.NewOpenAIService(model.Endpoint, model.APIKey, model.Model, vectorDB)
+			case config.ModelProviderGemini:
+				backend, err = service.NewGeminiService(strings.Split(model.APIKey, ","), model.Model, vectorDB)
+				if err != nil {
+					log.Fatalf("Failed to create Gemini model %s: %v", model.Name, err)
+				}
+			default:
+				log.Fatalf("Unknown provider %s of model %s", model.Provider, model.Name)
+			}
+			setupBackend(model.Name, backend)
+			backends[model.Name] = backend
+		}
+		modelRouter, err := service.NewModelRouter(cfg.Router, backends)
+		if err != nil {
+			log.Fatalf("Invalid router configuration: %v", err)
+		}
+		authProviders := make([]service.AuthProvider, 0, len(cfg.Auth.Providers))
+		for _, name := range cfg.Auth.Providers {
+			switch name {
+			case "mongo":
+				authProviders = append(authProviders, service.NewMongoAuthProvider(userRepo))
+			case "ldap":
+				authProviders = append(authProviders, service.NewLDAPAuthProvider(cfg.Auth.LDAP, userRepo))
+			default:
+				log.Fatalf("Unknown auth provider: %s", name)
+			}
+		}
+		loginService := service.NewLoginService(authProviders, loginAttemptRepo, service.DefaultLoginThrottleConfig)
+		notificationService := service.NewNotificationService(notificationRepo)
+		notificationHub := service.NewNotificationHub()
+		wsService := service.NewWebSocketService(modelRouter, taskTools, notificationHub, auditService, feedbackService)
+		deadlineScheduler := service.NewDeadlineScheduler(taskRepo, userRepo, notificationRepo, notificationHub,
+			service.NotifiersFromConfig(cfg.Notification),
+			time.Duration(cfg.Notification.ScanIntervalSeconds)*time.Second,
+			time.Duration(cfg.Notification.DueSoonHours)*time.Hour)
+		uploadService := service.NewFileService(cfg.UploadDir, vectorDB, pdfService, documentRepo)
+		documentService := service.NewDocumentService(documentRepo, vectorDB, cfg.UploadDir)
+		retentionPurger := service.NewRetentionPurger(userRepo, documentService,
+			time.Duration(cfg.Retention.DeletedDays)*24*time.Hour,
+			time.Duration(cfg.Retention.PurgeIntervalHours)*time.Hour)
 
 		// Initialize handlers
 		corsHandler := handler.NewCorsHandler()
-		uploadHandler := handler.NewUploadHandler(uploadService)
-		chatHandler := handler.NewChatHandler(aiService)
-		searchHandler := handler.NewSearchHandler(weaviateDb)
+		uploadHandler := handler.NewUploadHandler(uploadService, auditService)
+		chatHandler := handler.NewChatHandler(modelRouter, taskTools, auditService, feedbackService)
+		searchHandler := handler.NewSearchHandler(vectorDB, retriever, promptService, auditService)
 		pdfHandler := handler.NewDocumentHandler(cfg.UploadDir) // Add this line
-		loginHandler := handler.NewLoginHandler(userService)
+		loginHandler := handler.NewLoginHandler(loginService, auditService)
+		jwksHandler := handler.NewJWKSHandler()
 
-		userMngHandler := handler.NewUserManageHandler(userService)
+		userMngHandler := handler.NewUserManageHandler(userService, auditService)
+		taskHandler := handler.NewTaskHandler(taskService)
+		notificationHandler := handler.NewNotificationHandler(notificationService)
+		workspaceHandler := handler.NewWorkspaceHandler(workspaceService)
+		documentMngHandler := handler.NewDocumentManageHandler(documentService, auditService)
+		auditHandler := handler.NewAuditHandler(auditService)
+		usageHandler := handler.NewUsageHandler(usageService)
+		feedbackHandler := handler.NewFeedbackHandler(feedbackService, auditService)
+		faqHandler := handler.NewFAQHandler(faqService, auditService)
+		promptHandler := handler.NewPromptHandler(promptService, auditService)
 		// Setup routes
 		// Setup Gin router
 		router := gin.Default()
+		// Forwarded headers are only believed from the configured proxies
+		if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+			log.Fatalf("Invalid trusted proxies: %v", err)
+		}
 
 		// Apply global middleware
-		router.Use(corsHandler.CorsMiddleware)
+		router.Use(corsHandler.CorsMiddleware, middleware.ClientIP)
+		router.GET("/.well-known/jwks.json", jwksHandler.HandleJWKS)
 
 		// API v1 routes - require authentication
 		apiV1 := router.Group("/api/v1")
 		apiV1.POST("/login", loginHandler.HandleLogin)
+		apiV1.GET("/ws", middleware.WebSocketAuthMiddleware, gin.WrapF(wsService.HandleChat))
 
 		// Protected user routes
 		userRoutes := apiV1.Group("/")
 		userRoutes.Use(middleware.AuthMiddleware)
 		{
 			userRoutes.POST("/chat", chatHandler.HandleChat)
+			userRoutes.GET("/chat/models", chatHandler.HandleListModels)
+			userRoutes.GET("/chat/actions", chatHandler.HandleListActions)
+			userRoutes.POST("/chat/actions/:id/confirm", chatHandler.HandleConfirmAction)
+			userRoutes.DELETE("/chat/actions/:id", chatHandler.HandleDiscardAction)
+			userRoutes.PUT("/chat/answers/:id/feedback", chatHandler.HandleRateAnswer)
 			userRoutes.POST("/documents/search", searchHandler.HandleSearch)
+			userRoutes.POST("/documents/search/planned", searchHandler.HandlePlannedSearch)
 			userRoutes.POST("/documents/ask-ai", searchHandler.HandleAskAI)
 			userRoutes.GET("/pdf", pdfHandler.ServeDocument)
+			userRoutes.POST("/documents/upload", middleware.RequirePermission(types.PermissionDocumentsUpload), uploadHandler.UploadDocumentHandler)
+			userRoutes.DELETE("/documents/:id", middleware.RequirePermission(types.PermissionDocumentsDelete), documentMngHandler.HandleDeleteWorkspaceDocument)
+		}
+
+		// Task routes, scoped to the caller's workspace
+		taskRoutes := apiV1.Group("/tasks")
+		taskRoutes.Use(middleware.AuthMiddleware)
+		{
+			taskRoutes.POST("", taskHandler.HandleCreateTask)
+			taskRoutes.GET("", taskHandler.HandleListTasks)
+			taskRoutes.GET("/:id", taskHandler.HandleGetTask)
+			taskRoutes.PUT("/:id/assign", taskHandler.HandleAssignTask)
+			taskRoutes.PUT("/:id/report", taskHandler.HandleReportTask)
+			taskRoutes.PUT("/:id/status", taskHandler.HandleTransitionTask)
+			taskRoutes.GET("/:id/history", taskHandler.HandleGetTaskHistory)
+			taskRoutes.GET("/:id/comments", taskHandler.HandleListComments)
+			taskRoutes.POST("/:id/comments", taskHandler.HandleAddComment)
+		}
+
+		apiV1.GET("/workspaces/:id/members", middleware.AuthMiddleware,
+			middleware.RequirePermission(types.PermissionUsersRead), workspaceHandler.HandleListMyMembers)
+
+		notificationRoutes := apiV1.Group("/notifications")
+		notificationRoutes.Use(middleware.AuthMiddleware)
+		{
+			notificationRoutes.GET("", notificationHandler.HandleListNotifications)
+			notificationRoutes.PUT("/read", notificationHandler.HandleMarkAllRead)
+			notificationRoutes.PUT("/:id/read", notificationHandler.HandleMarkRead)
 		}
 
 		// Admin routes - require admin authentication
@@ -92,12 +238,48 @@ var startServerCmd = &cobra.Command{
 			adminRoutes.POST("/upload", uploadHandler.UploadDocumentHandler)
 			adminRoutes.POST("/users/create", userMngHandler.HandleCreateUser)
 			adminRoutes.POST("/users/batch-create", userMngHandler.HandlerBatchCreateUser)
+			adminRoutes.POST("/users/import", userMngHandler.HandleImportUsers)
+			adminRoutes.GET("/users/export", userMngHandler.HandleExportUsers)
+			adminRoutes.GET("/users", userMngHandler.HandlePaginateUser)
 			adminRoutes.GET("/users/paginate", userMngHandler.HandlePaginateUser)
 			adminRoutes.GET("/users/get", userMngHandler.HandleGetUser)
 			adminRoutes.PUT("/users/update", userMngHandler.HandleUpdateUser)
 			adminRoutes.DELETE("/users/delete", userMngHandler.HandleDeleteUser)
+			adminRoutes.GET("/users/deleted", userMngHandler.HandleListDeletedUsers)
+			adminRoutes.POST("/users/:id/restore", userMngHandler.HandleRestoreUser)
+			adminRoutes.GET("/documents", documentMngHandler.HandleListDocuments)
+			adminRoutes.GET("/documents/deleted", documentMngHandler.HandleListDeletedDocuments)
+			adminRoutes.DELETE("/documents/:id", documentMngHandler.HandleDeleteDocument)
+			adminRoutes.POST("/documents/:id/restore", documentMngHandler.HandleRestoreDocument)
+			adminRoutes.GET("/audit", auditHandler.HandleListEvents)
+			adminRoutes.GET("/audit/export", auditHandler.HandleExportEvents)
+			adminRoutes.GET("/usage", usageHandler.HandleUsageReport)
+			adminRoutes.GET("/feedback", feedbackHandler.HandleListReviewQueue)
+			adminRoutes.PUT("/feedback/:id/review", feedbackHandler.HandleReviewAnswer)
+			adminRoutes.POST("/feedback/:id/ingest", feedbackHandler.HandleIngestCorrection)
+			adminRoutes.POST("/faqs", faqHandler.HandleCreateFAQ)
+			adminRoutes.GET("/faqs", faqHandler.HandleListFAQs)
+			adminRoutes.GET("/faqs/:id", faqHandler.HandleGetFAQ)
+			adminRoutes.PUT("/faqs/:id", faqHandler.HandleUpdateFAQ)
+			adminRoutes.DELETE("/faqs/:id", faqHandler.HandleDeleteFAQ)
+			adminRoutes.POST("/prompts", promptHandler.HandleSavePrompt)
+			adminRoutes.GET("/prompts", promptHandler.HandleListPrompts)
+			adminRoutes.GET("/prompts/current", promptHandler.HandleCurrentPrompt)
+			adminRoutes.POST("/prompts/preview", promptHandler.HandlePreviewPrompt)
+			adminRoutes.GET("/prompts/:id", promptHandler.HandleGetPrompt)
+			adminRoutes.POST("/prompts/:id/restore", promptHandler.HandleRestorePrompt)
+			adminRoutes.POST("/workspaces", workspaceHandler.HandleCreateWorkspace)
+			adminRoutes.GET("/workspaces", workspaceHandler.HandleListWorkspaces)
+			adminRoutes.GET("/workspaces/:id", workspaceHandler.HandleGetWorkspace)
+			adminRoutes.PUT("/workspaces/:id", workspaceHandler.HandleUpdateWorkspace)
+			adminRoutes.DELETE("/workspaces/:id", workspaceHandler.HandleDeleteWorkspace)
+			adminRoutes.GET("/workspaces/:id/members", workspaceHandler.HandleListMembers)
+			adminRoutes.PUT("/workspaces/:id/members", workspaceHandler.HandleAssignMember)
 		}
 
+		deadlineScheduler.Start(context.Background())
+		retentionPurger.Start(context.Background())
+
 		log.Printf("Starting server on port %s...\n", cfg.Port)
 		if err := router.Run(":" + cfg.Port); err != nil {
 			log.Fatal("Server error:", err)
@@ -108,4 +290,5 @@ var startServerCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(startServerCmd)
 	startServerCmd.Flags().StringP("config", "c", "config/config.yaml", "config file")
+	startServerCmd.Flags().Bool("skip-migrate", false, "Do not apply pending MongoDB migrations on startup")
 }
@@ -48,14 +48,14 @@ to quickly create a Cobra application.`,
 
 		pdfService := service.NewPDFService(service.DefaultDocumentServiceConfig)
 
-		weaviateDb, err := database.NewWeaviateStore(cfg.WeaviateStoreConfig)
+		vectorDB, err := database.NewVectorDatabase(cfg.VectorStore, cfg.WeaviateStoreConfig, nil)
 		if err != nil {
-			log.Fatalf("Failed to connect to Weaviate database: %v", err)
+			log.Fatalf("Failed to open the vector database: %v", err)
 		}
 		if reinit {
-			err := weaviateDb.ReInit()
+			err := vectorDB.ReInit()
 			if err != nil {
-				log.Fatalf("Failed to reinitialize Weaviate database: %v", err)
+				log.Fatalf("Failed to reinitialize the vector database: %v", err)
 			}
 		}
 
@@ -87,7 +87,7 @@ to quickly create a Cobra application.`,
 			// defer testFile.Close()
 			// testFile.WriteString(document.Content)
 			// end test
-			err = weaviateDb.UpsertDocument(context.Background(), document, nil)
+			err = vectorDB.UpsertDocument(context.Background(), document, nil)
 			if err != nil {
 				log.Fatalf("Failed to upload document to Weaviate database: %v", err)
 			}
@@ -20,12 +20,171 @@ var OllamaGenerativeConfig = map[string]interface{}{
 }
 
 type Config struct {
-	Port                string              `mapstructure:"port"`
+	Port string `mapstructure:"port"`
+	// TrustedProxies are the addresses or CIDRs whose X-Forwarded-For header is believed, none by default
+	TrustedProxies      []string            `mapstructure:"trusted_proxies"`
 	AIEndpoint          string              `mapstructure:"ai_endpoint"`
 	Model               string              `mapstructure:"model"`
 	OpenAIAPIKey        string              `mapstructure:"OPENAI_API_KEY"`
 	UploadDir           string              `mapstructure:"upload_dir"`
 	WeaviateStoreConfig WeaviateStoreConfig `mapstructure:"weaviate_store_config"`
+	VectorStore         VectorStoreConfig   `mapstructure:"vector_store"`
+	JWT                 JWTConfig           `mapstructure:"jwt"`
+	Auth                AuthConfig          `mapstructure:"auth"`
+	Notification        NotificationConfig  `mapstructure:"notification"`
+	Retention           RetentionConfig     `mapstructure:"retention"`
+	Usage               UsageConfig         `mapstructure:"usage"`
+	FAQ                 FAQConfig           `mapstructure:"faq"`
+	Retrieval           RetrievalConfig     `mapstructure:"retrieval"`
+	Router              RouterConfig        `mapstructure:"router"`
+}
+
+const (
+	ModelProviderOpenAI = "openai"
+	ModelProviderGemini = "gemini"
+)
+
+// RouterConfig lists the chat models and picks a fallback chain of them per request.
+// Without models the server only chats with ai_endpoint and model.
+type RouterConfig struct {
+	Models []ModelConfig `mapstructure:"models"`
+	// Default is the chain of model names for the requests no rule matches, all models in order by default
+	Default []string `mapstructure:"default"`
+	// Rules are tried in order, the first matching rule gives the chain
+	Rules   []RouteRule   `mapstructure:"rules"`
+	Breaker BreakerConfig `mapstructure:"breaker"`
+}
+
+type ModelConfig struct {
+	// Name is what clients ask for in the model field, the model by default
+	Name string `mapstructure:"name"`
+	// Provider is openai, for any OpenAI compatible endpoint, or gemini
+	Provider string `mapstructure:"provider"`
+	Endpoint string `mapstructure:"endpoint"`
+	Model    string `mapstructure:"model"`
+	// APIKeyEnv names the env var holding the key, a comma separated list of keys for gemini
+	APIKeyEnv      string `mapstructure:"api_key_env"`
+	APIKey         string `mapstructure:"-"`
+	TimeoutSeconds int    `mapstructure:"timeout_seconds"`
+}
+
+// RouteRule matches when every condition it sets matches
+type RouteRule struct {
+	MinManagementLevel int      `mapstructure:"min_management_level"`
+	MinQuestionLength  int      `mapstructure:"min_question_length"`
+	Workspaces         []string `mapstructure:"workspaces"`
+	Chain              []string `mapstructure:"chain"`
+}
+
+// BreakerConfig stops sending requests to a model for open_seconds after failure_threshold
+// consecutive timeouts or server errors, then lets a single request try it again
+type BreakerConfig struct {
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	OpenSeconds      int `mapstructure:"open_seconds"`
+}
+
+// RetrievalConfig tunes the multi-query search of the knowledge base
+type RetrievalConfig struct {
+	// QueryVariants is how many paraphrases the planner writes besides the standalone question
+	QueryVariants      int `mapstructure:"query_variants"`
+	CandidatesPerQuery int `mapstructure:"candidates_per_query"`
+	// RRFK dampens the weight of the top ranks in reciprocal rank fusion
+	RRFK int `mapstructure:"rrf_k"`
+	// PlanTimeoutSeconds bounds the planning, the question is searched as is after it
+	PlanTimeoutSeconds int `mapstructure:"plan_timeout_seconds"`
+}
+
+// FAQConfig controls when a question is answered verbatim from the FAQ
+type FAQConfig struct {
+	// MaxDistance is the largest vector distance between the user question and an FAQ question
+	MaxDistance float32 `mapstructure:"max_distance"`
+}
+
+// UsageConfig sets the token quotas of each user; a limit of 0 means unlimited
+type UsageConfig struct {
+	DailyTokens   int64 `mapstructure:"daily_tokens"`
+	MonthlyTokens int64 `mapstructure:"monthly_tokens"`
+	// Workspaces override the default quotas for the members of a workspace
+	Workspaces []WorkspaceQuota `mapstructure:"workspaces"`
+}
+
+type WorkspaceQuota struct {
+	Workspace     string `mapstructure:"workspace"`
+	DailyTokens   int64  `mapstructure:"daily_tokens"`
+	MonthlyTokens int64  `mapstructure:"monthly_tokens"`
+}
+
+// QuotaFor returns the quotas that apply to the members of workspace
+func (c UsageConfig) QuotaFor(workspace string) WorkspaceQuota {
+	for _, quota := range c.Workspaces {
+		if quota.Workspace == workspace {
+			return quota
+		}
+	}
+	return WorkspaceQuota{Workspace: workspace, DailyTokens: c.DailyTokens, MonthlyTokens: c.MonthlyTokens}
+}
+
+// RetentionConfig controls how long soft-deleted users and documents are kept before being purged
+type RetentionConfig struct {
+	DeletedDays        int `mapstructure:"deleted_days"`
+	PurgeIntervalHours int `mapstructure:"purge_interval_hours"`
+}
+
+// NotificationConfig drives the deadline scanner and the optional external notifiers
+type NotificationConfig struct {
+	ScanIntervalSeconds int                   `mapstructure:"scan_interval_seconds"`
+	DueSoonHours        int                   `mapstructure:"due_soon_hours"`
+	Email               EmailNotifierConfig   `mapstructure:"email"`
+	Webhook             WebhookNotifierConfig `mapstructure:"webhook"`
+}
+
+type EmailNotifierConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	// Password comes from SMTP_PASSWORD
+	Password string `mapstructure:"SMTP_PASSWORD"`
+	From     string `mapstructure:"from"`
+}
+
+type WebhookNotifierConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	URL     string `mapstructure:"url"`
+	// Secret signs the body with HMAC-SHA256 in the X-Signature-256 header; it comes from WEBHOOK_SECRET
+	Secret         string `mapstructure:"WEBHOOK_SECRET"`
+	TimeoutSeconds int    `mapstructure:"timeout_seconds"`
+}
+
+// AuthConfig selects the login providers, tried in order
+type AuthConfig struct {
+	Providers []string   `mapstructure:"providers"`
+	LDAP      LDAPConfig `mapstructure:"ldap"`
+}
+
+type LDAPConfig struct {
+	URL                string `mapstructure:"url"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	TimeoutSeconds     int    `mapstructure:"timeout_seconds"`
+	// BindDN is the service account used to look users up; its password comes from LDAP_BIND_PASSWORD
+	BindDN       string `mapstructure:"bind_dn"`
+	BindPassword string `mapstructure:"LDAP_BIND_PASSWORD"`
+	BaseDN       string `mapstructure:"base_dn"`
+	// UserFilter is a search filter with one %s placeholder for the escaped username
+	UserFilter        string             `mapstructure:"user_filter"`
+	GroupAttribute    string             `mapstructure:"group_attribute"`
+	FullNameAttribute string             `mapstructure:"full_name_attribute"`
+	MailAttribute     string             `mapstructure:"mail_attribute"`
+	GroupMappings     []LDAPGroupMapping `mapstructure:"group_mappings"`
+}
+
+// LDAPGroupMapping maps a directory group (DN or CN) to workspace membership.
+// When a user is in several mapped groups the one with the highest management level wins.
+type LDAPGroupMapping struct {
+	Group           string `mapstructure:"group"`
+	Workspace       string `mapstructure:"workspace"`
+	WorkspaceRole   string `mapstructure:"workspace_role"`
+	ManagementLevel int    `mapstructure:"management_level"`
 }
 
 type WeaviateStoreConfig struct {
@@ -33,10 +192,219 @@ type WeaviateStoreConfig struct {
 	APIKey       string       `mapstructure:"WEAVIATE_APIKEY"` // Changed to match env var
 	Text2Vec     string       `mapstructure:"text2vec"`
 	ModuleConfig ModuleConfig `mapstructure:"module_config"`
+	// Embedding vectorizes documents and questions in the server instead of a Weaviate module
+	Embedding EmbeddingConfig `mapstructure:"embedding"`
+}
+
+// EmbeddingConfig points at an OpenAI compatible /embeddings endpoint, disabled without a model.
+// Changing the model requires running the re-embed command.
+type EmbeddingConfig struct {
+	Endpoint string `mapstructure:"endpoint"`
+	Model    string `mapstructure:"model"`
+	// APIKeyEnv names the env var holding the key, OPENAI_API_KEY by default
+	APIKeyEnv      string `mapstructure:"api_key_env"`
+	APIKey         string `mapstructure:"-"`
+	BatchSize      int    `mapstructure:"batch_size"`
+	CacheSize      int    `mapstructure:"cache_size"`
+	TimeoutSeconds int    `mapstructure:"timeout_seconds"`
+}
+
+// Enabled reports whether vectors are computed by the server
+func (c EmbeddingConfig) Enabled() bool {
+	return c.Model != ""
 }
 
 type ModuleConfig map[string]interface{}
 
+const (
+	VectorStoreWeaviate = "weaviate"
+	VectorStoreMemory   = "memory"
+)
+
+// VectorStoreConfig selects where the document chunks and FAQs are searched
+type VectorStoreConfig struct {
+	// Type is weaviate, or memory for a brute-force search in the server that embeds
+	// through weaviate_store_config.embedding
+	Type string `mapstructure:"type"`
+	// Path is the file the memory store is kept in, it is lost on restart without one
+	Path string `mapstructure:"path"`
+}
+
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+
+	// jwtMinSecretLength is the minimum length of an HMAC secret accepted in release mode
+	jwtMinSecretLength = 32
+)
+
+// insecureJWTSecrets are the values older builds fell back to; they are never accepted in release mode
+var insecureJWTSecrets = []string{"default_secret", "default_admin_secret", "secret", "changeme"}
+
+// JWTConfig holds the signing keys for user and admin tokens.
+// The first key of each list signs new tokens, the remaining keys are only
+// used to verify tokens issued before a rotation.
+type JWTConfig struct {
+	UserKeys  []JWTKeyConfig `mapstructure:"user_keys"`
+	AdminKeys []JWTKeyConfig `mapstructure:"admin_keys"`
+}
+
+type JWTKeyConfig struct {
+	KID       string `mapstructure:"kid"`
+	Algorithm string `mapstructure:"algorithm"`
+	// Secret is the HMAC secret for HS256 keys, SecretEnv names an env var holding it
+	Secret    string `mapstructure:"secret"`
+	SecretEnv string `mapstructure:"secret_env"`
+	// PrivateKeyFile and PublicKeyFile are PEM files for RS256 and EdDSA keys.
+	// A key without a private key file can only verify tokens.
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+}
+
+// IsReleaseMode reports whether the server runs in release mode (GIN_MODE=release)
+func IsReleaseMode() bool {
+	return os.Getenv("GIN_MODE") == "release"
+}
+
+// Validate checks the JWT keys. In release mode missing, default or short secrets are rejected.
+func (c JWTConfig) Validate(release bool) error {
+	if err := validateJWTKeys("user", c.UserKeys, release); err != nil {
+		return err
+	}
+	return validateJWTKeys("admin", c.AdminKeys, release)
+}
+
+func validateJWTKeys(name string, keys []JWTKeyConfig, release bool) error {
+	if len(keys) == 0 {
+		if release {
+			return fmt.Errorf("no %s jwt keys configured", name)
+		}
+		return nil
+	}
+	seen := make(map[string]bool)
+	for i, key := range keys {
+		if seen[key.KID] {
+			return fmt.Errorf("duplicate %s jwt kid %q", name, key.KID)
+		}
+		seen[key.KID] = true
+		switch key.Algorithm {
+		case JWTAlgorithmHS256:
+			if key.Secret == "" {
+				return fmt.Errorf("%s jwt key %q has no secret", name, key.KID)
+			}
+			if !release {
+				continue
+			}
+			for _, insecure := range insecureJWTSecrets {
+				if key.Secret == insecure {
+					return fmt.Errorf("%s jwt key %q uses a default secret", name, key.KID)
+				}
+			}
+			if len(key.Secret) < jwtMinSecretLength {
+				return fmt.Errorf("%s jwt key %q secret must be at least %d bytes", name, key.KID, jwtMinSecretLength)
+			}
+		case JWTAlgorithmRS256, JWTAlgorithmEdDSA:
+			if key.PublicKeyFile == "" && key.PrivateKeyFile == "" {
+				return fmt.Errorf("%s jwt key %q needs a public or private key file", name, key.KID)
+			}
+			if i == 0 && key.PrivateKeyFile == "" {
+				return fmt.Errorf("%s jwt signing key %q needs a private key file", name, key.KID)
+			}
+		default:
+			return fmt.Errorf("%s jwt key %q has unsupported algorithm %q", name, key.KID, key.Algorithm)
+		}
+	}
+	return nil
+}
+
+// resolveJWTKeys fills secrets from env vars and falls back to the legacy
+// single-secret env var when no keys are configured
+func resolveJWTKeys(keys []JWTKeyConfig, legacyEnv string) []JWTKeyConfig {
+	if len(keys) == 0 {
+		if secret := os.Getenv(legacyEnv); secret != "" {
+			return []JWTKeyConfig{{KID: "default", Algorithm: JWTAlgorithmHS256, Secret: secret}}
+		}
+		return nil
+	}
+	for i := range keys {
+		if keys[i].Algorithm == "" {
+			keys[i].Algorithm = JWTAlgorithmHS256
+		}
+		if keys[i].Secret == "" && keys[i].SecretEnv != "" {
+			keys[i].Secret = os.Getenv(keys[i].SecretEnv)
+		}
+	}
+	return keys
+}
+
+// resolveRouter fills the defaults of the router, a single model from ai_endpoint and model
+// when none is configured
+func resolveRouter(config *Config) {
+	router := &config.Router
+	if len(router.Models) == 0 {
+		router.Models = []ModelConfig{{
+			Provider: ModelProviderOpenAI,
+			Endpoint: config.AIEndpoint,
+			Model:    config.Model,
+			APIKey:   config.OpenAIAPIKey,
+		}}
+	}
+	for i := range router.Models {
+		model := &router.Models[i]
+		if model.Name == "" {
+			model.Name = model.Model
+		}
+		if model.Provider == "" {
+			model.Provider = ModelProviderOpenAI
+		}
+		if model.APIKey == "" && model.APIKeyEnv != "" {
+			model.APIKey = os.Getenv(model.APIKeyEnv)
+		}
+		if model.TimeoutSeconds <= 0 {
+			model.TimeoutSeconds = 120
+		}
+	}
+	if len(router.Default) == 0 {
+		for _, model := range router.Models {
+			router.Default = append(router.Default, model.Name)
+		}
+	}
+	if router.Breaker.FailureThreshold <= 0 {
+		router.Breaker.FailureThreshold = 3
+	}
+	if router.Breaker.OpenSeconds <= 0 {
+		router.Breaker.OpenSeconds = 60
+	}
+}
+
+// resolveEmbedding fills the defaults of the embedding endpoint from the chat endpoint.
+// Weaviate stops vectorizing once the server does it.
+func resolveEmbedding(config *Config) {
+	embedding := &config.WeaviateStoreConfig.Embedding
+	if !embedding.Enabled() {
+		return
+	}
+	if embedding.Endpoint == "" {
+		embedding.Endpoint = config.AIEndpoint
+	}
+	if embedding.APIKeyEnv != "" {
+		embedding.APIKey = os.Getenv(embedding.APIKeyEnv)
+	} else {
+		embedding.APIKey = config.OpenAIAPIKey
+	}
+	if embedding.BatchSize <= 0 {
+		embedding.BatchSize = 64
+	}
+	if embedding.CacheSize == 0 {
+		embedding.CacheSize = 10000
+	}
+	if embedding.TimeoutSeconds <= 0 {
+		embedding.TimeoutSeconds = 60
+	}
+	config.WeaviateStoreConfig.Text2Vec = "none"
+}
+
 func LoadConfig(configPath string) (*Config, error) {
 	v := viper.New()
 
@@ -61,6 +429,46 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 	config.WeaviateStoreConfig.APIKey = os.Getenv("WEAVIATE_APIKEY")
+	config.Auth.LDAP.BindPassword = os.Getenv("LDAP_BIND_PASSWORD")
+	config.Notification.Email.Password = os.Getenv("SMTP_PASSWORD")
+	config.Notification.Webhook.Secret = os.Getenv("WEBHOOK_SECRET")
+	if config.Notification.ScanIntervalSeconds <= 0 {
+		config.Notification.ScanIntervalSeconds = 300
+	}
+	if config.Notification.DueSoonHours <= 0 {
+		config.Notification.DueSoonHours = 24
+	}
+	if config.Retention.DeletedDays <= 0 {
+		config.Retention.DeletedDays = 30
+	}
+	if config.Retention.PurgeIntervalHours <= 0 {
+		config.Retention.PurgeIntervalHours = 24
+	}
+	if config.FAQ.MaxDistance <= 0 {
+		config.FAQ.MaxDistance = 0.15
+	}
+	if config.Retrieval.QueryVariants <= 0 {
+		config.Retrieval.QueryVariants = 4
+	}
+	if config.Retrieval.CandidatesPerQuery <= 0 {
+		config.Retrieval.CandidatesPerQuery = 10
+	}
+	if config.Retrieval.RRFK <= 0 {
+		config.Retrieval.RRFK = 60
+	}
+	if config.Retrieval.PlanTimeoutSeconds <= 0 {
+		config.Retrieval.PlanTimeoutSeconds = 10
+	}
+	resolveRouter(&config)
+	resolveEmbedding(&config)
+	if config.VectorStore.Type == "" {
+		config.VectorStore.Type = VectorStoreWeaviate
+	}
+	if len(config.Auth.Providers) == 0 {
+		config.Auth.Providers = []string{"mongo"}
+	}
+	config.JWT.UserKeys = resolveJWTKeys(config.JWT.UserKeys, "JWT_SECRET_USER")
+	config.JWT.AdminKeys = resolveJWTKeys(config.JWT.AdminKeys, "JWT_SECRET_ADMIN")
 	OllamaGenerativeConfig["generative-ollama"].(map[string]interface{})["model"] = config.Model
 	config.WeaviateStoreConfig.ModuleConfig = OllamaGenerativeConfig
 
@@ -2,7 +2,10 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"io"
 
+	"github.com/tieubaoca/chatbot-be/config"
 	"github.com/tieubaoca/chatbot-be/types"
 )
 
@@ -10,13 +13,53 @@ import (
 type VectorDatabase interface {
 	// Document operations
 	UpsertDocument(ctx context.Context, doc *types.Document, embedding []float32) error
+	BatchInsertDocuments(ctx context.Context, docs []types.Document, embeddings [][]float32) error
 	DeleteDocument(ctx context.Context, id string) error
+	// SetDocumentDeleted hides or shows again every chunk of a document in the searches
+	SetDocumentDeleted(ctx context.Context, documentID string, deleted bool) error
+	DeleteDocumentChunks(ctx context.Context, documentID string) error
+	// ReInit removes every document chunk
+	ReInit() error
 
 	// Search operations
-	SearchSimilar(ctx context.Context, query string, limit int) ([]types.Document, []float32, error)
+	SearchSimilar(ctx context.Context, queries []string, limit int) ([]types.Document, []float32, error)
 	SearchByMetadata(ctx context.Context, metadata types.Metadata, limit int) ([]types.Document, error)
-	SearchSimilarWithMetadata(ctx context.Context, query string, metadata types.Metadata, limit int) ([]types.Document, []float32, error)
+	SearchSimilarWithMetadata(ctx context.Context, queries []string, metadata types.Metadata, limit int) ([]types.Document, []float32, error)
+	AskAI(ctx context.Context, prompt string, queries []string, metadata types.Metadata, limit int) ([]types.Document, error)
+
+	// FAQ operations
+	UpsertFAQ(ctx context.Context, faq *types.FAQ) error
+	DeleteFAQ(ctx context.Context, id string) error
+	MatchFAQ(ctx context.Context, question, workspace string, maxDistance float32) (*types.FAQMatch, error)
+
+	// ReEmbed vectorizes every object again with the configured embedding model. The
+	// objects are written with their new vectors to backup first, which Restore loads
+	// again when storing them fails. It returns the number of objects per class.
+	ReEmbed(ctx context.Context, backup io.ReadWriteSeeker) (map[string]int, error)
+	// Restore replaces every object with those of a complete ReEmbed backup
+	Restore(ctx context.Context, backup io.ReadSeeker) (map[string]int, error)
+
 	// Collection operations
 	CreateCollection(ctx context.Context, name string, dimension int) error
 	DeleteCollection(ctx context.Context, name string) error
 }
+
+// NewVectorDatabase opens the vector store selected by storeConfig. The memory store embeds
+// with embedder, or through the endpoint of weaviate_store_config.embedding when it is nil,
+// so a deployment without an embedding server can plug in a local model.
+func NewVectorDatabase(storeConfig config.VectorStoreConfig, weaviateConfig config.WeaviateStoreConfig, embedder Embedder) (VectorDatabase, error) {
+	switch storeConfig.Type {
+	case config.VectorStoreWeaviate:
+		return NewWeaviateStore(weaviateConfig)
+	case config.VectorStoreMemory:
+		if embedder == nil {
+			if !weaviateConfig.Embedding.Enabled() {
+				return nil, fmt.Errorf("the memory vector store needs weaviate_store_config.embedding or an embedder")
+			}
+			embedder = NewEmbedder(weaviateConfig.Embedding)
+		}
+		return NewMemoryStore(embedder, storeConfig.Path)
+	default:
+		return nil, fmt.Errorf("unknown vector store %q", storeConfig.Type)
+	}
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/tieubaoca/chatbot-be/config"
+)
+
+// Embedder turns texts into vectors, one for each text in order
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model names the embedding model, vectors of different models must not be mixed
+	Model() string
+}
+
+type openAIEmbedder struct {
+	client    *openai.Client
+	model     string
+	batchSize int
+}
+
+// NewEmbedder returns a client of an OpenAI compatible /embeddings endpoint, caching the
+// vectors of the last cacheSize texts
+func NewEmbedder(cfg config.EmbeddingConfig) Embedder {
+	clientConfig := openai.DefaultConfig(cfg.APIKey)
+	clientConfig.BaseURL = cfg.Endpoint
+	clientConfig.HTTPClient = &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second}
+	embedder := &openAIEmbedder{
+		client:    openai.NewClientWithConfig(clientConfig),
+		model:     cfg.Model,
+		batchSize: cfg.BatchSize,
+	}
+	if cfg.CacheSize <= 0 {
+		return embedder
+	}
+	return newCachedEmbedder(embedder, cfg.CacheSize)
+}
+
+func (e *openAIEmbedder) Model() string {
+	return e.model
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for i := 0; i < len(texts); i += e.batchSize {
+		end := min(i+e.batchSize, len(texts))
+		resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+			Input: texts[i:end],
+			Model: openai.EmbeddingModel(e.model),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed texts: %w", err)
+		}
+		if len(resp.Data) != end-i {
+			return nil, fmt.Errorf("embedding endpoint returned %d vectors for %d texts", len(resp.Data), end-i)
+		}
+		batch := make([][]float32, end-i)
+		for _, embedding := range resp.Data {
+			if embedding.Index < 0 || embedding.Index >= len(batch) {
+				return nil, fmt.Errorf("embedding endpoint returned index %d out of range", embedding.Index)
+			}
+			batch[embedding.Index] = embedding.Embedding
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+type cacheEntry struct {
+	key    [sha256.Size]byte
+	vector []float32
+}
+
+// cachedEmbedder keeps the vectors of the most recently embedded texts, so repeated
+// questions and re-ingested chunks are not sent to the endpoint again
+type cachedEmbedder struct {
+	Embedder
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+func newCachedEmbedder(embedder Embedder, size int) *cachedEmbedder {
+	return &cachedEmbedder{
+		Embedder: embedder,
+		size:     size,
+		order:    list.New(),
+		entries:  make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+func (c *cachedEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	keys := make([][sha256.Size]byte, len(texts))
+	var missing []string
+	var missingIndexes []int
+	c.mu.Lock()
+	for i, text := range texts {
+		keys[i] = sha256.Sum256([]byte(c.Model() + "\x00" + text))
+		if element, ok := c.entries[keys[i]]; ok {
+			c.order.MoveToFront(element)
+			vectors[i] = element.Value.(*cacheEntry).vector
+			continue
+		}
+		missing = append(missing, text)
+		missingIndexes = append(missingIndexes, i)
+	}
+	c.mu.Unlock()
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := c.Embedder.Embed(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for j, i := range missingIndexes {
+		vectors[i] = embedded[j]
+		if _, ok := c.entries[keys[i]]; ok {
+			continue
+		}
+		c.entries[keys[i]] = c.order.PushFront(&cacheEntry{key: keys[i], vector: embedded[j]})
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+	return vectors, nil
+}
+
+// meanVector combines the vectors of several queries into one, like nearText does with concepts
+func meanVector(vectors [][]float32) []float32 {
+	if len(vectors) == 1 {
+		return vectors[0]
+	}
+	mean := make([]float32, len(vectors[0]))
+	for _, vector := range vectors {
+		for i, value := range vector {
+			mean[i] += value
+		}
+	}
+	var norm float64
+	for _, value := range mean {
+		norm += float64(value) * float64(value)
+	}
+	if norm == 0 {
+		return mean
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range mean {
+		mean[i] *= scale
+	}
+	return mean
+}
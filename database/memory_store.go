@@ -0,0 +1,648 @@
+package database
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// ErrUnsupported is returned by the stores for the operations they cannot do
+var ErrUnsupported = errors.New("not supported by this vector store")
+
+const (
+	memoryOpModel          = "model"
+	memoryOpUpsertDocument = "upsert_document"
+	memoryOpDeleteDocument = "delete_document"
+	memoryOpSetDeleted     = "set_deleted"
+	memoryOpDeleteChunks   = "delete_chunks"
+	memoryOpUpsertFAQ      = "upsert_faq"
+	memoryOpDeleteFAQ      = "delete_faq"
+	memoryOpReset          = "reset"
+	// memoryOpEnd ends a ReEmbed backup with the number of objects of each class
+	memoryOpEnd = "end"
+)
+
+type memoryDocument struct {
+	Document types.Document `json:"document"`
+	Deleted  bool           `json:"deleted"`
+	Vector   []float32      `json:"vector"`
+}
+
+type memoryFAQ struct {
+	FAQ    types.FAQ `json:"faq"`
+	Vector []float32 `json:"vector"`
+}
+
+// memoryRecord is a line of the store file, replayed in order on open
+type memoryRecord struct {
+	Op         string          `json:"op"`
+	Model      string          `json:"model,omitempty"`
+	Document   *memoryDocument `json:"document,omitempty"`
+	FAQ        *memoryFAQ      `json:"faq,omitempty"`
+	ID         string          `json:"id,omitempty"`
+	DocumentID string          `json:"document_id,omitempty"`
+	Deleted    bool            `json:"deleted,omitempty"`
+	Counts     map[string]int  `json:"counts,omitempty"`
+}
+
+// MemoryStore is a VectorDatabase searching by brute-force cosine distance in memory,
+// for tests and small deployments without Weaviate. With a path every change is appended
+// to the file, which is compacted when the store is opened.
+type MemoryStore struct {
+	embedder Embedder
+	path     string
+
+	mu        sync.RWMutex
+	file      *os.File
+	documents map[string]*memoryDocument
+	faqs      map[string]*memoryFAQ
+	// changes counts the committed records, ReEmbed checks that none came in meanwhile
+	changes uint64
+}
+
+var _ VectorDatabase = (*MemoryStore)(nil)
+
+// NewMemoryStore opens the store persisted at path, or an empty store kept in memory
+// only when path is empty
+func NewMemoryStore(embedder Embedder, path string) (*MemoryStore, error) {
+	if embedder == nil {
+		return nil, errors.New("the memory store needs an embedding model")
+	}
+	s := &MemoryStore{
+		embedder:  embedder,
+		path:      path,
+		documents: make(map[string]*memoryDocument),
+		faqs:      make(map[string]*memoryFAQ),
+	}
+	if path == "" {
+		return s, nil
+	}
+	model, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if model != "" && model != embedder.Model() {
+		log.Printf("Warning: the memory store was vectorized with %s, not %s, run the re-embed command", model, embedder.Model())
+	} else {
+		model = embedder.Model()
+	}
+	if err := s.compact(model); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load replays the records of the file, a record cut short by a crash ends the replay
+func (s *MemoryStore) load() (string, error) {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open memory store: %w", err)
+	}
+	defer file.Close()
+	model, _, err := s.replay(file, s.path)
+	return model, err
+}
+
+// replay applies the records read from r and returns the last embedding model recorded
+// and the counts of the end record of a backup
+func (s *MemoryStore) replay(r io.Reader, name string) (string, map[string]int, error) {
+	model := ""
+	var end map[string]int
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(data) > 0 {
+				log.Printf("Warning: ignoring the truncated last record of %s", name)
+			}
+			return model, end, nil
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		var record memoryRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return "", nil, fmt.Errorf("invalid record at line %d of %s: %w", line, name, err)
+		}
+		if end != nil {
+			return "", nil, fmt.Errorf("invalid record at line %d of %s: after the end record", line, name)
+		}
+		switch record.Op {
+		case memoryOpModel:
+			model = record.Model
+		case memoryOpEnd:
+			end = record.Counts
+			if end == nil {
+				end = make(map[string]int)
+			}
+		default:
+			s.apply(record)
+		}
+	}
+}
+
+// compact rewrites the file with the current objects only, then appends to it
+func (s *MemoryStore) compact(model string) error {
+	if s.path == "" {
+		return nil
+	}
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create memory store directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to compact memory store: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	err = encoder.Encode(memoryRecord{Op: memoryOpModel, Model: model})
+	for _, document := range s.documents {
+		if err != nil {
+			break
+		}
+		err = encoder.Encode(memoryRecord{Op: memoryOpUpsertDocument, Document: document})
+	}
+	for _, faq := range s.faqs {
+		if err != nil {
+			break
+		}
+		err = encoder.Encode(memoryRecord{Op: memoryOpUpsertFAQ, FAQ: faq})
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compact memory store: %w", err)
+	}
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open memory store: %w", err)
+	}
+	return nil
+}
+
+// commit applies the record and appends it to the file, the caller holds the lock
+func (s *MemoryStore) commit(record memoryRecord) error {
+	if s.file != nil {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := s.file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write memory store: %w", err)
+		}
+	}
+	s.apply(record)
+	s.changes++
+	return nil
+}
+
+func (s *MemoryStore) apply(record memoryRecord) {
+	switch record.Op {
+	case memoryOpUpsertDocument:
+		s.documents[record.Document.Document.ID] = record.Document
+	case memoryOpDeleteDocument:
+		delete(s.documents, record.ID)
+	case memoryOpSetDeleted:
+		for _, document := range s.documents {
+			if document.Document.Metadata.DocumentID == record.DocumentID {
+				document.Deleted = record.Deleted
+			}
+		}
+	case memoryOpDeleteChunks:
+		maps.DeleteFunc(s.documents, func(_ string, document *memoryDocument) bool {
+			return document.Document.Metadata.DocumentID == record.DocumentID
+		})
+	case memoryOpUpsertFAQ:
+		s.faqs[record.FAQ.FAQ.ID] = record.FAQ
+	case memoryOpDeleteFAQ:
+		delete(s.faqs, record.ID)
+	case memoryOpReset:
+		clear(s.documents)
+	}
+}
+
+// Close closes the store file, the store must not be used afterwards
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// ReInit removes every document chunk, like recreating the Weaviate Document class
+func (s *MemoryStore) ReInit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commit(memoryRecord{Op: memoryOpReset})
+}
+
+func (s *MemoryStore) UpsertDocument(ctx context.Context, doc *types.Document, embedding []float32) error {
+	if embedding == nil {
+		vectors, err := s.embedder.Embed(ctx, []string{doc.Content})
+		if err != nil {
+			return err
+		}
+		embedding = vectors[0]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commit(memoryRecord{Op: memoryOpUpsertDocument, Document: newMemoryDocument(*doc, embedding)})
+}
+
+func (s *MemoryStore) BatchInsertDocuments(ctx context.Context, docs []types.Document, embeddings [][]float32) error {
+	if embeddings == nil {
+		contents := make([]string, len(docs))
+		for i := range docs {
+			contents[i] = docs[i].Content
+		}
+		var err error
+		if embeddings, err = s.embedder.Embed(ctx, contents); err != nil {
+			return err
+		}
+	}
+	if len(embeddings) != len(docs) {
+		return fmt.Errorf("%d embeddings for %d documents", len(embeddings), len(docs))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range docs {
+		if err := s.commit(memoryRecord{Op: memoryOpUpsertDocument, Document: newMemoryDocument(docs[i], embeddings[i])}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newMemoryDocument copies the chunk under a new ID, like Weaviate creates a new object
+func newMemoryDocument(doc types.Document, vector []float32) *memoryDocument {
+	doc.ID = uuid.NewString()
+	doc.Metadata.Tags = slices.Clone(doc.Metadata.Tags)
+	doc.Metadata.Custom = maps.Clone(doc.Metadata.Custom)
+	return &memoryDocument{Document: doc, Vector: vector}
+}
+
+func (s *MemoryStore) DeleteDocument(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commit(memoryRecord{Op: memoryOpDeleteDocument, ID: id})
+}
+
+func (s *MemoryStore) SetDocumentDeleted(ctx context.Context, documentID string, deleted bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commit(memoryRecord{Op: memoryOpSetDeleted, DocumentID: documentID, Deleted: deleted})
+}
+
+func (s *MemoryStore) DeleteDocumentChunks(ctx context.Context, documentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commit(memoryRecord{Op: memoryOpDeleteChunks, DocumentID: documentID})
+}
+
+func (s *MemoryStore) SearchSimilar(ctx context.Context, queries []string, limit int) ([]types.Document, []float32, error) {
+	return s.SearchSimilarWithMetadata(ctx, queries, types.Metadata{}, limit)
+}
+
+// SearchSimilarWithMetadata returns the matching chunks within the certainty Weaviate
+// searches with, nearest first
+func (s *MemoryStore) SearchSimilarWithMetadata(ctx context.Context, queries []string, metadata types.Metadata, limit int) ([]types.Document, []float32, error) {
+	return s.searchDocuments(ctx, queries, metadata, limit, 0.6)
+}
+
+func (s *MemoryStore) searchDocuments(ctx context.Context, queries []string, metadata types.Metadata, limit int, maxDistance float32) ([]types.Document, []float32, error) {
+	if len(queries) == 0 {
+		return nil, nil, errors.New("no query to search for")
+	}
+	vectors, err := s.embedder.Embed(ctx, queries)
+	if err != nil {
+		return nil, nil, err
+	}
+	query := meanVector(vectors)
+
+	type hit struct {
+		document *memoryDocument
+		distance float32
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var hits []hit
+	for _, document := range s.documents {
+		if !matchesMetadata(document, metadata) {
+			continue
+		}
+		distance, ok := cosineDistance(query, document.Vector)
+		if ok && distance <= maxDistance {
+			hits = append(hits, hit{document, distance})
+		}
+	}
+	slices.SortFunc(hits, func(a, b hit) int {
+		if a.distance != b.distance {
+			return cmp.Compare(a.distance, b.distance)
+		}
+		return cmp.Compare(a.document.Document.ID, b.document.Document.ID)
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	docs := make([]types.Document, len(hits))
+	distances := make([]float32, len(hits))
+	for i, hit := range hits {
+		docs[i] = copyDocument(hit.document.Document)
+		docs[i].Metadata.Custom["distance"] = fmt.Sprintf("%f", hit.distance)
+		distances[i] = hit.distance
+	}
+	return docs, distances, nil
+}
+
+func (s *MemoryStore) SearchByMetadata(ctx context.Context, metadata types.Metadata, limit int) ([]types.Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var docs []types.Document
+	for _, document := range s.documents {
+		if matchesMetadata(document, metadata) {
+			docs = append(docs, copyDocument(document.Document))
+		}
+	}
+	slices.SortFunc(docs, func(a, b types.Document) int {
+		if a.CreatedAt != b.CreatedAt {
+			return cmp.Compare(a.CreatedAt, b.CreatedAt)
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if limit > 0 && len(docs) > limit {
+		docs = docs[:limit]
+	}
+	return docs, nil
+}
+
+// AskAI needs the generative module of Weaviate
+func (s *MemoryStore) AskAI(ctx context.Context, prompt string, queries []string, metadata types.Metadata, limit int) ([]types.Document, error) {
+	return nil, fmt.Errorf("ask ai: %w", ErrUnsupported)
+}
+
+func (s *MemoryStore) UpsertFAQ(ctx context.Context, faq *types.FAQ) error {
+	vectors, err := s.embedder.Embed(ctx, []string{faq.Question})
+	if err != nil {
+		return err
+	}
+	entry := *faq
+	entry.Tags = slices.Clone(faq.Tags)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commit(memoryRecord{Op: memoryOpUpsertFAQ, FAQ: &memoryFAQ{FAQ: entry, Vector: vectors[0]}})
+}
+
+func (s *MemoryStore) DeleteFAQ(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commit(memoryRecord{Op: memoryOpDeleteFAQ, ID: id})
+}
+
+// MatchFAQ returns the nearest entry within maxDistance visible from workspace, or nil
+func (s *MemoryStore) MatchFAQ(ctx context.Context, question, workspace string, maxDistance float32) (*types.FAQMatch, error) {
+	vectors, err := s.embedder.Embed(ctx, []string{question})
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var match *types.FAQMatch
+	for _, faq := range s.faqs {
+		if faq.FAQ.Workspace != "" && faq.FAQ.Workspace != workspace {
+			continue
+		}
+		distance, ok := cosineDistance(vectors[0], faq.Vector)
+		if !ok || distance > maxDistance {
+			continue
+		}
+		if match == nil || distance < match.Distance || (distance == match.Distance && faq.FAQ.ID < match.FAQID) {
+			match = &types.FAQMatch{
+				FAQID:    faq.FAQ.ID,
+				Question: faq.FAQ.Question,
+				Answer:   faq.FAQ.Answer,
+				Distance: distance,
+			}
+		}
+	}
+	return match, nil
+}
+
+// ReEmbed vectorizes every chunk and FAQ question again with the current embedding model.
+// The objects are written with their new vectors to backup as store records first, ending
+// with the number of objects of each class. The store is then rewritten from them by Restore.
+// The objects are embedded without holding the lock, searches and writes go on meanwhile.
+// The store is only rewritten when nothing was written since, otherwise ReEmbed fails.
+func (s *MemoryStore) ReEmbed(ctx context.Context, backup io.ReadWriteSeeker) (map[string]int, error) {
+	documents, faqs, changes := s.snapshot()
+	texts := make([]string, 0, len(documents)+len(faqs))
+	for _, document := range documents {
+		texts = append(texts, document.Document.Content)
+	}
+	for _, faq := range faqs {
+		texts = append(texts, faq.FAQ.Question)
+	}
+	vectors, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed objects: %w", err)
+	}
+
+	writer := bufio.NewWriter(backup)
+	encoder := json.NewEncoder(writer)
+	err = encoder.Encode(memoryRecord{Op: memoryOpModel, Model: s.embedder.Model()})
+	for i, document := range documents {
+		if err != nil {
+			break
+		}
+		err = encoder.Encode(memoryRecord{Op: memoryOpUpsertDocument, Document: &memoryDocument{
+			Document: document.Document,
+			Deleted:  document.Deleted,
+			Vector:   vectors[i],
+		}})
+	}
+	for i, faq := range faqs {
+		if err != nil {
+			break
+		}
+		err = encoder.Encode(memoryRecord{Op: memoryOpUpsertFAQ, FAQ: &memoryFAQ{FAQ: faq.FAQ, Vector: vectors[len(documents)+i]}})
+	}
+	if err == nil {
+		err = encoder.Encode(memoryRecord{Op: memoryOpEnd, Counts: map[string]int{DOCUMENT_CLASS: len(documents), FAQ_CLASS: len(faqs)}})
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if _, err := backup.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.changes != changes {
+		return nil, errors.New("the store was written while re-embedding, run it again")
+	}
+	return s.restore(backup)
+}
+
+// snapshot copies the objects of the store with the number of records committed so far
+func (s *MemoryStore) snapshot() ([]memoryDocument, []memoryFAQ, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	documents := make([]memoryDocument, 0, len(s.documents))
+	for _, document := range s.documents {
+		documents = append(documents, *document)
+	}
+	faqs := make([]memoryFAQ, 0, len(s.faqs))
+	for _, faq := range s.faqs {
+		faqs = append(faqs, *faq)
+	}
+	return documents, faqs, s.changes
+}
+
+// Restore replaces the objects of the store with the records of a ReEmbed backup. The
+// store is left as it was when the backup cannot be read, was cut short or the file
+// cannot be rewritten.
+func (s *MemoryStore) Restore(ctx context.Context, backup io.ReadSeeker) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restore(backup)
+}
+
+// restore implements Restore, the caller holds the lock
+func (s *MemoryStore) restore(backup io.Reader) (map[string]int, error) {
+	restored := &MemoryStore{
+		path:      s.path,
+		documents: make(map[string]*memoryDocument),
+		faqs:      make(map[string]*memoryFAQ),
+	}
+	model, end, err := restored.replay(backup, "backup")
+	if err != nil {
+		return nil, err
+	}
+	if end == nil {
+		return nil, errors.New("incomplete backup: it has no end record, the run writing it failed")
+	}
+	counts := map[string]int{DOCUMENT_CLASS: len(restored.documents), FAQ_CLASS: len(restored.faqs)}
+	for name, count := range counts {
+		if end[name] != count {
+			return nil, fmt.Errorf("incomplete backup: %d %s objects, the end record counts %d", count, name, end[name])
+		}
+	}
+	if model == "" {
+		model = s.embedder.Model()
+	}
+
+	documents, faqs := s.documents, s.faqs
+	s.documents, s.faqs = restored.documents, restored.faqs
+	if err := s.compact(model); err != nil {
+		s.documents, s.faqs = documents, faqs
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) CreateCollection(ctx context.Context, name string, dimension int) error {
+	return fmt.Errorf("collections: %w", ErrUnsupported)
+}
+
+func (s *MemoryStore) DeleteCollection(ctx context.Context, name string) error {
+	return fmt.Errorf("collections: %w", ErrUnsupported)
+}
+
+// matchesMetadata filters like buildMetadataFilter: deleted chunks never match and every
+// set field must be equal, tags must all be present
+func matchesMetadata(document *memoryDocument, metadata types.Metadata) bool {
+	if document.Deleted {
+		return false
+	}
+	doc := document.Document.Metadata
+	if metadata.Title != "" && doc.Title != metadata.Title {
+		return false
+	}
+	if metadata.Source != "" && doc.Source != metadata.Source {
+		return false
+	}
+	if metadata.Workspace != "" && doc.Workspace != metadata.Workspace {
+		return false
+	}
+	if metadata.Workspaces != nil && !slices.Contains(metadata.Workspaces, doc.Workspace) {
+		return false
+	}
+	if metadata.DocumentID != "" && doc.DocumentID != metadata.DocumentID {
+		return false
+	}
+	for _, tag := range metadata.Tags {
+		if !slices.Contains(doc.Tags, tag) {
+			return false
+		}
+	}
+	for key, value := range metadata.Custom {
+		if doc.Custom[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func copyDocument(doc types.Document) types.Document {
+	doc.Metadata.Tags = slices.Clone(doc.Metadata.Tags)
+	doc.Metadata.Custom = maps.Clone(doc.Metadata.Custom)
+	if doc.Metadata.Custom == nil {
+		doc.Metadata.Custom = make(map[string]string)
+	}
+	return doc
+}
+
+// cosineDistance is the distance Weaviate reports for the cosine metric, from 0 for
+// the same direction to 2 for opposite ones. Vectors of different sizes do not compare.
+func cosineDistance(a, b []float32) (float32, bool) {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0, false
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0, false
+	}
+	return float32(1 - dot/math.Sqrt(normA*normB)), true
+}
@@ -0,0 +1,269 @@
+package database
+
+import (
+	"context"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// countLines returns the number of records in the store file
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestMemoryStorePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors", "store.jsonl")
+	ctx := context.Background()
+	store, err := NewMemoryStore(&lengthEmbedder{}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []types.Document{
+		{Content: "kept", Metadata: types.Metadata{DocumentID: "d1", Tags: []string{"hr"}}},
+		{Content: "hidden", Metadata: types.Metadata{DocumentID: "d2"}},
+		{Content: "removed", Metadata: types.Metadata{DocumentID: "d3"}},
+	}
+	if err := store.BatchInsertDocuments(ctx, docs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetDocumentDeleted(ctx, "d2", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteDocumentChunks(ctx, "d3"); err != nil {
+		t.Fatal(err)
+	}
+	for _, faq := range []*types.FAQ{{ID: "f1", Question: "why?"}, {ID: "f2", Question: "how?"}} {
+		if err := store.UpsertFAQ(ctx, faq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.DeleteFAQ(ctx, "f2"); err != nil {
+		t.Fatal(err)
+	}
+	documents, faqs := store.documents, store.faqs
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The model, 3 chunks, set deleted, delete chunks, 2 FAQs and a delete FAQ
+	if lines := countLines(t, path); lines != 9 {
+		t.Fatalf("%d records appended, want 9", lines)
+	}
+
+	// A crash in the middle of a write leaves a record without its newline
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"upsert_faq","faq":{"faq":{"id":"f3"`)
+	file.Close()
+
+	reopened, err := NewMemoryStore(&lengthEmbedder{}, path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	if !reflect.DeepEqual(reopened.documents, documents) || !reflect.DeepEqual(reopened.faqs, faqs) {
+		t.Errorf("reopened with %d documents and %d FAQ entries, want %d and %d",
+			len(reopened.documents), len(reopened.faqs), len(documents), len(faqs))
+	}
+	// Opening compacts the file to the model and the live objects, the truncated record is dropped
+	if lines := countLines(t, path); lines != 4 {
+		t.Errorf("%d records after compaction, want 4", lines)
+	}
+	found, err := reopened.SearchByMetadata(ctx, types.Metadata{Tags: []string{"hr"}}, 10)
+	if err != nil || len(found) != 1 || found[0].Content != "kept" {
+		t.Errorf("SearchByMetadata = %v, %v", found, err)
+	}
+
+	// Writes after the compaction are appended and replayed again
+	if err := reopened.UpsertFAQ(ctx, &types.FAQ{ID: "f3", Question: "when?"}); err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+	again, err := NewMemoryStore(&lengthEmbedder{}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if len(again.documents) != 2 || len(again.faqs) != 2 || again.faqs["f3"] == nil {
+		t.Errorf("reopened with %d documents and FAQ entries %v", len(again.documents), slices.Collect(maps.Keys(again.faqs)))
+	}
+}
+
+func TestMemoryStoreRejectsACorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	content := `{"op":"model","model":"length"}` + "\n" + "garbage\n" + `{"op":"reset"}` + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMemoryStore(&lengthEmbedder{}, path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("NewMemoryStore = %v, want an invalid record error at line 2", err)
+	}
+	// The file is left for the operator to repair
+	if data, _ := os.ReadFile(path); string(data) != content {
+		t.Errorf("file rewritten to %q", data)
+	}
+}
+
+func TestNewVectorDatabaseMemoryStoreEmbedder(t *testing.T) {
+	storeConfig := config.VectorStoreConfig{Type: config.VectorStoreMemory}
+	if _, err := NewVectorDatabase(storeConfig, config.WeaviateStoreConfig{}, nil); err == nil {
+		t.Fatal("opened a memory store without an embedding endpoint or embedder")
+	}
+	embedder := &lengthEmbedder{}
+	vectorDB, err := NewVectorDatabase(storeConfig, config.WeaviateStoreConfig{}, embedder)
+	if err != nil {
+		t.Fatalf("NewVectorDatabase: %v", err)
+	}
+	if err := vectorDB.UpsertFAQ(context.Background(), &types.FAQ{ID: "f1", Question: "why?"}); err != nil {
+		t.Fatal(err)
+	}
+	if embedder.embedded != 1 {
+		t.Errorf("the given embedder embedded %d texts, want 1", embedder.embedded)
+	}
+}
+
+func TestMemoryStoreReEmbedWritesARestorableBackup(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewMemoryStore(&lengthEmbedder{}, filepath.Join(dir, "store.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	if err := store.UpsertDocument(ctx, &types.Document{Content: "hello"}, []float32{9, 9}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpsertFAQ(ctx, &types.FAQ{ID: "f1", Question: "why?", Answer: "because"}); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := os.Create(filepath.Join(dir, "backup.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	counts, err := store.ReEmbed(ctx, backup)
+	if err != nil {
+		t.Fatalf("ReEmbed: %v", err)
+	}
+	if counts[DOCUMENT_CLASS] != 1 || counts[FAQ_CLASS] != 1 {
+		t.Errorf("counts %v", counts)
+	}
+	id := slices.Collect(maps.Keys(store.documents))[0]
+	if vector := store.documents[id].Vector; !reflect.DeepEqual(vector, []float32{5, 1}) {
+		t.Errorf("document vector %v, want [5 1]", vector)
+	}
+
+	// An unreadable backup or one cut short leaves the store as it was
+	if _, err := backup.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	for _, invalid := range []string{
+		"not a record\n",
+		strings.Join(lines[:3], ""),
+		strings.Join(slices.Concat(lines[:1], lines[2:]), ""),
+	} {
+		if _, err := store.Restore(ctx, strings.NewReader(invalid)); err == nil {
+			t.Fatalf("Restore accepted the backup %q", invalid)
+		}
+		if len(store.documents) != 1 || len(store.faqs) != 1 {
+			t.Fatalf("%d documents and %d FAQ entries after a failed restore", len(store.documents), len(store.faqs))
+		}
+	}
+
+	// The backup restores the objects with their vectors without embedding them
+	embedder := &lengthEmbedder{}
+	other, err := NewMemoryStore(embedder, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backup.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Restore(ctx, backup); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if embedder.embedded != 0 {
+		t.Errorf("Restore embedded %d texts", embedder.embedded)
+	}
+	if !reflect.DeepEqual(other.documents[id], store.documents[id]) || !reflect.DeepEqual(other.faqs["f1"], store.faqs["f1"]) {
+		t.Errorf("restored %+v and %+v", other.documents[id], other.faqs["f1"])
+	}
+}
+
+// heldEmbedder holds the embedding of several texts until released, like a slow endpoint
+type heldEmbedder struct {
+	lengthEmbedder
+	held    chan struct{}
+	release chan struct{}
+}
+
+func (e *heldEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) > 1 {
+		close(e.held)
+		<-e.release
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{float32(len(text)), 1}
+	}
+	return vectors, nil
+}
+
+func TestMemoryStoreReEmbedDoesNotBlockTheStore(t *testing.T) {
+	embedder := &heldEmbedder{held: make(chan struct{}), release: make(chan struct{})}
+	store, err := NewMemoryStore(embedder, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := store.UpsertDocument(ctx, &types.Document{Content: "hello", Metadata: types.Metadata{Tags: []string{"hr"}}}, []float32{9, 9}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpsertFAQ(ctx, &types.FAQ{ID: "f1", Question: "why?"}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := store.ReEmbed(ctx, createBackup(t))
+		done <- err
+	}()
+	<-embedder.held
+	// Searches and writes go on while the objects are embedded
+	found, err := store.SearchByMetadata(ctx, types.Metadata{Tags: []string{"hr"}}, 10)
+	if err != nil || len(found) != 1 {
+		t.Fatalf("SearchByMetadata while re-embedding = %v, %v", found, err)
+	}
+	if err := store.UpsertFAQ(ctx, &types.FAQ{ID: "f2", Question: "how?"}); err != nil {
+		t.Fatal(err)
+	}
+	close(embedder.release)
+
+	// The entry written meanwhile is not lost to the rewrite
+	if err := <-done; err == nil {
+		t.Fatal("ReEmbed rewrote a store written while re-embedding")
+	}
+	if len(store.faqs) != 2 || !reflect.DeepEqual(store.documents[found[0].ID].Vector, []float32{9, 9}) {
+		t.Errorf("store changed by the failed re-embedding: %d FAQ entries", len(store.faqs))
+	}
+}
@@ -0,0 +1,399 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// SchemaMigrationsCollection records the migrations applied to a database
+const SchemaMigrationsCollection = "schema_migrations"
+
+const namespaceExistsCode = 48
+
+// Migration is one versioned change to the MongoDB schema. Up must be idempotent:
+// two instances starting together may both run a migration before either records it.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// MigrationState is a migration together with the time it was applied, 0 when pending
+type MigrationState struct {
+	Version     int    `json:"version" bson:"_id"`
+	Description string `json:"description" bson:"description"`
+	AppliedAt   int64  `json:"applied_at" bson:"applied_at"`
+}
+
+// Migrations lists every schema migration in version order. Never edit or reorder an
+// applied migration, add a new one instead.
+var Migrations = []Migration{
+	{Version: 1, Description: "create collections with validators", Up: migrateValidators},
+	{Version: 2, Description: "create query indexes", Up: migrateIndexes},
+	{Version: 3, Description: "unique usernames for users and admins", Up: migrateUniqueUsernames},
+	{Version: 4, Description: "soft delete indexes for users and documents", Up: migrateSoftDelete},
+	{Version: 5, Description: "audit log collection", Up: migrateAuditEvents},
+	{Version: 6, Description: "token usage indexes", Up: migrateUsage},
+	{Version: 7, Description: "chat answer and review queue indexes", Up: migrateChatAnswers},
+	{Version: 8, Description: "faq indexes", Up: migrateFAQs},
+	{Version: 9, Description: "prompt template versions", Up: migratePromptTemplates},
+}
+
+// Migrate applies the pending migrations in order and returns the ones it applied
+func Migrate(ctx context.Context, db *mongo.Database) ([]Migration, error) {
+	states, err := MigrationStatus(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]Migration, 0)
+	for i, migration := range sortedMigrations() {
+		if states[i].AppliedAt > 0 {
+			continue
+		}
+		if err := migration.Up(ctx, db); err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+		}
+		_, err := db.Collection(SchemaMigrationsCollection).InsertOne(ctx, MigrationState{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().Unix(),
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return applied, fmt.Errorf("recording migration %d: %w", migration.Version, err)
+		}
+		log.Printf("Applied migration %d: %s", migration.Version, migration.Description)
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// MigrationStatus returns every known migration in version order with the time it was applied
+func MigrationStatus(ctx context.Context, db *mongo.Database) ([]MigrationState, error) {
+	cursor, err := db.Collection(SchemaMigrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []MigrationState
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int]int64, len(records))
+	for _, record := range records {
+		appliedAt[record.Version] = record.AppliedAt
+	}
+
+	migrations := sortedMigrations()
+	states := make([]MigrationState, 0, len(migrations))
+	for _, migration := range migrations {
+		states = append(states, MigrationState{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   appliedAt[migration.Version],
+		})
+	}
+	return states, nil
+}
+
+func sortedMigrations() []Migration {
+	migrations := make([]Migration, len(Migrations))
+	copy(migrations, Migrations)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations
+}
+
+var (
+	integerTypes = bson.A{"int", "long"}
+
+	// collectionValidators are the $jsonSchema of each collection
+	collectionValidators = map[string]bson.M{
+		"users": {
+			"bsonType": "object",
+			"required": bson.A{"username"},
+			"properties": bson.M{
+				"username":         bson.M{"bsonType": "string", "minLength": 1},
+				"full_name":        bson.M{"bsonType": "string"},
+				"workspace":        bson.M{"bsonType": "string"},
+				"workspace_role":   bson.M{"bsonType": "string"},
+				"role":             bson.M{"bsonType": "string"},
+				"management_level": bson.M{"bsonType": integerTypes, "minimum": 0, "maximum": types.USER_MANAGEMENT_LEVEL_EXECUTIVE},
+			},
+		},
+		"admins": {
+			"bsonType": "object",
+			"required": bson.A{"username"},
+			"properties": bson.M{
+				"username": bson.M{"bsonType": "string", "minLength": 1},
+			},
+		},
+		"workspaces": {
+			"bsonType": "object",
+			"required": bson.A{"name"},
+			"properties": bson.M{
+				"name": bson.M{"bsonType": "string", "minLength": 1},
+			},
+		},
+		"tasks": {
+			"bsonType": "object",
+			"required": bson.A{"title", "workspace", "status"},
+			"properties": bson.M{
+				"title":     bson.M{"bsonType": "string", "minLength": 1},
+				"workspace": bson.M{"bsonType": "string"},
+				"status": bson.M{"enum": bson.A{
+					types.TASK_STATUS_OPEN, types.TASK_STATUS_DOING, types.TASK_STATUS_REVIEW,
+					types.TASK_STATUS_COMPLETED, types.TASK_STATUS_CLOSE, types.TASK_STATUS_CANCEL,
+				}},
+				"deadline": bson.M{"bsonType": integerTypes},
+			},
+		},
+		"task_comments": {
+			"bsonType": "object",
+			"required": bson.A{"task_id", "author", "content"},
+			"properties": bson.M{
+				"task_id": bson.M{"bsonType": "string"},
+				"content": bson.M{"bsonType": "string", "minLength": 1},
+			},
+		},
+		"notifications": {
+			"bsonType": "object",
+			"required": bson.A{"user_id", "type", "key"},
+		},
+	}
+
+	collectionIndexes = map[string][]mongo.IndexModel{
+		"users": {
+			{Keys: bson.D{{Key: "workspace", Value: 1}, {Key: "management_level", Value: -1}}},
+		},
+		"tasks": {
+			{Keys: bson.D{{Key: "status", Value: 1}}},
+			{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "deadline", Value: -1}}},
+			{Keys: bson.D{{Key: "workspace", Value: 1}, {Key: "status", Value: 1}, {Key: "deadline", Value: 1}}},
+			{Keys: bson.D{{Key: "assignee", Value: 1}, {Key: "deadline", Value: 1}}},
+			{Keys: bson.D{{Key: "reporter", Value: 1}, {Key: "deadline", Value: 1}}},
+		},
+		"task_comments": {
+			{Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		},
+		"notifications": {
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "read", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		"login_attempts": {
+			{Keys: bson.D{{Key: "username", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		},
+	}
+)
+
+// migrateValidators creates the collections with a $jsonSchema validator, or adds it to
+// existing ones. Validation is moderate so documents written before stay updatable.
+func migrateValidators(ctx context.Context, db *mongo.Database) error {
+	names, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(names))
+	for _, name := range names {
+		existing[name] = true
+	}
+	for name, schema := range collectionValidators {
+		if err := applyValidator(ctx, db, name, schema, existing[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyValidator creates the collection with the schema, or sets it on the existing collection
+func applyValidator(ctx context.Context, db *mongo.Database, name string, schema bson.M, exists bool) error {
+	validator := bson.M{"$jsonSchema": schema}
+	if !exists {
+		opts := options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel("moderate").
+			SetValidationAction("error")
+		err := db.CreateCollection(ctx, name, opts)
+		if err == nil {
+			return nil
+		}
+		// Another instance created it in the meantime, fall back to collMod
+		var cmdErr mongo.CommandError
+		if !errors.As(err, &cmdErr) || cmdErr.Code != namespaceExistsCode {
+			return fmt.Errorf("create %s: %w", name, err)
+		}
+	}
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: "error"},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("validator for %s: %w", name, err)
+	}
+	return nil
+}
+
+func migrateIndexes(ctx context.Context, db *mongo.Database) error {
+	for name, indexes := range collectionIndexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, indexes); err != nil {
+			return fmt.Errorf("indexes for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// migrateUniqueUsernames refuses to run while duplicates exist, listing them so they
+// can be merged or renamed by hand
+func migrateUniqueUsernames(ctx context.Context, db *mongo.Database) error {
+	for _, name := range []string{"users", "admins"} {
+		collection := db.Collection(name)
+		duplicates, err := duplicateValues(ctx, collection, "username")
+		if err != nil {
+			return err
+		}
+		if len(duplicates) > 0 {
+			return fmt.Errorf("%s has duplicate usernames, resolve them first: %s", name, strings.Join(duplicates, ", "))
+		}
+		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			return fmt.Errorf("unique username index for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func duplicateValues(ctx context.Context, collection *mongo.Collection, field string) ([]string, error) {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		Value interface{} `bson:"_id"`
+		Count int         `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	duplicates := make([]string, 0, len(groups))
+	for _, group := range groups {
+		duplicates = append(duplicates, fmt.Sprintf("%v (%d)", group.Value, group.Count))
+	}
+	return duplicates, nil
+}
+
+func migrateSoftDelete(ctx context.Context, db *mongo.Database) error {
+	indexes := map[string][]mongo.IndexModel{
+		"users": {
+			{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+		"documents": {
+			{Keys: bson.D{{Key: "workspace", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+	}
+	for name, models := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("indexes for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func migrateAuditEvents(ctx context.Context, db *mongo.Database) error {
+	names, err := db.ListCollectionNames(ctx, bson.D{{Key: "name", Value: "audit_events"}})
+	if err != nil {
+		return err
+	}
+	schema := bson.M{
+		"bsonType": "object",
+		"required": bson.A{"actor_type", "action", "outcome", "created_at"},
+		"properties": bson.M{
+			"actor_type": bson.M{"enum": bson.A{types.AUDIT_ACTOR_USER, types.AUDIT_ACTOR_ADMIN, types.AUDIT_ACTOR_ANONYMOUS}},
+			"action":     bson.M{"bsonType": "string"},
+			"outcome":    bson.M{"enum": bson.A{types.AUDIT_OUTCOME_SUCCESS, types.AUDIT_OUTCOME_FAILURE, types.AUDIT_OUTCOME_DENIED}},
+			"created_at": bson.M{"bsonType": integerTypes},
+		},
+	}
+	if err := applyValidator(ctx, db, "audit_events", schema, len(names) > 0); err != nil {
+		return err
+	}
+	_, err = db.Collection("audit_events").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("indexes for audit_events: %w", err)
+	}
+	return nil
+}
+
+func migrateUsage(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("usage").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// One counter per user, day and model, incremented by upserts
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "day", Value: 1}, {Key: "model", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "month", Value: 1}}},
+		{Keys: bson.D{{Key: "day", Value: -1}, {Key: "workspace", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("indexes for usage: %w", err)
+	}
+	return nil
+}
+
+func migrateChatAnswers(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("chat_answers").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "chat_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "feedback.review_status", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("indexes for chat_answers: %w", err)
+	}
+	return nil
+}
+
+func migrateFAQs(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("faqs").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "workspace", Value: 1}, {Key: "updated_at", Value: -1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("indexes for faqs: %w", err)
+	}
+	return nil
+}
+
+func migratePromptTemplates(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("prompt_templates").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "workspace", Value: 1}, {Key: "version", Value: -1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("indexes for prompt_templates: %w", err)
+	}
+	return nil
+}
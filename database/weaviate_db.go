@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 
 	"github.com/tieubaoca/chatbot-be/config"
@@ -26,20 +27,40 @@ var (
 			{Name: "title", DataType: []string{"text"}},
 			{Name: "source", DataType: []string{"text"}},
 			{Name: "tags", DataType: []string{"text[]"}},
+			{Name: "workspace", DataType: []string{"text"}},
 			{Name: "custom", DataType: []string{"object"},
 				NestedProperties: []*models.NestedProperty{
 					{Name: "page", DataType: []string{"text"}},
 				},
 			},
 			{Name: "createdAt", DataType: []string{"int"}},
+			{Name: "documentId", DataType: []string{"text"}, Tokenization: "field"},
+			{Name: "deleted", DataType: []string{"boolean"}},
 		},
 		VectorIndexType: "hnsw",
+		// Global chunks have no workspace, null state indexing lets searches filter for them
+		InvertedIndexConfig: &models.InvertedIndexConfig{IndexNullState: true},
 	}
 )
 
+// scopeOverfetch multiplies the hits fetched from a class without null state index when
+// a search is limited to workspaces, as they are filtered after the search
+const scopeOverfetch = 4
+
+var _ VectorDatabase = (*WeaviateStore)(nil)
+
 type WeaviateStore struct {
 	client         *weaviate.Client
 	text2VecModule string
+	// embedder vectorizes in the server, nil when a Weaviate module does it
+	embedder Embedder
+	// documentClass and faqClass are the schemas the classes are created with, copies
+	// of DOCUMENT_CLASS_OBJECT and FAQ_CLASS_OBJECT configured for this store
+	documentClass *models.Class
+	faqClass      *models.Class
+	// documentNullState and faqNullState tell whether the classes can filter for global objects
+	documentNullState bool
+	faqNullState      bool
 }
 
 func NewWeaviateStore(config config.WeaviateStoreConfig) (*WeaviateStore, error) {
@@ -63,8 +84,16 @@ func NewWeaviateStore(config config.WeaviateStoreConfig) (*WeaviateStore, error)
 			"X-Weaviate-Cluster-Url": fmt.Sprintf("%s://%s", scheme, host),
 		}
 	}
-	DOCUMENT_CLASS_OBJECT.Vectorizer = config.Text2Vec
-	DOCUMENT_CLASS_OBJECT.ModuleConfig = config.ModuleConfig
+	documentClass := copyClass(DOCUMENT_CLASS_OBJECT)
+	documentClass.Vectorizer = config.Text2Vec
+	documentClass.ModuleConfig = config.ModuleConfig
+	faqClass := newFAQClass(config)
+	var embedder Embedder
+	if config.Embedding.Enabled() {
+		embedder = NewEmbedder(config.Embedding)
+		documentClass.Description = embeddingDescription(embedder.Model())
+		faqClass.Description = embeddingDescription(embedder.Model())
+	}
 	client, err := weaviate.NewClient(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create weaviate client: %v", err)
@@ -76,31 +105,189 @@ func NewWeaviateStore(config config.WeaviateStoreConfig) (*WeaviateStore, error)
 	}
 
 	hasDocumentClass := false
+	documentNullState := true
 	for _, class := range schema.Classes {
 		if class.Class == DOCUMENT_CLASS {
 			hasDocumentClass = true
+			documentNullState = indexesNullState(class)
 			break
 		}
 	}
 	// Create Document class if it doesn't exist
 	if !hasDocumentClass {
-		err = client.Schema().ClassCreator().WithClass(DOCUMENT_CLASS_OBJECT).Do(context.Background())
+		err = client.Schema().ClassCreator().WithClass(documentClass).Do(context.Background())
 		if err != nil {
 			return nil, fmt.Errorf("failed to create Document class: %v", err)
 		}
+	} else if err := addMissingProperties(client, schema.Classes); err != nil {
+		return nil, err
+	}
+	if !documentNullState {
+		log.Printf("Warning: the Document class does not index null state, workspace scoped searches are filtered after the search; run the re-embed command to rebuild it")
+	}
+	faqNullState, err := ensureFAQClass(client, schema.Classes, faqClass)
+	if err != nil {
+		return nil, err
+	}
+	if embedder != nil {
+		warnEmbeddingModel(schema.Classes, embedder.Model())
 	}
 	return &WeaviateStore{
-		client: client,
+		client:            client,
+		embedder:          embedder,
+		documentClass:     documentClass,
+		faqClass:          faqClass,
+		documentNullState: documentNullState,
+		faqNullState:      faqNullState,
 	}, nil
 }
 
+// indexesNullState tells whether IsNull filters work on the class. It cannot be changed
+// on an existing class, re-embed recreates the classes.
+func indexesNullState(class *models.Class) bool {
+	return class.InvertedIndexConfig != nil && class.InvertedIndexConfig.IndexNullState
+}
+
+// withoutEmptyWorkspace leaves the workspace of global objects null, so that
+// workspacesFilter finds them
+func withoutEmptyWorkspace(properties map[string]interface{}) map[string]interface{} {
+	if workspace, ok := properties["workspace"].(string); ok && workspace == "" {
+		delete(properties, "workspace")
+	}
+	return properties
+}
+
+// workspacesFilter matches the objects of the workspaces, "" matching the global objects
+func workspacesFilter(workspaces []string) *filters.WhereBuilder {
+	operands := make([]*filters.WhereBuilder, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		if workspace == "" {
+			operands = append(operands, filters.Where().
+				WithPath([]string{"workspace"}).
+				WithOperator(filters.IsNull).
+				WithValueBoolean(true))
+			continue
+		}
+		operands = append(operands, filters.Where().
+			WithPath([]string{"workspace"}).
+			WithOperator(filters.Equal).
+			WithValueString(workspace))
+	}
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	return filters.Where().WithOperator(filters.Or).WithOperands(operands)
+}
+
+// copyClass copies a class schema with its properties, so that configuring the copy
+// leaves the original as declared
+func copyClass(class *models.Class) *models.Class {
+	copied := *class
+	copied.Properties = make([]*models.Property, len(class.Properties))
+	for i, property := range class.Properties {
+		p := *property
+		copied.Properties[i] = &p
+	}
+	return &copied
+}
+
+// embeddingDescription records in the class description which model wrote its vectors
+func embeddingDescription(model string) string {
+	return "embedding model: " + model
+}
+
+// warnEmbeddingModel tells when existing classes were vectorized by another model,
+// searching them with the new model's vectors gives wrong or no results
+func warnEmbeddingModel(classes []*models.Class, model string) {
+	for _, class := range classes {
+		if class.Class != DOCUMENT_CLASS && class.Class != FAQ_CLASS {
+			continue
+		}
+		if class.Description != embeddingDescription(model) {
+			log.Printf("Warning: the %s class was not vectorized with %s, run the re-embed command", class.Class, model)
+		}
+	}
+}
+
+// embed vectorizes the texts, returning nil when Weaviate vectorizes them itself
+func (s *WeaviateStore) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if s.embedder == nil || len(texts) == 0 {
+		return nil, nil
+	}
+	return s.embedder.Embed(ctx, texts)
+}
+
+// queryVector embeds the search queries into a single vector
+func (s *WeaviateStore) queryVector(ctx context.Context, queries []string) ([]float32, error) {
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no query to search for")
+	}
+	vectors, err := s.embed(ctx, queries)
+	if err != nil {
+		return nil, err
+	}
+	return meanVector(vectors), nil
+}
+
+// withNear searches near the queries, by vector when the server embeds them or by text otherwise
+func (s *WeaviateStore) withNear(ctx context.Context, get *graphql.GetBuilder, queries []string, certainty, distance float32) (*graphql.GetBuilder, error) {
+	if s.embedder == nil {
+		nearText := s.client.GraphQL().NearTextArgBuilder().WithConcepts(queries)
+		if certainty > 0 {
+			nearText = nearText.WithCertainty(certainty)
+		}
+		if distance > 0 {
+			nearText = nearText.WithDistance(distance)
+		}
+		return get.WithNearText(nearText), nil
+	}
+	vector, err := s.queryVector(ctx, queries)
+	if err != nil {
+		return nil, err
+	}
+	nearVector := s.client.GraphQL().NearVectorArgBuilder().WithVector(vector)
+	if certainty > 0 {
+		nearVector = nearVector.WithCertainty(certainty)
+	}
+	if distance > 0 {
+		nearVector = nearVector.WithDistance(distance)
+	}
+	return get.WithNearVector(nearVector), nil
+}
+
+// addMissingProperties adds the properties introduced after the Document class was created
+func addMissingProperties(client *weaviate.Client, classes []*models.Class) error {
+	existing := make(map[string]bool)
+	for _, class := range classes {
+		if class.Class != DOCUMENT_CLASS {
+			continue
+		}
+		for _, property := range class.Properties {
+			existing[property.Name] = true
+		}
+	}
+	for _, property := range DOCUMENT_CLASS_OBJECT.Properties {
+		if existing[property.Name] {
+			continue
+		}
+		err := client.Schema().PropertyCreator().
+			WithClassName(DOCUMENT_CLASS).
+			WithProperty(property).
+			Do(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to add property %s to Document class: %v", property.Name, err)
+		}
+	}
+	return nil
+}
+
 func (s *WeaviateStore) ReInit() error {
 	err := s.client.Schema().ClassDeleter().WithClassName(DOCUMENT_CLASS).Do(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to delete Document class: %v", err)
 	}
 
-	err = s.client.Schema().ClassCreator().WithClass(DOCUMENT_CLASS_OBJECT).Do(context.Background())
+	err = s.client.Schema().ClassCreator().WithClass(s.documentClass).Do(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to create Document class: %v", err)
 	}
@@ -112,19 +299,31 @@ func (s *WeaviateStore) UpsertDocument(ctx context.Context, doc *types.Document,
 	// Check if we found any exact matches
 
 	className := DOCUMENT_CLASS
-	properties := map[string]interface{}{
-		"content":   doc.Content,
-		"title":     doc.Metadata.Title,
-		"source":    doc.Metadata.Source,
-		"tags":      doc.Metadata.Tags,
-		"custom":    doc.Metadata.Custom,
-		"createdAt": doc.CreatedAt,
-	}
+	properties := withoutEmptyWorkspace(map[string]interface{}{
+		"content":    doc.Content,
+		"title":      doc.Metadata.Title,
+		"source":     doc.Metadata.Source,
+		"tags":       doc.Metadata.Tags,
+		"workspace":  doc.Metadata.Workspace,
+		"custom":     doc.Metadata.Custom,
+		"createdAt":  doc.CreatedAt,
+		"documentId": doc.Metadata.DocumentID,
+		"deleted":    false,
+	})
 
 	creator := s.client.Data().Creator().
 		WithClassName(className).
 		WithProperties(properties)
 
+	if embedding == nil {
+		vectors, err := s.embed(ctx, []string{doc.Content})
+		if err != nil {
+			return err
+		}
+		if vectors != nil {
+			embedding = vectors[0]
+		}
+	}
 	if embedding != nil {
 		creator = creator.WithVector(embedding)
 	}
@@ -139,6 +338,16 @@ func (s *WeaviateStore) UpsertDocument(ctx context.Context, doc *types.Document,
 
 func (s *WeaviateStore) BatchInsertDocuments(ctx context.Context, docs []types.Document, embeddings [][]float32) error {
 	total := len(docs)
+	if embeddings == nil {
+		contents := make([]string, total)
+		for i := range docs {
+			contents[i] = docs[i].Content
+		}
+		var err error
+		if embeddings, err = s.embed(ctx, contents); err != nil {
+			return err
+		}
+	}
 	for i := 0; i < total; i += BATCH_SIZE {
 		end := i + BATCH_SIZE
 		if end > total {
@@ -150,14 +359,17 @@ func (s *WeaviateStore) BatchInsertDocuments(ctx context.Context, docs []types.D
 
 		// Add documents to current batch
 		for j := i; j < end; j++ {
-			properties := map[string]interface{}{
-				"content":   docs[j].Content,
-				"title":     docs[j].Metadata.Title,
-				"source":    docs[j].Metadata.Source,
-				"tags":      docs[j].Metadata.Tags,
-				"custom":    docs[j].Metadata.Custom,
-				"createdAt": docs[j].CreatedAt,
-			}
+			properties := withoutEmptyWorkspace(map[string]interface{}{
+				"content":    docs[j].Content,
+				"title":      docs[j].Metadata.Title,
+				"source":     docs[j].Metadata.Source,
+				"tags":       docs[j].Metadata.Tags,
+				"workspace":  docs[j].Metadata.Workspace,
+				"custom":     docs[j].Metadata.Custom,
+				"createdAt":  docs[j].CreatedAt,
+				"documentId": docs[j].Metadata.DocumentID,
+				"deleted":    false,
+			})
 
 			// Add embedding if provided
 			if embeddings != nil && j < len(embeddings) {
@@ -193,31 +405,85 @@ func (s *WeaviateStore) DeleteDocument(ctx context.Context, id string) error {
 		Do(ctx)
 }
 
-func (s *WeaviateStore) AskAI(ctx context.Context, question string, queries []string, metadata types.Metadata, limit int) ([]types.Document, error) {
+// SetDocumentDeleted flags or unflags every chunk of a document. Flagged chunks are
+// excluded from search by buildMetadataFilter.
+func (s *WeaviateStore) SetDocumentDeleted(ctx context.Context, documentID string, deleted bool) error {
+	where := filters.Where().WithOperator(filters.And).WithOperands([]*filters.WhereBuilder{
+		documentIDFilter(documentID),
+		filters.Where().WithPath([]string{"deleted"}).WithOperator(filters.NotEqual).WithValueBoolean(deleted),
+	})
+	// Updated chunks stop matching the filter, so each round fetches the next ones
+	for {
+		result, err := s.client.GraphQL().Get().
+			WithClassName(DOCUMENT_CLASS).
+			WithFields(graphql.Field{Name: "_additional", Fields: []graphql.Field{{Name: "id"}}}).
+			WithWhere(where).
+			WithLimit(BATCH_SIZE).
+			Do(ctx)
+		if err != nil {
+			return err
+		}
+		if result.Errors != nil {
+			return fmt.Errorf("search failed: %v", result.Errors[0].Message)
+		}
+		data, _ := result.Data["Get"].(map[string]interface{})[DOCUMENT_CLASS].([]interface{})
+		if len(data) == 0 {
+			return nil
+		}
+		for _, item := range data {
+			additional, _ := item.(map[string]interface{})["_additional"].(map[string]interface{})
+			id := parseString(additional["id"])
+			if id == "" {
+				return fmt.Errorf("chunk of document %s has no id", documentID)
+			}
+			err := s.client.Data().Updater().
+				WithClassName(DOCUMENT_CLASS).
+				WithID(id).
+				WithMerge().
+				WithProperties(map[string]interface{}{"deleted": deleted}).
+				Do(ctx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// DeleteDocumentChunks removes every chunk of a document
+func (s *WeaviateStore) DeleteDocumentChunks(ctx context.Context, documentID string) error {
+	_, err := s.client.Batch().ObjectsBatchDeleter().
+		WithClassName(DOCUMENT_CLASS).
+		WithWhere(documentIDFilter(documentID)).
+		WithOutput("minimal").
+		Do(ctx)
+	return err
+}
+
+// AskAI generates an answer from each retrieved chunk with the prompt, in which Weaviate fills {title} and {content}
+func (s *WeaviateStore) AskAI(ctx context.Context, prompt string, queries []string, metadata types.Metadata, limit int) ([]types.Document, error) {
 	fields := []graphql.Field{
 		{Name: "content"},
 		{Name: "title"},
 		{Name: "source"},
 		{Name: "tags"},
+		{Name: "workspace"},
 		{Name: "custom", Fields: []graphql.Field{{Name: "page"}}},
 		{Name: "createdAt"},
+		{Name: "documentId"},
 		{Name: "_additional", Fields: []graphql.Field{{Name: "distance"}, {Name: "id"}}},
 	}
-	gs := graphql.NewGenerativeSearch().SingleResult(`You are an intelligent AI assistant. Below is relevant information retrieved from a RAG system:
-[CONTEXT]
-Title: {title}  
-Content: {content}  
-[/CONTEXT]  
-Based on the information above, answer the user's question accurately and concisely. If the provided information is not sufficient to answer, state that you don't have enough data instead of guessing. You answer by Vietnamese.
-User's question: ` + question)
-	response, err := s.client.GraphQL().Get().
+	gs := graphql.NewGenerativeSearch().SingleResult(prompt)
+	getBuilder, err := s.withNear(ctx, s.client.GraphQL().Get().
 		WithClassName(DOCUMENT_CLASS).
 		WithFields(
 			fields...,
 		).
-		WithGenerativeSearch(gs).
-		WithNearText((&graphql.NearTextArgumentBuilder{}).
-			WithConcepts(queries).WithDistance(0.7)).
+		WithGenerativeSearch(gs), queries, 0, 0.7)
+	if err != nil {
+		return nil, err
+	}
+	response, err := getBuilder.
+		WithWhere(buildMetadataFilter(metadata)).
 		WithLimit(limit).
 		Do(ctx)
 
@@ -231,17 +497,20 @@ User's question: ` + question)
 				document := types.Document{
 					Content: doc["content"].(string),
 					Metadata: types.Metadata{
-						Title:  doc["title"].(string),
-						Source: doc["source"].(string),
-						Tags:   parseStringArray(doc["tags"]),
-						Custom: parseStringMap(doc["custom"]),
+						Title:      doc["title"].(string),
+						Source:     doc["source"].(string),
+						Tags:       parseStringArray(doc["tags"]),
+						Workspace:  parseString(doc["workspace"]),
+						Custom:     parseStringMap(doc["custom"]),
+						DocumentID: parseString(doc["documentId"]),
 					},
 					CreatedAt: int64(doc["createdAt"].(float64)),
 				}
 
-				docs = append(docs, document)
-
 				if additional, ok := doc["_additional"].(map[string]interface{}); ok {
+					if document.Metadata.Custom == nil {
+						document.Metadata.Custom = make(map[string]string)
+					}
 					document.ID = additional["id"].(string)
 					document.Metadata.Custom["distance"] = fmt.Sprintf("%f", additional["distance"].(float64))
 					generate := doc["_additional"].(map[string]interface{})["generate"].(map[string]interface{})
@@ -249,6 +518,8 @@ User's question: ` + question)
 						document.Metadata.Custom["generative"] = generate["singleResult"].(string)
 					}
 				}
+				// Appended last, the ID and distance are only known from _additional
+				docs = append(docs, document)
 			}
 		}
 	}
@@ -262,27 +533,34 @@ func (s *WeaviateStore) SearchSimilarWithMetadata(ctx context.Context, queries [
 		{Name: "title"},
 		{Name: "source"},
 		{Name: "tags"},
+		{Name: "workspace"},
 		{Name: "custom", Fields: []graphql.Field{{Name: "page"}}},
 		{Name: "createdAt"},
+		{Name: "documentId"},
 		{Name: "_additional", Fields: []graphql.Field{{Name: "distance"}, {Name: "id"}}},
 	}
-	nearVector := s.client.GraphQL().NearTextArgBuilder().
-		WithConcepts(queries).
-		WithCertainty(0.7)
 	// Build where filter for metadata
 	where := buildMetadataFilter(metadata)
+	fetch := limit
+	filterScope := metadata.Workspaces != nil && !s.documentNullState
+	if metadata.Workspaces != nil && s.documentNullState {
+		where = filters.Where().WithOperator(filters.And).
+			WithOperands([]*filters.WhereBuilder{where, workspacesFilter(metadata.Workspaces)})
+	} else if filterScope {
+		fetch = limit * scopeOverfetch
+	}
 
 	// Combined query with both vector similarity and metadata filters
-	getBuilder := s.client.GraphQL().Get().
+	getBuilder, err := s.withNear(ctx, s.client.GraphQL().Get().
 		WithClassName(DOCUMENT_CLASS).
-		WithFields(fields...).
-		WithNearText(nearVector)
-	if limit > 0 {
-		getBuilder = getBuilder.WithLimit(limit)
+		WithFields(fields...), queries, 0.7, 0)
+	if err != nil {
+		return nil, nil, err
 	}
-	if where != nil {
-		getBuilder = getBuilder.WithWhere(where)
+	if fetch > 0 {
+		getBuilder = getBuilder.WithLimit(fetch)
 	}
+	getBuilder = getBuilder.WithWhere(where)
 
 	result, err := getBuilder.Do(ctx)
 
@@ -303,28 +581,54 @@ func (s *WeaviateStore) SearchSimilarWithMetadata(ctx context.Context, queries [
 				document := types.Document{
 					Content: doc["content"].(string),
 					Metadata: types.Metadata{
-						Title:  doc["title"].(string),
-						Source: doc["source"].(string),
-						Tags:   parseStringArray(doc["tags"]),
-						Custom: parseStringMap(doc["custom"]),
+						Title:      doc["title"].(string),
+						Source:     doc["source"].(string),
+						Tags:       parseStringArray(doc["tags"]),
+						Workspace:  parseString(doc["workspace"]),
+						Custom:     parseStringMap(doc["custom"]),
+						DocumentID: parseString(doc["documentId"]),
 					},
 					CreatedAt: int64(doc["createdAt"].(float64)),
 				}
 
-				docs = append(docs, document)
-
 				if additional, ok := doc["_additional"].(map[string]interface{}); ok {
+					if document.Metadata.Custom == nil {
+						document.Metadata.Custom = make(map[string]string)
+					}
 					distances = append(distances, float32(additional["distance"].(float64)))
 					document.ID = additional["id"].(string)
 					document.Metadata.Custom["distance"] = fmt.Sprintf("%f", additional["distance"].(float64))
 				}
+				docs = append(docs, document)
 			}
 		}
 	}
 
+	if filterScope {
+		docs, distances = filterWorkspaces(docs, distances, metadata.Workspaces, limit)
+	}
 	return docs, distances, nil
 }
 
+// filterWorkspaces keeps the first limit hits of the workspaces
+func filterWorkspaces(docs []types.Document, distances []float32, workspaces []string, limit int) ([]types.Document, []float32) {
+	keptDocs := make([]types.Document, 0, len(docs))
+	keptDistances := make([]float32, 0, len(distances))
+	for i, doc := range docs {
+		if !slices.Contains(workspaces, doc.Metadata.Workspace) {
+			continue
+		}
+		keptDocs = append(keptDocs, doc)
+		if i < len(distances) {
+			keptDistances = append(keptDistances, distances[i])
+		}
+		if limit > 0 && len(keptDocs) == limit {
+			break
+		}
+	}
+	return keptDocs, keptDistances
+}
+
 // Update SearchSimilar to use common search structure
 func (s *WeaviateStore) SearchSimilar(ctx context.Context, queries []string, limit int) ([]types.Document, []float32, error) {
 	// Call SearchSimilarWithMetadata with empty metadata
@@ -337,8 +641,10 @@ func (s *WeaviateStore) SearchByMetadata(ctx context.Context, metadata types.Met
 		{Name: "title"},
 		{Name: "source"},
 		{Name: "tags"},
+		{Name: "workspace"},
 		{Name: "custom", Fields: []graphql.Field{{Name: "page"}}},
 		{Name: "createdAt"},
+		{Name: "documentId"},
 		{Name: "_additional", Fields: []graphql.Field{{Name: "distance"}, {Name: "id"}}},
 	}
 
@@ -350,9 +656,7 @@ func (s *WeaviateStore) SearchByMetadata(ctx context.Context, metadata types.Met
 	if limit > 0 {
 		getBuilder = getBuilder.WithLimit(limit)
 	}
-	if where != nil {
-		getBuilder = getBuilder.WithWhere(where)
-	}
+	getBuilder = getBuilder.WithWhere(where)
 	result, err := getBuilder.Do(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %v", err)
@@ -367,16 +671,20 @@ func (s *WeaviateStore) SearchByMetadata(ctx context.Context, metadata types.Met
 		for _, item := range data {
 			if doc, ok := item.(map[string]interface{}); ok {
 				document := types.Document{
-					ID:      doc["id"].(string),
 					Content: doc["content"].(string),
 					Metadata: types.Metadata{
-						Title:  doc["title"].(string),
-						Source: doc["source"].(string),
-						Tags:   parseStringArray(doc["tags"]),
-						Custom: parseStringMap(doc["custom"]),
+						Title:      doc["title"].(string),
+						Source:     doc["source"].(string),
+						Tags:       parseStringArray(doc["tags"]),
+						Workspace:  parseString(doc["workspace"]),
+						Custom:     parseStringMap(doc["custom"]),
+						DocumentID: parseString(doc["documentId"]),
 					},
 					CreatedAt: int64(doc["createdAt"].(float64)),
 				}
+				if additional, ok := doc["_additional"].(map[string]interface{}); ok {
+					document.ID = parseString(additional["id"])
+				}
 				docs = append(docs, document)
 			}
 		}
@@ -415,6 +723,11 @@ func (s *WeaviateStore) DeleteCollection(ctx context.Context, name string) error
 }
 
 // Helper functions
+func parseString(v interface{}) string {
+	str, _ := v.(string)
+	return str
+}
+
 func parseStringArray(v interface{}) []string {
 	if v == nil {
 		return nil
@@ -445,58 +758,55 @@ func parseStringMap(v interface{}) map[string]string {
 	return result
 }
 
+// buildMetadataFilter matches the chunks having all the given metadata. Chunks of
+// soft-deleted documents never match.
 func buildMetadataFilter(metadata types.Metadata) *filters.WhereBuilder {
-
-	var whereFilter *filters.WhereBuilder
-
-	if metadata.Title != "" {
-		whereFilter = filters.Where().WithPath([]string{"title"}).
+	operands := []*filters.WhereBuilder{
+		filters.Where().
+			WithPath([]string{"deleted"}).
+			WithOperator(filters.NotEqual).
+			WithValueBoolean(true),
+	}
+	equal := func(path []string, value string) {
+		operands = append(operands, filters.Where().
+			WithPath(path).
 			WithOperator(filters.Equal).
-			WithValueString(metadata.Title)
+			WithValueString(value))
 	}
 
+	if metadata.Title != "" {
+		equal([]string{"title"}, metadata.Title)
+	}
 	if metadata.Source != "" {
-		sourceFilter := filters.Where().
-			WithPath([]string{"source"}).
-			WithOperator(filters.Equal).
-			WithValueString(metadata.Source)
-		if whereFilter == nil {
-			whereFilter = sourceFilter
-		} else {
-			whereFilter = whereFilter.WithOperator(filters.And).WithOperands([]*filters.WhereBuilder{sourceFilter})
-		}
-
+		equal([]string{"source"}, metadata.Source)
 	}
-
-	if len(metadata.Tags) > 0 {
-		for _, tag := range metadata.Tags {
-			tagFilter := filters.Where().
-				WithPath([]string{"tags"}).
-				WithOperator(filters.ContainsAny).
-				WithValueString(tag)
-			if whereFilter == nil {
-				whereFilter = tagFilter
-			} else {
-				whereFilter = whereFilter.WithOperator(filters.And).WithOperands([]*filters.WhereBuilder{tagFilter})
-			}
-		}
+	if metadata.Workspace != "" {
+		equal([]string{"workspace"}, metadata.Workspace)
+	}
+	if metadata.DocumentID != "" {
+		operands = append(operands, documentIDFilter(metadata.DocumentID))
+	}
+	for _, tag := range metadata.Tags {
+		operands = append(operands, filters.Where().
+			WithPath([]string{"tags"}).
+			WithOperator(filters.ContainsAny).
+			WithValueString(tag))
+	}
+	for key, value := range metadata.Custom {
+		equal([]string{"custom", key}, value)
 	}
 
-	if len(metadata.Custom) > 0 {
-		for key, value := range metadata.Custom {
-			customFilter := filters.Where().
-				WithPath([]string{"custom", key}).
-				WithOperator(filters.Equal).
-				WithValueString(value)
-			if whereFilter == nil {
-				whereFilter = customFilter
-			} else {
-				whereFilter = whereFilter.WithOperator(filters.And).WithOperands([]*filters.WhereBuilder{customFilter})
-			}
-		}
+	if len(operands) == 1 {
+		return operands[0]
 	}
+	return filters.Where().WithOperator(filters.And).WithOperands(operands)
+}
 
-	return whereFilter
+func documentIDFilter(documentID string) *filters.WhereBuilder {
+	return filters.Where().
+		WithPath([]string{"documentId"}).
+		WithOperator(filters.Equal).
+		WithValueString(documentID)
 }
 
 func NewOllamaModuleConfig(apiEndpoint, model, embedModel string) map[string]interface{} {
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// stubChunk is a Document class search hit
+func stubChunk(id, workspace string, distance float64) map[string]interface{} {
+	chunk := map[string]interface{}{
+		"content": "chunk " + id, "title": "Handbook", "source": "handbook.pdf", "createdAt": 1.0,
+		"_additional": map[string]interface{}{"id": id, "distance": distance},
+	}
+	if workspace != "" {
+		chunk["workspace"] = workspace
+	}
+	return chunk
+}
+
+func TestWeaviateSearchScopesWorkspacesInQuery(t *testing.T) {
+	stub := newWeaviateStub(t)
+	stub.get[DOCUMENT_CLASS] = []interface{}{stubChunk("c1", "", 0.1)}
+	store := stub.newStore(t)
+	if !store.documentNullState || !stub.classes[0].InvertedIndexConfig.IndexNullState {
+		t.Fatal("a new Document class must index null state")
+	}
+
+	metadata := types.Metadata{Tags: []string{"hr"}, Workspaces: []string{"DepartmentTechnical", ""}}
+	docs, distances, err := store.SearchSimilarWithMetadata(context.Background(), []string{"leave policy"}, metadata, 3)
+	if err != nil {
+		t.Fatalf("SearchSimilarWithMetadata: %v", err)
+	}
+	if len(docs) != 1 || len(distances) != 1 || docs[0].ID != "c1" {
+		t.Fatalf("docs %+v", docs)
+	}
+	query := stub.lastQuery()
+	for _, want := range []string{
+		`operator: IsNull path: ["workspace"] valueBoolean: true`,
+		`operator: Equal path: ["workspace"] valueString: "DepartmentTechnical"`,
+		`path: ["tags"] valueString: ["hr"]`,
+		`limit: 3`,
+	} {
+		if !strings.Contains(query, want) {
+			t.Errorf("query lacks %s:\n%s", want, query)
+		}
+	}
+
+	// Without Workspaces every workspace is searched
+	if _, _, err := store.SearchSimilarWithMetadata(context.Background(), []string{"leave policy"}, types.Metadata{}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if query := stub.lastQuery(); strings.Contains(query, `path: ["workspace"]`) {
+		t.Errorf("unscoped query filters workspaces:\n%s", query)
+	}
+}
+
+func TestWeaviateSearchFiltersOldClassAfterSearch(t *testing.T) {
+	stub := newWeaviateStub(t, &models.Class{Class: DOCUMENT_CLASS, Properties: DOCUMENT_CLASS_OBJECT.Properties})
+	stub.get[DOCUMENT_CLASS] = []interface{}{
+		stubChunk("c1", "DepartmentFinance", 0.1),
+		stubChunk("c2", "", 0.2),
+		stubChunk("c3", "DepartmentTechnical", 0.3),
+		stubChunk("c4", "", 0.4),
+	}
+	store := stub.newStore(t)
+	if store.documentNullState {
+		t.Fatal("an old Document class cannot filter for null workspaces")
+	}
+
+	metadata := types.Metadata{Workspaces: []string{"DepartmentTechnical", ""}}
+	docs, distances, err := store.SearchSimilarWithMetadata(context.Background(), []string{"leave policy"}, metadata, 2)
+	if err != nil {
+		t.Fatalf("SearchSimilarWithMetadata: %v", err)
+	}
+	if len(docs) != 2 || docs[0].ID != "c2" || docs[1].ID != "c3" {
+		t.Fatalf("docs %+v, want c2 and c3", docs)
+	}
+	if len(distances) != 2 || distances[0] != 0.2 || distances[1] != 0.3 {
+		t.Errorf("distances %v", distances)
+	}
+	query := stub.lastQuery()
+	if strings.Contains(query, `path: ["workspace"]`) || !strings.Contains(query, "limit: 8") {
+		t.Errorf("old class query must overfetch without a workspace filter:\n%s", query)
+	}
+}
+
+func TestNewWeaviateStoreConfiguresCopiesOfTheClasses(t *testing.T) {
+	stub := newWeaviateStub(t)
+	store, err := NewWeaviateStore(config.WeaviateStoreConfig{
+		Host:      stub.server.URL,
+		Text2Vec:  "text2vec-openai",
+		Embedding: config.EmbeddingConfig{Model: "bge-m3"},
+	})
+	if err != nil {
+		t.Fatalf("NewWeaviateStore: %v", err)
+	}
+	if store.documentClass.Vectorizer != "text2vec-openai" || store.faqClass.Description != embeddingDescription("bge-m3") {
+		t.Errorf("classes of the store not configured: %+v, %+v", store.documentClass, store.faqClass)
+	}
+	for _, created := range stub.classes {
+		if created.Description != embeddingDescription("bge-m3") {
+			t.Errorf("class %s created with description %q", created.Class, created.Description)
+		}
+	}
+	// Another store, in tests or the commands, starts from the classes as declared
+	if DOCUMENT_CLASS_OBJECT.Vectorizer != "" || DOCUMENT_CLASS_OBJECT.Description != "" || FAQ_CLASS_OBJECT.Description != "" {
+		t.Error("the declared classes were changed")
+	}
+	for _, property := range FAQ_CLASS_OBJECT.Properties {
+		if property.ModuleConfig != nil {
+			t.Errorf("declared FAQ property %s got module config %v", property.Name, property.ModuleConfig)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/fault"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// faqMatchCandidates is how many nearest entries are fetched from a FAQ class that
+// cannot filter global entries, see MatchFAQ
+const faqMatchCandidates = 5
+
+var (
+	FAQ_CLASS = "FAQ"
+	// Only the question is vectorized, user questions are matched against it. Global
+	// entries have no workspace, null state indexing lets searches filter for them.
+	FAQ_CLASS_OBJECT = &models.Class{
+		Class: FAQ_CLASS,
+		Properties: []*models.Property{
+			{Name: "question", DataType: []string{"text"}},
+			{Name: "answer", DataType: []string{"text"}},
+			{Name: "tags", DataType: []string{"text[]"}},
+			{Name: "workspace", DataType: []string{"text"}, Tokenization: "field"},
+			{Name: "faqId", DataType: []string{"text"}, Tokenization: "field"},
+		},
+		VectorIndexType:     "hnsw",
+		InvertedIndexConfig: &models.InvertedIndexConfig{IndexNullState: true},
+	}
+)
+
+// newFAQClass returns the FAQ class with the vectorizer of the config, keeping answers
+// out of the vectors
+func newFAQClass(config config.WeaviateStoreConfig) *models.Class {
+	class := copyClass(FAQ_CLASS_OBJECT)
+	class.Vectorizer = config.Text2Vec
+	class.ModuleConfig = config.ModuleConfig
+	if config.Text2Vec == "" || config.Text2Vec == "none" {
+		return class
+	}
+	for _, property := range class.Properties {
+		if property.Name != "question" {
+			property.ModuleConfig = map[string]interface{}{
+				config.Text2Vec: map[string]interface{}{"skip": true},
+			}
+		}
+	}
+	return class
+}
+
+// ensureFAQClass creates the FAQ class when missing and reports whether it indexes null
+// state. Classes created before cannot be changed, re-embed recreates them.
+func ensureFAQClass(client *weaviate.Client, classes []*models.Class, faqClass *models.Class) (bool, error) {
+	for _, class := range classes {
+		if class.Class != FAQ_CLASS {
+			continue
+		}
+		if !indexesNullState(class) {
+			log.Printf("Warning: the FAQ class does not index null state, FAQ matches are filtered by workspace after the search; run the re-embed command to rebuild it")
+			return false, nil
+		}
+		return true, nil
+	}
+	if err := client.Schema().ClassCreator().WithClass(faqClass).Do(context.Background()); err != nil {
+		return false, fmt.Errorf("failed to create FAQ class: %v", err)
+	}
+	return true, nil
+}
+
+// faqObjectID derives the Weaviate UUID of an FAQ entry from its Mongo ObjectID,
+// so that updates replace the same object
+func faqObjectID(id string) (string, error) {
+	if len(id) != 24 {
+		return "", fmt.Errorf("invalid faq id %q", id)
+	}
+	hex := "00000000" + id
+	return fmt.Sprintf("%s-%s-%s-%s-%s", hex[0:8], hex[8:12], hex[12:16], hex[16:20], hex[20:32]), nil
+}
+
+// UpsertFAQ indexes the entry, replacing the previous version of it
+func (s *WeaviateStore) UpsertFAQ(ctx context.Context, faq *types.FAQ) error {
+	objectID, err := faqObjectID(faq.ID)
+	if err != nil {
+		return err
+	}
+	properties := withoutEmptyWorkspace(map[string]interface{}{
+		"question":  faq.Question,
+		"answer":    faq.Answer,
+		"tags":      faq.Tags,
+		"workspace": faq.Workspace,
+		"faqId":     faq.ID,
+	})
+	// Only the question is embedded, like the FAQ class vectorizes it
+	vectors, err := s.embed(ctx, []string{faq.Question})
+	if err != nil {
+		return err
+	}
+	exists, err := s.client.Data().Checker().
+		WithClassName(FAQ_CLASS).
+		WithID(objectID).
+		Do(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		updater := s.client.Data().Updater().
+			WithClassName(FAQ_CLASS).
+			WithID(objectID).
+			WithProperties(properties)
+		if vectors != nil {
+			updater = updater.WithVector(vectors[0])
+		}
+		return updater.Do(ctx)
+	}
+	creator := s.client.Data().Creator().
+		WithClassName(FAQ_CLASS).
+		WithID(objectID).
+		WithProperties(properties)
+	if vectors != nil {
+		creator = creator.WithVector(vectors[0])
+	}
+	_, err = creator.Do(ctx)
+	return err
+}
+
+// DeleteFAQ removes the entry from the index, entries that were never indexed are ignored
+func (s *WeaviateStore) DeleteFAQ(ctx context.Context, id string) error {
+	objectID, err := faqObjectID(id)
+	if err != nil {
+		return err
+	}
+	err = s.client.Data().Deleter().
+		WithClassName(FAQ_CLASS).
+		WithID(objectID).
+		Do(ctx)
+	var clientErr *fault.WeaviateClientError
+	if errors.As(err, &clientErr) && clientErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// MatchFAQ returns the entry whose question is nearest to the given question within
+// maxDistance, among the global entries and those of the workspace. It returns nil without a match.
+func (s *WeaviateStore) MatchFAQ(ctx context.Context, question, workspace string, maxDistance float32) (*types.FAQMatch, error) {
+	get := s.client.GraphQL().Get()
+	limit := faqMatchCandidates
+	if s.faqNullState {
+		visible := []string{""}
+		if workspace != "" {
+			visible = append(visible, workspace)
+		}
+		get = get.WithWhere(workspacesFilter(visible))
+		limit = 1
+	}
+	getBuilder, err := s.withNear(ctx, get.
+		WithClassName(FAQ_CLASS).
+		WithFields(
+			graphql.Field{Name: "question"},
+			graphql.Field{Name: "answer"},
+			graphql.Field{Name: "workspace"},
+			graphql.Field{Name: "faqId"},
+			graphql.Field{Name: "_additional", Fields: []graphql.Field{{Name: "distance"}}},
+		), []string{question}, 0, maxDistance)
+	if err != nil {
+		return nil, err
+	}
+	result, err := getBuilder.
+		WithLimit(limit).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if result.Errors != nil {
+		return nil, fmt.Errorf("faq search failed: %v", result.Errors[0].Message)
+	}
+	data, _ := result.Data["Get"].(map[string]interface{})
+	entries, _ := data[FAQ_CLASS].([]interface{})
+	// Results are sorted by distance, the first visible entry is the best match. Only an
+	// old FAQ class returns entries of other workspaces.
+	for _, item := range entries {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		entryWorkspace := parseString(entry["workspace"])
+		if entryWorkspace != "" && entryWorkspace != workspace {
+			continue
+		}
+		match := &types.FAQMatch{
+			FAQID:    parseString(entry["faqId"]),
+			Question: parseString(entry["question"]),
+			Answer:   parseString(entry["answer"]),
+		}
+		if additional, ok := entry["_additional"].(map[string]interface{}); ok {
+			if distance, ok := additional["distance"].(float64); ok {
+				match.Distance = float32(distance)
+			}
+		}
+		return match, nil
+	}
+	return nil, nil
+}
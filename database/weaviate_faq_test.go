@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+func TestWeaviateMatchFAQFiltersWorkspaceInQuery(t *testing.T) {
+	stub := newWeaviateStub(t, &models.Class{Class: DOCUMENT_CLASS, Properties: DOCUMENT_CLASS_OBJECT.Properties})
+	stub.get[FAQ_CLASS] = []interface{}{map[string]interface{}{
+		"question": "How do I reset my password?", "answer": "Ask IT.", "faqId": "f1",
+		"_additional": map[string]interface{}{"distance": 0.1},
+	}}
+	store := stub.newStore(t)
+	created := stub.classes[len(stub.classes)-1]
+	if !store.faqNullState || created.Class != FAQ_CLASS || !created.InvertedIndexConfig.IndexNullState {
+		t.Fatal("a new FAQ class must index null state")
+	}
+
+	match, err := store.MatchFAQ(context.Background(), "reset password", "DepartmentTechnical", 0.2)
+	if err != nil {
+		t.Fatalf("MatchFAQ: %v", err)
+	}
+	if match == nil || match.FAQID != "f1" || match.Distance != 0.1 {
+		t.Fatalf("match %+v", match)
+	}
+	query := stub.lastQuery()
+	for _, want := range []string{
+		`operator: Or`,
+		`operator: IsNull path: ["workspace"] valueBoolean: true`,
+		`operator: Equal path: ["workspace"] valueString: "DepartmentTechnical"`,
+		`limit: 1`,
+	} {
+		if !strings.Contains(query, want) {
+			t.Errorf("query lacks %s:\n%s", want, query)
+		}
+	}
+
+	// Callers without a workspace only see the global entries
+	if _, err := store.MatchFAQ(context.Background(), "reset password", "", 0.2); err != nil {
+		t.Fatal(err)
+	}
+	if query := stub.lastQuery(); strings.Contains(query, "Equal") || !strings.Contains(query, "IsNull") {
+		t.Errorf("query without workspace:\n%s", query)
+	}
+}
+
+func TestWeaviateMatchFAQFiltersOldClassAfterSearch(t *testing.T) {
+	stub := newWeaviateStub(t,
+		&models.Class{Class: DOCUMENT_CLASS, Properties: DOCUMENT_CLASS_OBJECT.Properties},
+		&models.Class{Class: FAQ_CLASS, Properties: FAQ_CLASS_OBJECT.Properties},
+	)
+	stub.get[FAQ_CLASS] = []interface{}{
+		map[string]interface{}{"question": "Finance only", "workspace": "DepartmentFinance", "faqId": "f1"},
+		map[string]interface{}{"question": "Everyone", "workspace": "", "faqId": "f2"},
+	}
+	store := stub.newStore(t)
+	if store.faqNullState {
+		t.Fatal("an old FAQ class cannot filter for null workspaces")
+	}
+	match, err := store.MatchFAQ(context.Background(), "question", "DepartmentTechnical", 0.2)
+	if err != nil {
+		t.Fatalf("MatchFAQ: %v", err)
+	}
+	if match == nil || match.FAQID != "f2" {
+		t.Fatalf("match %+v, want the global entry f2", match)
+	}
+	if query := stub.lastQuery(); strings.Contains(query, "where") {
+		t.Errorf("old class queried with a filter:\n%s", query)
+	}
+}
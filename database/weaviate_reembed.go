@@ -0,0 +1,258 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// reEmbedClass is a class rebuilt by ReEmbed, with the property that is embedded
+type reEmbedClass struct {
+	class        *models.Class
+	textProperty string
+}
+
+func (s *WeaviateStore) reEmbedClasses() []reEmbedClass {
+	return []reEmbedClass{
+		{s.documentClass, "content"},
+		{s.faqClass, "question"},
+	}
+}
+
+// backupRecord is a line of a ReEmbed backup: an object, or the end record with the
+// number of objects of each class. A backup without the end record was cut short.
+type backupRecord struct {
+	models.Object
+	End map[string]int `json:"backup_end,omitempty"`
+}
+
+// ReEmbed rebuilds the Document and FAQ classes with the vectors of the current
+// embedding model, keeping object IDs and properties. The objects are read and embedded
+// page by page and written with their new vectors to backup as JSON lines, a failing
+// endpoint leaves the classes untouched. The backup ends with the number of objects of
+// each class. The classes are then rebuilt from the backup by Restore, which can be run
+// again with the backup when that fails midway.
+func (s *WeaviateStore) ReEmbed(ctx context.Context, backup io.ReadWriteSeeker) (map[string]int, error) {
+	if s.embedder == nil {
+		return nil, errors.New("no embedding model configured")
+	}
+	writer := bufio.NewWriter(backup)
+	encoder := json.NewEncoder(writer)
+	counts := make(map[string]int)
+	for _, class := range s.reEmbedClasses() {
+		count := 0
+		err := s.eachObjectPage(ctx, class.class.Class, func(page []*models.Object) error {
+			texts := make([]string, len(page))
+			for i, object := range page {
+				properties, _ := object.Properties.(map[string]interface{})
+				texts[i] = parseString(properties[class.textProperty])
+			}
+			vectors, err := s.embed(ctx, texts)
+			if err != nil {
+				return fmt.Errorf("failed to embed %s objects: %w", class.class.Class, err)
+			}
+			for i, object := range page {
+				if err := encoder.Encode(backupObject(object, vectors[i])); err != nil {
+					return fmt.Errorf("failed to write backup: %w", err)
+				}
+			}
+			count += len(page)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		counts[class.class.Class] = count
+		log.Printf("Embedded %d %s objects with %s", count, class.class.Class, s.embedder.Model())
+	}
+	if err := encoder.Encode(backupRecord{End: counts}); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if _, err := backup.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	return s.Restore(ctx, backup)
+}
+
+// backupObject keeps what Restore inserts of an object
+func backupObject(object *models.Object, vector []float32) *models.Object {
+	return &models.Object{
+		Class:      object.Class,
+		ID:         object.ID,
+		Properties: object.Properties,
+		Vector:     vector,
+	}
+}
+
+// Restore recreates the Document and FAQ classes with the objects of a ReEmbed backup,
+// vectors included, reading it one batch at a time. The backup is checked first, one cut
+// short drops nothing. A class is only dropped once the backup reaches its objects. It
+// returns the number of objects per class.
+func (s *WeaviateStore) Restore(ctx context.Context, backup io.ReadSeeker) (map[string]int, error) {
+	classes := make(map[string]*models.Class, 2)
+	for _, class := range s.reEmbedClasses() {
+		classes[class.class.Class] = class.class
+	}
+	if err := checkBackup(backup, classes); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(classes))
+	recreated := make(map[string]bool, len(classes))
+	recreate := func(name string) error {
+		if err := s.client.Schema().ClassDeleter().WithClassName(name).Do(ctx); err != nil {
+			return fmt.Errorf("failed to delete %s class: %w", name, err)
+		}
+		if err := s.client.Schema().ClassCreator().WithClass(classes[name]).Do(ctx); err != nil {
+			return fmt.Errorf("failed to create %s class: %w", name, err)
+		}
+		recreated[name] = true
+		counts[name] = 0
+		if name == FAQ_CLASS {
+			s.faqNullState = true
+		} else {
+			s.documentNullState = true
+		}
+		return nil
+	}
+
+	var batch []*models.Object
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		name := batch[0].Class
+		if err := checkBatch(s.client.Batch().ObjectsBatcher().WithObjects(batch...).Do(ctx)); err != nil {
+			return fmt.Errorf("failed to insert %s objects %d-%d: %w", name, counts[name], counts[name]+len(batch), err)
+		}
+		counts[name] += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	decoder := json.NewDecoder(backup)
+	for line := 1; ; line++ {
+		var record backupRecord
+		if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return counts, fmt.Errorf("invalid backup object %d: %w", line, err)
+		}
+		if record.End != nil {
+			break
+		}
+		object := record.Object
+		if len(batch) > 0 && (batch[0].Class != object.Class || len(batch) == BATCH_SIZE) {
+			if err := flush(); err != nil {
+				return counts, err
+			}
+		}
+		if !recreated[object.Class] {
+			if err := recreate(object.Class); err != nil {
+				return counts, err
+			}
+		}
+		if properties, ok := object.Properties.(map[string]interface{}); ok {
+			object.Properties = withoutEmptyWorkspace(properties)
+		}
+		batch = append(batch, &object)
+	}
+	if err := flush(); err != nil {
+		return counts, err
+	}
+	// Empty classes are recreated too, with the current schema
+	for _, class := range s.reEmbedClasses() {
+		if !recreated[class.class.Class] {
+			if err := recreate(class.class.Class); err != nil {
+				return counts, err
+			}
+		}
+	}
+	return counts, nil
+}
+
+// checkBackup reads the whole backup and rewinds it. It must hold objects of the classes
+// only and end with the end record counting them.
+func checkBackup(backup io.ReadSeeker, classes map[string]*models.Class) error {
+	counts := make(map[string]int, len(classes))
+	var end map[string]int
+	decoder := json.NewDecoder(backup)
+	for line := 1; ; line++ {
+		var record backupRecord
+		if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("invalid backup object %d: %w", line, err)
+		}
+		if end != nil {
+			return fmt.Errorf("invalid backup object %d: after the end of the backup", line)
+		}
+		if record.End != nil {
+			end = record.End
+			continue
+		}
+		if classes[record.Class] == nil {
+			return fmt.Errorf("invalid backup object %d: unknown class %q", line, record.Class)
+		}
+		counts[record.Class]++
+	}
+	if end == nil {
+		return errors.New("incomplete backup: it has no end record, the run writing it failed")
+	}
+	for name := range classes {
+		if counts[name] != end[name] {
+			return fmt.Errorf("incomplete backup: %d %s objects, the end record counts %d", counts[name], name, end[name])
+		}
+	}
+	if _, err := backup.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	return nil
+}
+
+// eachObjectPage pages through every object of the class by ID
+func (s *WeaviateStore) eachObjectPage(ctx context.Context, className string, handle func(page []*models.Object) error) error {
+	after := ""
+	for {
+		getter := s.client.Data().ObjectsGetter().
+			WithClassName(className).
+			WithLimit(BATCH_SIZE)
+		if after != "" {
+			getter = getter.WithAfter(after)
+		}
+		page, err := getter.Do(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read %s objects: %w", className, err)
+		}
+		if len(page) > 0 {
+			if err := handle(page); err != nil {
+				return err
+			}
+		}
+		if len(page) < BATCH_SIZE {
+			return nil
+		}
+		after = page[len(page)-1].ID.String()
+	}
+}
+
+// checkBatch turns the first object error of a batch into an error
+func checkBatch(results []models.ObjectsGetResponse, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Result != nil && result.Result.Errors != nil && len(result.Result.Errors.Error) > 0 {
+			return errors.New(result.Result.Errors.Error[0].Message)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// lengthEmbedder embeds a text to its length and counts the texts it embedded
+type lengthEmbedder struct {
+	embedded int
+	err      error
+}
+
+func (e *lengthEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.embedded += len(texts)
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{float32(len(text)), 1}
+	}
+	return vectors, nil
+}
+
+func (e *lengthEmbedder) Model() string {
+	return "length"
+}
+
+// newReEmbedStub holds documents chunks, more than a page, and an FAQ entry in classes
+// created before null state indexing
+func newReEmbedStub(t *testing.T, documents int) *weaviateStub {
+	t.Helper()
+	stub := newWeaviateStub(t,
+		&models.Class{Class: DOCUMENT_CLASS, Properties: DOCUMENT_CLASS_OBJECT.Properties},
+		&models.Class{Class: FAQ_CLASS, Properties: FAQ_CLASS_OBJECT.Properties},
+	)
+	for i := 0; i < documents; i++ {
+		workspace := ""
+		if i%2 == 1 {
+			workspace = "DepartmentTechnical"
+		}
+		stub.putObject(&models.Object{
+			Class:      DOCUMENT_CLASS,
+			ID:         strfmt.UUID(fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1)),
+			Properties: map[string]interface{}{"content": strings.Repeat("x", i%7+1), "workspace": workspace},
+		})
+	}
+	stub.putObject(&models.Object{
+		Class:      FAQ_CLASS,
+		ID:         "10000000-0000-0000-0000-000000000001",
+		Properties: map[string]interface{}{"question": "How do I reset my password?", "answer": "Ask IT.", "workspace": ""},
+	})
+	return stub
+}
+
+func createBackup(t *testing.T) *os.File {
+	t.Helper()
+	backup, err := os.Create(filepath.Join(t.TempDir(), "backup.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { backup.Close() })
+	return backup
+}
+
+func TestWeaviateReEmbedLeavesClassesWhenEmbeddingFails(t *testing.T) {
+	stub := newReEmbedStub(t, 3)
+	store := stub.newStore(t)
+	store.embedder = &lengthEmbedder{err: errors.New("endpoint down")}
+
+	if _, err := store.ReEmbed(context.Background(), createBackup(t)); err == nil || !strings.Contains(err.Error(), "endpoint down") {
+		t.Fatalf("ReEmbed = %v, want the embedding error", err)
+	}
+	if len(stub.classes) != 2 || len(stub.objects[DOCUMENT_CLASS]) != 3 || len(stub.objects[FAQ_CLASS]) != 1 {
+		t.Errorf("classes or objects changed: %d classes, %d documents, %d FAQs", len(stub.classes), len(stub.objects[DOCUMENT_CLASS]), len(stub.objects[FAQ_CLASS]))
+	}
+}
+
+func TestWeaviateReEmbedFailureIsRestoredFromBackup(t *testing.T) {
+	const documents = BATCH_SIZE + 50
+	stub := newReEmbedStub(t, documents)
+	store := stub.newStore(t)
+	embedder := &lengthEmbedder{}
+	store.embedder = embedder
+	stub.failBatch = func(objects []*models.Object) bool { return objects[0].Class == FAQ_CLASS }
+
+	backup := createBackup(t)
+	if _, err := store.ReEmbed(context.Background(), backup); err == nil || !strings.Contains(err.Error(), "FAQ") {
+		t.Fatalf("ReEmbed = %v, want the FAQ insert error", err)
+	}
+	if embedder.embedded != documents+1 {
+		t.Fatalf("%d texts embedded, want %d", embedder.embedded, documents+1)
+	}
+	// The FAQ class was recreated, its entry only lives in the backup now
+	if len(stub.objects[DOCUMENT_CLASS]) != documents || len(stub.objects[FAQ_CLASS]) != 0 {
+		t.Fatalf("%d documents and %d FAQs after the failure", len(stub.objects[DOCUMENT_CLASS]), len(stub.objects[FAQ_CLASS]))
+	}
+
+	stub.failBatch = nil
+	if _, err := backup.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	if end := fmt.Sprintf(`"backup_end":{"Document":%d,"FAQ":1}`, documents); !strings.Contains(lines[len(lines)-1], end) {
+		t.Fatalf("backup ends with %s", lines[len(lines)-1])
+	}
+	// A backup cut short, or missing an object, drops nothing
+	for name, partial := range map[string][]string{
+		"without end record": lines[:len(lines)-1],
+		"missing an object":  append(slices.Clone(lines[:3]), lines[4:]...),
+	} {
+		if _, err := store.Restore(context.Background(), strings.NewReader(strings.Join(partial, ""))); err == nil || !strings.Contains(err.Error(), "incomplete backup") {
+			t.Errorf("Restore of a backup %s = %v, want an incomplete backup error", name, err)
+		}
+		if len(stub.objects[DOCUMENT_CLASS]) != documents {
+			t.Fatalf("Restore of a backup %s left %d documents", name, len(stub.objects[DOCUMENT_CLASS]))
+		}
+	}
+
+	if _, err := backup.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := store.Restore(context.Background(), backup)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if counts[DOCUMENT_CLASS] != documents || counts[FAQ_CLASS] != 1 || embedder.embedded != documents+1 {
+		t.Fatalf("restored %v with %d texts embedded", counts, embedder.embedded)
+	}
+	faq := stub.objects[FAQ_CLASS][0]
+	if len(faq.Vector) != 2 || faq.Vector[0] != float32(len("How do I reset my password?")) {
+		t.Errorf("FAQ vector %v", faq.Vector)
+	}
+	if _, ok := faq.Properties.(map[string]interface{})["workspace"]; ok {
+		t.Error("the global FAQ entry kept an empty workspace")
+	}
+	for _, class := range stub.classes {
+		if class.InvertedIndexConfig == nil || !class.InvertedIndexConfig.IndexNullState {
+			t.Errorf("class %s recreated without null state index", class.Class)
+		}
+	}
+	if !store.documentNullState || !store.faqNullState {
+		t.Error("the store does not filter the recreated classes by null workspace")
+	}
+}
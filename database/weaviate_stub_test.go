@@ -0,0 +1,138 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// weaviateStub fakes the meta, schema, GraphQL, object listing and batch endpoints of Weaviate.
+// GraphQL queries are recorded and answered with the canned Get data, objects are kept
+// per class and sorted by ID.
+type weaviateStub struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	classes []*models.Class
+	queries []string
+	get     map[string]interface{}
+	objects map[string][]*models.Object
+	// failBatch, when set, fails the batches it returns true for
+	failBatch func(objects []*models.Object) bool
+}
+
+func newWeaviateStub(t *testing.T, classes ...*models.Class) *weaviateStub {
+	t.Helper()
+	stub := &weaviateStub{classes: classes, get: make(map[string]interface{}), objects: make(map[string][]*models.Object)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/schema", func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		json.NewEncoder(w).Encode(models.Schema{Classes: stub.classes})
+	})
+	mux.HandleFunc("POST /v1/schema", func(w http.ResponseWriter, r *http.Request) {
+		var class models.Class
+		if err := json.NewDecoder(r.Body).Decode(&class); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		stub.classes = append(stub.classes, &class)
+		stub.mu.Unlock()
+		json.NewEncoder(w).Encode(class)
+	})
+	// The client only pages by class on servers it knows the version of
+	mux.HandleFunc("GET /v1/meta", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.Meta{Version: "1.27.0"})
+	})
+	mux.HandleFunc("DELETE /v1/schema/{class}", func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		name := r.PathValue("class")
+		stub.classes = slices.DeleteFunc(stub.classes, func(class *models.Class) bool { return class.Class == name })
+		delete(stub.objects, name)
+	})
+	mux.HandleFunc("GET /v1/objects", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		page := []*models.Object{}
+		for _, object := range stub.objects[query.Get("class")] {
+			if object.ID.String() > query.Get("after") && len(page) < limit {
+				page = append(page, object)
+			}
+		}
+		json.NewEncoder(w).Encode(models.ObjectsListResponse{Objects: page})
+	})
+	mux.HandleFunc("POST /v1/batch/objects", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Objects []*models.Object `json:"objects"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		if stub.failBatch != nil && stub.failBatch(body.Objects) {
+			http.Error(w, `{"error":[{"message":"batch failed"}]}`, http.StatusInternalServerError)
+			return
+		}
+		results := make([]models.ObjectsGetResponse, len(body.Objects))
+		for i, object := range body.Objects {
+			stub.putObject(object)
+			results[i].Object = *object
+		}
+		json.NewEncoder(w).Encode(results)
+	})
+	mux.HandleFunc("POST /v1/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var query models.GraphQLQuery
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		stub.queries = append(stub.queries, query.Query)
+		json.NewEncoder(w).Encode(models.GraphQLResponse{Data: map[string]models.JSONObject{"Get": stub.get}})
+	})
+	stub.server = httptest.NewServer(mux)
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+// newStore connects a WeaviateStore to the stub with Weaviate vectorizing the texts
+func (s *weaviateStub) newStore(t *testing.T) *WeaviateStore {
+	t.Helper()
+	store, err := NewWeaviateStore(config.WeaviateStoreConfig{Host: s.server.URL, Text2Vec: "none"})
+	if err != nil {
+		t.Fatalf("NewWeaviateStore: %v", err)
+	}
+	return store
+}
+
+// putObject stores the object in ID order, the caller holds the lock
+func (s *weaviateStub) putObject(object *models.Object) {
+	objects := slices.DeleteFunc(s.objects[object.Class], func(o *models.Object) bool { return o.ID == object.ID })
+	objects = append(objects, object)
+	slices.SortFunc(objects, func(a, b *models.Object) int { return strings.Compare(a.ID.String(), b.ID.String()) })
+	s.objects[object.Class] = objects
+}
+
+func (s *weaviateStub) lastQuery() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queries) == 0 {
+		return ""
+	}
+	return s.queries[len(s.queries)-1]
+}
@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// auditEvent describes the request for the audit log, the actor comes from the JWT claims
+func auditEvent(c *gin.Context, action, targetType, targetID string, err error) *types.AuditEvent {
+	return service.NewAuditEvent(c.Request.Context(), c.ClientIP(), c.Request.UserAgent(), action, targetType, targetID, err)
+}
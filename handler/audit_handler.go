@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+type AuditHandler interface {
+	HandleListEvents(c *gin.Context)
+	HandleExportEvents(c *gin.Context)
+}
+
+type auditHandler struct {
+	auditService service.AuditService
+}
+
+func NewAuditHandler(auditService service.AuditService) AuditHandler {
+	return &auditHandler{
+		auditService: auditService,
+	}
+}
+
+func bindAuditFilter(c *gin.Context) (types.AuditFilter, bool) {
+	var filter types.AuditFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid filter parameters",
+		})
+		return filter, false
+	}
+	return filter, true
+}
+
+func (h *auditHandler) HandleListEvents(c *gin.Context) {
+	opts, ok := bindListOptions(c)
+	if !ok {
+		return
+	}
+	filter, ok := bindAuditFilter(c)
+	if !ok {
+		return
+	}
+	events, page, err := h.auditService.ListEvents(c, filter, opts)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, events, page)
+}
+
+func (h *auditHandler) HandleExportEvents(c *gin.Context) {
+	filter, ok := bindAuditFilter(c)
+	if !ok {
+		return
+	}
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_AUDIT_EXPORT, "", "", nil))
+
+	filename := fmt.Sprintf("audit-%s.jsonl", time.Now().Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	// The events are streamed, a failure past this point can only cut the file short
+	if err := h.auditService.ExportEvents(c.Request.Context(), filter, c.Writer); err != nil {
+		log.Printf("Failed to export audit events: %v", err)
+	}
+}
@@ -1,7 +1,12 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/tieubaoca/chatbot-be/service"
@@ -9,16 +14,26 @@ import (
 )
 
 type ChatHandler struct {
-	aiService *service.OpenAIService
+	router          *service.ModelRouter
+	taskTools       *service.TaskTools
+	auditService    service.AuditService
+	feedbackService service.FeedbackService
 }
 
-func NewChatHandler(aiService *service.OpenAIService) *ChatHandler {
+func NewChatHandler(router *service.ModelRouter, taskTools *service.TaskTools, auditService service.AuditService, feedbackService service.FeedbackService) *ChatHandler {
 	return &ChatHandler{
-		aiService: aiService,
+		router:          router,
+		taskTools:       taskTools,
+		auditService:    auditService,
+		feedbackService: feedbackService,
 	}
 }
 
 func (h *ChatHandler) HandleChat(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
 
 	var chatRequest types.ChatRequest
 	if err := c.ShouldBindJSON(&chatRequest); err != nil {
@@ -26,9 +41,34 @@ func (h *ChatHandler) HandleChat(c *gin.Context) {
 			Status:  false,
 			Message: "Invalid request body",
 		})
+		return
 	}
 
-	response, err := h.aiService.Chat(c, chatRequest.Messages)
+	startedAt := time.Now().Unix()
+	// The request context carries the caller's claims the task tools are scoped to
+	response, err := h.router.Chat(c.Request.Context(), chatRequest.Model, chatRequest.Messages)
+	h.auditService.Record(c.Request.Context(),
+		service.NewChatAuditEvent(c.Request.Context(), c.ClientIP(), c.Request.UserAgent(), chatRequest.Messages, err))
+	var quotaErr *service.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		c.Header("Retry-After", strconv.FormatInt(quotaErr.RetryAfter, 10))
+		c.JSON(http.StatusTooManyRequests, types.DataResponse{
+			Status:  false,
+			Message: fmt.Sprintf("You have used up your %s token quota", quotaErr.Period),
+		})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidArgument) || errors.Is(err, service.ErrPermissionDenied) {
+		writeServiceError(c, err)
+		return
+	}
+	if errors.Is(err, service.ErrModelsUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, types.DataResponse{
+			Status:  false,
+			Message: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.DataResponse{
 			Status:  false,
@@ -37,13 +77,94 @@ func (h *ChatHandler) HandleChat(c *gin.Context) {
 		return
 	}
 
+	// The answer is still returned when it cannot be stored, it just cannot be rated
+	if err := h.feedbackService.RecordAnswer(c.Request.Context(), claims, chatRequest.ChatId, chatRequest.Messages, response); err != nil {
+		log.Printf("Failed to record answer for %s: %v", claims.Username, err)
+	}
+
 	c.JSON(http.StatusOK,
 		types.DataResponse{
 			Status: true,
 			Data: types.ChatResponse{
-				Message: response,
+				ChatId:         chatRequest.ChatId,
+				Message:        response,
+				PendingActions: h.taskTools.PendingActions(claims, startedAt),
 			},
 		},
 	)
 
 }
+
+// HandleListModels lists the models a chat request can ask for
+func (h *ChatHandler) HandleListModels(c *gin.Context) {
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   h.router.Models(c.Request.Context()),
+	})
+}
+
+func (h *ChatHandler) HandleListActions(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   h.taskTools.PendingActions(claims, 0),
+	})
+}
+
+func (h *ChatHandler) HandleConfirmAction(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	result, err := h.taskTools.ConfirmAction(c.Request.Context(), claims, c.Param("id"))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   result,
+	})
+}
+
+func (h *ChatHandler) HandleDiscardAction(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	if err := h.taskTools.DiscardAction(claims, c.Param("id")); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status:  true,
+		Message: "Action discarded",
+	})
+}
+
+func (h *ChatHandler) HandleRateAnswer(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	var req types.AnswerFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	answer, err := h.feedbackService.RateAnswer(c.Request.Context(), claims, c.Param("id"), req)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   answer,
+	})
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+type DocumentManageHandler interface {
+	HandleListDocuments(c *gin.Context)
+	HandleListDeletedDocuments(c *gin.Context)
+	HandleDeleteDocument(c *gin.Context)
+	HandleDeleteWorkspaceDocument(c *gin.Context)
+	HandleRestoreDocument(c *gin.Context)
+}
+
+type documentManageHandler struct {
+	documentService service.DocumentService
+	auditService    service.AuditService
+}
+
+func NewDocumentManageHandler(documentService service.DocumentService, auditService service.AuditService) DocumentManageHandler {
+	return &documentManageHandler{
+		documentService: documentService,
+		auditService:    auditService,
+	}
+}
+
+func (h *documentManageHandler) HandleListDocuments(c *gin.Context) {
+	opts, ok := bindListOptions(c)
+	if !ok {
+		return
+	}
+	var filter types.DocumentFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid filter parameters",
+		})
+		return
+	}
+	docs, page, err := h.documentService.ListDocuments(c, filter, opts)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, docs, page)
+}
+
+func (h *documentManageHandler) HandleListDeletedDocuments(c *gin.Context) {
+	opts, ok := bindListOptions(c)
+	if !ok {
+		return
+	}
+	docs, page, err := h.documentService.ListDeletedDocuments(c, opts)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, docs, page)
+}
+
+func (h *documentManageHandler) HandleDeleteDocument(c *gin.Context) {
+	err := h.documentService.DeleteDocument(c, c.Param("id"), adminUsername(c))
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_DOCUMENT_DELETE, types.AUDIT_TARGET_DOCUMENT, c.Param("id"), err))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+	})
+}
+
+// HandleDeleteWorkspaceDocument lets a user with PermissionDocumentsDelete remove a document of their workspace
+func (h *documentManageHandler) HandleDeleteWorkspaceDocument(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	err := h.documentService.DeleteWorkspaceDocument(c, claims, c.Param("id"))
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_DOCUMENT_DELETE, types.AUDIT_TARGET_DOCUMENT, c.Param("id"), err))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+	})
+}
+
+func (h *documentManageHandler) HandleRestoreDocument(c *gin.Context) {
+	err := h.documentService.RestoreDocument(c, c.Param("id"))
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_DOCUMENT_RESTORE, types.AUDIT_TARGET_DOCUMENT, c.Param("id"), err))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+	})
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/middleware"
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// writeServiceError maps the service sentinel errors to HTTP status codes
+func writeServiceError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrPermissionDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, repository.ErrInvalidListOptions):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrConflict):
+		status = http.StatusConflict
+	}
+	c.JSON(status, types.DataResponse{
+		Status:  false,
+		Message: err.Error(),
+	})
+}
+
+// mustUserClaims returns the caller's claims or writes a 401 and returns false
+func mustUserClaims(c *gin.Context) (*utils.UserClaims, bool) {
+	claims, ok := middleware.GetUserClaims(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, types.DataResponse{
+			Status:  false,
+			Message: "Authentication required",
+		})
+	}
+	return claims, ok
+}
+
+// adminUsername names the admin making the request, for deleted_by and similar fields
+func adminUsername(c *gin.Context) string {
+	if claims, ok := middleware.GetAdminClaims(c.Request.Context()); ok {
+		return claims.Username
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+type FAQHandler interface {
+	HandleCreateFAQ(c *gin.Context)
+	HandleListFAQs(c *gin.Context)
+	HandleGetFAQ(c *gin.Context)
+	HandleUpdateFAQ(c *gin.Context)
+	HandleDeleteFAQ(c *gin.Context)
+}
+
+type faqHandler struct {
+	faqService   service.FAQService
+	auditService service.AuditService
+}
+
+func NewFAQHandler(faqService service.FAQService, auditService service.AuditService) FAQHandler {
+	return &faqHandler{
+		faqService:   faqService,
+		auditService: auditService,
+	}
+}
+
+func (h *faqHandler) HandleCreateFAQ(c *gin.Context) {
+	var req types.FAQRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	faq, err := h.faqService.CreateFAQ(c, req, adminUsername(c))
+	targetID := ""
+	if err == nil {
+		targetID = faq.ID
+	}
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_FAQ_CREATE, types.AUDIT_TARGET_FAQ, targetID, err))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   faq,
+	})
+}
+
+func (h *faqHandler) HandleListFAQs(c *gin.Context) {
+	opts, ok := bindListOptions(c)
+	if !ok {
+		return
+	}
+	var filter types.FAQFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid filter parameters",
+		})
+		return
+	}
+	faqs, page, err := h.faqService.ListFAQs(c, filter, opts)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, faqs, page)
+}
+
+func (h *faqHandler) HandleGetFAQ(c *gin.Context) {
+	faq, err := h.faqService.GetFAQ(c, c.Param("id"))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   faq,
+	})
+}
+
+func (h *faqHandler) HandleUpdateFAQ(c *gin.Context) {
+	var req types.FAQRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	faq, err := h.faqService.UpdateFAQ(c, c.Param("id"), req, adminUsername(c))
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_FAQ_UPDATE, types.AUDIT_TARGET_FAQ, c.Param("id"), err))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   faq,
+	})
+}
+
+func (h *faqHandler) HandleDeleteFAQ(c *gin.Context) {
+	err := h.faqService.DeleteFAQ(c, c.Param("id"))
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_FAQ_DELETE, types.AUDIT_TARGET_FAQ, c.Param("id"), err))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+	})
+}
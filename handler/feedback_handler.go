@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// FeedbackHandler serves the admin review queue of negatively rated answers
+type FeedbackHandler interface {
+	HandleListReviewQueue(c *gin.Context)
+	HandleReviewAnswer(c *gin.Context)
+	HandleIngestCorrection(c *gin.Context)
+}
+
+type feedbackHandler struct {
+	feedbackService service.FeedbackService
+	auditService    service.AuditService
+}
+
+func NewFeedbackHandler(feedbackService service.FeedbackService, auditService service.AuditService) FeedbackHandler {
+	return &feedbackHandler{
+		feedbackService: feedbackService,
+		auditService:    auditService,
+	}
+}
+
+func (h *feedbackHandler) HandleListReviewQueue(c *gin.Context) {
+	opts, ok := bindListOptions(c)
+	if !ok {
+		return
+	}
+	var filter types.AnswerReviewFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid filter parameters",
+		})
+		return
+	}
+	answers, page, err := h.feedbackService.ListReviewQueue(c, filter, opts)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, answers, page)
+}
+
+func (h *feedbackHandler) HandleReviewAnswer(c *gin.Context) {
+	var req types.AnswerReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	answer, err := h.feedbackService.ReviewAnswer(c, c.Param("id"), req, adminUsername(c))
+	event := auditEvent(c, types.AUDIT_ACTION_FEEDBACK_REVIEW, types.AUDIT_TARGET_ANSWER, c.Param("id"), err)
+	event.Details = map[string]string{"status": req.Status}
+	h.auditService.Record(c.Request.Context(), event)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   answer,
+	})
+}
+
+func (h *feedbackHandler) HandleIngestCorrection(c *gin.Context) {
+	record, err := h.feedbackService.IngestCorrection(c, c.Param("id"))
+	event := auditEvent(c, types.AUDIT_ACTION_FEEDBACK_INGEST, types.AUDIT_TARGET_ANSWER, c.Param("id"), err)
+	if err == nil {
+		event.Details = map[string]string{"document_id": record.ID}
+	}
+	h.auditService.Record(c.Request.Context(), event)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   record,
+	})
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+type JWKSHandler struct{}
+
+func NewJWKSHandler() *JWKSHandler {
+	return &JWKSHandler{}
+}
+
+// HandleJWKS publishes the public signing keys so other services can verify our tokens
+func (h *JWKSHandler) HandleJWKS(c *gin.Context) {
+	keys := utils.PublicJWKS()
+	if keys == nil {
+		keys = []utils.JWK{}
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// bindListOptions reads page, limit, sort, cursor and q from the query string,
+// writing a 400 and returning false when they are malformed
+func bindListOptions(c *gin.Context) (types.ListOptions, bool) {
+	var opts types.ListOptions
+	if err := c.ShouldBindQuery(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid list parameters",
+		})
+		return opts, false
+	}
+	return opts, true
+}
+
+// writeList answers a list endpoint with a PaginateResponse in a DataResponse
+func writeList(c *gin.Context, elements interface{}, page types.PageInfo) {
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   types.NewPaginateResponse(elements, page),
+	})
+}
+
+// singlePage describes an unpaginated list of n elements
+func singlePage(n int) types.PageInfo {
+	return types.PageInfo{Total: int64(n), Page: 1, Limit: int64(n)}
+}
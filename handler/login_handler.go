@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/tieubaoca/chatbot-be/service"
@@ -14,12 +17,14 @@ type LoginHandler interface {
 }
 
 type loginHandler struct {
-	userService service.UserService
+	loginService service.LoginService
+	auditService service.AuditService
 }
 
-func NewLoginHandler(userService service.UserService) LoginHandler {
+func NewLoginHandler(loginService service.LoginService, auditService service.AuditService) LoginHandler {
 	return &loginHandler{
-		userService: userService,
+		loginService: loginService,
+		auditService: auditService,
 	}
 }
 
@@ -34,19 +39,37 @@ func (h *loginHandler) HandleLogin(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetUserByUsername(c, req.Username)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, types.DataResponse{
-			Status:  false,
-			Message: err.Error(),
-		})
-		return
+	user, err := h.loginService.Login(c, req, c.ClientIP(), c.Request.UserAgent())
+	event := auditEvent(c, types.AUDIT_ACTION_LOGIN, types.AUDIT_TARGET_USER, "", err)
+	// The caller has no token yet, the actor is the username they claim
+	event.Actor = req.Username
+	if err == nil {
+		event.ActorID = user.ID
+		event.TargetID = user.ID
+		event.Workspace = user.Workspace
 	}
-	if user.Password != req.Password {
-		c.JSON(http.StatusUnauthorized, types.DataResponse{
-			Status:  false,
-			Message: "Invalid password",
-		})
+	h.auditService.Record(c.Request.Context(), event)
+	if err != nil {
+		var lockedErr *service.LoginLockedError
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, types.DataResponse{
+				Status:  false,
+				Message: "Invalid username or password",
+			})
+		case errors.As(err, &lockedErr):
+			c.Header("Retry-After", strconv.FormatInt(lockedErr.RetryAfter, 10))
+			c.JSON(http.StatusTooManyRequests, types.DataResponse{
+				Status:  false,
+				Message: "Too many failed login attempts, try again later",
+			})
+		default:
+			log.Println("Login error:", err)
+			c.JSON(http.StatusInternalServerError, types.DataResponse{
+				Status:  false,
+				Message: "Login failed",
+			})
+		}
 		return
 	}
 	token, err := utils.GenerateUserToken(user)
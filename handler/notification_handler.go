@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+type NotificationHandler interface {
+	HandleListNotifications(c *gin.Context)
+	HandleMarkRead(c *gin.Context)
+	HandleMarkAllRead(c *gin.Context)
+}
+
+type notificationHandler struct {
+	notificationService service.NotificationService
+}
+
+func NewNotificationHandler(notificationService service.NotificationService) NotificationHandler {
+	return &notificationHandler{
+		notificationService: notificationService,
+	}
+}
+
+func (h *notificationHandler) HandleListNotifications(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	opts, ok := bindListOptions(c)
+	if !ok {
+		return
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications, page, err := h.notificationService.ListNotifications(c, claims, unreadOnly, opts)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, notifications, page)
+}
+
+func (h *notificationHandler) HandleMarkRead(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	if err := h.notificationService.MarkRead(c, claims, c.Param("id")); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status:  true,
+		Message: "Notification marked as read",
+	})
+}
+
+func (h *notificationHandler) HandleMarkAllRead(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	if err := h.notificationService.MarkAllRead(c, claims); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status:  true,
+		Message: "All notifications marked as read",
+	})
+}
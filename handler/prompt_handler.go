@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+type PromptHandler interface {
+	HandleSavePrompt(c *gin.Context)
+	HandleListPrompts(c *gin.Context)
+	HandleGetPrompt(c *gin.Context)
+	HandleCurrentPrompt(c *gin.Context)
+	HandleRestorePrompt(c *gin.Context)
+	HandlePreviewPrompt(c *gin.Context)
+}
+
+type promptHandler struct {
+	promptService service.PromptService
+	auditService  service.AuditService
+}
+
+func NewPromptHandler(promptService service.PromptService, auditService service.AuditService) PromptHandler {
+	return &promptHandler{
+		promptService: promptService,
+		auditService:  auditService,
+	}
+}
+
+func (h *promptHandler) HandleSavePrompt(c *gin.Context) {
+	var req types.PromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	prompt, err := h.promptService.SavePrompt(c, req, adminUsername(c))
+	targetID := ""
+	if err == nil {
+		targetID = prompt.ID
+	}
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_PROMPT_SAVE, types.AUDIT_TARGET_PROMPT, targetID, err))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   prompt,
+	})
+}
+
+func (h *promptHandler) HandleListPrompts(c *gin.Context) {
+	opts, ok := bindListOptions(c)
+	if !ok {
+		return
+	}
+	var filter types.PromptTemplateFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid filter parameters",
+		})
+		return
+	}
+	prompts, page, err := h.promptService.ListPrompts(c, filter, opts)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, prompts, page)
+}
+
+func (h *promptHandler) HandleGetPrompt(c *gin.Context) {
+	prompt, err := h.promptService.GetPrompt(c, c.Param("id"))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   prompt,
+	})
+}
+
+// HandleCurrentPrompt returns the template in effect for the kind and workspace query parameters
+func (h *promptHandler) HandleCurrentPrompt(c *gin.Context) {
+	prompt, err := h.promptService.CurrentPrompt(c, c.Query("kind"), c.Query("workspace"))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   prompt,
+	})
+}
+
+func (h *promptHandler) HandleRestorePrompt(c *gin.Context) {
+	prompt, err := h.promptService.RestorePrompt(c, c.Param("id"), adminUsername(c))
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_PROMPT_RESTORE, types.AUDIT_TARGET_PROMPT, c.Param("id"), err))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   prompt,
+	})
+}
+
+func (h *promptHandler) HandlePreviewPrompt(c *gin.Context) {
+	var req types.PromptPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	content, err := h.promptService.PreviewPrompt(c, req)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   types.PromptPreviewResponse{Content: content},
+	})
+}
@@ -6,16 +6,23 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/service"
 	"github.com/tieubaoca/chatbot-be/types"
 )
 
 type SearchHandler struct {
-	vectorDB *database.WeaviateStore
+	vectorDB      database.VectorDatabase
+	retriever     *service.Retriever
+	promptService service.PromptService
+	auditService  service.AuditService
 }
 
-func NewSearchHandler(vectorDB *database.WeaviateStore) *SearchHandler {
+func NewSearchHandler(vectorDB database.VectorDatabase, retriever *service.Retriever, promptService service.PromptService, auditService service.AuditService) *SearchHandler {
 	return &SearchHandler{
-		vectorDB: vectorDB,
+		vectorDB:      vectorDB,
+		retriever:     retriever,
+		promptService: promptService,
+		auditService:  auditService,
 	}
 }
 
@@ -51,6 +58,39 @@ func (h *SearchHandler) HandleSearch(c *gin.Context) {
 	})
 }
 
+// HandlePlannedSearch plans search queries from the question, searches them together with
+// the given queries and fuses the results, within the workspaces visible to the caller
+func (h *SearchHandler) HandlePlannedSearch(c *gin.Context) {
+
+	var req types.PlannedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if req.Limit == 0 {
+		req.Limit = 5
+	}
+
+	ctx := c.Request.Context()
+	metadata := types.Metadata{Tags: req.Tags, Workspaces: service.VisibleWorkspaces(ctx)}
+	plan, docs, err := h.retriever.Retrieve(ctx, []types.Message{{Role: "user", Content: req.Question}}, req.Queries, metadata, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.DataResponse{
+			Status:  false,
+			Message: "Search failed: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   types.SearchResponse{Documents: docs, Queries: plan.Queries},
+	})
+}
+
 func (h *SearchHandler) HandleAskAI(c *gin.Context) {
 
 	var req types.AskAIWithRAGRequest
@@ -62,8 +102,26 @@ func (h *SearchHandler) HandleAskAI(c *gin.Context) {
 		return
 	}
 
+	// Without client queries the server plans them from the question
+	queries := req.SearchRequest.Queries
+	var planned []string
+	if len(queries) == 0 {
+		plan := h.retriever.Plan(c.Request.Context(), []types.Message{{Role: "user", Content: req.Question}})
+		queries, planned = plan.Queries, plan.Queries
+	}
+
+	data := service.PromptDataFromContext(c.Request.Context())
+	data.Question = req.Question
+	prompt, err := h.promptService.Render(c.Request.Context(), types.PROMPT_KIND_ASK_AI, data)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
 	// Search documents
-	docs, err := h.vectorDB.AskAI(context.Background(), req.Question, req.SearchRequest.Queries, types.Metadata{Tags: req.SearchRequest.Tags}, req.SearchRequest.Limit)
+	docs, err := h.vectorDB.AskAI(context.Background(), prompt, queries, types.Metadata{Tags: req.SearchRequest.Tags}, req.SearchRequest.Limit)
+	h.auditService.Record(c.Request.Context(),
+		service.NewQuestionAuditEvent(c.Request.Context(), c.ClientIP(), c.Request.UserAgent(), req.Question, err))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.DataResponse{
 			Status:  false,
@@ -73,7 +131,7 @@ func (h *SearchHandler) HandleAskAI(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, types.DataResponse{
 		Status: true,
-		Data:   types.SearchResponse{Documents: docs},
+		Data:   types.SearchResponse{Documents: docs, Queries: planned},
 	})
 
 }
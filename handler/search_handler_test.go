@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// flatEmbedder embeds every text to the same vector, all chunks are equally near
+type flatEmbedder struct{}
+
+func (flatEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i] = []float32{1, 1}
+	}
+	return vectors, nil
+}
+
+func (flatEmbedder) Model() string {
+	return "flat"
+}
+
+// fixedPlanner plans the question and the given variants
+type fixedPlanner struct {
+	variants []string
+}
+
+func (p fixedPlanner) PlanQueries(ctx context.Context, conversation []types.Message, variants int) (*types.QueryPlan, error) {
+	return &types.QueryPlan{Question: conversation[len(conversation)-1].Content, Queries: p.variants}, nil
+}
+
+func newSearchTestHandler(t *testing.T) *SearchHandler {
+	t.Helper()
+	store, err := database.NewMemoryStore(flatEmbedder{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []types.Document{
+		{Content: "Leave policy", Metadata: types.Metadata{Title: "Handbook", Tags: []string{"hr"}}},
+		{Content: "On-call leave", Metadata: types.Metadata{Title: "On-call", Tags: []string{"hr"}, Workspace: "DepartmentTechnical"}},
+		{Content: "Closing leave", Metadata: types.Metadata{Title: "Closing", Workspace: "DepartmentFinance"}},
+	}
+	if err := store.BatchInsertDocuments(context.Background(), docs, [][]float32{{1, 1}, {1, 1}, {1, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	retriever := service.NewRetriever(fixedPlanner{variants: []string{"annual leave"}}, store, config.RetrievalConfig{CandidatesPerQuery: 5, RRFK: 60})
+	return NewSearchHandler(store, retriever, nil, nil)
+}
+
+// serveSearch posts body to the handler as the given user
+func serveSearch(t *testing.T, handle gin.HandlerFunc, claims *utils.UserClaims, body string) types.SearchResponse {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/search", func(c *gin.Context) {
+		if claims != nil {
+			c.Request = c.Request.WithContext(utils.ContextWithUserClaims(c.Request.Context(), claims))
+		}
+	}, handle)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Data types.SearchResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response.Data
+}
+
+// documentTitles lists the sorted titles, equally near chunks come in any order
+func documentTitles(docs []types.Document) string {
+	titles := make([]string, len(docs))
+	for i, doc := range docs {
+		titles[i] = doc.Metadata.Title
+	}
+	slices.Sort(titles)
+	return strings.Join(titles, ",")
+}
+
+func TestHandleSearchSearchesQueriesAsGiven(t *testing.T) {
+	h := newSearchTestHandler(t)
+	staff := &utils.UserClaims{Workspace: "DepartmentTechnical", WorkspaceRole: types.USER_WORKSPACE_ROLE_STAFF}
+
+	got := serveSearch(t, h.HandleSearch, staff, `{"queries":["leave"],"tags":["hr"]}`)
+	if titles := documentTitles(got.Documents); titles != "Handbook,On-call" || got.Queries != nil {
+		t.Errorf("documents %s, queries %v", titles, got.Queries)
+	}
+	got = serveSearch(t, h.HandleSearch, staff, `{"queries":["leave"],"limit":1}`)
+	if len(got.Documents) != 1 {
+		t.Errorf("%d documents, want 1", len(got.Documents))
+	}
+}
+
+func TestHandlePlannedSearchScopesToCallerWorkspace(t *testing.T) {
+	h := newSearchTestHandler(t)
+	body := `{"question":"How many leave days?","queries":["leave days"]}`
+
+	staff := &utils.UserClaims{Workspace: "DepartmentTechnical", WorkspaceRole: types.USER_WORKSPACE_ROLE_STAFF}
+	got := serveSearch(t, h.HandlePlannedSearch, staff, body)
+	if titles := documentTitles(got.Documents); titles != "Handbook,On-call" {
+		t.Errorf("staff found %s, want Handbook,On-call", titles)
+	}
+	if queries := strings.Join(got.Queries, "|"); queries != "How many leave days?|annual leave|leave days" {
+		t.Errorf("queries %s", queries)
+	}
+
+	executive := &utils.UserClaims{Workspace: "DepartmentTechnical", WorkspaceRole: types.USER_WORKSPACE_ROLE_EXECUTIVE}
+	if got := serveSearch(t, h.HandlePlannedSearch, executive, body); len(got.Documents) != 3 {
+		t.Errorf("executive found %v, want every workspace", documentTitles(got.Documents))
+	}
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+type TaskHandler interface {
+	HandleCreateTask(c *gin.Context)
+	HandleListTasks(c *gin.Context)
+	HandleGetTask(c *gin.Context)
+	HandleAssignTask(c *gin.Context)
+	HandleReportTask(c *gin.Context)
+	HandleTransitionTask(c *gin.Context)
+	HandleGetTaskHistory(c *gin.Context)
+	HandleAddComment(c *gin.Context)
+	HandleListComments(c *gin.Context)
+}
+
+type taskHandler struct {
+	taskService service.TaskService
+}
+
+func NewTaskHandler(taskService service.TaskService) TaskHandler {
+	return &taskHandler{
+		taskService: taskService,
+	}
+}
+
+func (h *taskHandler) HandleCreateTask(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	var req types.CreateTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	task, err := h.taskService.CreateTask(c, claims, req)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   task,
+	})
+}
+
+func (h *taskHandler) HandleListTasks(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	filter := types.TaskFilter{
+		Workspace: c.Query("workspace"),
+		Assignee:  c.Query("assignee"),
+		Reporter:  c.Query("reporter"),
+	}
+	if status := c.Query("status"); status != "" {
+		filter.Status = strings.Split(status, ",")
+	}
+	filter.Deadline, _ = strconv.ParseInt(c.Query("deadline_before"), 10, 64)
+	opts, ok := bindListOptions(c)
+	if !ok {
+		return
+	}
+
+	tasks, page, err := h.taskService.ListTasks(c, claims, filter, opts)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, tasks, page)
+}
+
+func (h *taskHandler) HandleGetTask(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	task, err := h.taskService.GetTask(c, claims, c.Param("id"))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   task,
+	})
+}
+
+func (h *taskHandler) HandleAssignTask(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	var req types.AssignTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Assignee == "" {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	task, err := h.taskService.AssignTask(c, claims, c.Param("id"), req.Assignee)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   task,
+	})
+}
+
+func (h *taskHandler) HandleReportTask(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	var req types.ReportTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	task, err := h.taskService.ReportTask(c, claims, c.Param("id"), req.Report)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   task,
+	})
+}
+
+func (h *taskHandler) HandleTransitionTask(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	var req types.TransitionTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	task, err := h.taskService.TransitionTask(c, claims, c.Param("id"), req.Status)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   task,
+	})
+}
+
+func (h *taskHandler) HandleGetTaskHistory(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	task, err := h.taskService.GetTask(c, claims, c.Param("id"))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	history := task.History
+	if history == nil {
+		history = []types.TaskHistory{}
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   history,
+	})
+}
+
+func (h *taskHandler) HandleAddComment(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	var req types.CreateTaskCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	comment, err := h.taskService.AddComment(c, claims, c.Param("id"), req)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   comment,
+	})
+}
+
+func (h *taskHandler) HandleListComments(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	comments, err := h.taskService.ListComments(c, claims, c.Param("id"))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   comments,
+	})
+}
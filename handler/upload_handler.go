@@ -5,17 +5,20 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/middleware"
 	services "github.com/tieubaoca/chatbot-be/service"
 	"github.com/tieubaoca/chatbot-be/types"
 )
 
 type UploadHandler struct {
-	fileService *services.FileService
+	fileService  *services.FileService
+	auditService services.AuditService
 }
 
-func NewUploadHandler(fileService *services.FileService) *UploadHandler {
+func NewUploadHandler(fileService *services.FileService, auditService services.AuditService) *UploadHandler {
 	return &UploadHandler{
-		fileService: fileService,
+		fileService:  fileService,
+		auditService: auditService,
 	}
 }
 
@@ -42,6 +45,20 @@ func (h *UploadHandler) UploadDocumentHandler(c *gin.Context) {
 		return
 	}
 
+	// Users without global rights may only upload to their own workspace's corpus
+	if claims, ok := middleware.GetUserClaims(c.Request.Context()); ok {
+		if req.Workspace == "" {
+			req.Workspace = claims.Workspace
+		}
+		if !claims.CanAccessWorkspace(req.Workspace) {
+			c.JSON(http.StatusForbidden, types.DataResponse{
+				Status:  false,
+				Message: "Cannot upload to another workspace",
+			})
+			return
+		}
+	}
+
 	const maxSize = 10 << 20
 	if header.Size > maxSize {
 		c.JSON(http.StatusBadRequest, types.DataResponse{
@@ -55,8 +72,17 @@ func (h *UploadHandler) UploadDocumentHandler(c *gin.Context) {
 	errChan := make(chan error)
 	defer close(statusChan)
 	defer close(errChan)
+	// The upload outlives the request when the client disconnects, so the audit
+	// event is built from values captured now
+	ctx, ip, userAgent := c.Request.Context(), c.ClientIP(), c.Request.UserAgent()
+	var documentID string
 	go func() {
-		errChan <- h.fileService.UploadFile(req, header, statusChan)
+		id, err := h.fileService.UploadFile(req, header, statusChan)
+		event := services.NewAuditEvent(ctx, ip, userAgent, types.AUDIT_ACTION_DOCUMENT_UPLOAD, types.AUDIT_TARGET_DOCUMENT, id, err)
+		event.Details = map[string]string{"title": req.Title, "file": header.Filename, "workspace": req.Workspace}
+		h.auditService.Record(ctx, event)
+		documentID = id
+		errChan <- err
 	}()
 	// Create a channel to detect client disconnect
 	clientGone := c.Writer.CloseNotify()
@@ -82,6 +108,7 @@ func (h *UploadHandler) UploadDocumentHandler(c *gin.Context) {
 					Status: true,
 					Data: types.UploadResponse{
 						OriginalName: req.Title,
+						DocumentID:   documentID,
 					},
 				})
 			}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+type UsageHandler interface {
+	HandleUsageReport(c *gin.Context)
+}
+
+type usageHandler struct {
+	usageService service.UsageService
+}
+
+func NewUsageHandler(usageService service.UsageService) UsageHandler {
+	return &usageHandler{
+		usageService: usageService,
+	}
+}
+
+func (h *usageHandler) HandleUsageReport(c *gin.Context) {
+	var filter types.UsageReportFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid filter parameters",
+		})
+		return
+	}
+	rows, err := h.usageService.Report(c, filter)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   rows,
+	})
+}
@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -8,24 +11,34 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/tieubaoca/chatbot-be/service"
 	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
 )
 
+// maxImportFileSize is the largest user import upload accepted, in bytes
+const maxImportFileSize = 10 << 20
+
 type UserManageHandler interface {
 	HandleCreateUser(c *gin.Context)
 	HandlerBatchCreateUser(c *gin.Context)
+	HandleImportUsers(c *gin.Context)
+	HandleExportUsers(c *gin.Context)
 	HandlePaginateUser(c *gin.Context)
 	HandleGetUser(c *gin.Context)
 	HandleUpdateUser(c *gin.Context)
 	HandleDeleteUser(c *gin.Context)
+	HandleListDeletedUsers(c *gin.Context)
+	HandleRestoreUser(c *gin.Context)
 }
 
 type userManageHandler struct {
-	userService service.UserService
+	userService  service.UserService
+	auditService service.AuditService
 }
 
-func NewUserManageHandler(userService service.UserService) UserManageHandler {
+func NewUserManageHandler(userService service.UserService, auditService service.AuditService) UserManageHandler {
 	return &userManageHandler{
-		userService: userService,
+		userService:  userService,
+		auditService: auditService,
 	}
 }
 
@@ -45,17 +58,20 @@ func (h *userManageHandler) HandleCreateUser(c *gin.Context) {
 		// Hash password
 		Password:        req.Password,
 		FullName:        req.FullName,
+		Email:           req.Email,
 		Workspace:       req.Workspace,
 		ManagementLevel: req.ManagementLevel,
+		Role:            req.Role,
 		WorkspaceRole:   req.WorkspaceRole,
 		CreateAt:        time.Now().Unix(),
 		UpdateAt:        time.Now().Unix(),
 	}
-	if err := h.userService.CreateUser(c, user); err != nil {
-		c.JSON(http.StatusInternalServerError, types.DataResponse{
-			Status:  false,
-			Message: err.Error(),
-		})
+	err := h.userService.CreateUser(c, user)
+	event := auditEvent(c, types.AUDIT_ACTION_USER_CREATE, types.AUDIT_TARGET_USER, user.ID, err)
+	event.Details = map[string]string{"username": user.Username, "workspace": user.Workspace}
+	h.auditService.Record(c.Request.Context(), event)
+	if err != nil {
+		writeServiceError(c, err)
 		return
 	}
 
@@ -84,8 +100,10 @@ func (h *userManageHandler) HandlerBatchCreateUser(c *gin.Context) {
 			// Hash password
 			Password:        userReq.Password,
 			FullName:        userReq.FullName,
+			Email:           userReq.Email,
 			Workspace:       userReq.Workspace,
 			ManagementLevel: userReq.ManagementLevel,
+			Role:            userReq.Role,
 			WorkspaceRole:   userReq.WorkspaceRole,
 			CreateAt:        time.Now().Unix(),
 			UpdateAt:        time.Now().Unix(),
@@ -93,46 +111,153 @@ func (h *userManageHandler) HandlerBatchCreateUser(c *gin.Context) {
 		users = append(users, user)
 	}
 
-	if err := h.userService.BatchCreateUser(c, users); err != nil {
-		c.JSON(http.StatusInternalServerError, types.DataResponse{
+	result, err := h.userService.BatchCreateUser(c, users)
+	h.auditService.Record(c.Request.Context(), importAuditEvent(c, types.AUDIT_ACTION_USER_BATCH, result, err))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: result.Failed == 0,
+		Data:   result,
+	})
+}
+
+// HandleImportUsers upserts users by username from a CSV or XLSX file in the file form field.
+// With dry_run=true the file is only validated.
+func (h *userManageHandler) HandleImportUsers(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+	fileHeader, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, types.DataResponse{
+			Status:  false,
+			Message: fmt.Sprintf("The file must not be larger than %d MB", maxImportFileSize>>20),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "A CSV or XLSX file is required",
+		})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Failed to read file",
+		})
+		return
+	}
+	defer file.Close()
+	rows, err := utils.ReadSpreadsheet(fileHeader.Filename, file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
 			Status:  false,
 			Message: err.Error(),
 		})
 		return
 	}
-}
 
-func (h *userManageHandler) HandlePaginateUser(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", c.PostForm("dry_run")))
+	result, err := h.userService.ImportUsers(c, rows, dryRun)
+	event := importAuditEvent(c, types.AUDIT_ACTION_USER_IMPORT, result, err)
+	if event.Details != nil {
+		event.Details["file"] = fileHeader.Filename
+	}
+	h.auditService.Record(c.Request.Context(), event)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: result.Failed == 0,
+		Data:   result,
+	})
+}
 
-	var page, limit int64
-	pageStr := c.Query("page")
-	if pageStr == "" {
-		page = 1
-	} else {
-		page, _ = strconv.ParseInt(pageStr, 10, 64)
+// HandleExportUsers downloads the users as CSV or XLSX (format=xlsx), filtered like HandlePaginateUser
+func (h *userManageHandler) HandleExportUsers(c *gin.Context) {
+	var filter types.UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid filter parameters",
+		})
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	contentType, ok := spreadsheetContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: utils.ErrUnsupportedSpreadsheet.Error(),
+		})
+		return
 	}
-	limitStr := c.Query("limit")
-	if limitStr == "" {
-		limit = 10
-	} else {
-		limit, _ = strconv.ParseInt(limitStr, 10, 64)
+	rows, err := h.userService.ExportUsers(c, filter)
+	event := auditEvent(c, types.AUDIT_ACTION_USER_EXPORT, "", "", err)
+	event.Details = map[string]string{"format": format, "workspace": filter.Workspace}
+	if err == nil {
+		event.Details["rows"] = strconv.Itoa(len(rows) - 1)
 	}
-	users, total, err := h.userService.PaginateUser(c, page, limit)
+	h.auditService.Record(c.Request.Context(), event)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, types.DataResponse{
+		writeServiceError(c, err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := utils.WriteSpreadsheet(format, &buf, rows); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	filename := fmt.Sprintf("users-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// importAuditEvent summarises a batch create or import, the result is nil when err is set
+func importAuditEvent(c *gin.Context, action string, result *types.ImportUsersResult, err error) *types.AuditEvent {
+	event := auditEvent(c, action, types.AUDIT_TARGET_USER, "", err)
+	if result != nil {
+		event.Details = map[string]string{
+			"dry_run": strconv.FormatBool(result.DryRun),
+			"created": strconv.Itoa(result.Created),
+			"updated": strconv.Itoa(result.Updated),
+			"failed":  strconv.Itoa(result.Failed),
+		}
+	}
+	return event
+}
+
+var spreadsheetContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// HandlePaginateUser lists users. Besides the list parameters it filters by
+// workspace, role, workspace_role, level, min_level and max_level.
+func (h *userManageHandler) HandlePaginateUser(c *gin.Context) {
+	opts, ok := bindListOptions(c)
+	if !ok {
+		return
+	}
+	var filter types.UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
 			Status:  false,
-			Message: err.Error(),
+			Message: "Invalid filter parameters",
 		})
 		return
 	}
-
-	res := types.PaginateResponse{
-		Total:    total,
-		Elements: users,
-		Page:     page,
-		Limit:    limit,
+	users, page, err := h.userService.ListUsers(c, filter, opts)
+	if err != nil {
+		writeServiceError(c, err)
+		return
 	}
-	c.JSON(http.StatusOK, res)
+	writeList(c, users, page)
 }
 
 func (h *userManageHandler) HandleGetUser(c *gin.Context) {
@@ -169,29 +294,34 @@ func (h *userManageHandler) HandleUpdateUser(c *gin.Context) {
 		Username:        req.Username,
 		Password:        req.Password,
 		FullName:        req.FullName,
+		Email:           req.Email,
 		ManagementLevel: req.ManagementLevel,
+		Role:            req.Role,
 		WorkspaceRole:   req.WorkspaceRole,
 		Workspace:       req.Workspace,
 		UpdateAt:        time.Now().Unix(),
 	}
 
-	if err := h.userService.UpdateUser(c, req.ID, user); err != nil {
-		c.JSON(http.StatusInternalServerError, types.DataResponse{
-			Status:  false,
-			Message: err.Error(),
-		})
+	err := h.userService.UpdateUser(c, req.ID, user)
+	event := auditEvent(c, types.AUDIT_ACTION_USER_UPDATE, types.AUDIT_TARGET_USER, req.ID, err)
+	event.Details = updatedUserFields(req)
+	h.auditService.Record(c.Request.Context(), event)
+	if err != nil {
+		writeServiceError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+	})
 }
 
 func (h *userManageHandler) HandleDeleteUser(c *gin.Context) {
 
 	id := c.Query("id")
-	if err := h.userService.DeleteUser(c, id); err != nil {
-		c.JSON(http.StatusInternalServerError, types.DataResponse{
-			Status:  false,
-			Message: err.Error(),
-		})
+	err := h.userService.DeleteUser(c, id, adminUsername(c))
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_USER_DELETE, types.AUDIT_TARGET_USER, id, err))
+	if err != nil {
+		writeServiceError(c, err)
 		return
 	}
 
@@ -200,3 +330,58 @@ func (h *userManageHandler) HandleDeleteUser(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, res)
 }
+
+func (h *userManageHandler) HandleListDeletedUsers(c *gin.Context) {
+	opts, ok := bindListOptions(c)
+	if !ok {
+		return
+	}
+	users, page, err := h.userService.ListDeletedUsers(c, opts)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, users, page)
+}
+
+func (h *userManageHandler) HandleRestoreUser(c *gin.Context) {
+	err := h.userService.RestoreUser(c, c.Param("id"))
+	h.auditService.Record(c.Request.Context(), auditEvent(c, types.AUDIT_ACTION_USER_RESTORE, types.AUDIT_TARGET_USER, c.Param("id"), err))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+	})
+}
+
+// updatedUserFields lists the fields an update request changes, never the password itself
+func updatedUserFields(req types.UpdateUserRequest) map[string]string {
+	fields := make(map[string]string)
+	if req.Username != "" {
+		fields["username"] = req.Username
+	}
+	if req.Password != "" {
+		fields["password"] = "changed"
+	}
+	if req.FullName != "" {
+		fields["full_name"] = req.FullName
+	}
+	if req.Email != "" {
+		fields["email"] = req.Email
+	}
+	if req.Workspace != "" {
+		fields["workspace"] = req.Workspace
+	}
+	if req.WorkspaceRole != "" {
+		fields["workspace_role"] = req.WorkspaceRole
+	}
+	if req.ManagementLevel != 0 {
+		fields["management_level"] = strconv.Itoa(req.ManagementLevel)
+	}
+	if req.Role != "" {
+		fields["role"] = req.Role
+	}
+	return fields
+}
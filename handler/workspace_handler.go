@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/service"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+type WorkspaceHandler interface {
+	HandleCreateWorkspace(c *gin.Context)
+	HandleListWorkspaces(c *gin.Context)
+	HandleGetWorkspace(c *gin.Context)
+	HandleUpdateWorkspace(c *gin.Context)
+	HandleDeleteWorkspace(c *gin.Context)
+	HandleListMembers(c *gin.Context)
+	HandleAssignMember(c *gin.Context)
+	// HandleListMyMembers serves the roster to users of the workspace
+	HandleListMyMembers(c *gin.Context)
+}
+
+type workspaceHandler struct {
+	workspaceService service.WorkspaceService
+}
+
+func NewWorkspaceHandler(workspaceService service.WorkspaceService) WorkspaceHandler {
+	return &workspaceHandler{
+		workspaceService: workspaceService,
+	}
+}
+
+func (h *workspaceHandler) HandleCreateWorkspace(c *gin.Context) {
+	var req types.CreateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	workspace, err := h.workspaceService.CreateWorkspace(c, req)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   workspace,
+	})
+}
+
+func (h *workspaceHandler) HandleListWorkspaces(c *gin.Context) {
+	workspaces, err := h.workspaceService.ListWorkspaces(c)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, workspaces, singlePage(len(workspaces)))
+}
+
+func (h *workspaceHandler) HandleGetWorkspace(c *gin.Context) {
+	workspace, err := h.workspaceService.GetWorkspace(c, c.Param("id"))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   workspace,
+	})
+}
+
+func (h *workspaceHandler) HandleUpdateWorkspace(c *gin.Context) {
+	var req types.UpdateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	workspace, err := h.workspaceService.UpdateWorkspace(c, c.Param("id"), req)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   workspace,
+	})
+}
+
+func (h *workspaceHandler) HandleDeleteWorkspace(c *gin.Context) {
+	if err := h.workspaceService.DeleteWorkspace(c, c.Param("id")); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+	})
+}
+
+func (h *workspaceHandler) HandleListMembers(c *gin.Context) {
+	members, err := h.workspaceService.ListMembers(c, c.Param("id"))
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, members, singlePage(len(members)))
+}
+
+func (h *workspaceHandler) HandleAssignMember(c *gin.Context) {
+	var req types.AssignMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == "" {
+		c.JSON(http.StatusBadRequest, types.DataResponse{
+			Status:  false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	member, err := h.workspaceService.AssignMember(c, c.Param("id"), req)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.DataResponse{
+		Status: true,
+		Data:   member,
+	})
+}
+
+func (h *workspaceHandler) HandleListMyMembers(c *gin.Context) {
+	claims, ok := mustUserClaims(c)
+	if !ok {
+		return
+	}
+	workspace := c.Param("id")
+	if !claims.CanAccessWorkspace(workspace) {
+		// Other workspaces are reported as missing rather than forbidden
+		writeServiceError(c, service.ErrNotFound)
+		return
+	}
+	members, err := h.workspaceService.ListMembers(c, workspace)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	writeList(c, members, singlePage(len(members)))
+}
@@ -0,0 +1,13 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// ClientIP stores the client address gin resolves from the trusted proxies in the
+// request context, for the handlers that only see the raw request
+func ClientIP(c *gin.Context) {
+	c.Request = c.Request.WithContext(utils.ContextWithClientIP(c.Request.Context(), c.ClientIP()))
+	c.Next()
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+func TestClientIPIgnoresForwardedHeadersFromUntrustedPeers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		trusted []string
+		want    string
+	}{
+		{"no trusted proxy", nil, "192.0.2.10"},
+		{"trusted proxy", []string{"192.0.2.0/24"}, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			if err := router.SetTrustedProxies(tt.trusted); err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			router.Use(ClientIP)
+			router.GET("/", func(c *gin.Context) {
+				got, _ = utils.ClientIPFromContext(c.Request.Context())
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "192.0.2.10:5000"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			req.Header.Set("X-Real-Ip", "198.51.100.1")
+			router.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,24 +2,33 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/tieubaoca/chatbot-be/types"
 	"github.com/tieubaoca/chatbot-be/utils"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type JsonResponse struct {
 	Error string `json:"error"`
 }
 
-type contextKey string
+// UserLookup loads a user that is not deleted, repository.UserRepo satisfies it
+type UserLookup interface {
+	GetUser(ctx context.Context, id string) (*types.User, error)
+}
 
-const (
-	userContextKey  contextKey = "user"
-	adminContextKey contextKey = "admin"
-)
+var userLookup UserLookup
+
+// SetupUserCheck makes AuthMiddleware load the user of each token, rejecting tokens of
+// deleted users and tokens issued before the user was last updated, whose claims are stale
+func SetupUserCheck(users UserLookup) {
+	userLookup = users
+}
 
 func AuthMiddleware(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
@@ -51,7 +60,35 @@ func AuthMiddleware(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	ctx := context.WithValue(c.Request.Context(), userContextKey, claims)
+	if userLookup != nil {
+		user, err := userLookup.GetUser(c.Request.Context(), claims.ID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusUnauthorized, types.DataResponse{
+				Status:  false,
+				Message: "User no longer exists",
+			})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to load user %s for token check: %v", claims.ID, err)
+			c.JSON(http.StatusInternalServerError, types.DataResponse{
+				Status:  false,
+				Message: "Failed to verify user",
+			})
+			c.Abort()
+			return
+		}
+		if claims.IssuedAt == nil || claims.IssuedAt.Unix() < user.UpdateAt {
+			c.JSON(http.StatusUnauthorized, types.DataResponse{
+				Status:  false,
+				Message: "User token was revoked, please log in again",
+			})
+			c.Abort()
+			return
+		}
+	}
+	ctx := utils.ContextWithUserClaims(c.Request.Context(), claims)
 	c.Request = c.Request.WithContext(ctx)
 	c.Next()
 }
@@ -86,8 +123,29 @@ func AdminAuthMiddleware(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	ctx := context.WithValue(c.Request.Context(), adminContextKey, claims)
+	ctx := utils.ContextWithAdminClaims(c.Request.Context(), claims)
 	c.Request = c.Request.WithContext(ctx)
 	c.Next()
 
 }
+
+// WebSocketAuthMiddleware is AuthMiddleware for WebSocket upgrades. Browsers cannot
+// set headers on a WebSocket handshake, so the token may also come from the token query parameter.
+func WebSocketAuthMiddleware(c *gin.Context) {
+	if c.GetHeader("Authorization") == "" {
+		if token := c.Query("token"); token != "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	AuthMiddleware(c)
+}
+
+// GetUserClaims returns the user claims stored by AuthMiddleware
+func GetUserClaims(ctx context.Context) (*utils.UserClaims, bool) {
+	return utils.UserClaimsFromContext(ctx)
+}
+
+// GetAdminClaims returns the admin claims stored by AdminAuthMiddleware
+func GetAdminClaims(ctx context.Context) (*utils.AdminClaims, bool) {
+	return utils.AdminClaimsFromContext(ctx)
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// usersByID serves the users that are not deleted, like the Mongo repo
+type usersByID map[string]*types.User
+
+func (u usersByID) GetUser(ctx context.Context, id string) (*types.User, error) {
+	user, ok := u[id]
+	if !ok || user.DeletedAt != 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return user, nil
+}
+
+func TestAuthMiddlewareRejectsTokensOfChangedUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if err := utils.SetupJWT(config.JWTConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	issued := time.Now().Unix()
+	tests := []struct {
+		name string
+		user *types.User
+		want int
+	}{
+		{"unchanged user", &types.User{ID: "u1", UpdateAt: issued - 60}, http.StatusOK},
+		{"updated in the second the token was issued", &types.User{ID: "u1", UpdateAt: issued}, http.StatusOK},
+		{"deleted user", &types.User{ID: "u1", UpdateAt: issued - 60, DeletedAt: issued + 60}, http.StatusUnauthorized},
+		{"updated after the token was issued", &types.User{ID: "u1", UpdateAt: issued + 60}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := utils.GenerateUserToken(&types.User{ID: "u1", Username: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			SetupUserCheck(usersByID{tt.user.ID: tt.user})
+			defer SetupUserCheck(nil)
+
+			router := gin.New()
+			router.GET("/", AuthMiddleware, func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// RequirePermission aborts with 403 unless the authenticated caller holds the permission.
+// It must run after AuthMiddleware or AdminAuthMiddleware; admin tokens hold every permission.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetAdminClaims(c.Request.Context()); ok {
+			c.Next()
+			return
+		}
+		claims, ok := GetUserClaims(c.Request.Context())
+		if !ok {
+			c.JSON(http.StatusUnauthorized, types.DataResponse{
+				Status:  false,
+				Message: "Authentication required",
+			})
+			c.Abort()
+			return
+		}
+		if !claims.HasPermission(permission) {
+			c.JSON(http.StatusForbidden, types.DataResponse{
+				Status:  false,
+				Message: "Permission denied: " + permission,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type AnswerRepo interface {
+	CreateAnswer(ctx context.Context, answer *types.ChatAnswer) error
+	GetAnswer(ctx context.Context, id string) (*types.ChatAnswer, error)
+	SetFeedback(ctx context.Context, id string, feedback *types.AnswerFeedback) error
+	// ListRatedDown returns the negatively rated answers with the given review status
+	ListRatedDown(ctx context.Context, filter types.AnswerReviewFilter, opts types.ListOptions) ([]*types.ChatAnswer, types.PageInfo, error)
+}
+
+type answerRepo struct {
+	collection *mongo.Collection
+}
+
+func NewAnswerRepo(collection *mongo.Collection) AnswerRepo {
+	return &answerRepo{
+		collection: collection,
+	}
+}
+
+var answerListSpec = listSpec{
+	// Cursors only support top level fields, so the queue is ordered by answer time
+	SortFields:   []string{"created_at", "workspace"},
+	DefaultSort:  "-created_at",
+	SearchFields: []string{"question", "answer", "feedback.comment"},
+}
+
+func (r *answerRepo) CreateAnswer(ctx context.Context, answer *types.ChatAnswer) error {
+	result, err := r.collection.InsertOne(ctx, answer)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		answer.ID = id.Hex()
+	}
+	return nil
+}
+
+func (r *answerRepo) GetAnswer(ctx context.Context, id string) (*types.ChatAnswer, error) {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var answer types.ChatAnswer
+	if err := r.collection.FindOne(ctx, bson.M{"_id": objId}).Decode(&answer); err != nil {
+		return nil, err
+	}
+	return &answer, nil
+}
+
+func (r *answerRepo) SetFeedback(ctx context.Context, id string, feedback *types.AnswerFeedback) error {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": bson.M{"feedback": feedback}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *answerRepo) ListRatedDown(ctx context.Context, filter types.AnswerReviewFilter, opts types.ListOptions) ([]*types.ChatAnswer, types.PageInfo, error) {
+	query := bson.M{
+		"feedback.rating":        types.FEEDBACK_RATING_DOWN,
+		"feedback.review_status": filter.Status,
+	}
+	if filter.Workspace != "" {
+		query["workspace"] = filter.Workspace
+	}
+	return findPage[types.ChatAnswer](ctx, r.collection, query, opts, answerListSpec)
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// AuditRepo only appends and reads, audit events are never updated or deleted
+type AuditRepo interface {
+	RecordEvent(ctx context.Context, event *types.AuditEvent) error
+	ListEvents(ctx context.Context, filter types.AuditFilter, opts types.ListOptions) ([]*types.AuditEvent, types.PageInfo, error)
+	// EachEvent calls fn for every matching event, oldest first, until fn returns an error
+	EachEvent(ctx context.Context, filter types.AuditFilter, fn func(*types.AuditEvent) error) error
+}
+
+type auditRepo struct {
+	collection *mongo.Collection
+}
+
+func NewAuditRepo(collection *mongo.Collection) AuditRepo {
+	return &auditRepo{
+		collection: collection,
+	}
+}
+
+var auditListSpec = listSpec{
+	SortFields:   []string{"created_at", "actor", "action"},
+	DefaultSort:  "-created_at",
+	SearchFields: []string{"actor", "target_id", "message"},
+}
+
+func (r *auditRepo) RecordEvent(ctx context.Context, event *types.AuditEvent) error {
+	result, err := r.collection.InsertOne(ctx, event)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		event.ID = id.Hex()
+	}
+	return nil
+}
+
+func (r *auditRepo) ListEvents(ctx context.Context, filter types.AuditFilter, opts types.ListOptions) ([]*types.AuditEvent, types.PageInfo, error) {
+	return findPage[types.AuditEvent](ctx, r.collection, auditQuery(filter), opts, auditListSpec)
+}
+
+func (r *auditRepo) EachEvent(ctx context.Context, filter types.AuditFilter, fn func(*types.AuditEvent) error) error {
+	cursor, err := r.collection.Find(ctx, auditQuery(filter),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var event types.AuditEvent
+		if err := cursor.Decode(&event); err != nil {
+			return err
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func auditQuery(filter types.AuditFilter) bson.M {
+	query := bson.M{}
+	createdAt := bson.M{}
+	if filter.From > 0 {
+		createdAt["$gte"] = filter.From
+	}
+	if filter.To > 0 {
+		createdAt["$lte"] = filter.To
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+	if filter.Actor != "" {
+		query["actor"] = filter.Actor
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.Outcome != "" {
+		query["outcome"] = filter.Outcome
+	}
+	if filter.TargetID != "" {
+		query["target_id"] = filter.TargetID
+	}
+	return query
+}
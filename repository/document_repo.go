@@ -1 +1,136 @@
 package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type DocumentRepo interface {
+	CreateDocument(ctx context.Context, doc *types.DocumentRecord) error
+	GetDocument(ctx context.Context, id string) (*types.DocumentRecord, error)
+	// GetDeletedDocument returns a soft-deleted document
+	GetDeletedDocument(ctx context.Context, id string) (*types.DocumentRecord, error)
+	ListDocuments(ctx context.Context, filter types.DocumentFilter, opts types.ListOptions) ([]*types.DocumentRecord, types.PageInfo, error)
+	ListDeletedDocuments(ctx context.Context, opts types.ListOptions) ([]*types.DocumentRecord, types.PageInfo, error)
+	SetChunks(ctx context.Context, id string, chunks int) error
+	DeleteDocument(ctx context.Context, id, deletedBy string) error
+	RestoreDocument(ctx context.Context, id string) error
+	// ListPurgeableDocuments returns the documents deleted at or before the given time
+	ListPurgeableDocuments(ctx context.Context, before int64) ([]*types.DocumentRecord, error)
+	PurgeDocument(ctx context.Context, id string) error
+}
+
+type documentRepo struct {
+	collection *mongo.Collection
+}
+
+func NewDocumentRepo(collection *mongo.Collection) DocumentRepo {
+	return &documentRepo{
+		collection: collection,
+	}
+}
+
+var documentListSpec = listSpec{
+	SortFields:   []string{"title", "source", "workspace", "created_at", "deleted_at"},
+	DefaultSort:  "-created_at",
+	SearchFields: []string{"title", "source"},
+}
+
+func (r *documentRepo) CreateDocument(ctx context.Context, doc *types.DocumentRecord) error {
+	result, err := r.collection.InsertOne(ctx, doc)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		doc.ID = id.Hex()
+	}
+	return nil
+}
+
+func (r *documentRepo) GetDocument(ctx context.Context, id string) (*types.DocumentRecord, error) {
+	return r.findOne(ctx, id, notDeleted)
+}
+
+func (r *documentRepo) GetDeletedDocument(ctx context.Context, id string) (*types.DocumentRecord, error) {
+	return r.findOne(ctx, id, onlyDeleted)
+}
+
+func (r *documentRepo) findOne(ctx context.Context, id string, scope func(bson.M) bson.M) (*types.DocumentRecord, error) {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var doc types.DocumentRecord
+	if err := r.collection.FindOne(ctx, scope(bson.M{"_id": objId})).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *documentRepo) ListDocuments(ctx context.Context, filter types.DocumentFilter, opts types.ListOptions) ([]*types.DocumentRecord, types.PageInfo, error) {
+	query := notDeleted(bson.M{})
+	if filter.Workspace != "" {
+		query["workspace"] = filter.Workspace
+	}
+	if filter.Tag != "" {
+		query["tags"] = filter.Tag
+	}
+	return findPage[types.DocumentRecord](ctx, r.collection, query, opts, documentListSpec)
+}
+
+func (r *documentRepo) ListDeletedDocuments(ctx context.Context, opts types.ListOptions) ([]*types.DocumentRecord, types.PageInfo, error) {
+	if opts.Sort == "" {
+		opts.Sort = "-deleted_at"
+	}
+	return findPage[types.DocumentRecord](ctx, r.collection, onlyDeleted(bson.M{}), opts, documentListSpec)
+}
+
+func (r *documentRepo) SetChunks(ctx context.Context, id string, chunks int) error {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": bson.M{"chunks": chunks}})
+	return err
+}
+
+func (r *documentRepo) DeleteDocument(ctx context.Context, id, deletedBy string) error {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	return softDelete(ctx, r.collection, objId, deletedBy, time.Now().Unix())
+}
+
+func (r *documentRepo) RestoreDocument(ctx context.Context, id string) error {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	return restore(ctx, r.collection, objId)
+}
+
+func (r *documentRepo) ListPurgeableDocuments(ctx context.Context, before int64) ([]*types.DocumentRecord, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"deleted_at": bson.M{"$lte": before}})
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]*types.DocumentRecord, 0)
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (r *documentRepo) PurgeDocument(ctx context.Context, id string) error {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = r.collection.DeleteOne(ctx, bson.M{"_id": objId})
+	return err
+}
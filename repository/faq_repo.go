@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type FAQRepo interface {
+	CreateFAQ(ctx context.Context, faq *types.FAQ) error
+	GetFAQ(ctx context.Context, id string) (*types.FAQ, error)
+	ListFAQs(ctx context.Context, filter types.FAQFilter, opts types.ListOptions) ([]*types.FAQ, types.PageInfo, error)
+	UpdateFAQ(ctx context.Context, faq *types.FAQ) error
+	DeleteFAQ(ctx context.Context, id string) error
+}
+
+type faqRepo struct {
+	collection *mongo.Collection
+}
+
+func NewFAQRepo(collection *mongo.Collection) FAQRepo {
+	return &faqRepo{
+		collection: collection,
+	}
+}
+
+var faqListSpec = listSpec{
+	SortFields:   []string{"question", "workspace", "created_at", "updated_at"},
+	DefaultSort:  "-updated_at",
+	SearchFields: []string{"question", "answer"},
+}
+
+func (r *faqRepo) CreateFAQ(ctx context.Context, faq *types.FAQ) error {
+	result, err := r.collection.InsertOne(ctx, faq)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		faq.ID = id.Hex()
+	}
+	return nil
+}
+
+func (r *faqRepo) GetFAQ(ctx context.Context, id string) (*types.FAQ, error) {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var faq types.FAQ
+	if err := r.collection.FindOne(ctx, bson.M{"_id": objId}).Decode(&faq); err != nil {
+		return nil, err
+	}
+	return &faq, nil
+}
+
+func (r *faqRepo) ListFAQs(ctx context.Context, filter types.FAQFilter, opts types.ListOptions) ([]*types.FAQ, types.PageInfo, error) {
+	query := bson.M{}
+	if filter.Workspace != "" {
+		query["workspace"] = filter.Workspace
+	}
+	if filter.Tag != "" {
+		query["tags"] = filter.Tag
+	}
+	return findPage[types.FAQ](ctx, r.collection, query, opts, faqListSpec)
+}
+
+func (r *faqRepo) UpdateFAQ(ctx context.Context, faq *types.FAQ) error {
+	objId, err := bson.ObjectIDFromHex(faq.ID)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": bson.M{
+		"question":   faq.Question,
+		"answer":     faq.Answer,
+		"tags":       faq.Tags,
+		"workspace":  faq.Workspace,
+		"updated_by": faq.UpdatedBy,
+		"updated_at": faq.UpdateAt,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *faqRepo) DeleteFAQ(ctx context.Context, id string) error {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": objId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
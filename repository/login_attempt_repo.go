@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type LoginAttemptRepo interface {
+	RecordAttempt(ctx context.Context, attempt *types.LoginAttempt) error
+	GetThrottle(ctx context.Context, key string) (*types.LoginThrottle, error)
+	// RegisterFailure counts a failure for the key unless it is locked, locking it once
+	// maxFailures is reached, and returns the state before, which tells whether it was locked
+	RegisterFailure(ctx context.Context, key string, now int64, maxFailures int, config types.LoginThrottleConfig) (*types.LoginThrottle, error)
+	// ForgiveFailure takes back a failure counted for an attempt that did not fail
+	ForgiveFailure(ctx context.Context, key string, maxFailures int) error
+	ResetThrottle(ctx context.Context, key string) error
+}
+
+type loginAttemptRepo struct {
+	attempts  *mongo.Collection
+	throttles *mongo.Collection
+}
+
+func NewLoginAttemptRepo(attempts, throttles *mongo.Collection) LoginAttemptRepo {
+	return &loginAttemptRepo{
+		attempts:  attempts,
+		throttles: throttles,
+	}
+}
+
+func (r *loginAttemptRepo) RecordAttempt(ctx context.Context, attempt *types.LoginAttempt) error {
+	_, err := r.attempts.InsertOne(ctx, attempt)
+	return err
+}
+
+// GetThrottle returns the throttle state for the key, or an empty state if the key has no failures
+func (r *loginAttemptRepo) GetThrottle(ctx context.Context, key string) (*types.LoginThrottle, error) {
+	throttle := &types.LoginThrottle{Key: key}
+	err := r.throttles.FindOne(ctx, bson.M{"_id": key}).Decode(throttle)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return throttle, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return throttle, nil
+}
+
+// RegisterFailure updates the key in one step, so that concurrent attempts cannot pass
+// the limit. A failure after FailureWindow seconds starts the count over, every failure
+// from maxFailures on locks the key for BaseLockout seconds doubled per further failure,
+// up to MaxLockout.
+func (r *loginAttemptRepo) RegisterFailure(ctx context.Context, key string, now int64, maxFailures int, config types.LoginThrottleConfig) (*types.LoginThrottle, error) {
+	locked := bson.M{"$gt": bson.A{"$locked_until", now}}
+	expired := bson.M{"$gt": bson.A{bson.M{"$subtract": bson.A{now, "$last_failure_at"}}, config.FailureWindow}}
+	failures := bson.M{"$cond": bson.A{expired, 1, bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}}}}
+	lockout := bson.M{"$toLong": bson.M{"$min": bson.A{
+		config.MaxLockout,
+		bson.M{"$multiply": bson.A{config.BaseLockout, bson.M{"$pow": bson.A{2, bson.M{"$subtract": bson.A{failures, maxFailures}}}}}},
+	}}}
+	lockedUntil := bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{failures, maxFailures}}, bson.M{"$add": bson.A{now, lockout}}, 0}}
+	update := bson.A{bson.M{"$set": bson.M{
+		"failures":        bson.M{"$cond": bson.A{locked, "$failures", failures}},
+		"last_failure_at": bson.M{"$cond": bson.A{locked, "$last_failure_at", now}},
+		"locked_until":    bson.M{"$cond": bson.A{locked, "$locked_until", lockedUntil}},
+	}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	throttle := &types.LoginThrottle{Key: key}
+	err := r.throttles.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(throttle)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return throttle, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return throttle, nil
+}
+
+func (r *loginAttemptRepo) ForgiveFailure(ctx context.Context, key string, maxFailures int) error {
+	failures := bson.M{"$max": bson.A{bson.M{"$subtract": bson.A{"$failures", 1}}, 0}}
+	update := bson.A{bson.M{"$set": bson.M{
+		"failures":     failures,
+		"locked_until": bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{failures, maxFailures}}, 0, "$locked_until"}},
+	}}}
+	_, err := r.throttles.UpdateOne(ctx, bson.M{"_id": key}, update)
+	return err
+}
+
+func (r *loginAttemptRepo) ResetThrottle(ctx context.Context, key string) error {
+	_, err := r.throttles.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type NotificationRepo interface {
+	// CreateNotification stores the notification unless the user already has one with the same key.
+	// It reports whether a new notification was stored.
+	CreateNotification(ctx context.Context, notification *types.Notification) (bool, error)
+	ListNotifications(ctx context.Context, userID string, unreadOnly bool, opts types.ListOptions) ([]*types.Notification, types.PageInfo, error)
+	MarkRead(ctx context.Context, userID, id string) error
+	MarkAllRead(ctx context.Context, userID string) error
+}
+
+type notificationRepo struct {
+	collection *mongo.Collection
+}
+
+func NewNotificationRepo(collection *mongo.Collection) NotificationRepo {
+	return &notificationRepo{
+		collection: collection,
+	}
+}
+
+func (r *notificationRepo) CreateNotification(ctx context.Context, notification *types.Notification) (bool, error) {
+	doc := *notification
+	doc.ID = ""
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"user_id": notification.UserID, "key": notification.Key},
+		bson.M{"$setOnInsert": doc},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.UpsertedCount == 0 {
+		return false, nil
+	}
+	if id, ok := result.UpsertedID.(bson.ObjectID); ok {
+		notification.ID = id.Hex()
+	}
+	return true, nil
+}
+
+var notificationListSpec = listSpec{
+	SortFields:   []string{"created_at"},
+	DefaultSort:  "-created_at",
+	SearchFields: []string{"title", "message"},
+}
+
+func (r *notificationRepo) ListNotifications(ctx context.Context, userID string, unreadOnly bool, opts types.ListOptions) ([]*types.Notification, types.PageInfo, error) {
+	query := bson.M{"user_id": userID}
+	if unreadOnly {
+		query["read"] = false
+	}
+	return findPage[types.Notification](ctx, r.collection, query, opts, notificationListSpec)
+}
+
+func (r *notificationRepo) MarkRead(ctx context.Context, userID, id string) error {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objId, "user_id": userID},
+		bson.M{"$set": bson.M{"read": true}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *notificationRepo) MarkAllRead(ctx context.Context, userID string) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "read": false},
+		bson.M{"$set": bson.M{"read": true}},
+	)
+	return err
+}
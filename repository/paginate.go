@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 200
+)
+
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+// listSpec describes how a collection can be listed
+type listSpec struct {
+	// SortFields are the fields callers may sort by
+	SortFields []string
+	// DefaultSort is used when the caller does not ask for an order, e.g. "-created_at"
+	DefaultSort string
+	// SearchFields are matched case-insensitively against ListOptions.Search
+	SearchFields []string
+}
+
+// listCursor marks the last document of a page: its sort value and _id
+type listCursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    string      `json:"id"`
+	OID   bool        `json:"oid,omitempty"`
+}
+
+// findPage runs a paginated, sorted and searchable Find. Documents are ordered by
+// the sort field and then _id, so pages are stable and cursors are unambiguous.
+func findPage[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, opts types.ListOptions, spec listSpec) ([]*T, types.PageInfo, error) {
+	page := types.PageInfo{Page: opts.Page, Limit: opts.Limit}
+	if page.Limit <= 0 {
+		page.Limit = DefaultListLimit
+	}
+	if page.Limit > MaxListLimit {
+		page.Limit = MaxListLimit
+	}
+	if page.Page <= 0 {
+		page.Page = 1
+	}
+
+	sortField, direction, err := parseSort(opts.Sort, spec)
+	if err != nil {
+		return nil, page, err
+	}
+
+	query := bson.M{}
+	for key, value := range filter {
+		query[key] = value
+	}
+	if search := strings.TrimSpace(opts.Search); search != "" && len(spec.SearchFields) > 0 {
+		pattern := bson.Regex{Pattern: regexp.QuoteMeta(search), Options: "i"}
+		or := make(bson.A, 0, len(spec.SearchFields))
+		for _, field := range spec.SearchFields {
+			or = append(or, bson.M{field: pattern})
+		}
+		query["$or"] = or
+	}
+
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, page, err
+	}
+	page.Total = total
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: sortField, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(page.Limit)
+	if opts.Cursor != "" {
+		after, err := cursorFilter(opts.Cursor, sortField, direction)
+		if err != nil {
+			return nil, page, err
+		}
+		query = bson.M{"$and": bson.A{query, after}}
+	} else if page.Page > 1 {
+		findOpts.SetSkip((page.Page - 1) * page.Limit)
+	}
+
+	cursor, err := collection.Find(ctx, query, findOpts)
+	if err != nil {
+		return nil, page, err
+	}
+	defer cursor.Close(ctx)
+
+	elements := make([]*T, 0)
+	var last bson.Raw
+	for cursor.Next(ctx) {
+		var element T
+		if err := cursor.Decode(&element); err != nil {
+			return nil, page, err
+		}
+		elements = append(elements, &element)
+		last = cursor.Current
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, page, err
+	}
+	if int64(len(elements)) == page.Limit && last != nil {
+		page.NextCursor, err = encodeCursor(last, sortField)
+		if err != nil {
+			return nil, page, err
+		}
+	}
+	return elements, page, nil
+}
+
+func parseSort(sort string, spec listSpec) (string, int, error) {
+	if sort == "" {
+		sort = spec.DefaultSort
+	}
+	direction := 1
+	if strings.HasPrefix(sort, "-") {
+		direction = -1
+		sort = sort[1:]
+	}
+	if sort == "" || sort == "_id" {
+		return "_id", direction, nil
+	}
+	for _, field := range spec.SortFields {
+		if field == sort {
+			return sort, direction, nil
+		}
+	}
+	return "", 0, fmt.Errorf("%w: cannot sort by %q", ErrInvalidListOptions, sort)
+}
+
+func encodeCursor(doc bson.Raw, sortField string) (string, error) {
+	var fields bson.M
+	if err := bson.Unmarshal(doc, &fields); err != nil {
+		return "", err
+	}
+	c := listCursor{Sort: sortField, Value: fields[sortField]}
+	switch id := fields["_id"].(type) {
+	case bson.ObjectID:
+		c.ID = id.Hex()
+		c.OID = true
+	case string:
+		c.ID = id
+	default:
+		return "", fmt.Errorf("unsupported _id type %T", id)
+	}
+	if oid, ok := c.Value.(bson.ObjectID); ok {
+		c.Value = oid.Hex()
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// cursorFilter matches the documents after the cursor in the given order
+func cursorFilter(encoded, sortField string, direction int) (bson.M, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	var c listCursor
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	// Keep integer sort values integral, timestamps are stored as int64
+	if number, ok := c.Value.(json.Number); ok {
+		if n, err := number.Int64(); err == nil {
+			c.Value = n
+		} else if f, err := number.Float64(); err == nil {
+			c.Value = f
+		}
+	}
+	if c.Sort != sortField {
+		return nil, fmt.Errorf("%w: cursor was issued for another sort order", ErrInvalidListOptions)
+	}
+	var id interface{} = c.ID
+	if c.OID {
+		oid, err := bson.ObjectIDFromHex(c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+		}
+		id = oid
+	}
+	op := "$gt"
+	if direction < 0 {
+		op = "$lt"
+	}
+	if sortField == "_id" {
+		return bson.M{"_id": bson.M{op: id}}, nil
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{sortField: bson.M{op: c.Value}},
+		bson.M{sortField: c.Value, "_id": bson.M{op: id}},
+	}}, nil
+}
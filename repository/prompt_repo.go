@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type PromptRepo interface {
+	// CreatePrompt stores the template as the next version of its kind and workspace
+	CreatePrompt(ctx context.Context, prompt *types.PromptTemplate) error
+	GetPrompt(ctx context.Context, id string) (*types.PromptTemplate, error)
+	// LatestPrompt returns the latest version of the kind for the workspace
+	LatestPrompt(ctx context.Context, kind, workspace string) (*types.PromptTemplate, error)
+	ListPrompts(ctx context.Context, filter types.PromptTemplateFilter, opts types.ListOptions) ([]*types.PromptTemplate, types.PageInfo, error)
+}
+
+type promptRepo struct {
+	collection *mongo.Collection
+}
+
+func NewPromptRepo(collection *mongo.Collection) PromptRepo {
+	return &promptRepo{
+		collection: collection,
+	}
+}
+
+var promptListSpec = listSpec{
+	SortFields:   []string{"kind", "workspace", "version", "created_at"},
+	DefaultSort:  "-created_at",
+	SearchFields: []string{"content", "note"},
+}
+
+// promptVersionRetries bounds the attempts to take a version number saved concurrently
+const promptVersionRetries = 3
+
+func (r *promptRepo) CreatePrompt(ctx context.Context, prompt *types.PromptTemplate) error {
+	var err error
+	for attempt := 0; attempt < promptVersionRetries; attempt++ {
+		prompt.Version = 1
+		latest, latestErr := r.LatestPrompt(ctx, prompt.Kind, prompt.Workspace)
+		if latestErr == nil {
+			prompt.Version = latest.Version + 1
+		} else if !errors.Is(latestErr, mongo.ErrNoDocuments) {
+			return latestErr
+		}
+		prompt.ID = ""
+		var result *mongo.InsertOneResult
+		result, err = r.collection.InsertOne(ctx, prompt)
+		if err == nil {
+			if id, ok := result.InsertedID.(bson.ObjectID); ok {
+				prompt.ID = id.Hex()
+			}
+			return nil
+		}
+		// The unique index rejects a version taken by a concurrent save, take the next one
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (r *promptRepo) GetPrompt(ctx context.Context, id string) (*types.PromptTemplate, error) {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var prompt types.PromptTemplate
+	if err := r.collection.FindOne(ctx, bson.M{"_id": objId}).Decode(&prompt); err != nil {
+		return nil, err
+	}
+	return &prompt, nil
+}
+
+func (r *promptRepo) LatestPrompt(ctx context.Context, kind, workspace string) (*types.PromptTemplate, error) {
+	var prompt types.PromptTemplate
+	err := r.collection.FindOne(ctx,
+		bson.M{"kind": kind, "workspace": workspace},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}),
+	).Decode(&prompt)
+	if err != nil {
+		return nil, err
+	}
+	return &prompt, nil
+}
+
+func (r *promptRepo) ListPrompts(ctx context.Context, filter types.PromptTemplateFilter, opts types.ListOptions) ([]*types.PromptTemplate, types.PageInfo, error) {
+	query := bson.M{}
+	if filter.Kind != "" {
+		query["kind"] = filter.Kind
+	}
+	if filter.Workspace != "" {
+		query["workspace"] = filter.Workspace
+	}
+	return findPage[types.PromptTemplate](ctx, r.collection, query, opts, promptListSpec)
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// notDeleted restricts a filter to documents that are not soft-deleted
+func notDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
+
+// onlyDeleted restricts a filter to soft-deleted documents
+func onlyDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": true}
+	return filter
+}
+
+// softDelete marks a live document as deleted, mongo.ErrNoDocuments means there was none
+func softDelete(ctx context.Context, collection *mongo.Collection, id interface{}, deletedBy string, deletedAt int64) error {
+	result, err := collection.UpdateOne(ctx,
+		notDeleted(bson.M{"_id": id}),
+		bson.M{"$set": bson.M{"deleted_at": deletedAt, "deleted_by": deletedBy}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// restore clears the deletion mark, mongo.ErrNoDocuments means no deleted document has the id
+func restore(ctx context.Context, collection *mongo.Collection, id interface{}) error {
+	result, err := collection.UpdateOne(ctx,
+		onlyDeleted(bson.M{"_id": id}),
+		bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
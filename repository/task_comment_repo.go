@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type TaskCommentRepo interface {
+	CreateComment(ctx context.Context, comment *types.TaskComment) error
+	GetComment(ctx context.Context, id string) (*types.TaskComment, error)
+	ListComments(ctx context.Context, taskID string) ([]*types.TaskComment, error)
+}
+
+type taskCommentRepo struct {
+	collection *mongo.Collection
+}
+
+func NewTaskCommentRepo(collection *mongo.Collection) TaskCommentRepo {
+	return &taskCommentRepo{
+		collection: collection,
+	}
+}
+
+func (r *taskCommentRepo) CreateComment(ctx context.Context, comment *types.TaskComment) error {
+	result, err := r.collection.InsertOne(ctx, comment)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		comment.ID = id.Hex()
+	}
+	return nil
+}
+
+func (r *taskCommentRepo) GetComment(ctx context.Context, id string) (*types.TaskComment, error) {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var comment types.TaskComment
+	if err := r.collection.FindOne(ctx, bson.M{"_id": objId}).Decode(&comment); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// ListComments returns all comments of a task, oldest first
+func (r *taskCommentRepo) ListComments(ctx context.Context, taskID string) ([]*types.TaskComment, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"task_id": taskID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	comments := make([]*types.TaskComment, 0)
+	for cursor.Next(ctx) {
+		var comment types.TaskComment
+		if err := cursor.Decode(&comment); err != nil {
+			return nil, err
+		}
+		comments = append(comments, &comment)
+	}
+	return comments, nil
+}
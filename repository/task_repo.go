@@ -2,18 +2,22 @@ package repository
 
 import (
 	"context"
-	"log"
+	"errors"
 
 	"github.com/tieubaoca/chatbot-be/types"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
+// ErrTaskConflict is returned when a task changed status between read and update
+var ErrTaskConflict = errors.New("task was modified concurrently")
+
 type TaskRepo interface {
 	CreateTask(ctx context.Context, task *types.Task) error
 	GetTask(ctx context.Context, id string) (*types.Task, error)
-	ListTasks(ctx context.Context, assignee, reporter string, status []string, createFromTime, deadline int64, limit, offset int) ([]*types.Task, error)
-	UpdateTask(ctx context.Context, task *types.Task) error
+	ListTasks(ctx context.Context, filter types.TaskFilter, opts types.ListOptions) ([]*types.Task, types.PageInfo, error)
+	UpdateTask(ctx context.Context, id string, fields map[string]interface{}, history ...types.TaskHistory) error
+	UpdateTaskStatus(ctx context.Context, id, from, to string, history types.TaskHistory) error
 	DeleteTask(ctx context.Context, id string) error
 }
 
@@ -21,98 +25,113 @@ type taskRepo struct {
 	collection *mongo.Collection
 }
 
-func NewTaskRepo(db *mongo.Database) TaskRepo {
-	// check if collection does not exist, create one
-	collectionNames, err := db.ListCollectionNames(context.Background(), nil)
-	if err != nil {
-		panic(err)
-	}
-	collectionExists := false
-	for _, name := range collectionNames {
-		if name == "tasks" {
-			collectionExists = true
-			break
-		}
-	}
-	collection := db.Collection("tasks")
-	if !collectionExists {
-		indexes := []mongo.IndexModel{
-
-			{
-				Keys: bson.D{
-					{Key: "status", Value: 1},
-				},
-			},
-			{
-				Keys: bson.D{
-					{Key: "created_at", Value: -1},
-					{Key: "deadline", Value: -1},
-				},
-			}}
-
-		_, err = collection.Indexes().CreateMany(context.Background(), indexes)
-		if err != nil {
-			log.Printf("Error creating indexes: %v", err)
-			return nil
-		}
-	}
-
+func NewTaskRepo(collection *mongo.Collection) TaskRepo {
 	return &taskRepo{
-		collection: db.Collection("tasks"),
+		collection: collection,
 	}
 }
 
 func (r *taskRepo) CreateTask(ctx context.Context, task *types.Task) error {
-	_, err := r.collection.InsertOne(ctx, task)
-	return err
+	result, err := r.collection.InsertOne(ctx, task)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		task.ID = id.Hex()
+	}
+	return nil
 }
 
 func (r *taskRepo) GetTask(ctx context.Context, id string) (*types.Task, error) {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
 	var task types.Task
-	err := r.collection.FindOne(ctx, map[string]string{"id": id}).Decode(&task)
-	return &task, err
+	if err := r.collection.FindOne(ctx, bson.M{"_id": objId}).Decode(&task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+var taskListSpec = listSpec{
+	SortFields:   []string{"created_at", "updated_at", "deadline", "title", "status"},
+	DefaultSort:  "-created_at",
+	SearchFields: []string{"title", "description"},
 }
 
-func (r *taskRepo) ListTasks(ctx context.Context, assignee, reporter string, status []string, createFromTime, deadline int64, limit, offset int) ([]*types.Task, error) {
-	filter := make(map[string]interface{})
-	if assignee != "" {
-		filter["assignee"] = assignee
+func (r *taskRepo) ListTasks(ctx context.Context, filter types.TaskFilter, opts types.ListOptions) ([]*types.Task, types.PageInfo, error) {
+	query := bson.M{}
+	if filter.Workspace != "" {
+		query["workspace"] = filter.Workspace
 	}
-	if reporter != "" {
-		filter["reporter"] = reporter
+	if filter.Assignee != "" {
+		query["assignee"] = filter.Assignee
 	}
-	if len(status) > 0 {
-		filter["status"] = map[string]interface{}{"$in": status}
+	if filter.Reporter != "" {
+		query["reporter"] = filter.Reporter
 	}
-	if createFromTime > 0 {
-		filter["created_at"] = map[string]interface{}{"$gte": createFromTime}
+	if len(filter.Status) > 0 {
+		query["status"] = bson.M{"$in": filter.Status}
 	}
-	if deadline > 0 {
-		filter["deadline"] = map[string]interface{}{"$lte": deadline}
+	if filter.CreateFromTime > 0 {
+		query["created_at"] = bson.M{"$gte": filter.CreateFromTime}
 	}
-	cursor, err := r.collection.Find(ctx, filter)
-	if err != nil {
-		return nil, err
+	if filter.Deadline > 0 {
+		// Tasks without a deadline are stored with 0 and never match
+		query["deadline"] = bson.M{"$gt": 0, "$lte": filter.Deadline}
 	}
-	defer cursor.Close(ctx)
+	return findPage[types.Task](ctx, r.collection, query, opts, taskListSpec)
+}
 
-	var tasks []*types.Task
-	for cursor.Next(ctx) {
-		var task types.Task
-		if err := cursor.Decode(&task); err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, &task)
-	}
-	return tasks, nil
+// UpdateTask sets the given fields and appends history entries in a single update
+func (r *taskRepo) UpdateTask(ctx context.Context, id string, fields map[string]interface{}, history ...types.TaskHistory) error {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$set": fields}
+	if len(history) > 0 {
+		update["$push"] = bson.M{"history": bson.M{"$each": history}}
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objId}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
 }
 
-func (r *taskRepo) UpdateTask(ctx context.Context, task *types.Task) error {
-	_, err := r.collection.ReplaceOne(ctx, map[string]string{"id": task.ID}, task)
-	return err
+// UpdateTaskStatus moves the task from one status to another, failing with
+// ErrTaskConflict if the task is no longer in the expected status
+func (r *taskRepo) UpdateTaskStatus(ctx context.Context, id, from, to string, history types.TaskHistory) error {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objId, "status": from},
+		bson.M{
+			"$set":  bson.M{"status": to, "updated_at": history.CreateAt},
+			"$push": bson.M{"history": history},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTaskConflict
+	}
+	return nil
 }
 
 func (r *taskRepo) DeleteTask(ctx context.Context, id string) error {
-	_, err := r.collection.DeleteOne(ctx, map[string]string{"id": id})
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = r.collection.DeleteOne(ctx, bson.M{"_id": objId})
 	return err
 }
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type UsageRepo interface {
+	// AddUsage adds the tokens of record to the user's counters for its day and model
+	AddUsage(ctx context.Context, record *types.UsageRecord) error
+	// UserTokens returns the total tokens the user spent during day and during month
+	UserTokens(ctx context.Context, userID, day, month string) (daily int64, monthly int64, err error)
+	Report(ctx context.Context, filter types.UsageReportFilter) ([]*types.UsageReportRow, error)
+}
+
+type usageRepo struct {
+	collection *mongo.Collection
+}
+
+func NewUsageRepo(collection *mongo.Collection) UsageRepo {
+	return &usageRepo{
+		collection: collection,
+	}
+}
+
+func (r *usageRepo) AddUsage(ctx context.Context, record *types.UsageRecord) error {
+	filter := bson.M{"user_id": record.UserID, "day": record.Day, "model": record.Model}
+	update := bson.M{
+		"$inc": bson.M{
+			"prompt_tokens":     record.PromptTokens,
+			"completion_tokens": record.CompletionTokens,
+			"total_tokens":      record.TotalTokens,
+			"requests":          1,
+		},
+		"$set": bson.M{
+			"username":   record.Username,
+			"workspace":  record.Workspace,
+			"month":      record.Month,
+			"updated_at": time.Now().Unix(),
+		},
+	}
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent upsert created the counter first, the retry updates it
+		_, err = r.collection.UpdateOne(ctx, filter, update)
+	}
+	return err
+}
+
+func (r *usageRepo) UserTokens(ctx context.Context, userID, day, month string) (int64, int64, error) {
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID, "month": month}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     nil,
+			"monthly": bson.M{"$sum": "$total_tokens"},
+			"daily": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$eq": bson.A{"$day", day}}, "$total_tokens", 0},
+			}},
+		}}},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	var totals []struct {
+		Daily   int64 `bson:"daily"`
+		Monthly int64 `bson:"monthly"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return 0, 0, err
+	}
+	if len(totals) == 0 {
+		return 0, 0, nil
+	}
+	return totals[0].Daily, totals[0].Monthly, nil
+}
+
+func (r *usageRepo) Report(ctx context.Context, filter types.UsageReportFilter) ([]*types.UsageReportRow, error) {
+	match := bson.M{}
+	day := bson.M{}
+	if filter.From != "" {
+		day["$gte"] = filter.From
+	}
+	if filter.To != "" {
+		day["$lte"] = filter.To
+	}
+	if len(day) > 0 {
+		match["day"] = day
+	}
+	if filter.Workspace != "" {
+		match["workspace"] = filter.Workspace
+	}
+	if filter.Model != "" {
+		match["model"] = filter.Model
+	}
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":               bson.M{"day": "$day", "workspace": "$workspace"},
+			"users":             bson.M{"$addToSet": "$user_id"},
+			"requests":          bson.M{"$sum": "$requests"},
+			"prompt_tokens":     bson.M{"$sum": "$prompt_tokens"},
+			"completion_tokens": bson.M{"$sum": "$completion_tokens"},
+			"total_tokens":      bson.M{"$sum": "$total_tokens"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":               0,
+			"day":               "$_id.day",
+			"workspace":         "$_id.workspace",
+			"users":             bson.M{"$size": "$users"},
+			"requests":          1,
+			"prompt_tokens":     1,
+			"completion_tokens": 1,
+			"total_tokens":      1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "day", Value: -1}, {Key: "workspace", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]*types.UsageReportRow, 0)
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -2,11 +2,11 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/tieubaoca/chatbot-be/types"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 type UserRepo interface {
@@ -14,10 +14,17 @@ type UserRepo interface {
 	BatchCreateUser(ctx context.Context, users []*types.User) error
 	GetUser(ctx context.Context, id string) (*types.User, error)
 	GetUserByWorkspace(ctx context.Context, workspace string) ([]*types.User, error)
-	PaginateUser(ctx context.Context, page int64, limit int64) ([]*types.User, int64, error)
+	ListUsers(ctx context.Context, filter types.UserFilter, opts types.ListOptions) ([]*types.User, types.PageInfo, error)
 	UpdateUser(ctx context.Context, id string, user *types.User) error
-	DeleteUser(ctx context.Context, id string) error
+	// DeleteUser soft-deletes the user, every other query skips deleted users
+	DeleteUser(ctx context.Context, id, deletedBy string) error
+	RestoreUser(ctx context.Context, id string) error
+	ListDeletedUsers(ctx context.Context, opts types.ListOptions) ([]*types.User, types.PageInfo, error)
+	// PurgeDeletedUsers removes the users deleted at or before the given time
+	PurgeDeletedUsers(ctx context.Context, before int64) (int64, error)
 	GetUserByUsername(ctx context.Context, username string) (*types.User, error)
+	// GetDeletedUserByUsername finds the deleted user still holding a username
+	GetDeletedUserByUsername(ctx context.Context, username string) (*types.User, error)
 }
 
 type userRepo struct {
@@ -31,8 +38,14 @@ func NewUserRepo(collection *mongo.Collection) UserRepo {
 }
 
 func (r *userRepo) CreateUser(ctx context.Context, user *types.User) error {
-	_, err := r.collection.InsertOne(ctx, user)
-	return err
+	result, err := r.collection.InsertOne(ctx, user)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(bson.ObjectID); ok {
+		user.ID = id.Hex()
+	}
+	return nil
 }
 
 func (r *userRepo) BatchCreateUser(ctx context.Context, users []*types.User) error {
@@ -50,12 +63,12 @@ func (r *userRepo) GetUser(ctx context.Context, id string) (*types.User, error)
 		return nil, err
 	}
 	var user types.User
-	err = r.collection.FindOne(ctx, map[string]bson.ObjectID{"_id": objId}).Decode(&user)
+	err = r.collection.FindOne(ctx, notDeleted(bson.M{"_id": objId})).Decode(&user)
 	return &user, err
 }
 
 func (r *userRepo) GetUserByWorkspace(ctx context.Context, workspace string) ([]*types.User, error) {
-	cursor, err := r.collection.Find(ctx, map[string]string{"workspace": workspace})
+	cursor, err := r.collection.Find(ctx, notDeleted(bson.M{"workspace": workspace}))
 	if err != nil {
 		return nil, err
 	}
@@ -72,28 +85,37 @@ func (r *userRepo) GetUserByWorkspace(ctx context.Context, workspace string) ([]
 	return users, nil
 }
 
-func (r *userRepo) PaginateUser(ctx context.Context, page int64, limit int64) ([]*types.User, int64, error) {
-	opts := options.Find().SetSkip(page * limit).SetLimit(limit)
-	cursor, err := r.collection.Find(ctx, nil, opts)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer cursor.Close(ctx)
+var userListSpec = listSpec{
+	SortFields:   []string{"username", "full_name", "workspace", "management_level", "created_at", "updated_at", "deleted_at"},
+	DefaultSort:  "username",
+	SearchFields: []string{"username", "full_name"},
+}
 
-	var users []*types.User
-	for cursor.Next(ctx) {
-		var user types.User
-		if err := cursor.Decode(&user); err != nil {
-			return nil, 0, err
-		}
-		users = append(users, &user)
+func (r *userRepo) ListUsers(ctx context.Context, filter types.UserFilter, opts types.ListOptions) ([]*types.User, types.PageInfo, error) {
+	query := notDeleted(bson.M{})
+	if filter.Workspace != "" {
+		query["workspace"] = filter.Workspace
 	}
-
-	total, err := r.collection.CountDocuments(ctx, nil)
-	if err != nil {
-		return nil, 0, err
+	if filter.Role != "" {
+		query["role"] = filter.Role
+	}
+	if filter.WorkspaceRole != "" {
+		query["workspace_role"] = filter.WorkspaceRole
+	}
+	level := bson.M{}
+	if filter.ManagementLevel > 0 {
+		level["$eq"] = filter.ManagementLevel
+	}
+	if filter.MinLevel > 0 {
+		level["$gte"] = filter.MinLevel
 	}
-	return users, total, nil
+	if filter.MaxLevel > 0 {
+		level["$lte"] = filter.MaxLevel
+	}
+	if len(level) > 0 {
+		query["management_level"] = level
+	}
+	return findPage[types.User](ctx, r.collection, query, opts, userListSpec)
 }
 
 func (r *userRepo) UpdateUser(ctx context.Context, id string, user *types.User) error {
@@ -101,21 +123,52 @@ func (r *userRepo) UpdateUser(ctx context.Context, id string, user *types.User)
 	if err != nil {
 		return err
 	}
-	_, err = r.collection.UpdateOne(ctx, map[string]bson.ObjectID{"_id": objId}, user)
+	// _id is immutable, so it must not be part of the $set document
+	update := *user
+	update.ID = ""
+	_, err = r.collection.UpdateOne(ctx, notDeleted(bson.M{"_id": objId}), bson.M{"$set": update})
 	return err
 }
 
-func (r *userRepo) DeleteUser(ctx context.Context, id string) error {
+func (r *userRepo) DeleteUser(ctx context.Context, id, deletedBy string) error {
 	objId, err := bson.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
-	_, err = r.collection.DeleteOne(ctx, map[string]bson.ObjectID{"_id": objId})
-	return err
+	return softDelete(ctx, r.collection, objId, deletedBy, time.Now().Unix())
+}
+
+func (r *userRepo) RestoreUser(ctx context.Context, id string) error {
+	objId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	return restore(ctx, r.collection, objId)
+}
+
+func (r *userRepo) ListDeletedUsers(ctx context.Context, opts types.ListOptions) ([]*types.User, types.PageInfo, error) {
+	if opts.Sort == "" {
+		opts.Sort = "-deleted_at"
+	}
+	return findPage[types.User](ctx, r.collection, onlyDeleted(bson.M{}), opts, userListSpec)
+}
+
+func (r *userRepo) PurgeDeletedUsers(ctx context.Context, before int64) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lte": before}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
 }
 
 func (r *userRepo) GetUserByUsername(ctx context.Context, username string) (*types.User, error) {
 	var user types.User
-	err := r.collection.FindOne(ctx, map[string]string{"username": username}).Decode(&user)
+	err := r.collection.FindOne(ctx, notDeleted(bson.M{"username": username})).Decode(&user)
+	return &user, err
+}
+
+func (r *userRepo) GetDeletedUserByUsername(ctx context.Context, username string) (*types.User, error) {
+	var user types.User
+	err := r.collection.FindOne(ctx, onlyDeleted(bson.M{"username": username})).Decode(&user)
 	return &user, err
 }
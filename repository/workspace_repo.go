@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type WorkspaceRepo interface {
+	CreateWorkspace(ctx context.Context, workspace *types.Workspace) error
+	GetWorkspace(ctx context.Context, id string) (*types.Workspace, error)
+	ListWorkspaces(ctx context.Context) ([]*types.Workspace, error)
+	UpdateWorkspace(ctx context.Context, id string, fields map[string]interface{}) error
+	DeleteWorkspace(ctx context.Context, id string) error
+	// EnsureWorkspaces inserts the workspaces that do not exist yet and leaves the others untouched
+	EnsureWorkspaces(ctx context.Context, workspaces []types.Workspace) error
+}
+
+type workspaceRepo struct {
+	collection *mongo.Collection
+}
+
+func NewWorkspaceRepo(collection *mongo.Collection) WorkspaceRepo {
+	return &workspaceRepo{
+		collection: collection,
+	}
+}
+
+func (r *workspaceRepo) CreateWorkspace(ctx context.Context, workspace *types.Workspace) error {
+	_, err := r.collection.InsertOne(ctx, workspace)
+	return err
+}
+
+func (r *workspaceRepo) GetWorkspace(ctx context.Context, id string) (*types.Workspace, error) {
+	var workspace types.Workspace
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&workspace); err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+func (r *workspaceRepo) ListWorkspaces(ctx context.Context) ([]*types.Workspace, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	workspaces := make([]*types.Workspace, 0)
+	for cursor.Next(ctx) {
+		var workspace types.Workspace
+		if err := cursor.Decode(&workspace); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, &workspace)
+	}
+	return workspaces, nil
+}
+
+func (r *workspaceRepo) UpdateWorkspace(ctx context.Context, id string, fields map[string]interface{}) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *workspaceRepo) DeleteWorkspace(ctx context.Context, id string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *workspaceRepo) EnsureWorkspaces(ctx context.Context, workspaces []types.Workspace) error {
+	for _, workspace := range workspaces {
+		_, err := r.collection.UpdateOne(ctx,
+			bson.M{"_id": workspace.ID},
+			bson.M{"$setOnInsert": bson.M{
+				"name":        workspace.Name,
+				"description": workspace.Description,
+				"created_at":  workspace.CreateAt,
+				"updated_at":  workspace.UpdateAt,
+			}},
+			options.UpdateOne().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
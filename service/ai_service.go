@@ -3,9 +3,34 @@ package service
 import (
 	"context"
 
+	"github.com/sashabaranov/go-openai/jsonschema"
 	"github.com/tieubaoca/chatbot-be/types"
 )
 
+// AIService is a chat backend. Both answer with the RAG tool and the registered functions.
 type AIService interface {
-	Chat(ctx context.Context, prompt string, messages []types.Message) (string, error)
+	Chat(ctx context.Context, messages []types.Message) (*types.Message, error)
+	// ChatStream streams the answer to the handler and returns it once it is complete
+	ChatStream(ctx context.Context, messages []types.Message, handler types.StreamEventHandler) (*types.Message, error)
 }
+
+// FunctionRegistry is a backend whose model can call the registered functions
+type FunctionRegistry interface {
+	RegisterFunctionCall(name, description string, params jsonschema.Definition, handler types.FunctionHandler) error
+}
+
+// ChatBackend is a backend configured with the services shared by every model
+type ChatBackend interface {
+	AIService
+	FunctionRegistry
+	RegisterRAGFunctionCall() error
+	SetUsageService(usage UsageService)
+	SetFAQService(faq FAQService)
+	SetRetriever(retriever *Retriever)
+	SetPromptService(prompts PromptService)
+}
+
+var (
+	_ ChatBackend = (*OpenAIService)(nil)
+	_ ChatBackend = (*GeminiService)(nil)
+)
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+const (
+	// auditWriteTimeout bounds how long recording an event may delay a request
+	auditWriteTimeout = 5 * time.Second
+	// maxAuditQuestionLength bounds the question kept in chat.ask events, in runes
+	maxAuditQuestionLength = 500
+)
+
+type AuditService interface {
+	// Record stores the event. Failures are logged and never fail the audited action.
+	Record(ctx context.Context, event *types.AuditEvent)
+	ListEvents(ctx context.Context, filter types.AuditFilter, opts types.ListOptions) ([]*types.AuditEvent, types.PageInfo, error)
+	// ExportEvents writes the matching events as JSON lines, oldest first
+	ExportEvents(ctx context.Context, filter types.AuditFilter, w io.Writer) error
+}
+
+type auditService struct {
+	auditRepo repository.AuditRepo
+}
+
+func NewAuditService(auditRepo repository.AuditRepo) AuditService {
+	return &auditService{
+		auditRepo: auditRepo,
+	}
+}
+
+// NewAuditEvent describes an action of the caller identified by the JWT claims in ctx.
+// The outcome is derived from err.
+func NewAuditEvent(ctx context.Context, ip, userAgent, action, targetType, targetID string, err error) *types.AuditEvent {
+	event := &types.AuditEvent{
+		ActorType:  types.AUDIT_ACTOR_ANONYMOUS,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         ip,
+		UserAgent:  userAgent,
+		Outcome:    types.AUDIT_OUTCOME_SUCCESS,
+		CreateAt:   time.Now().Unix(),
+	}
+	if claims, ok := utils.UserClaimsFromContext(ctx); ok {
+		event.ActorType = types.AUDIT_ACTOR_USER
+		event.ActorID = claims.ID
+		event.Actor = claims.Username
+		event.Workspace = claims.Workspace
+	} else if claims, ok := utils.AdminClaimsFromContext(ctx); ok {
+		event.ActorType = types.AUDIT_ACTOR_ADMIN
+		event.ActorID = claims.ID
+		event.Actor = claims.Username
+	}
+	if err != nil {
+		event.Outcome = types.AUDIT_OUTCOME_FAILURE
+		if errors.Is(err, ErrPermissionDenied) {
+			event.Outcome = types.AUDIT_OUTCOME_DENIED
+		}
+		event.Message = err.Error()
+	}
+	return event
+}
+
+// NewChatAuditEvent records the latest user message of a conversation sent to the assistant
+func NewChatAuditEvent(ctx context.Context, ip, userAgent string, messages []types.Message, err error) *types.AuditEvent {
+	return NewQuestionAuditEvent(ctx, ip, userAgent, lastUserMessage(messages), err)
+}
+
+func NewQuestionAuditEvent(ctx context.Context, ip, userAgent, question string, err error) *types.AuditEvent {
+	event := NewAuditEvent(ctx, ip, userAgent, types.AUDIT_ACTION_CHAT_ASK, "", "", err)
+	if runes := []rune(question); len(runes) > maxAuditQuestionLength {
+		question = string(runes[:maxAuditQuestionLength]) + "…"
+	}
+	event.Details = map[string]string{"question": question}
+	return event
+}
+
+func (s *auditService) Record(ctx context.Context, event *types.AuditEvent) {
+	// The event is kept even when the client has gone away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditWriteTimeout)
+	defer cancel()
+	if err := s.auditRepo.RecordEvent(ctx, event); err != nil {
+		log.Printf("Failed to record audit event %s by %s: %v", event.Action, event.Actor, err)
+	}
+}
+
+func (s *auditService) ListEvents(ctx context.Context, filter types.AuditFilter, opts types.ListOptions) ([]*types.AuditEvent, types.PageInfo, error) {
+	return s.auditRepo.ListEvents(ctx, filter, opts)
+}
+
+func (s *auditService) ExportEvents(ctx context.Context, filter types.AuditFilter, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return s.auditRepo.EachEvent(ctx, filter, func(event *types.AuditEvent) error {
+		return encoder.Encode(event)
+	})
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrUserNotFound tells the login service to try the next provider
+var ErrUserNotFound = errors.New("user not found")
+
+// AuthProvider verifies a username and password and returns the matching user.
+// It returns ErrUserNotFound when it does not know the user and
+// ErrInvalidCredentials when it knows the user but the password is wrong.
+type AuthProvider interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*types.User, error)
+}
+
+type mongoAuthProvider struct {
+	userRepo repository.UserRepo
+}
+
+// NewMongoAuthProvider checks passwords stored in the users collection
+func NewMongoAuthProvider(userRepo repository.UserRepo) AuthProvider {
+	return &mongoAuthProvider{
+		userRepo: userRepo,
+	}
+}
+
+func (p *mongoAuthProvider) Name() string {
+	return "mongo"
+}
+
+func (p *mongoAuthProvider) Authenticate(ctx context.Context, username, password string) (*types.User, error) {
+	user, err := p.userRepo.GetUserByUsername(ctx, username)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Directory users are provisioned without a local password
+	if user.AuthSource == types.USER_AUTH_SOURCE_LDAP || user.Password == "" {
+		return nil, ErrUserNotFound
+	}
+	if subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
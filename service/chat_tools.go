@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// chatTools is what the chat backends share besides their model: the services used while
+// answering, the registered functions and the document retrieval of the RAG tool. The
+// backends only convert the results to their own messages.
+type chatTools struct {
+	vectorDB      database.VectorDatabase
+	functionsCall map[string]types.FunctionHandler
+	usage         UsageService
+	faq           FAQService
+	retriever     *Retriever
+	prompts       PromptService
+}
+
+// SetUsageService enables token accounting and quota enforcement for the chats of users
+func (t *chatTools) SetUsageService(usage UsageService) {
+	t.usage = usage
+}
+
+// SetFAQService makes document retrieval answer matching questions from the FAQ first
+func (t *chatTools) SetFAQService(faq FAQService) {
+	t.faq = faq
+}
+
+// SetRetriever replaces the single search of the queries chosen by the model with
+// server-side query planning and rank fusion
+func (t *chatTools) SetRetriever(retriever *Retriever) {
+	t.retriever = retriever
+}
+
+// SetPromptService makes the prompts come from the templates of the caller's workspace
+func (t *chatTools) SetPromptService(prompts PromptService) {
+	t.prompts = prompts
+}
+
+func (t *chatTools) checkQuota(ctx context.Context) error {
+	if t.usage == nil {
+		return nil
+	}
+	return t.usage.CheckQuota(ctx)
+}
+
+// recordUsage accounts the tokens of a completion of the model. Behind the router they
+// are accounted to the name of the model in the router, the one answers are marked with.
+func (t *chatTools) recordUsage(ctx context.Context, model string, promptTokens, completionTokens int) {
+	if t.usage == nil {
+		return
+	}
+	t.usage.Record(ctx, routedModelName(ctx, model), promptTokens, completionTokens)
+}
+
+// registerFunction keeps the handler of a function the model may call
+func (t *chatTools) registerFunction(name string, handler types.FunctionHandler) error {
+	if name == ragFunctionName {
+		return fmt.Errorf("function name %s is reserved", ragFunctionName)
+	}
+	if t.functionsCall == nil {
+		t.functionsCall = make(map[string]types.FunctionHandler)
+	}
+	t.functionsCall[name] = handler
+	return nil
+}
+
+// runFunction runs a registered function with the JSON arguments of the model. The error
+// is meant for the model, a panic of the handler is reported as a failure.
+func (t *chatTools) runFunction(ctx context.Context, name string, args []byte) (result any, err error) {
+	handler := t.functionsCall[name]
+	if handler == nil {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Function call %s panicked: %v", name, r)
+			result, err = nil, fmt.Errorf("function %s failed", name)
+		}
+	}()
+	result, err = handler(ctx, args)
+	if err != nil {
+		log.Printf("Function call %s failed: %v", name, err)
+	}
+	return result, err
+}
+
+// retrieval is the outcome of a RAG tool call: the prompt with the retrieved chunks, the
+// FAQ entry answering the question instead, or the error to report to the model
+type retrieval struct {
+	prompt   string
+	chunkIDs []string
+	faq      *types.FAQMatch
+	err      error
+}
+
+// chatPlan is the query plan of one chat, planned at its first RAG call only so that
+// further and parallel calls do not ask the planner again
+type chatPlan struct {
+	retriever    *Retriever
+	conversation []types.Message
+
+	once sync.Once
+	plan *types.QueryPlan
+}
+
+func (t *chatTools) newChatPlan(conversation []types.Message) *chatPlan {
+	return &chatPlan{retriever: t.retriever, conversation: conversation}
+}
+
+// get returns the plan of the chat, nil without a retriever
+func (p *chatPlan) get(ctx context.Context) *types.QueryPlan {
+	if p.retriever == nil {
+		return nil
+	}
+	p.once.Do(func() {
+		p.plan = p.retriever.Plan(ctx, p.conversation)
+	})
+	return p.plan
+}
+
+// retrieve answers a RAG tool call with the JSON arguments of the model. A matching FAQ
+// entry is returned instead of searching.
+func (t *chatTools) retrieve(ctx context.Context, chat *chatPlan, args []byte) retrieval {
+	var retrieveDocumentArgs struct {
+		Queries  []string `json:"queries"`
+		Question string   `json:"question"`
+	}
+	if err := json.Unmarshal(args, &retrieveDocumentArgs); err != nil {
+		return retrieval{err: fmt.Errorf("invalid arguments: %w", err)}
+	}
+	// The question of the call is kept, the plan only fills it in and adds queries
+	question := retrieveDocumentArgs.Question
+	queries := retrieveDocumentArgs.Queries
+	plan := chat.get(ctx)
+	if question == "" && plan != nil {
+		question = plan.Question
+	}
+	if question == "" {
+		question = lastUserMessage(chat.conversation)
+	}
+
+	if match := matchFAQ(ctx, t.faq, question); match != nil {
+		return retrieval{faq: match}
+	}
+
+	// Users only retrieve the global documents and those of their workspace
+	scope := types.Metadata{Workspaces: VisibleWorkspaces(ctx)}
+	var docs []types.Document
+	var err error
+	if plan != nil {
+		queries = slices.Concat(plan.Queries, []string{question}, queries)
+		docs, err = t.retriever.Search(ctx, uniqueQueries(queries), scope, 5)
+	} else {
+		queries = uniqueQueries(queries)
+		if len(queries) == 0 {
+			queries = []string{question}
+		}
+		docs, _, err = t.vectorDB.SearchSimilarWithMetadata(ctx, queries, scope, 5)
+	}
+	if err != nil {
+		log.Printf("Document retrieval failed: %v", err)
+		return retrieval{err: errors.New("document search is unavailable")}
+	}
+	if len(docs) == 0 {
+		return retrieval{prompt: retrievalPrompt(ctx, t.prompts, "No documents found", question)}
+	}
+	jsonDocs, err := json.Marshal(docs)
+	if err != nil {
+		return retrieval{err: err}
+	}
+	chunkIDs := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		chunkIDs = append(chunkIDs, doc.ID)
+	}
+	return retrieval{prompt: retrievalPrompt(ctx, t.prompts, string(jsonDocs), question), chunkIDs: chunkIDs}
+}
+
+// chatRounds gathers what the tool rounds of one chat found, so that every backend ends
+// a chat the same way
+type chatRounds struct {
+	chunkIDs []string
+	faq      *types.FAQMatch
+	// functionsRan tells whether a function other than retrieval ran, its outcome must
+	// then be told by the model and an FAQ answer no longer ends the chat on its own
+	functionsRan bool
+}
+
+// offersTools tells whether a round offers tools, the last one offers none so that the
+// model has to answer
+func offersTools(iteration int) bool {
+	return iteration < maxToolIterations
+}
+
+// answer returns the answer of the model when it called no tools or the rounds are over,
+// or nil when the calls must run. Some servers finish with "stop" even when they call
+// tools, the calls are what matters.
+func (r *chatRounds) answer(iteration int, text string, calls int) (*types.Message, error) {
+	if calls > 0 && offersTools(iteration) {
+		return nil, nil
+	}
+	if text == "" && calls > 0 {
+		return nil, fmt.Errorf("no answer after %d rounds of tool calls", maxToolIterations)
+	}
+	return &types.Message{
+		Role:     "assistant",
+		Content:  text,
+		ChunkIDs: r.chunkIDs,
+	}, nil
+}
+
+// record adds the outcome of a call of the round, only RAG calls retrieve anything
+func (r *chatRounds) record(name string, result retrieval) {
+	r.functionsRan = r.functionsRan || name != ragFunctionName
+	r.chunkIDs = append(r.chunkIDs, result.chunkIDs...)
+	if r.faq == nil {
+		r.faq = result.faq
+	}
+}
+
+// faqAnswer returns the FAQ answer ending the chat after a round that only retrieved
+// documents, the model otherwise quotes the entry it was given
+func (r *chatRounds) faqAnswer(ctx context.Context, prompts PromptService) *types.Message {
+	match := r.faq
+	r.faq = nil
+	if match == nil || r.functionsRan {
+		return nil
+	}
+	return faqMessage(ctx, prompts, match)
+}
+
+// streamFAQAnswer streams an FAQ answer, it is not generated by the model so nothing of
+// it was streamed yet
+func streamFAQAnswer(answer *types.Message, handler types.StreamEventHandler) {
+	if answer.FAQID != "" {
+		handler(types.StreamEvent{Type: types.STREAM_EVENT_DELTA, Content: answer.Content})
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// countingPlanner counts its plans, a hanging planner waits for the end of its context
+type countingPlanner struct {
+	plans   atomic.Int32
+	hanging bool
+}
+
+func (p *countingPlanner) PlanQueries(ctx context.Context, conversation []types.Message, variants int) (*types.QueryPlan, error) {
+	p.plans.Add(1)
+	if p.hanging {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &types.QueryPlan{Question: "planned question", Queries: []string{"planned query"}}, nil
+}
+
+func newTestChatTools(t *testing.T, planner QueryPlanner, retrieval config.RetrievalConfig) *chatTools {
+	t.Helper()
+	store, err := database.NewMemoryStore(flatEmbedder{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.BatchInsertDocuments(context.Background(), []types.Document{{Content: "Leave policy"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	retrieval.CandidatesPerQuery, retrieval.RRFK = 5, 60
+	return &chatTools{vectorDB: store, retriever: NewRetriever(planner, store, retrieval)}
+}
+
+func TestChatRetrievalPlansOncePerChat(t *testing.T) {
+	planner := &countingPlanner{}
+	tools := newTestChatTools(t, planner, config.RetrievalConfig{})
+	plan := tools.newChatPlan([]types.Message{{Role: "user", Content: "nghỉ phép"}})
+
+	// Parallel calls of a round and the calls of later rounds share the plan
+	args := []string{`{"question": "model question"}`, `{"queries": ["leave"]}`, `{}`}
+	results := make([]retrieval, len(args))
+	var wg sync.WaitGroup
+	for i := range args {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = tools.retrieve(context.Background(), plan, []byte(args[i]))
+		}(i)
+	}
+	wg.Wait()
+	tools.retrieve(context.Background(), plan, []byte(`{}`))
+
+	if plans := planner.plans.Load(); plans != 1 {
+		t.Errorf("planned %d times, want once", plans)
+	}
+	for i, result := range results {
+		if result.err != nil || len(result.chunkIDs) != 1 {
+			t.Fatalf("retrieval %d = %+v", i, result)
+		}
+	}
+	// The question of the model is kept, the plan only fills it in
+	if !strings.Contains(results[0].prompt, "model question") || strings.Contains(results[0].prompt, "planned question") {
+		t.Errorf("prompt of the call with a question %q", results[0].prompt)
+	}
+	if !strings.Contains(results[2].prompt, "planned question") {
+		t.Errorf("prompt of the call without a question %q", results[2].prompt)
+	}
+}
+
+func TestChatRetrievalFallsBackWhenPlanningTimesOut(t *testing.T) {
+	planner := &countingPlanner{hanging: true}
+	tools := newTestChatTools(t, planner, config.RetrievalConfig{PlanTimeoutSeconds: 1})
+	plan := tools.newChatPlan([]types.Message{{Role: "user", Content: "nghỉ phép"}})
+
+	start := time.Now()
+	result := tools.retrieve(context.Background(), plan, []byte(`{}`))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("retrieval took %s", elapsed)
+	}
+	if result.err != nil || len(result.chunkIDs) != 1 || !strings.Contains(result.prompt, "nghỉ phép") {
+		t.Errorf("retrieval after the planner timed out = %+v", result)
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// deadlineScanBatch is the number of tasks loaded per query during a scan
+const deadlineScanBatch = 200
+
+// activeTaskStatuses are the statuses whose deadline still matters
+var activeTaskStatuses = []string{types.TASK_STATUS_OPEN, types.TASK_STATUS_DOING, types.TASK_STATUS_REVIEW}
+
+// DeadlineScheduler periodically looks for active tasks that are due soon or
+// overdue and notifies their assignee and reporter once per deadline
+type DeadlineScheduler struct {
+	taskRepo         repository.TaskRepo
+	userRepo         repository.UserRepo
+	notificationRepo repository.NotificationRepo
+	hub              *NotificationHub
+	notifiers        []Notifier
+	interval         time.Duration
+	dueSoon          time.Duration
+}
+
+func NewDeadlineScheduler(taskRepo repository.TaskRepo, userRepo repository.UserRepo, notificationRepo repository.NotificationRepo,
+	hub *NotificationHub, notifiers []Notifier, interval, dueSoon time.Duration) *DeadlineScheduler {
+	return &DeadlineScheduler{
+		taskRepo:         taskRepo,
+		userRepo:         userRepo,
+		notificationRepo: notificationRepo,
+		hub:              hub,
+		notifiers:        notifiers,
+		interval:         interval,
+		dueSoon:          dueSoon,
+	}
+}
+
+// Start scans right away and then every interval until ctx is cancelled
+func (s *DeadlineScheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			if err := s.Scan(ctx); err != nil {
+				log.Printf("Deadline scan failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Scan notifies about every active task with a deadline before now + dueSoon
+func (s *DeadlineScheduler) Scan(ctx context.Context) error {
+	now := time.Now()
+	filter := types.TaskFilter{
+		Status:   activeTaskStatuses,
+		Deadline: now.Add(s.dueSoon).Unix(),
+	}
+	opts := types.ListOptions{Limit: deadlineScanBatch, Sort: "deadline"}
+	for {
+		tasks, page, err := s.taskRepo.ListTasks(ctx, filter, opts)
+		if err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			s.notifyTask(ctx, task, now)
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+func (s *DeadlineScheduler) notifyTask(ctx context.Context, task *types.Task, now time.Time) {
+	deadline := time.Unix(task.Deadline, 0)
+	notificationType := types.NOTIFICATION_TYPE_TASK_DUE_SOON
+	title := fmt.Sprintf("Task %q is due soon", task.Title)
+	message := fmt.Sprintf("Task %q is due at %s.", task.Title, deadline.Format("2006-01-02 15:04"))
+	if !deadline.After(now) {
+		notificationType = types.NOTIFICATION_TYPE_TASK_OVERDUE
+		title = fmt.Sprintf("Task %q is overdue", task.Title)
+		message = fmt.Sprintf("Task %q was due at %s and is still %s.", task.Title, deadline.Format("2006-01-02 15:04"), task.Status)
+	}
+
+	recipients := []string{task.Assignee}
+	if task.Reporter != task.Assignee {
+		recipients = append(recipients, task.Reporter)
+	}
+	for _, userID := range recipients {
+		if userID == "" {
+			continue
+		}
+		notification := &types.Notification{
+			UserID: userID,
+			Type:   notificationType,
+			// The deadline is part of the key so a rescheduled task is notified again
+			Key:      fmt.Sprintf("%s:%s:%d", task.ID, notificationType, task.Deadline),
+			TaskID:   task.ID,
+			Title:    title,
+			Message:  message,
+			CreateAt: now.Unix(),
+		}
+		created, err := s.notificationRepo.CreateNotification(ctx, notification)
+		if err != nil {
+			log.Printf("Failed to store notification for task %s: %v", task.ID, err)
+			continue
+		}
+		if !created {
+			continue
+		}
+		s.hub.Publish(notification)
+		s.notifyExternal(ctx, notification)
+	}
+}
+
+func (s *DeadlineScheduler) notifyExternal(ctx context.Context, notification *types.Notification) {
+	if len(s.notifiers) == 0 {
+		return
+	}
+	user, err := s.userRepo.GetUser(ctx, notification.UserID)
+	if err != nil {
+		log.Printf("Failed to load user %s for notification: %v", notification.UserID, err)
+		return
+	}
+	for _, notifier := range s.notifiers {
+		if err := notifier.Notify(ctx, user, notification); err != nil {
+			log.Printf("%s notifier failed for user %s: %v", notifier.Name(), user.Username, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// recordingNotifier collects the external notifications per user
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (n *recordingNotifier) Name() string {
+	return "recording"
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, user *types.User, notification *types.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, user.Username+":"+notification.Type)
+	return nil
+}
+
+func TestDeadlineSchedulerNotifiesOncePerDeadline(t *testing.T) {
+	alice := &types.User{Username: "alice"}
+	bob := &types.User{Username: "bob"}
+	users := newFakeUserRepo(alice, bob)
+	deadline := time.Now().Add(-time.Hour).Unix()
+	tasks := &fakeTaskRepo{tasks: []*types.Task{
+		{ID: "t1", Title: "Quarterly report", Status: types.TASK_STATUS_OPEN, Assignee: alice.ID, Reporter: bob.ID, Deadline: deadline},
+		// Reported to oneself, notified once
+		{ID: "t2", Title: "Review", Status: types.TASK_STATUS_DOING, Assignee: alice.ID, Reporter: alice.ID, Deadline: time.Now().Add(time.Hour).Unix()},
+		{ID: "t3", Title: "Later", Status: types.TASK_STATUS_OPEN, Assignee: alice.ID, Reporter: bob.ID, Deadline: time.Now().Add(72 * time.Hour).Unix()},
+	}}
+	notifications := &fakeNotificationRepo{}
+	hub := NewNotificationHub()
+	inbox, unsubscribe := hub.Subscribe(alice.ID)
+	defer unsubscribe()
+	notifier := &recordingNotifier{}
+	scheduler := NewDeadlineScheduler(tasks, users, notifications, hub, []Notifier{notifier}, time.Minute, 24*time.Hour)
+
+	if err := scheduler.Scan(context.Background()); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(notifications.notifications) != 3 {
+		t.Fatalf("%d notifications stored, want 3", len(notifications.notifications))
+	}
+	if key := notifications.notifications[0].Key; key != fmt.Sprintf("t1:%s:%d", types.NOTIFICATION_TYPE_TASK_OVERDUE, deadline) {
+		t.Errorf("key %q", key)
+	}
+	if len(inbox) != 2 {
+		t.Errorf("%d notifications published to alice, want 2", len(inbox))
+	}
+
+	// A second scan finds the same keys and neither publishes nor sends anything
+	if err := scheduler.Scan(context.Background()); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(notifications.notifications) != 3 || len(notifier.sent) != 3 {
+		t.Errorf("second scan: %d stored, %d sent, want 3 and 3", len(notifications.notifications), len(notifier.sent))
+	}
+
+	// Moving the deadline changes the key, so the rescheduled task is notified again
+	tasks.mu.Lock()
+	tasks.tasks[0].Deadline = time.Now().Add(2 * time.Hour).Unix()
+	tasks.mu.Unlock()
+	if err := scheduler.Scan(context.Background()); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(notifications.notifications) != 5 {
+		t.Fatalf("%d notifications after rescheduling, want 5", len(notifications.notifications))
+	}
+	if last := notifications.notifications[4]; last.Type != types.NOTIFICATION_TYPE_TASK_DUE_SOON || last.TaskID != "t1" {
+		t.Errorf("rescheduled notification %s for %s, want %s for t1", last.Type, last.TaskID, types.NOTIFICATION_TYPE_TASK_DUE_SOON)
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+type DocumentService interface {
+	ListDocuments(ctx context.Context, filter types.DocumentFilter, opts types.ListOptions) ([]*types.DocumentRecord, types.PageInfo, error)
+	ListDeletedDocuments(ctx context.Context, opts types.ListOptions) ([]*types.DocumentRecord, types.PageInfo, error)
+	// DeleteDocument soft-deletes the document and hides its chunks from search
+	DeleteDocument(ctx context.Context, id, deletedBy string) error
+	// DeleteWorkspaceDocument soft-deletes the document if it belongs to a workspace the caller may access
+	DeleteWorkspaceDocument(ctx context.Context, caller *utils.UserClaims, id string) error
+	RestoreDocument(ctx context.Context, id string) error
+	// PurgeDocuments removes the documents deleted at or before the given time, with their chunks and files
+	PurgeDocuments(ctx context.Context, before int64) (int, error)
+}
+
+type documentService struct {
+	documentRepo repository.DocumentRepo
+	vectorDB     database.VectorDatabase
+	uploadDir    string
+}
+
+func NewDocumentService(documentRepo repository.DocumentRepo, vectorDB database.VectorDatabase, uploadDir string) DocumentService {
+	return &documentService{
+		documentRepo: documentRepo,
+		vectorDB:     vectorDB,
+		uploadDir:    uploadDir,
+	}
+}
+
+func (s *documentService) ListDocuments(ctx context.Context, filter types.DocumentFilter, opts types.ListOptions) ([]*types.DocumentRecord, types.PageInfo, error) {
+	return s.documentRepo.ListDocuments(ctx, filter, opts)
+}
+
+func (s *documentService) ListDeletedDocuments(ctx context.Context, opts types.ListOptions) ([]*types.DocumentRecord, types.PageInfo, error) {
+	return s.documentRepo.ListDeletedDocuments(ctx, opts)
+}
+
+func (s *documentService) DeleteDocument(ctx context.Context, id, deletedBy string) error {
+	if _, err := s.documentRepo.GetDocument(ctx, id); err != nil {
+		if isNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return s.deleteDocument(ctx, id, deletedBy)
+}
+
+func (s *documentService) DeleteWorkspaceDocument(ctx context.Context, caller *utils.UserClaims, id string) error {
+	doc, err := s.documentRepo.GetDocument(ctx, id)
+	if err != nil {
+		if isNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	// Documents of other workspaces are reported as missing rather than forbidden
+	if !caller.CanAccessWorkspace(doc.Workspace) {
+		return ErrNotFound
+	}
+	return s.deleteDocument(ctx, id, caller.Username)
+}
+
+func (s *documentService) deleteDocument(ctx context.Context, id, deletedBy string) error {
+	// Chunks are hidden first, so a failure leaves the document live and the call can be retried
+	if err := s.vectorDB.SetDocumentDeleted(ctx, id, true); err != nil {
+		return err
+	}
+	err := s.documentRepo.DeleteDocument(ctx, id, deletedBy)
+	if isNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *documentService) RestoreDocument(ctx context.Context, id string) error {
+	if _, err := s.documentRepo.GetDeletedDocument(ctx, id); err != nil {
+		if isNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := s.vectorDB.SetDocumentDeleted(ctx, id, false); err != nil {
+		return err
+	}
+	err := s.documentRepo.RestoreDocument(ctx, id)
+	if isNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *documentService) PurgeDocuments(ctx context.Context, before int64) (int, error) {
+	docs, err := s.documentRepo.ListPurgeableDocuments(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, doc := range docs {
+		if err := s.vectorDB.DeleteDocumentChunks(ctx, doc.ID); err != nil {
+			return purged, err
+		}
+		if doc.File != "" {
+			err := os.Remove(filepath.Join(s.uploadDir, filepath.Base(doc.File)))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return purged, err
+			}
+		}
+		if err := s.documentRepo.PurgeDocument(ctx, doc.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// searchedDocuments returns the sorted document IDs of the chunks a search finds
+func searchedDocuments(t *testing.T, vectorDB database.VectorDatabase) []string {
+	t.Helper()
+	chunks, _, err := vectorDB.SearchSimilarWithMetadata(context.Background(), []string{"policy"}, types.Metadata{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, chunk := range chunks {
+		ids = append(ids, chunk.Metadata.DocumentID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestDocumentServiceDeleteRestoreAndPurge(t *testing.T) {
+	ctx := context.Background()
+	store, err := database.NewMemoryStore(flatEmbedder{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := []types.Document{
+		{Content: "leave policy", Metadata: types.Metadata{DocumentID: "d1"}},
+		{Content: "leave policy, part 2", Metadata: types.Metadata{DocumentID: "d1"}},
+		{Content: "travel policy", Metadata: types.Metadata{DocumentID: "d2"}},
+	}
+	if err := store.BatchInsertDocuments(ctx, chunks, nil); err != nil {
+		t.Fatal(err)
+	}
+	uploadDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(uploadDir, "leave.pdf"), []byte("%PDF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	repo := newFakeDocumentRepo(
+		&types.DocumentRecord{ID: "d1", Title: "Leave", File: "leave.pdf", Chunks: 2},
+		&types.DocumentRecord{ID: "d2", Title: "Travel", Chunks: 1},
+	)
+	documents := NewDocumentService(repo, store, uploadDir)
+
+	// Deleting hides the chunks, restoring shows them again
+	if err := documents.DeleteDocument(ctx, "d1", "alice"); err != nil {
+		t.Fatalf("DeleteDocument: %v", err)
+	}
+	if ids := searchedDocuments(t, store); !slices.Equal(ids, []string{"d2"}) {
+		t.Errorf("search after delete found %v", ids)
+	}
+	if err := documents.DeleteDocument(ctx, "d1", "alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteDocument twice = %v, want ErrNotFound", err)
+	}
+	if err := documents.RestoreDocument(ctx, "d1"); err != nil {
+		t.Fatalf("RestoreDocument: %v", err)
+	}
+	if ids := searchedDocuments(t, store); !slices.Equal(ids, []string{"d1", "d1", "d2"}) {
+		t.Errorf("search after restore found %v", ids)
+	}
+	if err := documents.RestoreDocument(ctx, "d1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RestoreDocument of a live document = %v, want ErrNotFound", err)
+	}
+
+	// Purging removes the chunks and the uploaded file of the deleted documents only
+	if err := documents.DeleteDocument(ctx, "d1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := documents.PurgeDocuments(ctx, time.Now().Unix())
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeDocuments = %d, %v; want 1", purged, err)
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir, "leave.pdf")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("uploaded file kept: %v", err)
+	}
+	if err := store.SetDocumentDeleted(ctx, "d1", false); err != nil {
+		t.Fatal(err)
+	}
+	if ids := searchedDocuments(t, store); !slices.Equal(ids, []string{"d2"}) {
+		t.Errorf("search after purge found %v", ids)
+	}
+	if !slices.Equal(repo.purged, []string{"d1"}) {
+		t.Errorf("purged records %v", repo.purged)
+	}
+}
+
+func TestDeleteWorkspaceDocumentStaysInTheCallersWorkspace(t *testing.T) {
+	ctx := context.Background()
+	store, err := database.NewMemoryStore(flatEmbedder{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newFakeDocumentRepo(
+		&types.DocumentRecord{ID: "d1", Title: "Leave", Workspace: types.DepartmentTechnical},
+		&types.DocumentRecord{ID: "d2", Title: "Travel", Workspace: types.DepartmentQuality},
+		&types.DocumentRecord{ID: "d3", Title: "Onboarding"},
+	)
+	documents := NewDocumentService(repo, store, t.TempDir())
+	head := &utils.UserClaims{Username: "alice", Workspace: types.DepartmentTechnical, WorkspaceRole: types.USER_WORKSPACE_ROLE_HEAD}
+	executive := &utils.UserClaims{Username: "bob", Workspace: types.DepartmentTechnical, WorkspaceRole: types.USER_WORKSPACE_ROLE_EXECUTIVE}
+
+	if err := documents.DeleteWorkspaceDocument(ctx, head, "d1"); err != nil {
+		t.Fatalf("DeleteWorkspaceDocument of the own workspace: %v", err)
+	}
+	if deleted := repo.documents["d1"]; deleted.DeletedAt == 0 || deleted.DeletedBy != "alice" {
+		t.Errorf("d1 deleted at %d by %q", deleted.DeletedAt, deleted.DeletedBy)
+	}
+	// Documents of another workspace or of no workspace are not visible to a head
+	for _, id := range []string{"d2", "d3", "missing"} {
+		if err := documents.DeleteWorkspaceDocument(ctx, head, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteWorkspaceDocument of %s = %v, want ErrNotFound", id, err)
+		}
+	}
+	if repo.documents["d2"].DeletedAt != 0 || repo.documents["d3"].DeletedAt != 0 {
+		t.Error("a document outside the caller's workspace was deleted")
+	}
+	if err := documents.DeleteWorkspaceDocument(ctx, executive, "d2"); err != nil {
+		t.Errorf("DeleteWorkspaceDocument by an executive: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrNotFound         = errors.New("not found")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrConflict         = errors.New("conflict")
+)
+
+// isNotFound reports whether a repository error means the document does not exist,
+// including malformed ids that can never match a document
+func isNotFound(err error) bool {
+	var invalidByte hex.InvalidByteError
+	return errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, bson.ErrInvalidHex) || errors.As(err, &invalidByte)
+}
@@ -0,0 +1,504 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// fakeUserRepo keeps users in memory with the semantics of the Mongo repo: usernames are
+// unique across deleted users too and lookups skip deleted users. The methods a test does
+// not need panic through the nil embedded interface.
+type fakeUserRepo struct {
+	repository.UserRepo
+
+	mu      sync.Mutex
+	users   map[string]*types.User
+	nextID  int
+	updates int
+}
+
+func newFakeUserRepo(users ...*types.User) *fakeUserRepo {
+	repo := &fakeUserRepo{users: make(map[string]*types.User)}
+	for _, user := range users {
+		repo.CreateUser(context.Background(), user)
+	}
+	return repo
+}
+
+func (r *fakeUserRepo) CreateUser(ctx context.Context, user *types.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.users {
+		if existing.Username == user.Username {
+			return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "duplicate key"}}}
+		}
+	}
+	r.nextID++
+	user.ID = fmt.Sprintf("%024x", r.nextID)
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *fakeUserRepo) GetUser(ctx context.Context, id string) (*types.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *fakeUserRepo) GetUserByUsername(ctx context.Context, username string) (*types.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Username == username && user.DeletedAt == 0 {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *fakeUserRepo) GetDeletedUserByUsername(ctx context.Context, username string) (*types.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Username == username && user.DeletedAt != 0 {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *fakeUserRepo) UpdateUser(ctx context.Context, id string, user *types.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[id]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	stored := *user
+	stored.ID = id
+	r.users[id] = &stored
+	r.updates++
+	return nil
+}
+
+// fakeTaskRepo lists the tasks whose deadline is before the filter deadline, in one page
+type fakeTaskRepo struct {
+	repository.TaskRepo
+
+	mu    sync.Mutex
+	tasks []*types.Task
+}
+
+func (r *fakeTaskRepo) ListTasks(ctx context.Context, filter types.TaskFilter, opts types.ListOptions) ([]*types.Task, types.PageInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tasks := make([]*types.Task, 0)
+	for _, task := range r.tasks {
+		if filter.Deadline == 0 || task.Deadline <= filter.Deadline {
+			found := *task
+			tasks = append(tasks, &found)
+		}
+	}
+	return tasks, types.PageInfo{Total: int64(len(tasks))}, nil
+}
+
+func (r *fakeTaskRepo) GetTask(ctx context.Context, id string) (*types.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, task := range r.tasks {
+		if task.ID == id {
+			found := *task
+			found.History = slices.Clone(task.History)
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+// UpdateTaskStatus only moves a task still in the from status, like the status filter of the Mongo repo
+func (r *fakeTaskRepo) UpdateTaskStatus(ctx context.Context, id, from, to string, history types.TaskHistory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, task := range r.tasks {
+		if task.ID != id {
+			continue
+		}
+		if task.Status != from {
+			return repository.ErrTaskConflict
+		}
+		task.Status = to
+		task.UpdateAt = history.CreateAt
+		task.History = append(task.History, history)
+		return nil
+	}
+	return repository.ErrTaskConflict
+}
+
+// fakeNotificationRepo stores a notification once per user and key, like the unique index
+type fakeNotificationRepo struct {
+	repository.NotificationRepo
+
+	mu            sync.Mutex
+	notifications []*types.Notification
+}
+
+func (r *fakeNotificationRepo) CreateNotification(ctx context.Context, notification *types.Notification) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.notifications {
+		if existing.UserID == notification.UserID && existing.Key == notification.Key {
+			return false, nil
+		}
+	}
+	notification.ID = fmt.Sprintf("%024x", len(r.notifications)+1)
+	stored := *notification
+	r.notifications = append(r.notifications, &stored)
+	return true, nil
+}
+
+// flatEmbedder embeds every text to the same vector, all chunks are equally near
+type flatEmbedder struct{}
+
+func (flatEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i := range texts {
+		vectors[i] = []float32{1, 1}
+	}
+	return vectors, nil
+}
+
+func (flatEmbedder) Model() string {
+	return "flat"
+}
+
+// fakeWorkspaceService knows the given workspaces, the empty workspace is always valid
+type fakeWorkspaceService struct {
+	WorkspaceService
+
+	workspaces []string
+}
+
+func (s fakeWorkspaceService) ValidateMembership(ctx context.Context, workspace, workspaceRole string) error {
+	if workspace != "" && !slices.Contains(s.workspaces, workspace) {
+		return fmt.Errorf("%w: unknown workspace %s", ErrInvalidArgument, workspace)
+	}
+	return nil
+}
+
+// fakeFAQRepo keeps the FAQ entries in memory
+type fakeFAQRepo struct {
+	repository.FAQRepo
+
+	mu     sync.Mutex
+	faqs   map[string]*types.FAQ
+	nextID int
+}
+
+func newFakeFAQRepo() *fakeFAQRepo {
+	return &fakeFAQRepo{faqs: make(map[string]*types.FAQ)}
+}
+
+func (r *fakeFAQRepo) CreateFAQ(ctx context.Context, faq *types.FAQ) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	faq.ID = fmt.Sprintf("%024x", r.nextID)
+	stored := *faq
+	r.faqs[faq.ID] = &stored
+	return nil
+}
+
+func (r *fakeFAQRepo) GetFAQ(ctx context.Context, id string) (*types.FAQ, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	faq, ok := r.faqs[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	found := *faq
+	return &found, nil
+}
+
+func (r *fakeFAQRepo) UpdateFAQ(ctx context.Context, faq *types.FAQ) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.faqs[faq.ID]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	stored := *faq
+	r.faqs[faq.ID] = &stored
+	return nil
+}
+
+func (r *fakeFAQRepo) DeleteFAQ(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.faqs[id]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	delete(r.faqs, id)
+	return nil
+}
+
+// fakeDocumentRepo keeps the document records in memory with their soft-delete state
+type fakeDocumentRepo struct {
+	repository.DocumentRepo
+
+	mu        sync.Mutex
+	documents map[string]*types.DocumentRecord
+	purged    []string
+}
+
+func newFakeDocumentRepo(documents ...*types.DocumentRecord) *fakeDocumentRepo {
+	repo := &fakeDocumentRepo{documents: make(map[string]*types.DocumentRecord)}
+	for _, document := range documents {
+		stored := *document
+		repo.documents[document.ID] = &stored
+	}
+	return repo
+}
+
+// get returns the record if its deleted state is the wanted one, the caller holds the lock
+func (r *fakeDocumentRepo) get(id string, deleted bool) (*types.DocumentRecord, error) {
+	document, ok := r.documents[id]
+	if !ok || (document.DeletedAt != 0) != deleted {
+		return nil, mongo.ErrNoDocuments
+	}
+	return document, nil
+}
+
+func (r *fakeDocumentRepo) GetDocument(ctx context.Context, id string) (*types.DocumentRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	document, err := r.get(id, false)
+	if err != nil {
+		return nil, err
+	}
+	found := *document
+	return &found, nil
+}
+
+func (r *fakeDocumentRepo) GetDeletedDocument(ctx context.Context, id string) (*types.DocumentRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	document, err := r.get(id, true)
+	if err != nil {
+		return nil, err
+	}
+	found := *document
+	return &found, nil
+}
+
+func (r *fakeDocumentRepo) DeleteDocument(ctx context.Context, id, deletedBy string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	document, err := r.get(id, false)
+	if err != nil {
+		return err
+	}
+	document.DeletedAt = time.Now().Unix()
+	document.DeletedBy = deletedBy
+	return nil
+}
+
+func (r *fakeDocumentRepo) RestoreDocument(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	document, err := r.get(id, true)
+	if err != nil {
+		return err
+	}
+	document.DeletedAt = 0
+	document.DeletedBy = ""
+	return nil
+}
+
+func (r *fakeDocumentRepo) ListPurgeableDocuments(ctx context.Context, before int64) ([]*types.DocumentRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var documents []*types.DocumentRecord
+	for _, document := range r.documents {
+		if document.DeletedAt != 0 && document.DeletedAt <= before {
+			found := *document
+			documents = append(documents, &found)
+		}
+	}
+	return documents, nil
+}
+
+func (r *fakeDocumentRepo) PurgeDocument(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.documents, id)
+	r.purged = append(r.purged, id)
+	return nil
+}
+
+// fakePromptRepo keeps the template versions in memory, err fails every lookup
+type fakePromptRepo struct {
+	repository.PromptRepo
+
+	mu      sync.Mutex
+	prompts []*types.PromptTemplate
+	err     error
+}
+
+func (r *fakePromptRepo) CreatePrompt(ctx context.Context, prompt *types.PromptTemplate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prompt.Version = 1
+	for _, saved := range r.prompts {
+		if saved.Kind == prompt.Kind && saved.Workspace == prompt.Workspace {
+			prompt.Version = max(prompt.Version, saved.Version+1)
+		}
+	}
+	prompt.ID = fmt.Sprintf("prompt-%d", len(r.prompts)+1)
+	saved := *prompt
+	r.prompts = append(r.prompts, &saved)
+	return nil
+}
+
+func (r *fakePromptRepo) LatestPrompt(ctx context.Context, kind, workspace string) (*types.PromptTemplate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	var latest *types.PromptTemplate
+	for _, saved := range r.prompts {
+		if saved.Kind == kind && saved.Workspace == workspace && (latest == nil || saved.Version > latest.Version) {
+			latest = saved
+		}
+	}
+	if latest == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	found := *latest
+	return &found, nil
+}
+
+// fakeLoginAttemptRepo keeps the throttles in memory with the semantics of the Mongo repo
+type fakeLoginAttemptRepo struct {
+	mu        sync.Mutex
+	throttles map[string]*types.LoginThrottle
+	results   []string
+}
+
+func newFakeLoginAttemptRepo() *fakeLoginAttemptRepo {
+	return &fakeLoginAttemptRepo{throttles: make(map[string]*types.LoginThrottle)}
+}
+
+func (r *fakeLoginAttemptRepo) RecordAttempt(ctx context.Context, attempt *types.LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, attempt.Result)
+	return nil
+}
+
+func (r *fakeLoginAttemptRepo) GetThrottle(ctx context.Context, key string) (*types.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.throttle(key), nil
+}
+
+// throttle returns a copy of the state of the key, the caller holds the lock
+func (r *fakeLoginAttemptRepo) throttle(key string) *types.LoginThrottle {
+	if throttle, ok := r.throttles[key]; ok {
+		found := *throttle
+		return &found
+	}
+	return &types.LoginThrottle{Key: key}
+}
+
+func (r *fakeLoginAttemptRepo) RegisterFailure(ctx context.Context, key string, now int64, maxFailures int, config types.LoginThrottleConfig) (*types.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	before := r.throttle(key)
+	if before.LockedUntil > now {
+		return before, nil
+	}
+	after := *before
+	after.Failures++
+	if before.LastFailureAt > 0 && now-before.LastFailureAt > config.FailureWindow {
+		after.Failures = 1
+	}
+	after.LastFailureAt = now
+	after.LockedUntil = 0
+	if after.Failures >= maxFailures {
+		lockout := config.MaxLockout
+		if exp := after.Failures - maxFailures; exp < 32 && config.BaseLockout<<exp < lockout {
+			lockout = config.BaseLockout << exp
+		}
+		after.LockedUntil = now + lockout
+	}
+	r.throttles[key] = &after
+	return before, nil
+}
+
+func (r *fakeLoginAttemptRepo) ForgiveFailure(ctx context.Context, key string, maxFailures int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	throttle, ok := r.throttles[key]
+	if !ok {
+		return nil
+	}
+	throttle.Failures = max(throttle.Failures-1, 0)
+	if throttle.Failures < maxFailures {
+		throttle.LockedUntil = 0
+	}
+	return nil
+}
+
+func (r *fakeLoginAttemptRepo) ResetThrottle(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.throttles, key)
+	return nil
+}
+
+// fakeUsageRepo sums the tokens of the records per user, day and month
+type fakeUsageRepo struct {
+	repository.UsageRepo
+
+	mu      sync.Mutex
+	records []*types.UsageRecord
+}
+
+func (r *fakeUsageRepo) AddUsage(ctx context.Context, record *types.UsageRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+	return nil
+}
+
+func (r *fakeUsageRepo) UserTokens(ctx context.Context, userID, day, month string) (int64, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var daily, monthly int64
+	for _, record := range r.records {
+		if record.UserID != userID {
+			continue
+		}
+		if record.Day == day {
+			daily += record.TotalTokens
+		}
+		if record.Month == month {
+			monthly += record.TotalTokens
+		}
+	}
+	return daily, monthly, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+type FAQService interface {
+	CreateFAQ(ctx context.Context, req types.FAQRequest, by string) (*types.FAQ, error)
+	GetFAQ(ctx context.Context, id string) (*types.FAQ, error)
+	ListFAQs(ctx context.Context, filter types.FAQFilter, opts types.ListOptions) ([]*types.FAQ, types.PageInfo, error)
+	UpdateFAQ(ctx context.Context, id string, req types.FAQRequest, by string) (*types.FAQ, error)
+	DeleteFAQ(ctx context.Context, id string) error
+	// MatchFAQ returns the entry answering the question of a member of workspace, or nil
+	MatchFAQ(ctx context.Context, question, workspace string) (*types.FAQMatch, error)
+}
+
+type faqService struct {
+	faqRepo          repository.FAQRepo
+	workspaceService WorkspaceService
+	vectorDB         database.VectorDatabase
+	maxDistance      float32
+}
+
+func NewFAQService(faqRepo repository.FAQRepo, workspaceService WorkspaceService, vectorDB database.VectorDatabase, maxDistance float32) FAQService {
+	return &faqService{
+		faqRepo:          faqRepo,
+		workspaceService: workspaceService,
+		vectorDB:         vectorDB,
+		maxDistance:      maxDistance,
+	}
+}
+
+func (s *faqService) validate(ctx context.Context, req *types.FAQRequest) error {
+	req.Question = strings.TrimSpace(req.Question)
+	req.Answer = strings.TrimSpace(req.Answer)
+	if req.Question == "" || req.Answer == "" {
+		return fmt.Errorf("%w: question and answer are required", ErrInvalidArgument)
+	}
+	if req.Tags == nil {
+		req.Tags = []string{}
+	}
+	return s.workspaceService.ValidateMembership(ctx, req.Workspace, "")
+}
+
+func (s *faqService) CreateFAQ(ctx context.Context, req types.FAQRequest, by string) (*types.FAQ, error) {
+	if err := s.validate(ctx, &req); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	faq := &types.FAQ{
+		Question:  req.Question,
+		Answer:    req.Answer,
+		Tags:      req.Tags,
+		Workspace: req.Workspace,
+		CreatedBy: by,
+		UpdatedBy: by,
+		CreateAt:  now,
+		UpdateAt:  now,
+	}
+	if err := s.faqRepo.CreateFAQ(ctx, faq); err != nil {
+		return nil, err
+	}
+	if err := s.vectorDB.UpsertFAQ(ctx, faq); err != nil {
+		// An entry that is not indexed would never be answered, do not keep it
+		if deleteErr := s.faqRepo.DeleteFAQ(ctx, faq.ID); deleteErr != nil {
+			log.Printf("Failed to remove unindexed faq %s: %v", faq.ID, deleteErr)
+		}
+		return nil, err
+	}
+	return faq, nil
+}
+
+func (s *faqService) GetFAQ(ctx context.Context, id string) (*types.FAQ, error) {
+	faq, err := s.faqRepo.GetFAQ(ctx, id)
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	return faq, err
+}
+
+func (s *faqService) ListFAQs(ctx context.Context, filter types.FAQFilter, opts types.ListOptions) ([]*types.FAQ, types.PageInfo, error) {
+	return s.faqRepo.ListFAQs(ctx, filter, opts)
+}
+
+func (s *faqService) UpdateFAQ(ctx context.Context, id string, req types.FAQRequest, by string) (*types.FAQ, error) {
+	if err := s.validate(ctx, &req); err != nil {
+		return nil, err
+	}
+	faq, err := s.GetFAQ(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	faq.Question = req.Question
+	faq.Answer = req.Answer
+	faq.Tags = req.Tags
+	faq.Workspace = req.Workspace
+	faq.UpdatedBy = by
+	faq.UpdateAt = time.Now().Unix()
+	if err := s.faqRepo.UpdateFAQ(ctx, faq); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := s.vectorDB.UpsertFAQ(ctx, faq); err != nil {
+		return nil, err
+	}
+	return faq, nil
+}
+
+func (s *faqService) DeleteFAQ(ctx context.Context, id string) error {
+	if _, err := s.GetFAQ(ctx, id); err != nil {
+		return err
+	}
+	// The index goes first so that a failure never leaves an answer without its entry
+	if err := s.vectorDB.DeleteFAQ(ctx, id); err != nil {
+		return err
+	}
+	err := s.faqRepo.DeleteFAQ(ctx, id)
+	if isNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *faqService) MatchFAQ(ctx context.Context, question, workspace string) (*types.FAQMatch, error) {
+	if strings.TrimSpace(question) == "" {
+		return nil, nil
+	}
+	return s.vectorDB.MatchFAQ(ctx, question, workspace, s.maxDistance)
+}
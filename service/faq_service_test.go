@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// failingEmbedder fails every embedding, like an unreachable endpoint
+type failingEmbedder struct {
+	flatEmbedder
+}
+
+func (failingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, errors.New("embedding endpoint unreachable")
+}
+
+func newTestFAQService(t *testing.T, embedder database.Embedder) (FAQService, *fakeFAQRepo) {
+	t.Helper()
+	store, err := database.NewMemoryStore(embedder, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newFakeFAQRepo()
+	workspaces := fakeWorkspaceService{workspaces: []string{"DepartmentTechnical", "DepartmentFinance"}}
+	return NewFAQService(repo, workspaces, store, 0.2), repo
+}
+
+func TestFAQServiceMatchesByWorkspace(t *testing.T) {
+	ctx := context.Background()
+	faqs, _ := newTestFAQService(t, flatEmbedder{})
+	faq, err := faqs.CreateFAQ(ctx, types.FAQRequest{Question: " How do I reset my VPN token? ", Answer: "Ask IT.", Workspace: "DepartmentTechnical"}, "alice")
+	if err != nil {
+		t.Fatalf("CreateFAQ: %v", err)
+	}
+	if faq.Question != "How do I reset my VPN token?" || faq.CreatedBy != "alice" || faq.Tags == nil {
+		t.Errorf("created %+v", faq)
+	}
+
+	match, err := faqs.MatchFAQ(ctx, "vpn token", "DepartmentTechnical")
+	if err != nil || match == nil || match.FAQID != faq.ID {
+		t.Fatalf("MatchFAQ from the workspace = %+v, %v", match, err)
+	}
+	if match, err := faqs.MatchFAQ(ctx, "vpn token", "DepartmentFinance"); err != nil || match != nil {
+		t.Errorf("MatchFAQ from another workspace = %+v, %v", match, err)
+	}
+
+	// Moving the entry to every workspace reindexes it
+	if _, err := faqs.UpdateFAQ(ctx, faq.ID, types.FAQRequest{Question: faq.Question, Answer: "Ask IT again."}, "bob"); err != nil {
+		t.Fatalf("UpdateFAQ: %v", err)
+	}
+	match, err = faqs.MatchFAQ(ctx, "vpn token", "DepartmentFinance")
+	if err != nil || match == nil || match.Answer != "Ask IT again." {
+		t.Fatalf("MatchFAQ after moving to every workspace = %+v, %v", match, err)
+	}
+
+	if err := faqs.DeleteFAQ(ctx, faq.ID); err != nil {
+		t.Fatalf("DeleteFAQ: %v", err)
+	}
+	if match, err := faqs.MatchFAQ(ctx, "vpn token", ""); err != nil || match != nil {
+		t.Errorf("MatchFAQ after delete = %+v, %v", match, err)
+	}
+	if err := faqs.DeleteFAQ(ctx, faq.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteFAQ twice = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFAQServiceCreateValidates(t *testing.T) {
+	tests := map[string]types.FAQRequest{
+		"blank question":    {Question: " ", Answer: "a"},
+		"blank answer":      {Question: "q", Answer: ""},
+		"unknown workspace": {Question: "q", Answer: "a", Workspace: "DepartmentNowhere"},
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			faqs, repo := newTestFAQService(t, flatEmbedder{})
+			if _, err := faqs.CreateFAQ(context.Background(), req, "alice"); !errors.Is(err, ErrInvalidArgument) {
+				t.Fatalf("CreateFAQ = %v, want ErrInvalidArgument", err)
+			}
+			if len(repo.faqs) != 0 {
+				t.Errorf("%d entries stored", len(repo.faqs))
+			}
+		})
+	}
+}
+
+func TestFAQServiceCreateRemovesUnindexedEntry(t *testing.T) {
+	faqs, repo := newTestFAQService(t, failingEmbedder{})
+	if _, err := faqs.CreateFAQ(context.Background(), types.FAQRequest{Question: "q", Answer: "a"}, "alice"); err == nil {
+		t.Fatal("CreateFAQ succeeded without indexing the entry")
+	}
+	if len(repo.faqs) != 0 {
+		t.Errorf("%d unindexed entries kept", len(repo.faqs))
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+type FeedbackService interface {
+	// RecordAnswer stores an assistant answer and sets its ID so that the user can rate it
+	RecordAnswer(ctx context.Context, caller *utils.UserClaims, chatID string, messages []types.Message, answer *types.Message) error
+	// RateAnswer sets the caller's rating of one of their answers, negative ratings enter the review queue
+	RateAnswer(ctx context.Context, caller *utils.UserClaims, id string, req types.AnswerFeedbackRequest) (*types.ChatAnswer, error)
+	ListReviewQueue(ctx context.Context, filter types.AnswerReviewFilter, opts types.ListOptions) ([]*types.ChatAnswer, types.PageInfo, error)
+	ReviewAnswer(ctx context.Context, id string, req types.AnswerReviewRequest, reviewer string) (*types.ChatAnswer, error)
+	// IngestCorrection adds an accepted correction to the knowledge base as a curated Q&A document
+	IngestCorrection(ctx context.Context, id string) (*types.DocumentRecord, error)
+}
+
+type feedbackService struct {
+	answerRepo   repository.AnswerRepo
+	documentRepo repository.DocumentRepo
+	vectorDB     database.VectorDatabase
+}
+
+func NewFeedbackService(answerRepo repository.AnswerRepo, documentRepo repository.DocumentRepo, vectorDB database.VectorDatabase) FeedbackService {
+	return &feedbackService{
+		answerRepo:   answerRepo,
+		documentRepo: documentRepo,
+		vectorDB:     vectorDB,
+	}
+}
+
+func (s *feedbackService) RecordAnswer(ctx context.Context, caller *utils.UserClaims, chatID string, messages []types.Message, answer *types.Message) error {
+	chunkIDs := answer.ChunkIDs
+	if chunkIDs == nil {
+		chunkIDs = []string{}
+	}
+	record := &types.ChatAnswer{
+		ChatID:    chatID,
+		UserID:    caller.ID,
+		Username:  caller.Username,
+		Workspace: caller.Workspace,
+		Question:  lastUserMessage(messages),
+		Answer:    answer.Content,
+		ChunkIDs:  chunkIDs,
+		Model:     answer.Model,
+		CreateAt:  time.Now().Unix(),
+	}
+	if err := s.answerRepo.CreateAnswer(ctx, record); err != nil {
+		return err
+	}
+	answer.ID = record.ID
+	return nil
+}
+
+func (s *feedbackService) RateAnswer(ctx context.Context, caller *utils.UserClaims, id string, req types.AnswerFeedbackRequest) (*types.ChatAnswer, error) {
+	if req.Rating != types.FEEDBACK_RATING_UP && req.Rating != types.FEEDBACK_RATING_DOWN {
+		return nil, fmt.Errorf("%w: rating must be %s or %s", ErrInvalidArgument, types.FEEDBACK_RATING_UP, types.FEEDBACK_RATING_DOWN)
+	}
+	answer, err := s.getAnswer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Answers of other users are reported as missing rather than forbidden
+	if answer.UserID != caller.ID {
+		return nil, ErrNotFound
+	}
+	if answer.Feedback != nil && answer.Feedback.ReviewStatus != "" && answer.Feedback.ReviewStatus != types.FEEDBACK_REVIEW_PENDING {
+		return nil, fmt.Errorf("%w: the feedback has already been reviewed", ErrConflict)
+	}
+	feedback := &types.AnswerFeedback{
+		Rating:     req.Rating,
+		Comment:    strings.TrimSpace(req.Comment),
+		Correction: strings.TrimSpace(req.Correction),
+		RatedAt:    time.Now().Unix(),
+	}
+	if req.Rating == types.FEEDBACK_RATING_DOWN {
+		feedback.ReviewStatus = types.FEEDBACK_REVIEW_PENDING
+	}
+	if err := s.answerRepo.SetFeedback(ctx, id, feedback); err != nil {
+		return nil, err
+	}
+	answer.Feedback = feedback
+	return answer, nil
+}
+
+func (s *feedbackService) ListReviewQueue(ctx context.Context, filter types.AnswerReviewFilter, opts types.ListOptions) ([]*types.ChatAnswer, types.PageInfo, error) {
+	switch filter.Status {
+	case "":
+		filter.Status = types.FEEDBACK_REVIEW_PENDING
+	case types.FEEDBACK_REVIEW_PENDING, types.FEEDBACK_REVIEW_ACCEPTED, types.FEEDBACK_REVIEW_REJECTED:
+	default:
+		return nil, types.PageInfo{}, fmt.Errorf("%w: unknown review status %q", ErrInvalidArgument, filter.Status)
+	}
+	return s.answerRepo.ListRatedDown(ctx, filter, opts)
+}
+
+func (s *feedbackService) ReviewAnswer(ctx context.Context, id string, req types.AnswerReviewRequest, reviewer string) (*types.ChatAnswer, error) {
+	if req.Status != types.FEEDBACK_REVIEW_ACCEPTED && req.Status != types.FEEDBACK_REVIEW_REJECTED {
+		return nil, fmt.Errorf("%w: status must be %s or %s", ErrInvalidArgument, types.FEEDBACK_REVIEW_ACCEPTED, types.FEEDBACK_REVIEW_REJECTED)
+	}
+	answer, err := s.getAnswer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if answer.Feedback == nil || answer.Feedback.Rating != types.FEEDBACK_RATING_DOWN {
+		return nil, fmt.Errorf("%w: only negatively rated answers are reviewed", ErrInvalidArgument)
+	}
+	if answer.Feedback.CuratedDocumentID != "" {
+		return nil, fmt.Errorf("%w: the correction has already been ingested", ErrConflict)
+	}
+	feedback := *answer.Feedback
+	if correction := strings.TrimSpace(req.Correction); correction != "" {
+		feedback.Correction = correction
+	}
+	if req.Status == types.FEEDBACK_REVIEW_ACCEPTED && feedback.Correction == "" {
+		return nil, fmt.Errorf("%w: an accepted review needs a correction", ErrInvalidArgument)
+	}
+	feedback.ReviewStatus = req.Status
+	feedback.ReviewedBy = reviewer
+	feedback.ReviewedAt = time.Now().Unix()
+	feedback.ReviewNote = strings.TrimSpace(req.Note)
+	if err := s.answerRepo.SetFeedback(ctx, id, &feedback); err != nil {
+		return nil, err
+	}
+	answer.Feedback = &feedback
+	return answer, nil
+}
+
+func (s *feedbackService) IngestCorrection(ctx context.Context, id string) (*types.DocumentRecord, error) {
+	answer, err := s.getAnswer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if answer.Feedback == nil || answer.Feedback.ReviewStatus != types.FEEDBACK_REVIEW_ACCEPTED {
+		return nil, fmt.Errorf("%w: only accepted corrections can be ingested", ErrInvalidArgument)
+	}
+	if answer.Feedback.CuratedDocumentID != "" {
+		return nil, fmt.Errorf("%w: the correction has already been ingested", ErrConflict)
+	}
+	now := time.Now().Unix()
+	record := &types.DocumentRecord{
+		Title:     curatedTitle(answer.Question),
+		Source:    "feedback:" + answer.ID,
+		Tags:      []string{types.CURATED_TAG},
+		Workspace: answer.Workspace,
+		Chunks:    1,
+		CreateAt:  now,
+	}
+	if err := s.documentRepo.CreateDocument(ctx, record); err != nil {
+		return nil, err
+	}
+	chunk := &types.Document{
+		Content: fmt.Sprintf("Question: %s\nAnswer: %s", answer.Question, answer.Feedback.Correction),
+		Metadata: types.Metadata{
+			Title:      record.Title,
+			Source:     record.Source,
+			Tags:       record.Tags,
+			Workspace:  record.Workspace,
+			DocumentID: record.ID,
+		},
+		CreatedAt: now,
+	}
+	if err := s.vectorDB.UpsertDocument(ctx, chunk, nil); err != nil {
+		if purgeErr := s.documentRepo.PurgeDocument(ctx, record.ID); purgeErr != nil {
+			log.Printf("Failed to remove curated document %s: %v", record.ID, purgeErr)
+		}
+		return nil, err
+	}
+	feedback := *answer.Feedback
+	feedback.CuratedDocumentID = record.ID
+	if err := s.answerRepo.SetFeedback(ctx, id, &feedback); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *feedbackService) getAnswer(ctx context.Context, id string) (*types.ChatAnswer, error) {
+	answer, err := s.answerRepo.GetAnswer(ctx, id)
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	return answer, err
+}
+
+// curatedTitle names a curated document after its question, shortened for the document list
+func curatedTitle(question string) string {
+	const maxLength = 120
+	title := strings.Join(strings.Fields(question), " ")
+	if runes := []rune(title); len(runes) > maxLength {
+		title = string(runes[:maxLength]) + "…"
+	}
+	return title
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -10,42 +11,48 @@ import (
 	"time"
 
 	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/repository"
 	"github.com/tieubaoca/chatbot-be/types"
 )
 
 type FileService struct {
-	uploadDir  string
-	vectorDB   *database.WeaviateStore
-	pdfService *PDFService
+	uploadDir    string
+	vectorDB     database.VectorDatabase
+	pdfService   *PDFService
+	documentRepo repository.DocumentRepo
 }
 
 func NewFileService(
 	uploadDir string,
-	vectorDB *database.WeaviateStore,
+	vectorDB database.VectorDatabase,
 	pdfService *PDFService,
+	documentRepo repository.DocumentRepo,
 ) *FileService {
 	// Tạo thư mục nếu chưa tồn tại
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
 		panic(err)
 	}
 	return &FileService{
-		uploadDir:  uploadDir,
-		vectorDB:   vectorDB,
-		pdfService: pdfService,
+		uploadDir:    uploadDir,
+		vectorDB:     vectorDB,
+		pdfService:   pdfService,
+		documentRepo: documentRepo,
 	}
 }
 
-func (s *FileService) UploadFile(req types.UploadRequest, file *multipart.FileHeader, c chan<- types.ProcessingDocumentStatus) error {
+// UploadFile stores the file and ingests PDFs into the vector store. It returns the ID of
+// the document record, empty for files that are only stored.
+func (s *FileService) UploadFile(req types.UploadRequest, file *multipart.FileHeader, c chan<- types.ProcessingDocumentStatus) (string, error) {
 	// Kiểm tra phần mở rộng file
 	ext := strings.ToLower(filepath.Ext(file.Filename))
 	if ext != ".pdf" && ext != ".doc" && ext != ".docx" {
-		return fmt.Errorf("unsupported file type: %s", ext)
+		return "", fmt.Errorf("unsupported file type: %s", ext)
 	}
 
 	// Mở file được upload
 	src, err := file.Open()
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer src.Close()
 
@@ -64,20 +71,55 @@ func (s *FileService) UploadFile(req types.UploadRequest, file *multipart.FileHe
 
 	dst, err := os.Create(filepath.Join(s.uploadDir, filename))
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer dst.Close()
 
 	// Copy nội dung file
 	if _, err = io.Copy(dst, src); err != nil {
-		return err
+		return "", err
 	}
 
 	// Process PDF và lưu vào vector DB
 	if ext == ".pdf" {
+		record := &types.DocumentRecord{
+			Title:     req.Title,
+			Source:    req.Source,
+			Tags:      req.Tags,
+			Workspace: req.Workspace,
+			File:      filename,
+			CreateAt:  time.Now().Unix(),
+		}
+		if err := s.documentRepo.CreateDocument(context.Background(), record); err != nil {
+			return "", err
+		}
+		chunks := 0
 		chunkChan := make(chan types.DocumentChunk)
-		go s.pdfService.ProcessPDF(filepath.Join(s.uploadDir, filename+ext), req, chunkChan)
+		go s.pdfService.ProcessPDF(filepath.Join(s.uploadDir, filename), req, chunkChan)
 		for chunk := range chunkChan {
+			document := &types.Document{
+				Content: chunk.Content,
+				Metadata: types.Metadata{
+					Title:     chunk.Metadata.Title,
+					Source:    req.Source,
+					Tags:      req.Tags,
+					Workspace: req.Workspace,
+					Custom: map[string]string{
+						"page": fmt.Sprintf("%d", chunk.Metadata.PageNum),
+					},
+					DocumentID: record.ID,
+				},
+				CreatedAt: time.Now().Unix(),
+			}
+			if err := s.vectorDB.UpsertDocument(context.Background(), document, nil); err != nil {
+				// drain the channel so ProcessPDF can finish
+				go func() {
+					for range chunkChan {
+					}
+				}()
+				return record.ID, err
+			}
+			chunks++
 			c <- types.ProcessingDocumentStatus{
 				Status:         "processing",
 				Message:        "Processing document",
@@ -86,12 +128,16 @@ func (s *FileService) UploadFile(req types.UploadRequest, file *multipart.FileHe
 				ProcessedPages: chunk.Metadata.PageNum,
 			}
 		}
+		if err := s.documentRepo.SetChunks(context.Background(), record.ID, chunks); err != nil {
+			return record.ID, err
+		}
 		c <- types.ProcessingDocumentStatus{
 			Status:  "completed",
 			Message: "Done processing PDF",
 		}
 		fmt.Println("Done processing PDF")
+		return record.ID, nil
 	}
 
-	return nil
+	return "", nil
 }
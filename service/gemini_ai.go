@@ -6,211 +6,454 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/google/generative-ai-go/genai"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"github.com/tieubaoca/chatbot-be/database"
 	"github.com/tieubaoca/chatbot-be/types"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
-type GeminiService struct {
-	apiKeys       []string
-	currentKey    int
-	client        *genai.Client
-	model         *genai.GenerativeModel
-	functionsCall map[string]types.FunctionHandler
-	mu            sync.Mutex
+// Gemini only knows these two roles, function responses are sent as the user's
+const (
+	geminiRoleUser  = "user"
+	geminiRoleModel = "model"
+)
+
+// geminiClient is a client for one API key. Calls hold it while they use it so that
+// a key rotation closes it only once they are done.
+type geminiClient struct {
+	client *genai.Client
+	key    int
+	inUse  sync.WaitGroup
 }
 
-func defaultStreamHandler(response string) {
-	println(response)
+type GeminiService struct {
+	chatTools
+	apiKeys   []string
+	modelName string
+	options   []option.ClientOption
+	tools     []*genai.Tool
+
+	mu      sync.RWMutex
+	current *geminiClient
 }
 
-func NewGeminiService(apiKeys []string, modelName string) (*GeminiService, error) {
+// NewGeminiService creates the service with the first key. Client options are added to
+// the key of each client, e.g. option.WithEndpoint for a proxy.
+func NewGeminiService(apiKeys []string, modelName string, vectorDB database.VectorDatabase, opts ...option.ClientOption) (*GeminiService, error) {
 	if len(apiKeys) == 0 {
 		return nil, errors.New("no API keys provided")
 	}
 
 	service := &GeminiService{
-		apiKeys:       apiKeys,
-		currentKey:    0,
-		functionsCall: make(map[string]types.FunctionHandler),
+		chatTools: chatTools{
+			vectorDB:      vectorDB,
+			functionsCall: make(map[string]types.FunctionHandler),
+		},
+		apiKeys:   apiKeys,
+		modelName: modelName,
+		options:   opts,
 	}
 
-	err := service.initClient()
+	client, err := service.newClient(0)
 	if err != nil {
 		return nil, err
 	}
-
-	service.model = service.client.GenerativeModel(modelName)
+	service.current = client
 	return service, nil
 }
 
-func (s *GeminiService) initClient() error {
+// Close closes the client of the current key
+func (s *GeminiService) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.current.inUse.Wait()
+	return s.current.client.Close()
+}
 
-	client, err := genai.NewClient(context.Background(), option.WithAPIKey(s.apiKeys[s.currentKey]))
+func (s *GeminiService) newClient(key int) (*geminiClient, error) {
+	opts := append([]option.ClientOption{option.WithAPIKey(s.apiKeys[key])}, s.options...)
+	client, err := genai.NewClient(context.Background(), opts...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	s.client = client
-	return nil
+	return &geminiClient{client: client, key: key}, nil
+}
+
+// acquire returns the client of the current key, to be released after the call
+func (s *GeminiService) acquire() *geminiClient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.current.inUse.Add(1)
+	return s.current
+}
+
+func (s *GeminiService) release(client *geminiClient) {
+	client.inUse.Done()
 }
 
-func (s *GeminiService) rotateAPIKey() error {
+// rotateAPIKey moves on to the key after the one of the failed client. Concurrent calls
+// failing with the same client rotate only once. The failed client is closed once the
+// calls still using it are done.
+func (s *GeminiService) rotateAPIKey(failed *geminiClient) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-
-	s.currentKey = (s.currentKey + 1) % len(s.apiKeys)
-	if err := s.client.Close(); err != nil {
+	if s.current != failed {
+		return nil
+	}
+	next, err := s.newClient((failed.key + 1) % len(s.apiKeys))
+	if err != nil {
 		return err
 	}
-	return s.initClient()
+	s.current = next
+	go func() {
+		failed.inUse.Wait()
+		if err := failed.client.Close(); err != nil {
+			log.Printf("Failed to close the Gemini client of key %d: %v", failed.key, err)
+		}
+	}()
+	return nil
 }
 
-func (s *GeminiService) Chat(ctx context.Context, prompt string, messages []types.Message) (string, error) {
-	log.Printf("Chat with prompt %s and history %v\n", prompt, messages)
-	// Convert messages to chat history
-	history := make([]*genai.Content, 0, len(messages))
-	for _, msg := range messages {
-		history = append(history, &genai.Content{
-			Parts: []genai.Part{genai.Text(msg.Content)},
-			Role:  string(msg.Role),
-		})
+// isKeyError tells whether another key may succeed: the key is invalid, not allowed or out of quota
+func isKeyError(err error) bool {
+	code := 0
+	var apiErr *apierror.APIError
+	var googleErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		code = apiErr.HTTPCode()
+	} else if errors.As(err, &googleErr) {
+		code = googleErr.Code
+	}
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	case http.StatusBadRequest:
+		// An invalid key is reported as a bad request
+		return strings.Contains(err.Error(), "API key")
 	}
-	// Start chat
-	chat := s.model.StartChat()
-	chat.History = history
+	return false
+}
 
-	resp, err := chat.SendMessage(ctx, genai.Text(prompt))
-	if err != nil {
-		// Try rotating API key if there's an error
-		if err := s.rotateAPIKey(); err != nil {
-			return "", err
-		}
-		chat = s.model.StartChat()
-		chat.History = history
-		resp, err = chat.SendMessage(ctx, genai.Text(prompt))
-		if err != nil {
-			return "", err
+func (s *GeminiService) newModel(client *genai.Client, system string, withTools bool) *genai.GenerativeModel {
+	model := client.GenerativeModel(s.modelName)
+	model.SystemInstruction = genai.NewUserContent(genai.Text(system))
+	if withTools {
+		model.Tools = s.tools
+	}
+	return model
+}
+
+// startChat starts a chat session with the turns before the last one and returns the parts
+// of the last turn to send, the client library only sends a conversation through a session
+func (s *GeminiService) startChat(client *genai.Client, system string, contents []*genai.Content, withTools bool) (*genai.ChatSession, []genai.Part) {
+	chat := s.newModel(client, system, withTools).StartChat()
+	n := len(contents)
+	// The session appends to its history, the capacity keeps it from writing into contents
+	chat.History = contents[: n-1 : n-1]
+	return chat, contents[n-1].Parts
+}
+
+func (s *GeminiService) Chat(ctx context.Context, messages []types.Message) (*types.Message, error) {
+	return s.runChat(ctx, messages, func(system string, contents []*genai.Content, withTools bool) (*genai.Content, error) {
+		return s.generate(ctx, system, contents, withTools)
+	}, nil)
+}
+
+// ChatStream answers like Chat but streams the answer to the handler as it is generated,
+// with a status event for each function call
+func (s *GeminiService) ChatStream(ctx context.Context, messages []types.Message, handler types.StreamEventHandler) (*types.Message, error) {
+	answer, err := s.runChat(ctx, messages, func(system string, contents []*genai.Content, withTools bool) (*genai.Content, error) {
+		return s.generateStream(ctx, system, contents, withTools, handler)
+	}, func(calls []genai.FunctionCall) {
+		for _, call := range calls {
+			handler(types.StreamEvent{Type: types.STREAM_EVENT_STATUS, Content: toolStatus(call.Name)})
 		}
+	})
+	if err != nil {
+		return nil, err
 	}
+	streamFAQAnswer(answer, handler)
+	return answer, nil
+}
 
-	if len(resp.Candidates) == 0 {
-		return "", errors.New("no response generated")
+// runChat answers the conversation, running the function calls of the model for at most
+// maxToolIterations rounds. complete generates one model turn.
+func (s *GeminiService) runChat(
+	ctx context.Context,
+	messages []types.Message,
+	complete func(system string, contents []*genai.Content, withTools bool) (*genai.Content, error),
+	onToolCalls func(calls []genai.FunctionCall),
+) (*types.Message, error) {
+	if err := s.checkQuota(ctx); err != nil {
+		return nil, err
+	}
+	contents := geminiContents(messages)
+	if len(contents) == 0 {
+		return nil, fmt.Errorf("%w: the conversation has no messages", ErrInvalidArgument)
 	}
+	system := systemPrompt(ctx, s.prompts) + "\n\n" + currentDate()
 
-	candidate := resp.Candidates[0]
-	if funcs := candidate.FunctionCalls(); len(funcs) > 0 {
-		resp, err = s.handleFunctionCall(ctx, chat, funcs)
+	var rounds chatRounds
+	plan := s.newChatPlan(messages)
+	for iteration := 0; ; iteration++ {
+		content, err := complete(system, contents, offersTools(iteration))
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		calls := functionCalls(content)
+		if answer, err := rounds.answer(iteration, contentText(content), len(calls)); answer != nil || err != nil {
+			return answer, err
 		}
 
+		startToolRound(ctx)
+		if onToolCalls != nil {
+			onToolCalls(calls)
+		}
+		contents = append(contents, content)
+		results := s.runFunctionCalls(ctx, plan, calls)
+		for i, result := range results {
+			rounds.record(calls[i].Name, result.retrieval)
+		}
+		if answer := rounds.faqAnswer(ctx, s.prompts); answer != nil {
+			return answer, nil
+		}
+		responses := &genai.Content{Role: geminiRoleUser}
+		for _, result := range results {
+			responses.Parts = append(responses.Parts, result.response)
+		}
+		contents = append(contents, responses)
 	}
-	content := ""
-	for _, cand := range resp.Candidates {
-		if cand.Content != nil {
-			for _, part := range cand.Content.Parts {
-				if text, ok := part.(genai.Text); ok {
-					content += string(text)
-				}
-			}
+}
 
+// generate generates one model turn, retrying with the next keys while the key is refused
+func (s *GeminiService) generate(ctx context.Context, system string, contents []*genai.Content, withTools bool) (*genai.Content, error) {
+	for attempt := 1; ; attempt++ {
+		client := s.acquire()
+		chat, last := s.startChat(client.client, system, contents, withTools)
+		resp, err := chat.SendMessage(ctx, last...)
+		s.release(client)
+		if err != nil {
+			if attempt >= len(s.apiKeys) || !isKeyError(err) {
+				return nil, err
+			}
+			if err := s.rotateAPIKey(client); err != nil {
+				return nil, err
+			}
+			continue
 		}
+		s.recordUsage(ctx, resp.UsageMetadata)
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			return nil, errors.New("no response generated")
+		}
+		return resp.Candidates[0].Content, nil
 	}
-
-	return content, nil
 }
 
-func (s *GeminiService) handleFunctionCall(ctx context.Context, chat *genai.ChatSession, functions []genai.FunctionCall) (*genai.GenerateContentResponse, error) {
-	log.Printf("Handle function call with functions %v\n", functions)
-	funcResults := []genai.Part{}
-	for _, function := range functions {
-		handler, exists := s.functionsCall[function.Name]
-		if !exists {
-			return nil, fmt.Errorf("unknown function: %s", function.Name)
+// generateStream streams one model turn to the handler. A refused key is only retried
+// with the next keys before anything was streamed.
+func (s *GeminiService) generateStream(ctx context.Context, system string, contents []*genai.Content, withTools bool, handler types.StreamEventHandler) (*genai.Content, error) {
+	for attempt := 1; ; attempt++ {
+		client := s.acquire()
+		content, streamed, err := s.streamTurn(ctx, client.client, system, contents, withTools, handler)
+		s.release(client)
+		if err == nil {
+			return content, nil
 		}
+		if streamed || attempt >= len(s.apiKeys) || !isKeyError(err) {
+			return nil, err
+		}
+		if err := s.rotateAPIKey(client); err != nil {
+			return nil, err
+		}
+	}
+}
 
-		// Convert args to JSON bytes first
-		argsBytes, err := json.Marshal(function.Args)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal function args: %v", err)
+func (s *GeminiService) streamTurn(ctx context.Context, client *genai.Client, system string, contents []*genai.Content, withTools bool, handler types.StreamEventHandler) (*genai.Content, bool, error) {
+	chat, last := s.startChat(client, system, contents, withTools)
+	iter := chat.SendMessageStream(ctx, last...)
+	var text strings.Builder
+	var calls []genai.Part
+	var usage *genai.UsageMetadata
+	streamed := false
+	for {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
 		}
-		// Execute the function
-		result, err := handler(ctx, argsBytes)
 		if err != nil {
-			return nil, fmt.Errorf("function execution failed: %v", err)
-		}
-		funcResults = append(funcResults, genai.FunctionResponse{
-			Name:     function.Name,
-			Response: map[string]any{"result": result},
-		})
-		log.Printf("Function %s executed with result %v\n", function.Name, result)
-	}
-	// Generate final response with function result
-	resp, err := chat.SendMessage(
-		ctx,
-		funcResults...,
-	)
+			return nil, streamed, err
+		}
+		// Each chunk reports the usage so far, the last one the usage of the turn
+		if resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			switch part := part.(type) {
+			case genai.Text:
+				if part == "" {
+					continue
+				}
+				text.WriteString(string(part))
+				streamed = true
+				handler(types.StreamEvent{Type: types.STREAM_EVENT_DELTA, Content: string(part)})
+			case genai.FunctionCall:
+				calls = append(calls, part)
+			}
+		}
+	}
+	s.recordUsage(ctx, usage)
+
+	content := &genai.Content{Role: geminiRoleModel}
+	if text.Len() > 0 {
+		content.Parts = append(content.Parts, genai.Text(text.String()))
+	}
+	content.Parts = append(content.Parts, calls...)
+	return content, streamed, nil
+}
+
+func (s *GeminiService) recordUsage(ctx context.Context, usage *genai.UsageMetadata) {
+	if usage == nil {
+		return
+	}
+	s.chatTools.recordUsage(ctx, s.modelName, int(usage.PromptTokenCount), int(usage.CandidatesTokenCount))
+}
+
+// functionResult is the response to one function call, with the outcome of a retrieval
+type functionResult struct {
+	response genai.FunctionResponse
+	retrieval
+}
+
+// runFunctionCalls runs the function calls of a round in parallel. Failures are reported
+// to the model in the response so that it can explain them or try again.
+func (s *GeminiService) runFunctionCalls(ctx context.Context, plan *chatPlan, calls []genai.FunctionCall) []functionResult {
+	results := make([]functionResult, len(calls))
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func(result *functionResult, call genai.FunctionCall) {
+			defer wg.Done()
+			var response map[string]any
+			if call.Name == ragFunctionName {
+				result.retrieval = s.retrieveDocument(ctx, plan, call.Args)
+				response = retrievalResponse(result.retrieval)
+			} else {
+				response = s.callFunction(ctx, call)
+			}
+			result.response = genai.FunctionResponse{Name: call.Name, Response: response}
+		}(&results[i], call)
+	}
+	wg.Wait()
+	return results
+}
+
+// callFunction runs a registered function and returns the function response
+func (s *GeminiService) callFunction(ctx context.Context, call genai.FunctionCall) map[string]any {
+	args, err := json.Marshal(call.Args)
 	if err != nil {
-		return nil, err
+		return functionError(fmt.Errorf("invalid arguments: %w", err))
+	}
+	result, err := s.runFunction(ctx, call.Name, args)
+	if err != nil {
+		return functionError(err)
 	}
-	if len(resp.Candidates) == 0 {
-		return nil, errors.New("no response generated")
+	// The response is sent as a protobuf Struct, which only holds JSON values
+	encoded, err := json.Marshal(result)
+	var value any
+	if err == nil {
+		err = json.Unmarshal(encoded, &value)
 	}
-	candidate := resp.Candidates[0]
-	if funcs := candidate.FunctionCalls(); len(funcs) > 0 {
-		return s.handleFunctionCall(ctx, chat, funcs)
+	if err != nil {
+		log.Printf("Function call %s returned an unencodable result: %v", call.Name, err)
+		return functionError(fmt.Errorf("function %s returned an invalid result", call.Name))
 	}
+	return map[string]any{"result": value}
+}
 
-	return resp, nil
+// retrieveDocument runs a RAG call with the arguments of the model
+func (s *GeminiService) retrieveDocument(ctx context.Context, plan *chatPlan, args map[string]any) retrieval {
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		return retrieval{err: fmt.Errorf("invalid arguments: %w", err)}
+	}
+	return s.retrieve(ctx, plan, encoded)
 }
 
-// Thêm method mới để hỗ trợ streaming
-func (s *GeminiService) ChatStream(ctx context.Context, prompt string, handler types.StreamHandler) error {
-	if handler == nil {
-		handler = defaultStreamHandler
+// retrievalResponse is the function response of a RAG call: the prompt with the retrieved
+// chunks or the FAQ entry answering the question
+func retrievalResponse(result retrieval) map[string]any {
+	switch {
+	case result.err != nil:
+		return functionError(result.err)
+	case result.faq != nil:
+		return faqToolResponse(result.faq)
 	}
-	iter := s.model.GenerateContentStream(ctx, genai.Text(prompt))
+	return map[string]any{"result": result.prompt}
+}
 
-	for {
-		resp, err := iter.Next()
-		if err == iterator.Done {
-			break
+// functionError is the function response reporting a failed function call
+func functionError(err error) map[string]any {
+	return map[string]any{"error": err.Error()}
+}
+
+// geminiContents converts the client conversation. Assistant messages become model turns
+// and any other role is the user's. Gemini expects the roles to alternate, so consecutive
+// messages of a role are sent as one turn.
+func geminiContents(messages []types.Message) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Content == "" {
+			continue
 		}
-		if err != nil {
-			// Nếu lỗi, thử rotate sang API key khác
-			if err := s.rotateAPIKey(); err != nil {
-				return err
-			}
-			// Thử lại với API key mới
-			iter = s.model.GenerateContentStream(ctx, genai.Text(prompt))
-			resp, err = iter.Next()
-			if err != nil {
-				return err
-			}
+		role := geminiRoleUser
+		if msg.Role == "assistant" || msg.Role == geminiRoleModel {
+			role = geminiRoleModel
 		}
-
-		if len(resp.Candidates) == 0 {
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, genai.Text(msg.Content))
 			continue
 		}
+		contents = append(contents, &genai.Content{Role: role, Parts: []genai.Part{genai.Text(msg.Content)}})
+	}
+	return contents
+}
 
-		for _, candidate := range resp.Candidates {
-			for _, part := range candidate.Content.Parts {
-				if text, ok := part.(genai.Text); ok {
-					handler(string(text))
-				}
-			}
+func functionCalls(content *genai.Content) []genai.FunctionCall {
+	var calls []genai.FunctionCall
+	for _, part := range content.Parts {
+		if call, ok := part.(genai.FunctionCall); ok {
+			calls = append(calls, call)
 		}
 	}
-	return nil
+	return calls
+}
+
+func contentText(content *genai.Content) string {
+	var text strings.Builder
+	for _, part := range content.Parts {
+		if t, ok := part.(genai.Text); ok {
+			text.WriteString(string(t))
+		}
+	}
+	return text.String()
 }
 
 // RegisterFunction adds a new function to the model's capabilities
-func (s *GeminiService) RegisterFunction(name, description string, parameters map[string]*genai.Schema, handler types.FunctionHandler) {
+func (s *GeminiService) RegisterFunction(name, description string, parameters map[string]*genai.Schema, handler types.FunctionHandler) error {
+	if err := s.registerFunction(name, handler); err != nil {
+		return err
+	}
 	functionDeclaration := &genai.FunctionDeclaration{
 		Name:        name,
 		Description: description,
@@ -229,12 +472,85 @@ func (s *GeminiService) RegisterFunction(name, description string, parameters ma
 		)
 	}
 
-	// Create the tool with the function declaration
-	tool := &genai.Tool{
+	s.tools = append(s.tools, &genai.Tool{
 		FunctionDeclarations: []*genai.FunctionDeclaration{functionDeclaration},
+	})
+	return nil
+}
+
+// RegisterFunctionCall adds a function described by a JSON schema, like the OpenAI backend
+func (s *GeminiService) RegisterFunctionCall(name, description string, params jsonschema.Definition, handler types.FunctionHandler) error {
+	if err := s.registerFunction(name, handler); err != nil {
+		return err
+	}
+	s.tools = append(s.tools, &genai.Tool{
+		FunctionDeclarations: []*genai.FunctionDeclaration{{
+			Name:        name,
+			Description: description,
+			Parameters:  geminiSchema(params),
+		}},
+	})
+	return nil
+}
+
+var geminiTypes = map[jsonschema.DataType]genai.Type{
+	jsonschema.Object:  genai.TypeObject,
+	jsonschema.Array:   genai.TypeArray,
+	jsonschema.String:  genai.TypeString,
+	jsonschema.Number:  genai.TypeNumber,
+	jsonschema.Integer: genai.TypeInteger,
+	jsonschema.Boolean: genai.TypeBoolean,
+}
+
+// geminiSchema converts a JSON schema to the subset of OpenAPI schemas Gemini takes
+func geminiSchema(definition jsonschema.Definition) *genai.Schema {
+	schema := &genai.Schema{
+		Type:        geminiTypes[definition.Type],
+		Description: definition.Description,
+		Enum:        definition.Enum,
+		Required:    definition.Required,
+	}
+	// Gemini only checks the values of a string with the enum format
+	if len(definition.Enum) > 0 && schema.Type == genai.TypeString {
+		schema.Format = "enum"
+	}
+	if definition.Items != nil {
+		schema.Items = geminiSchema(*definition.Items)
+	}
+	if len(definition.Properties) > 0 {
+		schema.Properties = make(map[string]*genai.Schema, len(definition.Properties))
+		for name, property := range definition.Properties {
+			schema.Properties[name] = geminiSchema(property)
+		}
 	}
+	return schema
+}
 
-	// Set the tool and function call handler
-	s.model.Tools = append(s.model.Tools, tool)
-	s.functionsCall[name] = handler
+// RegisterRAGFunctionCall lets the model search the documents in Weaviate
+func (s *GeminiService) RegisterRAGFunctionCall() error {
+	if s.vectorDB == nil {
+		return errors.New("document retrieval needs a vector store")
+	}
+	s.tools = append(s.tools, &genai.Tool{
+		FunctionDeclarations: []*genai.FunctionDeclaration{{
+			Name:        ragFunctionName,
+			Description: "Retrieve the augmented graph of the documents, use the document as context to answer the question",
+			Parameters: &genai.Schema{
+				Type:        genai.TypeObject,
+				Description: "Retrieve the augmented graph of the document",
+				Properties: map[string]*genai.Schema{
+					"queries": {
+						Type:        genai.TypeArray,
+						Description: "List of queries to retrieve the document and use as context",
+						Items:       &genai.Schema{Type: genai.TypeString},
+					},
+					"question": {
+						Type:        genai.TypeString,
+						Description: "The question of the user",
+					},
+				},
+			},
+		}},
+	})
+	return nil
 }
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+	"google.golang.org/api/option"
+)
+
+// geminiStubRequest is the part of a generateContent request the tests look at
+type geminiStubRequest struct {
+	key               string
+	Contents          []geminiStubContent `json:"contents"`
+	SystemInstruction *geminiStubContent  `json:"systemInstruction"`
+	Tools             []json.RawMessage   `json:"tools"`
+}
+
+type geminiStubContent struct {
+	Role  string `json:"role"`
+	Parts []struct {
+		Text         string `json:"text"`
+		FunctionCall *struct {
+			Name string         `json:"name"`
+			Args map[string]any `json:"args"`
+		} `json:"functionCall"`
+		FunctionResponse *struct {
+			Name     string         `json:"name"`
+			Response map[string]any `json:"response"`
+		} `json:"functionResponse"`
+	} `json:"parts"`
+}
+
+// geminiStub fakes the streaming endpoint of the Gemini REST API, which the client
+// library uses for both SendMessage and SendMessageStream. Each request is answered
+// with the chunks of the next scripted turn, the last turn over and over.
+type geminiStub struct {
+	server *httptest.Server
+	// refused keys are answered with 429, after refuse is called
+	refused map[string]bool
+	refuse  func()
+
+	mu       sync.Mutex
+	requests []geminiStubRequest
+	turns    [][]string
+}
+
+func newGeminiStub(t *testing.T, turns ...[]string) *geminiStub {
+	t.Helper()
+	if !jsonEndsArrayStreams() {
+		t.Skip("the encoding/json of this toolchain fails gax response streams on their closing bracket, run with GOEXPERIMENT=nojsonv2")
+	}
+	stub := &geminiStub{turns: turns, refused: map[string]bool{}, refuse: func() {}}
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ":streamGenerateContent") {
+			http.NotFound(w, r)
+			return
+		}
+		request := geminiStubRequest{key: r.URL.Query().Get("key")}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if stub.refused[request.key] {
+			stub.refuse()
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`)
+			return
+		}
+		stub.mu.Lock()
+		stub.requests = append(stub.requests, request)
+		turn := stub.turns[min(len(stub.requests), len(stub.turns))-1]
+		stub.mu.Unlock()
+		fmt.Fprint(w, "["+strings.Join(turn, ",\n")+"]")
+	}))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+// jsonEndsArrayStreams tells whether a json.Decoder still reads the closing bracket of an
+// array after Decode failed on it, which is how gax finds the end of a response stream
+func jsonEndsArrayStreams() bool {
+	decoder := json.NewDecoder(strings.NewReader("[{}]"))
+	var raw json.RawMessage
+	if _, err := decoder.Token(); err != nil || decoder.Decode(&raw) != nil || decoder.Decode(&raw) == nil {
+		return false
+	}
+	token, _ := decoder.Token()
+	return token == json.Delim(']')
+}
+
+func (s *geminiStub) newService(t *testing.T, keys []string, vectorDB database.VectorDatabase) *GeminiService {
+	t.Helper()
+	service, err := NewGeminiService(keys, "test-model", vectorDB, option.WithEndpoint(s.server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.Close() })
+	return service
+}
+
+// geminiText is a response chunk of model text
+func geminiText(text string) string {
+	encoded, _ := json.Marshal(text)
+	return `{"candidates":[{"content":{"role":"model","parts":[{"text":` + string(encoded) + `}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":2}}`
+}
+
+// geminiCall is a response chunk calling a function
+func geminiCall(name string, args map[string]any) string {
+	encoded, _ := json.Marshal(map[string]any{"name": name, "args": args})
+	return `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":` + string(encoded) + `}]}}]}`
+}
+
+func (c geminiStubContent) roleAndTexts() string {
+	texts := make([]string, len(c.Parts))
+	for i, part := range c.Parts {
+		texts[i] = part.Text
+	}
+	return c.Role + ":" + strings.Join(texts, "|")
+}
+
+func TestGeminiContentsMapsAndMergesRoles(t *testing.T) {
+	contents := geminiContents([]types.Message{
+		{Role: "system", Content: "Trả lời ngắn gọn"},
+		{Role: "user", Content: "Xin chào"},
+		{Role: "assistant", Content: "Chào bạn"},
+		{Role: "model", Content: "Tôi giúp gì được?"},
+		{Role: "user", Content: ""},
+		{Role: "user", Content: "Task nào sắp đến hạn?"},
+	})
+	var got []string
+	for _, content := range contents {
+		var texts []string
+		for _, part := range content.Parts {
+			texts = append(texts, string(part.(genai.Text)))
+		}
+		got = append(got, content.Role+":"+strings.Join(texts, "|"))
+	}
+	want := []string{"user:Trả lời ngắn gọn|Xin chào", "model:Chào bạn|Tôi giúp gì được?", "user:Task nào sắp đến hạn?"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("contents %q, want %q", got, want)
+	}
+}
+
+func TestGeminiChatStreamSendsHistory(t *testing.T) {
+	stub := newGeminiStub(t, []string{geminiText("Có "), geminiText("2 task.")})
+	s := stub.newService(t, []string{"k0"}, nil)
+
+	var deltas []string
+	reply, err := s.ChatStream(context.Background(), []types.Message{
+		{Role: "user", Content: "Xin chào"},
+		{Role: "assistant", Content: "Chào bạn"},
+		{Role: "user", Content: "Task nào sắp đến hạn?"},
+		{Role: "user", Content: "Của tôi thôi"},
+	}, func(event types.StreamEvent) {
+		if event.Type == types.STREAM_EVENT_DELTA {
+			deltas = append(deltas, event.Content)
+		}
+	})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if reply.Content != "Có 2 task." || !reflect.DeepEqual(deltas, []string{"Có ", "2 task."}) {
+		t.Errorf("reply %q streamed as %q", reply.Content, deltas)
+	}
+
+	if len(stub.requests) != 1 {
+		t.Fatalf("%d requests, want 1", len(stub.requests))
+	}
+	request := stub.requests[0]
+	var got []string
+	for _, content := range request.Contents {
+		got = append(got, content.roleAndTexts())
+	}
+	want := []string{"user:Xin chào", "model:Chào bạn", "user:Task nào sắp đến hạn?|Của tôi thôi"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("contents %q, want %q", got, want)
+	}
+	if request.SystemInstruction == nil || len(request.SystemInstruction.Parts) == 0 || request.SystemInstruction.Parts[0].Text == "" {
+		t.Error("no system instruction")
+	}
+}
+
+func TestGeminiChatRetrievesDocuments(t *testing.T) {
+	store, err := database.NewMemoryStore(flatEmbedder{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []types.Document{
+		{Content: "Nhân viên có 12 ngày phép năm", Metadata: types.Metadata{Title: "Sổ tay"}},
+		{Content: "Phòng Tài chính nghỉ bù sau kỳ quyết toán", Metadata: types.Metadata{Title: "Quyết toán", Workspace: "DepartmentFinance"}},
+	}
+	if err := store.BatchInsertDocuments(context.Background(), docs, [][]float32{{1, 1}, {1, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	stub := newGeminiStub(t,
+		[]string{geminiCall(ragFunctionName, map[string]any{"queries": []string{"ngày phép"}, "question": "Tôi có mấy ngày phép?"})},
+		[]string{geminiText("Bạn có 12 ngày phép năm.")},
+	)
+	s := stub.newService(t, []string{"k0"}, store)
+	if err := s.RegisterRAGFunctionCall(); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &utils.UserClaims{Workspace: "DepartmentTechnical", WorkspaceRole: types.USER_WORKSPACE_ROLE_STAFF}
+	ctx := utils.ContextWithUserClaims(context.Background(), claims)
+	reply, err := s.Chat(ctx, []types.Message{{Role: "user", Content: "Tôi có mấy ngày phép?"}})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if reply.Content != "Bạn có 12 ngày phép năm." || len(reply.ChunkIDs) != 1 {
+		t.Errorf("reply %+v, want the answer with one chunk", reply)
+	}
+	if len(stub.requests) != 2 || len(stub.requests[0].Tools) != 1 {
+		t.Fatalf("%d requests, want 2 offering the retrieval", len(stub.requests))
+	}
+
+	// The model turn with the call is followed by the user turn with the response
+	contents := stub.requests[1].Contents
+	if len(contents) != 3 || contents[1].Role != "model" || contents[1].Parts[0].FunctionCall == nil || contents[2].Role != "user" {
+		t.Fatalf("contents %+v", contents)
+	}
+	response := contents[2].Parts[0].FunctionResponse
+	if response == nil || response.Name != ragFunctionName {
+		t.Fatalf("function response %+v", response)
+	}
+	result, _ := response.Response["result"].(string)
+	if !strings.Contains(result, "12 ngày phép") || strings.Contains(result, "quyết toán") {
+		t.Errorf("retrieval result %q, want the global chunk only", result)
+	}
+}
+
+func TestGeminiRotatesRefusedKeyOnce(t *testing.T) {
+	const calls = 8
+	stub := newGeminiStub(t, []string{geminiText("OK")})
+	stub.refused["k0"] = true
+	// The refusals wait for each other, so that every call fails with the first client
+	var refusals sync.WaitGroup
+	refusals.Add(calls)
+	allRefused := make(chan struct{})
+	go func() {
+		refusals.Wait()
+		close(allRefused)
+	}()
+	stub.refuse = func() {
+		refusals.Done()
+		select {
+		case <-allRefused:
+		case <-time.After(2 * time.Second):
+		}
+	}
+	s := stub.newService(t, []string{"k0", "k1", "k2"}, nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, calls)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Chat(context.Background(), []types.Message{{Role: "user", Content: "Xin chào"}})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+	}
+
+	// Every call moved on to k1, the concurrent failures rotated only once
+	s.mu.RLock()
+	key := s.current.key
+	s.mu.RUnlock()
+	if key != 1 {
+		t.Errorf("current key %d, want 1", key)
+	}
+	for _, request := range stub.requests {
+		if request.key != "k1" {
+			t.Errorf("request with key %s", request.key)
+		}
+	}
+	if len(stub.requests) != calls {
+		t.Errorf("%d requests answered, want %d", len(stub.requests), calls)
+	}
+}
+
+func TestGeminiSchemaConvertsJSONSchema(t *testing.T) {
+	schema := geminiSchema(jsonschema.Definition{
+		Type:     jsonschema.Object,
+		Required: []string{"title"},
+		Properties: map[string]jsonschema.Definition{
+			"title":  {Type: jsonschema.String, Description: "Short title"},
+			"status": {Type: jsonschema.Array, Items: &jsonschema.Definition{Type: jsonschema.String, Enum: []string{"open", "doing"}}},
+			"limit":  {Type: jsonschema.Integer},
+		},
+	})
+	if schema.Type != genai.TypeObject || !reflect.DeepEqual(schema.Required, []string{"title"}) || len(schema.Properties) != 3 {
+		t.Fatalf("schema %+v", schema)
+	}
+	if title := schema.Properties["title"]; title.Type != genai.TypeString || title.Description != "Short title" {
+		t.Errorf("title %+v", title)
+	}
+	status := schema.Properties["status"]
+	if status.Type != genai.TypeArray || status.Items.Type != genai.TypeString || status.Items.Format != "enum" || len(status.Items.Enum) != 2 {
+		t.Errorf("status %+v, items %+v", status, status.Items)
+	}
+	if schema.Properties["limit"].Type != genai.TypeInteger {
+		t.Errorf("limit %+v", schema.Properties["limit"])
+	}
+}
+
+func TestGeminiChatFAQMatch(t *testing.T) {
+	match := &types.FAQMatch{FAQID: "f1", Question: "Làm sao đặt lại mật khẩu?", Answer: "Liên hệ IT."}
+	store, err := database.NewMemoryStore(flatEmbedder{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgotPassword := []types.Message{{Role: "user", Content: "quên mật khẩu"}}
+
+	t.Run("retrieval only", func(t *testing.T) {
+		stub := newGeminiStub(t, []string{geminiCall(ragFunctionName, map[string]any{"question": "quên mật khẩu"})}, []string{geminiText("unused")})
+		s := stub.newService(t, []string{"k0"}, store)
+		s.RegisterRAGFunctionCall()
+		s.SetFAQService(fixedFAQ{match: match})
+		reply, err := s.Chat(context.Background(), forgotPassword)
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		if reply.FAQID != "f1" || !strings.HasSuffix(reply.Content, "Liên hệ IT.") || len(stub.requests) != 1 {
+			t.Errorf("reply %+v after %d requests, want the FAQ answer after 1", reply, len(stub.requests))
+		}
+	})
+
+	t.Run("with another function", func(t *testing.T) {
+		stub := newGeminiStub(t,
+			[]string{geminiCall(ragFunctionName, map[string]any{"question": "quên mật khẩu"}), geminiCall("create_task", map[string]any{"title": "Đặt lại mật khẩu"})},
+			[]string{geminiText("Đã tạo task. Theo FAQ: Liên hệ IT.")},
+		)
+		s := stub.newService(t, []string{"k0"}, store)
+		s.RegisterRAGFunctionCall()
+		s.SetFAQService(fixedFAQ{match: match})
+		var title string
+		s.RegisterFunctionCall("create_task", "Create a task", jsonschema.Definition{
+			Type:       jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{"title": {Type: jsonschema.String}},
+		}, func(ctx context.Context, args []byte) (any, error) {
+			var task struct{ Title string }
+			json.Unmarshal(args, &task)
+			title = task.Title
+			return map[string]string{"id": "t1"}, nil
+		})
+		rounds := 0
+		ctx := contextWithToolRounds(context.Background(), func() { rounds++ })
+		reply, err := s.Chat(ctx, forgotPassword)
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		if reply.FAQID != "" || reply.Content != "Đã tạo task. Theo FAQ: Liên hệ IT." || title != "Đặt lại mật khẩu" || rounds != 1 {
+			t.Fatalf("reply %+v, task %q, %d tool rounds", reply, title, rounds)
+		}
+		responses := map[string]map[string]any{}
+		for _, part := range stub.requests[1].Contents[2].Parts {
+			if part.FunctionResponse != nil {
+				responses[part.FunctionResponse.Name] = part.FunctionResponse.Response
+			}
+		}
+		if responses[ragFunctionName]["answer"] != "Liên hệ IT." || responses["create_task"]["result"] == nil {
+			t.Errorf("function responses %v", responses)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type ldapAuthProvider struct {
+	config   config.LDAPConfig
+	userRepo repository.UserRepo
+	dial     func() (ldap.Client, error)
+}
+
+// NewLDAPAuthProvider binds against the directory and provisions a types.User on first login
+func NewLDAPAuthProvider(cfg config.LDAPConfig, userRepo repository.UserRepo) AuthProvider {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	return NewLDAPAuthProviderWithDialer(cfg, userRepo, func() (ldap.Client, error) {
+		conn, err := ldap.DialURL(cfg.URL,
+			ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+			ldap.DialWithTLSConfig(tlsConfig))
+		if err != nil {
+			return nil, err
+		}
+		conn.SetTimeout(timeout)
+		return conn, nil
+	})
+}
+
+// NewLDAPAuthProviderWithDialer lets callers supply the connection, e.g. to an in-process LDAP stub
+func NewLDAPAuthProviderWithDialer(cfg config.LDAPConfig, userRepo repository.UserRepo, dial func() (ldap.Client, error)) AuthProvider {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.FullNameAttribute == "" {
+		cfg.FullNameAttribute = "displayName"
+	}
+	if cfg.MailAttribute == "" {
+		cfg.MailAttribute = "mail"
+	}
+	return &ldapAuthProvider{
+		config:   cfg,
+		userRepo: userRepo,
+		dial:     dial,
+	}
+}
+
+func (p *ldapAuthProvider) Name() string {
+	return "ldap"
+}
+
+func (p *ldapAuthProvider) Authenticate(ctx context.Context, username, password string) (*types.User, error) {
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := p.dial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap: %w", err)
+	}
+	defer conn.Close()
+
+	if p.config.BindDN != "" {
+		if err := conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind failed: %w", err)
+		}
+	}
+
+	filter := fmt.Sprintf(p.config.UserFilter, ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(p.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter, []string{p.config.GroupAttribute, p.config.FullNameAttribute, p.config.MailAttribute}, nil))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap search failed: %w", err)
+	}
+	if result == nil || len(result.Entries) == 0 {
+		return nil, ErrUserNotFound
+	}
+	if len(result.Entries) > 1 {
+		return nil, fmt.Errorf("ldap filter matched several entries for %q", username)
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	mapping, ok := p.mapGroups(entry.GetAttributeValues(p.config.GroupAttribute))
+	if !ok {
+		log.Printf("LDAP user %s is not in any mapped group", username)
+		return nil, ErrInvalidCredentials
+	}
+	return p.provision(ctx, username, entry.GetAttributeValue(p.config.FullNameAttribute), entry.GetAttributeValue(p.config.MailAttribute), mapping)
+}
+
+// mapGroups picks the mapped group with the highest management level
+func (p *ldapAuthProvider) mapGroups(groups []string) (config.LDAPGroupMapping, bool) {
+	var best config.LDAPGroupMapping
+	found := false
+	for _, group := range groups {
+		for _, mapping := range p.config.GroupMappings {
+			if !strings.EqualFold(group, mapping.Group) && !strings.EqualFold(ldapCommonName(group), mapping.Group) {
+				continue
+			}
+			if !found || mapping.ManagementLevel > best.ManagementLevel {
+				best = mapping
+				found = true
+			}
+		}
+	}
+	return best, found
+}
+
+// provision creates the user on first login and keeps directory-managed fields in sync afterwards
+func (p *ldapAuthProvider) provision(ctx context.Context, username, fullName, email string, mapping config.LDAPGroupMapping) (*types.User, error) {
+	if fullName == "" {
+		fullName = username
+	}
+	user, err := p.userRepo.GetUserByUsername(ctx, username)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		newUser := &types.User{
+			Username:        username,
+			FullName:        fullName,
+			Email:           email,
+			ManagementLevel: mapping.ManagementLevel,
+			WorkspaceRole:   mapping.WorkspaceRole,
+			Workspace:       mapping.Workspace,
+			AuthSource:      types.USER_AUTH_SOURCE_LDAP,
+			CreateAt:        time.Now().Unix(),
+			UpdateAt:        time.Now().Unix(),
+		}
+		err = p.userRepo.CreateUser(ctx, newUser)
+		// A concurrent first login may have provisioned the user already
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		if err == nil {
+			log.Printf("Provisioned LDAP user %s in workspace %s", username, mapping.Workspace)
+		}
+		user, err = p.userRepo.GetUserByUsername(ctx, username)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// The username belongs to a deleted account
+			return nil, ErrInvalidCredentials
+		}
+		return user, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.AuthSource != types.USER_AUTH_SOURCE_LDAP {
+		// A local account with the same name is never taken over by the directory
+		return nil, ErrInvalidCredentials
+	}
+	if user.FullName != fullName || user.Email != email || user.Workspace != mapping.Workspace ||
+		user.WorkspaceRole != mapping.WorkspaceRole || user.ManagementLevel != mapping.ManagementLevel {
+		user.FullName = fullName
+		user.Email = email
+		user.Workspace = mapping.Workspace
+		user.WorkspaceRole = mapping.WorkspaceRole
+		user.ManagementLevel = mapping.ManagementLevel
+		user.UpdateAt = time.Now().Unix()
+		if err := p.userRepo.UpdateUser(ctx, user.ID, user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// ldapCommonName returns the CN of a DN like "CN=Technical,OU=Groups,DC=x52"
+func ldapCommonName(dn string) string {
+	first, _, _ := strings.Cut(dn, ",")
+	key, value, ok := strings.Cut(first, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(key), "cn") {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
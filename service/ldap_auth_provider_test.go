@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+const (
+	ldapTestServiceDN = "cn=chatbot,ou=service,dc=x52,dc=local"
+	ldapTestAliceDN   = "uid=alice,ou=people,dc=x52,dc=local"
+)
+
+func newLDAPTestProvider(t *testing.T, users ...*types.User) (*ldapStub, *fakeUserRepo, AuthProvider) {
+	t.Helper()
+	stub := newLDAPStub(t, "(uid=%s)")
+	stub.addEntry(&ldapStubEntry{dn: ldapTestServiceDN, password: "service-secret"})
+	stub.addEntry(&ldapStubEntry{
+		dn:       ldapTestAliceDN,
+		uid:      "alice",
+		password: "alice-secret",
+		attributes: map[string][]string{
+			"displayName": {"Alice Nguyen"},
+			"mail":        {"alice.nguyen@x52.vn"},
+			"memberOf": {
+				"CN=Technical,OU=Groups,DC=x52,DC=local",
+				"CN=Technical-Heads,OU=Groups,DC=x52,DC=local",
+			},
+		},
+	})
+	repo := newFakeUserRepo(users...)
+	provider := NewLDAPAuthProvider(config.LDAPConfig{
+		URL:            stub.URL(),
+		TimeoutSeconds: 2,
+		BindDN:         ldapTestServiceDN,
+		BindPassword:   "service-secret",
+		BaseDN:         "dc=x52,dc=local",
+		UserFilter:     "(uid=%s)",
+		GroupMappings: []config.LDAPGroupMapping{
+			{Group: "Technical", Workspace: "DepartmentTechnical", WorkspaceRole: "staff", ManagementLevel: 2},
+			{Group: "CN=Technical-Heads,OU=Groups,DC=x52,DC=local", Workspace: "DepartmentTechnical", WorkspaceRole: "head", ManagementLevel: 4},
+		},
+	}, repo)
+	return stub, repo, provider
+}
+
+func TestLDAPAuthProviderProvisionsOnFirstLogin(t *testing.T) {
+	_, repo, provider := newLDAPTestProvider(t)
+
+	user, err := provider.Authenticate(context.Background(), "alice", "alice-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	// The group with the highest management level wins, matched by DN or by CN
+	if user.Workspace != "DepartmentTechnical" || user.WorkspaceRole != "head" || user.ManagementLevel != 4 {
+		t.Errorf("mapped to %s/%s level %d, want DepartmentTechnical/head level 4", user.Workspace, user.WorkspaceRole, user.ManagementLevel)
+	}
+	if user.FullName != "Alice Nguyen" || user.Email != "alice.nguyen@x52.vn" || user.AuthSource != types.USER_AUTH_SOURCE_LDAP {
+		t.Errorf("provisioned %q <%s> from %q", user.FullName, user.Email, user.AuthSource)
+	}
+	if len(repo.users) != 1 {
+		t.Errorf("%d users provisioned, want 1", len(repo.users))
+	}
+}
+
+func TestLDAPAuthProviderSyncsDirectoryFields(t *testing.T) {
+	stub, repo, provider := newLDAPTestProvider(t)
+	if _, err := provider.Authenticate(context.Background(), "alice", "alice-secret"); err != nil {
+		t.Fatal(err)
+	}
+	stub.mu.Lock()
+	stub.entries[1].attributes["memberOf"] = []string{"CN=Technical,OU=Groups,DC=x52,DC=local"}
+	stub.mu.Unlock()
+
+	user, err := provider.Authenticate(context.Background(), "alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.WorkspaceRole != "staff" || user.ManagementLevel != 2 {
+		t.Errorf("role %s level %d after leaving the heads group, want staff level 2", user.WorkspaceRole, user.ManagementLevel)
+	}
+	if repo.updates != 1 || len(repo.users) != 1 {
+		t.Errorf("%d updates of %d users, want 1 update of 1 user", repo.updates, len(repo.users))
+	}
+}
+
+func TestLDAPAuthProviderRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		setup    func(stub *ldapStub)
+		users    []*types.User
+		want     error
+	}{
+		{name: "wrong password", username: "alice", password: "nope", want: ErrInvalidCredentials},
+		{name: "unknown user", username: "bob", password: "secret", want: ErrUserNotFound},
+		{name: "empty password", username: "alice", password: "", want: ErrInvalidCredentials},
+		// The escaped value must not widen the filter to every entry
+		{name: "filter injection", username: "*", password: "alice-secret", want: ErrUserNotFound},
+		{name: "filter injection with a clause", username: "alice)(uid=*", password: "alice-secret", want: ErrUserNotFound},
+		{
+			name: "no mapped group", username: "carol", password: "carol-secret",
+			setup: func(stub *ldapStub) {
+				stub.addEntry(&ldapStubEntry{
+					dn: "uid=carol,ou=people,dc=x52,dc=local", uid: "carol", password: "carol-secret",
+					attributes: map[string][]string{"memberOf": {"CN=Sales,OU=Groups,DC=x52,DC=local"}},
+				})
+			},
+			want: ErrInvalidCredentials,
+		},
+		{
+			name: "local account of the same name", username: "alice", password: "alice-secret",
+			users: []*types.User{{Username: "alice", AuthSource: types.USER_AUTH_SOURCE_LOCAL, Workspace: "DepartmentFinance"}},
+			want:  ErrInvalidCredentials,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, repo, provider := newLDAPTestProvider(t, tt.users...)
+			if tt.setup != nil {
+				tt.setup(stub)
+			}
+			user, err := provider.Authenticate(context.Background(), tt.username, tt.password)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Authenticate = %v, %v; want %v", user, err, tt.want)
+			}
+			for _, stored := range repo.users {
+				if stored.AuthSource == types.USER_AUTH_SOURCE_LDAP {
+					t.Errorf("provisioned %s on a rejected login", stored.Username)
+				}
+			}
+		})
+	}
+}
+
+func TestLDAPAuthProviderServiceBindFailure(t *testing.T) {
+	stub, _, provider := newLDAPTestProvider(t)
+	stub.mu.Lock()
+	stub.binds[ldapTestServiceDN] = "rotated"
+	stub.mu.Unlock()
+
+	_, err := provider.Authenticate(context.Background(), "alice", "alice-secret")
+	// A broken service account is a server problem, not a wrong password
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate = %v, want a service bind error", err)
+	}
+}
+
+func TestLDAPAuthProviderMalformedResponses(t *testing.T) {
+	responses := map[string][]byte{
+		"truncated packet":    {0x30, 0x84, 0x00, 0x00},
+		"not a sequence":      {0x04, 0x03, 'b', 'a', 'd'},
+		"missing result code": {0x30, 0x05, 0x02, 0x01, 0x01, 0x61, 0x00},
+		"huge length":         {0x30, 0x84, 0x7f, 0xff, 0xff, 0xff, 0x02, 0x01, 0x01},
+	}
+	for name, response := range responses {
+		t.Run(name, func(t *testing.T) {
+			stub, repo, provider := newLDAPTestProvider(t)
+			stub.mu.Lock()
+			stub.malformed = response
+			stub.mu.Unlock()
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := provider.Authenticate(context.Background(), "alice", "alice-secret")
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if err == nil || errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("Authenticate = %v, want a protocol error", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Authenticate did not return on a malformed response")
+			}
+			if len(repo.users) != 0 {
+				t.Error("provisioned a user from a malformed response")
+			}
+		})
+	}
+}
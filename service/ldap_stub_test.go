@@ -0,0 +1,154 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+type ldapStubEntry struct {
+	dn         string
+	uid        string
+	password   string
+	attributes map[string][]string
+}
+
+// ldapStub is an in-process LDAPv3 server answering simple binds and the user searches
+// of the provider. A search matches the entries whose uid, escaped into userFilter, gives
+// the requested filter.
+type ldapStub struct {
+	listener   net.Listener
+	userFilter string
+
+	mu      sync.Mutex
+	binds   map[string]string
+	entries []*ldapStubEntry
+	// malformed, when set, answers every request with these bytes instead
+	malformed []byte
+}
+
+func newLDAPStub(t *testing.T, userFilter string) *ldapStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &ldapStub{listener: listener, userFilter: userFilter, binds: make(map[string]string)}
+	t.Cleanup(func() { listener.Close() })
+	go stub.serve()
+	return stub
+}
+
+func (s *ldapStub) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *ldapStub) addEntry(entry *ldapStubEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	s.binds[entry.dn] = entry.password
+}
+
+func (s *ldapStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *ldapStub) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		request, err := ber.ReadPacket(conn)
+		if err != nil || len(request.Children) < 2 {
+			return
+		}
+		id := request.Children[0].Value.(int64)
+		op := request.Children[1]
+		s.mu.Lock()
+		malformed := s.malformed
+		s.mu.Unlock()
+		if malformed != nil {
+			conn.Write(malformed)
+			return
+		}
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			s.mu.Lock()
+			expected, ok := s.binds[dn]
+			s.mu.Unlock()
+			code := uint16(ldap.LDAPResultSuccess)
+			if !ok || expected != password {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			conn.Write(ldapStubResult(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				conn.Write(ldapStubResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError).Bytes())
+				continue
+			}
+			for _, entry := range s.search(filter) {
+				conn.Write(ldapStubSearchEntry(id, entry).Bytes())
+			}
+			conn.Write(ldapStubResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (s *ldapStub) search(filter string) []*ldapStubEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []*ldapStubEntry
+	for _, entry := range s.entries {
+		if fmt.Sprintf(s.userFilter, ldap.EscapeFilter(entry.uid)) == filter {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+func ldapStubMessage(id int64, op *ber.Packet) *ber.Packet {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	message.AppendChild(op)
+	return message
+}
+
+func ldapStubResult(id int64, application ber.Tag, code uint16) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return ldapStubMessage(id, result)
+}
+
+func ldapStubSearchEntry(id int64, entry *ldapStubEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "objectName"))
+	attributes := ber.NewSequence("attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.NewSequence("attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	return ldapStubMessage(id, op)
+}
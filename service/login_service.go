@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// ErrInvalidCredentials is returned for both unknown usernames and wrong passwords
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// LoginLockedError is returned while a username or client IP is locked out
+type LoginLockedError struct {
+	RetryAfter int64 // Seconds until the lockout ends
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %d seconds", e.RetryAfter)
+}
+
+var DefaultLoginThrottleConfig = types.LoginThrottleConfig{
+	MaxUserFailures: 5,
+	MaxIPFailures:   20,
+	FailureWindow:   15 * 60,
+	BaseLockout:     30,
+	MaxLockout:      60 * 60,
+}
+
+type LoginService interface {
+	Login(ctx context.Context, req types.LoginRequest, ip, userAgent string) (*types.User, error)
+}
+
+type loginService struct {
+	providers   []AuthProvider
+	attemptRepo repository.LoginAttemptRepo
+	config      types.LoginThrottleConfig
+}
+
+// NewLoginService authenticates against the providers in order, the first one that knows the user decides
+func NewLoginService(providers []AuthProvider, attemptRepo repository.LoginAttemptRepo, config types.LoginThrottleConfig) LoginService {
+	return &loginService{
+		providers:   providers,
+		attemptRepo: attemptRepo,
+		config:      config,
+	}
+}
+
+func (s *loginService) Login(ctx context.Context, req types.LoginRequest, ip, userAgent string) (*types.User, error) {
+	now := time.Now().Unix()
+	userKey := "user:" + strings.ToLower(strings.TrimSpace(req.Username))
+	ipKey := "ip:" + ip
+	attempt := &types.LoginAttempt{
+		Username:  req.Username,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreateAt:  now,
+	}
+
+	// Every attempt counts as a failure of the username and the client IP before the password
+	// is checked, so that parallel attempts cannot guess past the limit. It is refused while
+	// either key is locked.
+	keys := []struct {
+		key         string
+		maxFailures int
+	}{
+		{userKey, s.config.MaxUserFailures},
+		{ipKey, s.config.MaxIPFailures},
+	}
+	var retryAfter int64
+	for _, key := range keys {
+		throttle, err := s.attemptRepo.RegisterFailure(ctx, key.key, now, key.maxFailures, s.config)
+		if err != nil {
+			s.record(ctx, attempt, types.LOGIN_RESULT_ERROR)
+			return nil, err
+		}
+		retryAfter = max(retryAfter, throttle.LockedUntil-now)
+	}
+	if retryAfter > 0 {
+		s.record(ctx, attempt, types.LOGIN_RESULT_LOCKED)
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
+	}
+
+	user, err := s.authenticate(ctx, req.Username, req.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		s.record(ctx, attempt, types.LOGIN_RESULT_INVALID_CREDENTIALS)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		// A failing provider tells nothing about the password
+		s.forgiveFailure(ctx, userKey, s.config.MaxUserFailures)
+		s.forgiveFailure(ctx, ipKey, s.config.MaxIPFailures)
+		s.record(ctx, attempt, types.LOGIN_RESULT_ERROR)
+		return nil, err
+	}
+
+	// The username counter is cleared, the IP one only loses this attempt so that one
+	// valid account cannot unlock an IP
+	if err := s.attemptRepo.ResetThrottle(ctx, userKey); err != nil {
+		log.Printf("Failed to reset login throttle %s: %v", userKey, err)
+	}
+	s.forgiveFailure(ctx, ipKey, s.config.MaxIPFailures)
+	s.record(ctx, attempt, types.LOGIN_RESULT_SUCCESS)
+	return user, nil
+}
+
+func (s *loginService) authenticate(ctx context.Context, username, password string) (*types.User, error) {
+	for _, provider := range s.providers {
+		user, err := provider.Authenticate(ctx, username, password)
+		if errors.Is(err, ErrUserNotFound) {
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+			return nil, fmt.Errorf("%s provider: %w", provider.Name(), err)
+		}
+		return user, err
+	}
+	return nil, ErrInvalidCredentials
+}
+
+func (s *loginService) forgiveFailure(ctx context.Context, key string, maxFailures int) {
+	if err := s.attemptRepo.ForgiveFailure(ctx, key, maxFailures); err != nil {
+		log.Printf("Failed to take back login failure %s: %v", key, err)
+	}
+}
+
+func (s *loginService) record(ctx context.Context, attempt *types.LoginAttempt, result string) {
+	attempt.Result = result
+	if err := s.attemptRepo.RecordAttempt(ctx, attempt); err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+}
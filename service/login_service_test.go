@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// passwordProvider knows alice with the password "secret" and counts the checked passwords
+type passwordProvider struct {
+	checked atomic.Int32
+	err     error
+}
+
+func (p *passwordProvider) Name() string {
+	return "test"
+}
+
+func (p *passwordProvider) Authenticate(ctx context.Context, username, password string) (*types.User, error) {
+	p.checked.Add(1)
+	if p.err != nil {
+		return nil, p.err
+	}
+	if username != "alice" {
+		return nil, ErrUserNotFound
+	}
+	if password != "secret" {
+		return nil, ErrInvalidCredentials
+	}
+	return &types.User{Username: "alice"}, nil
+}
+
+var testThrottleConfig = types.LoginThrottleConfig{
+	MaxUserFailures: 3,
+	MaxIPFailures:   10,
+	FailureWindow:   15 * 60,
+	BaseLockout:     30,
+	MaxLockout:      100,
+}
+
+func newTestLoginService() (LoginService, *fakeLoginAttemptRepo, *passwordProvider) {
+	repo := newFakeLoginAttemptRepo()
+	provider := &passwordProvider{}
+	return NewLoginService([]AuthProvider{provider}, repo, testThrottleConfig), repo, provider
+}
+
+func login(logins LoginService, password, ip string) error {
+	_, err := logins.Login(context.Background(), types.LoginRequest{Username: "alice", Password: password}, ip, "test")
+	return err
+}
+
+// unlock ends the lockout of the key as if its time had passed
+func (r *fakeLoginAttemptRepo) unlock(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.throttles[key].LockedUntil = time.Now().Unix() - 1
+}
+
+func TestLoginLocksOutWithBackoff(t *testing.T) {
+	logins, repo, provider := newTestLoginService()
+	for i := range testThrottleConfig.MaxUserFailures {
+		if err := login(logins, "guess", "10.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failure %d = %v, want invalid credentials", i+1, err)
+		}
+	}
+	// Even the right password is refused without being checked while locked
+	var locked *LoginLockedError
+	if err := login(logins, "secret", "10.0.0.2"); !errors.As(err, &locked) || locked.RetryAfter < 29 || locked.RetryAfter > 30 {
+		t.Fatalf("login while locked = %v, want a lockout of 30 seconds", err)
+	}
+	if checked := provider.checked.Load(); checked != 3 {
+		t.Errorf("%d passwords checked, want 3", checked)
+	}
+
+	// Every further failure doubles the lockout up to MaxLockout
+	for _, want := range []int64{60, 100, 100} {
+		repo.unlock("user:alice")
+		if err := login(logins, "guess", "10.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failure after the lockout = %v", err)
+		}
+		if err := login(logins, "guess", "10.0.0.1"); !errors.As(err, &locked) || locked.RetryAfter < want-1 || locked.RetryAfter > want {
+			t.Fatalf("lockout %v, want %d seconds", err, want)
+		}
+	}
+}
+
+func TestLoginParallelGuessesStopAtTheLimit(t *testing.T) {
+	logins, _, provider := newTestLoginService()
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			login(logins, "guess", "10.0.0.1")
+		}()
+	}
+	wg.Wait()
+	if checked := provider.checked.Load(); checked != int32(testThrottleConfig.MaxUserFailures) {
+		t.Errorf("%d passwords checked in parallel, want %d", checked, testThrottleConfig.MaxUserFailures)
+	}
+}
+
+func TestLoginSuccessResetsTheUsernameOnly(t *testing.T) {
+	logins, repo, _ := newTestLoginService()
+	for range testThrottleConfig.MaxUserFailures - 1 {
+		login(logins, "guess", "10.0.0.1")
+	}
+	if err := login(logins, "secret", "10.0.0.1"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, ok := repo.throttles["user:alice"]; ok {
+		t.Error("the username throttle was kept after a success")
+	}
+	// The successful attempt is not counted against the IP, the failures before are
+	if ip := repo.throttles["ip:10.0.0.1"]; ip == nil || ip.Failures != 2 {
+		t.Errorf("IP throttle %+v, want 2 failures", ip)
+	}
+	// The count starts over, a full series of failures is needed to lock again
+	for range testThrottleConfig.MaxUserFailures - 1 {
+		login(logins, "guess", "10.0.0.1")
+	}
+	if err := login(logins, "secret", "10.0.0.1"); err != nil {
+		t.Errorf("Login after a reset = %v", err)
+	}
+	want := []string{
+		types.LOGIN_RESULT_INVALID_CREDENTIALS, types.LOGIN_RESULT_INVALID_CREDENTIALS, types.LOGIN_RESULT_SUCCESS,
+		types.LOGIN_RESULT_INVALID_CREDENTIALS, types.LOGIN_RESULT_INVALID_CREDENTIALS, types.LOGIN_RESULT_SUCCESS,
+	}
+	if !slices.Equal(repo.results, want) {
+		t.Errorf("recorded %v, want %v", repo.results, want)
+	}
+}
+
+func TestLoginProviderErrorsDoNotCount(t *testing.T) {
+	logins, repo, provider := newTestLoginService()
+	provider.err = errors.New("directory unreachable")
+	for range testThrottleConfig.MaxUserFailures + 1 {
+		if err := login(logins, "secret", "10.0.0.1"); !errors.Is(err, provider.err) {
+			t.Fatalf("Login = %v, want the provider error", err)
+		}
+	}
+	if user := repo.throttles["user:alice"]; user.Failures != 0 || user.LockedUntil != 0 {
+		t.Errorf("username throttle %+v after provider errors", user)
+	}
+}
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/googleapis/gax-go/v2/apierror"
+	"github.com/sashabaranov/go-openai"
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// ErrModelsUnavailable means no model of the chain could answer
+var ErrModelsUnavailable = errors.New("no model available")
+
+type routedModel struct {
+	config  config.ModelConfig
+	backend AIService
+	breaker *circuitBreaker
+}
+
+// ModelRouter sends each chat to the first available model of the chain its policy
+// picks, falling back to the next one on timeouts and server errors
+type ModelRouter struct {
+	models       map[string]*routedModel
+	names        []string
+	defaultChain []string
+	rules        []config.RouteRule
+}
+
+// NewModelRouter routes over the backends, one for each configured model by name
+func NewModelRouter(cfg config.RouterConfig, backends map[string]AIService) (*ModelRouter, error) {
+	router := &ModelRouter{
+		models:       make(map[string]*routedModel, len(cfg.Models)),
+		defaultChain: cfg.Default,
+		rules:        cfg.Rules,
+	}
+	for _, model := range cfg.Models {
+		backend := backends[model.Name]
+		if backend == nil {
+			return nil, fmt.Errorf("no backend for model %s", model.Name)
+		}
+		if _, ok := router.models[model.Name]; ok {
+			return nil, fmt.Errorf("duplicate model name %s", model.Name)
+		}
+		router.models[model.Name] = &routedModel{
+			config:  model,
+			backend: backend,
+			breaker: newCircuitBreaker(cfg.Breaker.FailureThreshold, time.Duration(cfg.Breaker.OpenSeconds)*time.Second),
+		}
+		router.names = append(router.names, model.Name)
+	}
+	chains := [][]string{cfg.Default}
+	for _, rule := range cfg.Rules {
+		chains = append(chains, rule.Chain)
+	}
+	for _, chain := range chains {
+		if len(chain) == 0 {
+			return nil, errors.New("a model chain is empty")
+		}
+		for _, name := range chain {
+			if _, ok := router.models[name]; !ok {
+				return nil, fmt.Errorf("unknown model %s in a chain", name)
+			}
+		}
+	}
+	return router, nil
+}
+
+// Chat answers with the model asked for, or the chain of the policy when model is empty.
+// The answer names the model that wrote it.
+func (r *ModelRouter) Chat(ctx context.Context, model string, messages []types.Message) (*types.Message, error) {
+	return r.route(ctx, model, messages, func(ctx context.Context, backend AIService) (*types.Message, error) {
+		return backend.Chat(ctx, messages)
+	}, nil)
+}
+
+// ChatStream streams like AIService.ChatStream. A model only falls back to the next
+// one while it has not sent any event to the handler yet.
+func (r *ModelRouter) ChatStream(ctx context.Context, model string, messages []types.Message, handler types.StreamEventHandler) (*types.Message, error) {
+	streamed := false
+	return r.route(ctx, model, messages, func(ctx context.Context, backend AIService) (*types.Message, error) {
+		return backend.ChatStream(ctx, messages, func(event types.StreamEvent) {
+			streamed = true
+			handler(event)
+		})
+	}, func() bool {
+		return !streamed
+	})
+}
+
+// Models lists the models the caller can ask for
+func (r *ModelRouter) Models(ctx context.Context) []types.ModelInfo {
+	claims, _ := utils.UserClaimsFromContext(ctx)
+	models := make([]types.ModelInfo, 0, len(r.names))
+	for _, name := range r.names {
+		if !r.allowed(name, claims) {
+			continue
+		}
+		model := r.models[name]
+		models = append(models, types.ModelInfo{
+			Name:      name,
+			Provider:  model.config.Provider,
+			Model:     model.config.Model,
+			Available: model.breaker.State() != breakerOpen,
+		})
+	}
+	return models
+}
+
+func (r *ModelRouter) route(
+	ctx context.Context,
+	requested string,
+	messages []types.Message,
+	call func(ctx context.Context, backend AIService) (*types.Message, error),
+	canFallBack func() bool,
+) (*types.Message, error) {
+	chain, err := r.chain(ctx, requested, messages)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, name := range chain {
+		model := r.models[name]
+		if !model.breaker.Allow() {
+			lastErr = fmt.Errorf("model %s is failing", name)
+			continue
+		}
+		toolsRan := false
+		attemptCtx := contextWithRoutedModel(contextWithToolRounds(ctx, func() { toolsRan = true }), name)
+		attemptCtx, cancel := context.WithTimeout(attemptCtx, time.Duration(model.config.TimeoutSeconds)*time.Second)
+		answer, err := call(attemptCtx, model.backend)
+		cancel()
+		if err == nil {
+			model.breaker.Success()
+			answer.Model = name
+			return answer, nil
+		}
+		// The client gave up, that tells nothing about the model
+		if ctx.Err() != nil {
+			model.breaker.Release()
+			return nil, err
+		}
+		// Errors such as an exceeded quota or an invalid request are no trial of the model
+		if !isFallbackError(err) {
+			model.breaker.Release()
+			return nil, err
+		}
+		model.breaker.Failure()
+		lastErr = err
+		// The functions called may have changed data, another model would call them again
+		if toolsRan || (canFallBack != nil && !canFallBack()) {
+			return nil, err
+		}
+		log.Printf("Model %s failed, falling back: %v", name, err)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrModelsUnavailable, lastErr)
+}
+
+// chain returns the models to try in order: the requested one first, then the chain of
+// the first rule matching the caller and the question, or the default chain. Callers
+// may only ask for the models their rules allow.
+func (r *ModelRouter) chain(ctx context.Context, requested string, messages []types.Message) ([]string, error) {
+	chain := r.defaultChain
+	claims, _ := utils.UserClaimsFromContext(ctx)
+	questionLength := utf8.RuneCountInString(lastUserMessage(messages))
+	for _, rule := range r.rules {
+		if ruleMatches(rule, claims, questionLength) {
+			chain = rule.Chain
+			break
+		}
+	}
+	if requested == "" {
+		return chain, nil
+	}
+	if _, ok := r.models[requested]; !ok {
+		return nil, fmt.Errorf("%w: unknown model %s", ErrInvalidArgument, requested)
+	}
+	if !r.allowed(requested, claims) {
+		return nil, fmt.Errorf("%w: model %s is not available to you", ErrPermissionDenied, requested)
+	}
+	fallbacks := slices.DeleteFunc(slices.Clone(chain), func(name string) bool { return name == requested })
+	return append([]string{requested}, fallbacks...), nil
+}
+
+// allowed tells whether the caller may ask for the model: it is in the default chain or
+// in the chain of a rule for the caller. The question length only picks a chain.
+func (r *ModelRouter) allowed(name string, claims *utils.UserClaims) bool {
+	if slices.Contains(r.defaultChain, name) {
+		return true
+	}
+	for _, rule := range r.rules {
+		if ruleAppliesTo(rule, claims) && slices.Contains(rule.Chain, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleMatches(rule config.RouteRule, claims *utils.UserClaims, questionLength int) bool {
+	if rule.MinQuestionLength > 0 && questionLength < rule.MinQuestionLength {
+		return false
+	}
+	return ruleAppliesTo(rule, claims)
+}
+
+// ruleAppliesTo checks the conditions of the rule on the caller
+func ruleAppliesTo(rule config.RouteRule, claims *utils.UserClaims) bool {
+	if rule.MinManagementLevel > 0 && (claims == nil || claims.ManagementLevel < rule.MinManagementLevel) {
+		return false
+	}
+	if len(rule.Workspaces) > 0 && (claims == nil || !slices.Contains(rule.Workspaces, claims.Workspace)) {
+		return false
+	}
+	return true
+}
+
+type toolRoundsContextKey struct{}
+
+// contextWithToolRounds lets the backend tell the router that it runs a round of tool
+// calls, onToolRound is called before the calls run
+func contextWithToolRounds(ctx context.Context, onToolRound func()) context.Context {
+	return context.WithValue(ctx, toolRoundsContextKey{}, onToolRound)
+}
+
+// startToolRound is called by the backends before they run the tool calls of a round
+func startToolRound(ctx context.Context) {
+	if onToolRound, ok := ctx.Value(toolRoundsContextKey{}).(func()); ok {
+		onToolRound()
+	}
+}
+
+type routedModelContextKey struct{}
+
+// contextWithRoutedModel names the model of the router a backend answers as
+func contextWithRoutedModel(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, routedModelContextKey{}, name)
+}
+
+// routedModelName returns the name the router gave the answering model, or fallback when
+// the backend is called without the router
+func routedModelName(ctx context.Context, fallback string) string {
+	if name, ok := ctx.Value(routedModelContextKey{}).(string); ok {
+		return name
+	}
+	return fallback
+}
+
+// isFallbackError tells whether another model may answer: the model timed out, could
+// not be reached or failed with a server error
+func isFallbackError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var openaiErr *openai.APIError
+	if errors.As(err, &openaiErr) {
+		return openaiErr.HTTPStatusCode >= 500
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode >= 500
+	}
+	var geminiErr *apierror.APIError
+	if errors.As(err, &geminiErr) {
+		return geminiErr.HTTPCode() >= 500
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker opens after threshold consecutive failures. Once openFor has passed
+// a single trial request is let through, its outcome closes or reopens the breaker.
+type circuitBreaker struct {
+	threshold int
+	openFor   time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func newCircuitBreaker(threshold int, openFor time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, openFor: openFor}
+}
+
+func (b *circuitBreaker) State() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state()
+}
+
+func (b *circuitBreaker) state() int {
+	switch {
+	case b.failures < b.threshold:
+		return breakerClosed
+	case time.Now().Before(b.openUntil) || b.trial:
+		return breakerOpen
+	default:
+		return breakerHalfOpen
+	}
+}
+
+// Allow reports whether a request may be sent, the caller then reports its outcome
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state() {
+	case breakerClosed:
+		return true
+	case breakerHalfOpen:
+		b.trial = true
+		return true
+	}
+	return false
+}
+
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.openFor)
+	}
+}
+
+// Release ends a request whose outcome says nothing about the model
+func (b *circuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
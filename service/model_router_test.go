@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// scriptedBackend answers or fails as told, optionally after a round of tool calls
+type scriptedBackend struct {
+	name      string
+	toolRound bool
+	err       error
+	calls     int
+	// usageModel is the model the backend accounts its tokens to
+	usageModel string
+}
+
+func (b *scriptedBackend) Chat(ctx context.Context, messages []types.Message) (*types.Message, error) {
+	b.calls++
+	b.usageModel = routedModelName(ctx, b.name+"-upstream")
+	if b.toolRound {
+		startToolRound(ctx)
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	return &types.Message{Role: "assistant", Content: "answer of " + b.name}, nil
+}
+
+func (b *scriptedBackend) ChatStream(ctx context.Context, messages []types.Message, handler types.StreamEventHandler) (*types.Message, error) {
+	return b.Chat(ctx, messages)
+}
+
+func newTestRouter(t *testing.T, local, hosted *scriptedBackend) *ModelRouter {
+	t.Helper()
+	router, err := NewModelRouter(config.RouterConfig{
+		Models: []config.ModelConfig{
+			{Name: "local", Provider: config.ModelProviderOpenAI, TimeoutSeconds: 5},
+			{Name: "hosted", Provider: config.ModelProviderGemini, TimeoutSeconds: 5},
+		},
+		Default: []string{"local"},
+		Rules:   []config.RouteRule{{MinManagementLevel: 4, Chain: []string{"hosted", "local"}}},
+		Breaker: config.BreakerConfig{FailureThreshold: 3, OpenSeconds: 60},
+	}, map[string]AIService{"local": local, "hosted": hosted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+var routerQuestion = []types.Message{{Role: "user", Content: "Tóm tắt báo cáo quý"}}
+
+func TestModelRouterOnlyServesRequestedModelsOfCallerRules(t *testing.T) {
+	local, hosted := &scriptedBackend{name: "local"}, &scriptedBackend{name: "hosted"}
+	router := newTestRouter(t, local, hosted)
+	staff := utils.ContextWithUserClaims(context.Background(), &utils.UserClaims{ManagementLevel: 1})
+	executive := utils.ContextWithUserClaims(context.Background(), &utils.UserClaims{ManagementLevel: 5})
+
+	if _, err := router.Chat(staff, "hosted", routerQuestion); !errors.Is(err, ErrPermissionDenied) || hosted.calls != 0 {
+		t.Fatalf("staff asking for hosted: %v after %d calls, want permission denied", err, hosted.calls)
+	}
+	if answer, err := router.Chat(staff, "local", routerQuestion); err != nil || answer.Model != "local" {
+		t.Fatalf("staff asking for local: %+v, %v", answer, err)
+	}
+	if answer, err := router.Chat(executive, "hosted", routerQuestion); err != nil || answer.Model != "hosted" {
+		t.Fatalf("executive asking for hosted: %+v, %v", answer, err)
+	}
+	// Usage is accounted to the model the answer is marked with
+	if hosted.usageModel != "hosted" {
+		t.Errorf("usage accounted to %q, want hosted", hosted.usageModel)
+	}
+
+	if models := router.Models(staff); len(models) != 1 || models[0].Name != "local" {
+		t.Errorf("staff models %+v, want local only", models)
+	}
+	if models := router.Models(executive); len(models) != 2 {
+		t.Errorf("executive models %+v, want both", models)
+	}
+}
+
+func TestModelRouterFallsBackOnlyBeforeToolRounds(t *testing.T) {
+	serverErr := &openai.APIError{HTTPStatusCode: 502, Message: "bad gateway"}
+	executive := utils.ContextWithUserClaims(context.Background(), &utils.UserClaims{ManagementLevel: 5})
+
+	local, hosted := &scriptedBackend{name: "local"}, &scriptedBackend{name: "hosted", err: serverErr}
+	answer, err := newTestRouter(t, local, hosted).Chat(executive, "", routerQuestion)
+	if err != nil || answer.Model != "local" {
+		t.Fatalf("Chat = %+v, %v; want the fallback to local", answer, err)
+	}
+
+	// A task may have been created before the failure, local must not create it again
+	local, hosted = &scriptedBackend{name: "local"}, &scriptedBackend{name: "hosted", err: serverErr, toolRound: true}
+	if _, err := newTestRouter(t, local, hosted).Chat(executive, "", routerQuestion); !errors.Is(err, serverErr) || local.calls != 0 {
+		t.Fatalf("Chat = %v after %d fallback calls, want the error of hosted without fallback", err, local.calls)
+	}
+}
+
+func TestModelRouterBreakerIgnoresErrorsBeforeTheModel(t *testing.T) {
+	serverErr := &openai.APIError{HTTPStatusCode: 502, Message: "bad gateway"}
+	local := &scriptedBackend{name: "local", err: serverErr}
+	router := newTestRouter(t, local, &scriptedBackend{name: "hosted"})
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := router.Chat(ctx, "", routerQuestion); !errors.Is(err, ErrModelsUnavailable) {
+			t.Fatalf("Chat = %v, want ErrModelsUnavailable", err)
+		}
+	}
+	// An exceeded quota never reaches the model, the failures so far still count
+	local.err = &QuotaExceededError{Period: types.USAGE_PERIOD_DAILY}
+	if _, err := router.Chat(ctx, "", routerQuestion); !errors.Is(err, local.err) {
+		t.Fatalf("Chat = %v, want the quota error", err)
+	}
+	local.err = serverErr
+	router.Chat(ctx, "", routerQuestion)
+	if state := router.models["local"].breaker.State(); state != breakerOpen {
+		t.Errorf("breaker state %d after 3 failures, want open", state)
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// NotificationHub fans notifications out to the WebSocket connections of each user
+type NotificationHub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan *types.Notification]struct{}
+}
+
+func NewNotificationHub() *NotificationHub {
+	return &NotificationHub{
+		subscribers: make(map[string]map[chan *types.Notification]struct{}),
+	}
+}
+
+// Subscribe registers a connection of the user. The returned function must be called when the connection closes.
+func (h *NotificationHub) Subscribe(userID string) (<-chan *types.Notification, func()) {
+	ch := make(chan *types.Notification, 16)
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan *types.Notification]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers the notification to every open connection of its user.
+// Slow connections drop the notification, it stays available through the REST endpoint.
+func (h *NotificationHub) Publish(notification *types.Notification) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.subscribers[notification.UserID] {
+		select {
+		case ch <- notification:
+		default:
+		}
+	}
+}
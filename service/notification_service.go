@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+type NotificationService interface {
+	ListNotifications(ctx context.Context, caller *utils.UserClaims, unreadOnly bool, opts types.ListOptions) ([]*types.Notification, types.PageInfo, error)
+	MarkRead(ctx context.Context, caller *utils.UserClaims, id string) error
+	MarkAllRead(ctx context.Context, caller *utils.UserClaims) error
+}
+
+type notificationService struct {
+	notificationRepo repository.NotificationRepo
+}
+
+func NewNotificationService(notificationRepo repository.NotificationRepo) NotificationService {
+	return &notificationService{
+		notificationRepo: notificationRepo,
+	}
+}
+
+func (s *notificationService) ListNotifications(ctx context.Context, caller *utils.UserClaims, unreadOnly bool, opts types.ListOptions) ([]*types.Notification, types.PageInfo, error) {
+	return s.notificationRepo.ListNotifications(ctx, caller.ID, unreadOnly, opts)
+}
+
+func (s *notificationService) MarkRead(ctx context.Context, caller *utils.UserClaims, id string) error {
+	if err := s.notificationRepo.MarkRead(ctx, caller.ID, id); err != nil {
+		if isNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *notificationService) MarkAllRead(ctx context.Context, caller *utils.UserClaims) error {
+	return s.notificationRepo.MarkAllRead(ctx, caller.ID)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// Notifier delivers a notification outside the app, e.g. by email or webhook
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, user *types.User, notification *types.Notification) error
+}
+
+// NotifiersFromConfig builds the enabled external notifiers
+func NotifiersFromConfig(cfg config.NotificationConfig) []Notifier {
+	notifiers := make([]Notifier, 0)
+	if cfg.Email.Enabled {
+		notifiers = append(notifiers, NewEmailNotifier(cfg.Email))
+	}
+	if cfg.Webhook.Enabled {
+		notifiers = append(notifiers, NewWebhookNotifier(cfg.Webhook))
+	}
+	return notifiers
+}
+
+type emailNotifier struct {
+	config config.EmailNotifierConfig
+}
+
+// NewEmailNotifier sends plain text mails over SMTP to the stored email of the user.
+// Users without one are not mailed.
+func NewEmailNotifier(cfg config.EmailNotifierConfig) Notifier {
+	if cfg.Port == 0 {
+		cfg.Port = 25
+	}
+	return &emailNotifier{config: cfg}
+}
+
+func (n *emailNotifier) Name() string {
+	return "email"
+}
+
+func (n *emailNotifier) Notify(ctx context.Context, user *types.User, notification *types.Notification) error {
+	to := user.Email
+	if to == "" {
+		return fmt.Errorf("no email address for user %s", user.Username)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notification.Title))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(notification.Message)
+	msg.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+	addr := net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+	// smtp.SendMail takes no context, run it so a hanging server does not block the scan
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, n.config.From, []string{to}, msg.Bytes())
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type webhookNotifier struct {
+	config config.WebhookNotifierConfig
+	client *http.Client
+}
+
+// webhookPayload is the JSON body posted to the webhook
+type webhookPayload struct {
+	User         webhookUser         `json:"user"`
+	Notification *types.Notification `json:"notification"`
+}
+
+type webhookUser struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	FullName  string `json:"full_name"`
+	Email     string `json:"email,omitempty"`
+	Workspace string `json:"workspace"`
+}
+
+func NewWebhookNotifier(cfg config.WebhookNotifierConfig) Notifier {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return &webhookNotifier{
+		config: cfg,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (n *webhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, user *types.User, notification *types.Notification) error {
+	body, err := json.Marshal(webhookPayload{
+		User: webhookUser{
+			ID:        user.ID,
+			Username:  user.Username,
+			FullName:  user.FullName,
+			Email:     user.Email,
+			Workspace: user.Workspace,
+		},
+		Notification: notification,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.config.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
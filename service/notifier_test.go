@@ -0,0 +1,234 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+var notifierTestNotification = &types.Notification{
+	UserID:  "u1",
+	Type:    types.NOTIFICATION_TYPE_TASK_OVERDUE,
+	TaskID:  "t1",
+	Title:   "Task \"Báo cáo quý\" is overdue",
+	Message: "Task \"Báo cáo quý\" was due at 2025-03-01 17:00 and is still open.",
+}
+
+func TestWebhookNotifierSignsPayload(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature-256")
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type %q", r.Header.Get("Content-Type"))
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(config.WebhookNotifierConfig{URL: server.URL, Secret: "s3cret"})
+	user := &types.User{ID: "u1", Username: "alice", FullName: "Alice Nguyen", Email: "alice.nguyen@x52.vn", Workspace: "DepartmentTechnical"}
+	if err := notifier.Notify(context.Background(), user, notifierTestNotification); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if payload.User.Username != "alice" || payload.User.Email != "alice.nguyen@x52.vn" || payload.Notification.TaskID != "t1" {
+		t.Errorf("payload %+v", payload)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("signature %q, want %q", signature, want)
+	}
+}
+
+func TestWebhookNotifierUnsignedWithoutSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if signature := r.Header.Get("X-Signature-256"); signature != "" {
+			t.Errorf("signed with %q without a secret", signature)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(config.WebhookNotifierConfig{URL: server.URL})
+	if err := notifier.Notify(context.Background(), &types.User{ID: "u1"}, notifierTestNotification); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+}
+
+func TestWebhookNotifierFailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(config.WebhookNotifierConfig{URL: server.URL})
+	err := notifier.Notify(context.Background(), &types.User{ID: "u1"}, notifierTestNotification)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("Notify = %v, want a status 500 error", err)
+	}
+}
+
+// smtpStub is a minimal SMTP server accepting every mail without extensions or auth
+type smtpStub struct {
+	listener net.Listener
+
+	mu   sync.Mutex
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &smtpStub{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.handle(conn)
+		}
+	}()
+	return stub
+}
+
+func (s *smtpStub) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 stub ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 stub")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = strings.TrimPrefix(line, "MAIL FROM:")
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			s.to = append(s.to, strings.TrimPrefix(line, "RCPT TO:"))
+			s.mu.Unlock()
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifierSendsToUserEmail(t *testing.T) {
+	stub := newSMTPStub(t)
+	notifier := NewEmailNotifier(config.EmailNotifierConfig{Host: "127.0.0.1", Port: stub.port(), From: "chatbot@x52.local"})
+	user := &types.User{Username: "alice", Email: "alice.nguyen@x52.vn"}
+	if err := notifier.Notify(context.Background(), user, notifierTestNotification); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.from != "<chatbot@x52.local>" || len(stub.to) != 1 || stub.to[0] != "<alice.nguyen@x52.vn>" {
+		t.Errorf("mailed from %s to %v", stub.from, stub.to)
+	}
+	if !strings.Contains(stub.data, "To: alice.nguyen@x52.vn\r\n") {
+		t.Errorf("To header missing in %q", stub.data)
+	}
+	// The subject is Q-encoded, the UTF-8 body is sent as is
+	if !strings.Contains(stub.data, "Subject: =?utf-8?q?") || !strings.Contains(stub.data, notifierTestNotification.Message) {
+		t.Errorf("unexpected message %q", stub.data)
+	}
+}
+
+func TestEmailNotifierWithoutStoredEmail(t *testing.T) {
+	// Neither the username nor the domain of From is taken for an address
+	for _, username := range []string{"alice", "bob@x52.vn"} {
+		stub := newSMTPStub(t)
+		notifier := NewEmailNotifier(config.EmailNotifierConfig{Host: "127.0.0.1", Port: stub.port(), From: "chatbot@x52.local"})
+		err := notifier.Notify(context.Background(), &types.User{Username: username}, notifierTestNotification)
+		if err == nil || !strings.Contains(err.Error(), "no email address") {
+			t.Fatalf("Notify for %s = %v, want a missing address error", username, err)
+		}
+		stub.mu.Lock()
+		if len(stub.to) != 0 {
+			t.Errorf("mailed %s at %v", username, stub.to)
+		}
+		stub.mu.Unlock()
+	}
+}
+
+func TestEmailNotifierRespectsContext(t *testing.T) {
+	// A server that accepts but never greets must not block the caller past its context
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+	notifier := NewEmailNotifier(config.EmailNotifierConfig{Host: "127.0.0.1", Port: port, From: "chatbot@x52.local"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := notifier.Notify(ctx, &types.User{Username: "alice", Email: "alice.nguyen@x52.vn"}, notifierTestNotification); err != context.Canceled {
+		t.Fatalf("Notify = %v, want context.Canceled", err)
+	}
+}
@@ -7,144 +7,214 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/sashabaranov/go-openai/jsonschema"
 	"github.com/tieubaoca/chatbot-be/database"
 	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
 )
 
-var (
-	SystemMessageInitiateMechanicalEngineer = openai.ChatCompletionMessage{
-		Role: openai.ChatMessageRoleSystem,
-		Content: `You are an AI technical assistant for the X52 factory (Nhà máy X52). Your task is to support and answer technical questions related to the operation, maintenance, repair, and optimization of equipment and production processes in the factory.  
-
-You always respond in Vietnamese with accurate, clear, and concise answers. If in-depth information is available, you can provide detailed explanations to help users understand the issue thoroughly.  
-
-If a question falls outside your area of expertise or there is not enough data to answer, politely inform the user instead of making assumptions.  
-
-Always maintain a professional, polite, and helpful approach when assisting users.  
-`,
-	}
+const (
+	ragFunctionName = "retrieve_augmented_graph"
+	// maxToolIterations bounds the rounds of tool calls of a chat
+	maxToolIterations = 5
 )
 
 type OpenAIService struct {
-	client        *openai.Client
-	weaviateDb    *database.WeaviateStore
-	functionsCall map[string]types.FunctionHandler
-	tools         []openai.Tool
-	model         string
+	chatTools
+	client *openai.Client
+	tools  []openai.Tool
+	model  string
 }
 
-func NewOpenAIService(baseURL string, apiKey, model string, weaviateDb *database.WeaviateStore) *OpenAIService {
+func NewOpenAIService(baseURL string, apiKey, model string, vectorDB database.VectorDatabase) *OpenAIService {
 	config := openai.DefaultConfig(apiKey)
 	config.BaseURL = baseURL // Set this to your local LLM server URL
 	client := openai.NewClientWithConfig(config)
 	return &OpenAIService{
-		client:        client,
-		functionsCall: make(map[string]types.FunctionHandler),
-		tools:         make([]openai.Tool, 0),
-		model:         model,
-		weaviateDb:    weaviateDb,
+		chatTools: chatTools{
+			vectorDB:      vectorDB,
+			functionsCall: make(map[string]types.FunctionHandler),
+		},
+		client: client,
+		tools:  make([]openai.Tool, 0),
+		model:  model,
 	}
 }
 
 func (s *OpenAIService) Chat(ctx context.Context, messages []types.Message) (*types.Message, error) {
-	// Convert our Message type to OpenAI chat messages
-	openaiMessages := make([]openai.ChatCompletionMessage, 0)
-	openaiMessages = append(openaiMessages, SystemMessageInitiateMechanicalEngineer)
-	for _, msg := range messages {
-		openaiMessages = append(openaiMessages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: msg.Content,
-		})
-	}
-
-	// Create chat completion request
-	resp, err := s.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Messages: openaiMessages,
-			// Tools:    s.tools,
-			Model: s.model,
-		},
-	)
+	return s.runChat(ctx, messages, func(request openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error) {
+		resp, err := s.client.CreateChatCompletion(ctx, request)
+		if err != nil {
+			return openai.ChatCompletionMessage{}, err
+		}
+		s.recordUsage(ctx, resp)
+		if len(resp.Choices) == 0 {
+			return openai.ChatCompletionMessage{}, errors.New("no response generated")
+		}
+		return resp.Choices[0].Message, nil
+	}, nil)
+}
 
+// ChatStream answers like Chat but streams the answer to the handler as it is generated.
+// Tool calls are run as soon as their stream ends, with a status event for each of them,
+// and the answer then resumes. The complete answer is returned once the stream is done.
+func (s *OpenAIService) ChatStream(ctx context.Context, messages []types.Message, handler types.StreamEventHandler) (*types.Message, error) {
+	answer, err := s.runChat(ctx, messages, func(request openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error) {
+		return s.streamCompletion(ctx, request, handler)
+	}, func(toolCalls []openai.ToolCall) {
+		for _, toolCall := range toolCalls {
+			handler(types.StreamEvent{Type: types.STREAM_EVENT_STATUS, Content: toolStatus(toolCall.Function.Name)})
+		}
+	})
 	if err != nil {
 		return nil, err
 	}
+	streamFAQAnswer(answer, handler)
+	return answer, nil
+}
 
-	if len(resp.Choices) == 0 {
-		return nil, errors.New("no response generated")
+// runChat answers the conversation, running the tool calls of the model for at most
+// maxToolIterations rounds. complete sends one request to the model, onToolCalls is
+// told about the calls of a round before they run.
+func (s *OpenAIService) runChat(
+	ctx context.Context,
+	messages []types.Message,
+	complete func(request openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error),
+	onToolCalls func(toolCalls []openai.ToolCall),
+) (*types.Message, error) {
+	if err := s.checkQuota(ctx); err != nil {
+		return nil, err
+	}
+	openaiMessages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: systemPrompt(ctx, s.prompts)},
+		currentDateMessage(),
 	}
+	openaiMessages = append(openaiMessages, conversationMessages(messages)...)
 
-	if resp.Choices[0].FinishReason == openai.FinishReasonToolCalls {
-		if resp.Choices[0].Message.ToolCalls[0].Function.Name == "retrieve_augmented_graph" {
-			// remove last message
-			resp, err = s.retrieveDocument(ctx, openaiMessages, resp.Choices[0].Message.ToolCalls[0].Function.Arguments)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			resp, err = s.handleFunctionCall(ctx, openaiMessages, resp)
-			if err != nil {
-				return nil, err
-			}
+	var rounds chatRounds
+	plan := s.newChatPlan(messages)
+	for iteration := 0; ; iteration++ {
+		request := openai.ChatCompletionRequest{
+			Messages: openaiMessages,
+			Model:    s.model,
+		}
+		if offersTools(iteration) {
+			request.Tools = s.tools
+		}
+		message, err := complete(request)
+		if err != nil {
+			return nil, err
+		}
+		if answer, err := rounds.answer(iteration, message.Content, len(message.ToolCalls)); answer != nil || err != nil {
+			return answer, err
 		}
 
+		startToolRound(ctx)
+		if onToolCalls != nil {
+			onToolCalls(message.ToolCalls)
+		}
+		openaiMessages = append(openaiMessages, message)
+		results := s.runToolCalls(ctx, plan, message.ToolCalls)
+		for i, result := range results {
+			rounds.record(message.ToolCalls[i].Function.Name, result.retrieval)
+		}
+		if answer := rounds.faqAnswer(ctx, s.prompts); answer != nil {
+			return answer, nil
+		}
+		for _, result := range results {
+			openaiMessages = append(openaiMessages, result.message)
+		}
 	}
-
-	// Convert response back to our Message type
-	return &types.Message{
-		Role:    "assistant",
-		Content: resp.Choices[0].Message.Content,
-	}, nil
 }
 
-func (s *OpenAIService) ChatStream(ctx context.Context, messages []types.Message, streamHandler types.StreamHandler) error {
-	// Convert our Message type to OpenAI chat messages
-	openaiMessages := make([]openai.ChatCompletionMessage, 0)
-	openaiMessages = append(openaiMessages, SystemMessageInitiateMechanicalEngineer)
-	for _, msg := range messages {
-		openaiMessages = append(openaiMessages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: msg.Content,
-		})
-	}
-
-	// Create chat completion request
-	stream, err := s.client.CreateChatCompletionStream(
-		ctx,
-		openai.ChatCompletionRequest{
-			Messages: openaiMessages,
-			// Tools:    s.tools,
-			Model: s.model,
-		},
-	)
+// streamCompletion streams one completion, forwarding the content deltas to the handler
+// and assembling the tool calls from their fragments
+func (s *OpenAIService) streamCompletion(ctx context.Context, request openai.ChatCompletionRequest, handler types.StreamEventHandler) (openai.ChatCompletionMessage, error) {
+	// The last chunk then carries the usage of the whole stream, without choices
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := s.client.CreateChatCompletionStream(ctx, request)
 	if err != nil {
-		return err
+		return openai.ChatCompletionMessage{}, err
 	}
 	defer stream.Close()
+
+	var content strings.Builder
+	var toolCalls []openai.ToolCall
 	for {
 		resp, err := stream.Recv()
-
+		if errors.Is(err, io.EOF) {
+			break
+		}
 		if err != nil {
-			if err == io.EOF {
-				return nil
+			return openai.ChatCompletionMessage{}, fmt.Errorf("receive stream: %w", err)
+		}
+		if resp.Usage != nil {
+			s.chatTools.recordUsage(ctx, s.model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		delta := resp.Choices[0].Delta
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			handler(types.StreamEvent{Type: types.STREAM_EVENT_DELTA, Content: delta.Content})
+		}
+		for _, fragment := range delta.ToolCalls {
+			// Fragments of a call share its index, servers without indexes send an ID with each new call
+			index := len(toolCalls) - 1
+			if fragment.Index != nil {
+				index = *fragment.Index
+			} else if fragment.ID != "" || index < 0 {
+				index = len(toolCalls)
+			}
+			// A call continues one of the calls so far or starts the next one
+			if index < 0 || index > len(toolCalls) {
+				return openai.ChatCompletionMessage{}, fmt.Errorf("tool call index %d out of order after %d calls", index, len(toolCalls))
 			}
-			log.Println("Error receiving response from stream:", err)
+			if index == len(toolCalls) {
+				toolCalls = append(toolCalls, openai.ToolCall{Type: openai.ToolTypeFunction})
+			}
+			toolCall := &toolCalls[index]
+			if fragment.ID != "" {
+				toolCall.ID = fragment.ID
+			}
+			toolCall.Function.Name += fragment.Function.Name
+			toolCall.Function.Arguments += fragment.Function.Arguments
 		}
-		streamHandler(resp.Choices[0].Delta.Content)
 	}
 
+	message := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: content.String(),
+	}
+	for i := range toolCalls {
+		toolCall := toolCalls[i]
+		// The index only serves to assemble the stream, tool messages answer the call by ID
+		toolCall.Index = nil
+		if toolCall.ID == "" {
+			toolCall.ID = fmt.Sprintf("call_%d", i)
+		}
+		message.ToolCalls = append(message.ToolCalls, toolCall)
+	}
+	return message, nil
 }
 
-func (s *OpenAIService) RegisterFunctionCall(name, description string, params jsonschema.Definition, handler types.FunctionHandler) error {
-	if name == "retrieve_augmented_graph" {
-		return errors.New("function name retrieve_augmented_graph is reserved")
+// toolStatus tells the user what the assistant is doing while a tool runs
+func toolStatus(name string) string {
+	if name == ragFunctionName {
+		return "Searching documents…"
 	}
-	if s.functionsCall == nil {
-		s.functionsCall = make(map[string]types.FunctionHandler)
+	return fmt.Sprintf("Running %s…", name)
+}
+
+func (s *OpenAIService) RegisterFunctionCall(name, description string, params jsonschema.Definition, handler types.FunctionHandler) error {
+	if err := s.registerFunction(name, handler); err != nil {
+		return err
 	}
 	f := openai.FunctionDefinition{
 		Name:        name,
@@ -155,14 +225,13 @@ func (s *OpenAIService) RegisterFunctionCall(name, description string, params js
 		Type:     openai.ToolTypeFunction,
 		Function: &f,
 	}
-	s.functionsCall[name] = handler
 	s.tools = append(s.tools, t)
 	return nil
 }
 
 func (s *OpenAIService) RegisterRAGFunctionCall() error {
 	f := openai.FunctionDefinition{
-		Name:        "retrieve_augmented_graph",
+		Name:        ragFunctionName,
 		Description: "Retrieve the augmented graph of the documents, use the document as context to answer the question",
 		Parameters: jsonschema.Definition{
 			Type:        "object",
@@ -171,6 +240,7 @@ func (s *OpenAIService) RegisterRAGFunctionCall() error {
 				"queries": {
 					Type:        "array",
 					Description: "List of queries to retrieve the document and use as context",
+					Items:       &jsonschema.Definition{Type: "string"},
 				},
 				"question": {
 					Type:        "string",
@@ -187,104 +257,201 @@ func (s *OpenAIService) RegisterRAGFunctionCall() error {
 	return nil
 }
 
-func (s *OpenAIService) retrieveDocument(ctx context.Context, openaiMessages []openai.ChatCompletionMessage, args string) (openai.ChatCompletionResponse, error) {
-	// var question string
-	// var queries []string
-	openaiMessages = openaiMessages[:len(openaiMessages)-1]
-
-	type RetrieveDocumentArgs struct {
-		Queries  []string `json:"queries"`
-		Question string   `json:"question"`
-	}
+// toolCallResult is the tool message answering one tool call, with the outcome of a
+// retrieval. An FAQ entry answering the question is also in the tool message for rounds
+// that ran other functions.
+type toolCallResult struct {
+	message openai.ChatCompletionMessage
+	retrieval
+}
 
-	var retrieveDocumentArgs RetrieveDocumentArgs
-	if err := json.Unmarshal([]byte(args), &retrieveDocumentArgs); err != nil {
-		return openai.ChatCompletionResponse{}, err
+// runToolCalls runs the tool calls of a round in parallel. Failures are reported
+// to the model in the tool message so that it can explain them or try again.
+func (s *OpenAIService) runToolCalls(ctx context.Context, plan *chatPlan, toolCalls []openai.ToolCall) []toolCallResult {
+	results := make([]toolCallResult, len(toolCalls))
+	var wg sync.WaitGroup
+	for i, toolCall := range toolCalls {
+		wg.Add(1)
+		go func(result *toolCallResult, toolCall openai.ToolCall) {
+			defer wg.Done()
+			var content string
+			if toolCall.Function.Name == ragFunctionName {
+				result.retrieval = s.retrieve(ctx, plan, []byte(toolCall.Function.Arguments))
+				content = retrievalToolContent(result.retrieval)
+			} else {
+				content = s.callFunction(ctx, toolCall)
+			}
+			result.message = openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    content,
+				Name:       toolCall.Function.Name,
+				ToolCallID: toolCall.ID,
+			}
+		}(&results[i], toolCall)
 	}
-	question := retrieveDocumentArgs.Question
-	queries := retrieveDocumentArgs.Queries
+	wg.Wait()
+	return results
+}
 
-	docs, _, err := s.weaviateDb.SearchSimilar(ctx, queries, 5)
+// callFunction runs a registered function and returns the tool message content
+func (s *OpenAIService) callFunction(ctx context.Context, toolCall openai.ToolCall) string {
+	result, err := s.runFunction(ctx, toolCall.Function.Name, []byte(toolCall.Function.Arguments))
 	if err != nil {
-		return openai.ChatCompletionResponse{}, err
+		return toolError(err)
 	}
-	jsonDocs, err := json.Marshal(docs)
+	content, err := toolResultContent(result)
 	if err != nil {
-		return openai.ChatCompletionResponse{}, err
+		log.Printf("Function call %s returned an unencodable result: %v", toolCall.Function.Name, err)
+		return toolError(fmt.Errorf("function %s returned an invalid result", toolCall.Function.Name))
 	}
-	var prompt string
-	if len(docs) == 0 {
-		prompt = createRetrieveDocumentPrompt("No documents found", question)
-	} else {
-		prompt = createRetrieveDocumentPrompt(string(jsonDocs), question)
+	return content
+}
+
+// retrievalToolContent is the tool message content of a RAG tool call: the prompt with the
+// retrieved chunks or the FAQ entry answering the question
+func retrievalToolContent(result retrieval) string {
+	switch {
+	case result.err != nil:
+		return toolError(result.err)
+	case result.faq != nil:
+		return faqToolContent(result.faq)
 	}
-	openaiMessages = append(openaiMessages, openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleUser,
-		Content: prompt,
+	return result.prompt
+}
+
+// PlanQueries asks the model for the standalone question of the conversation and
+// variants paraphrases of it, in Vietnamese and English, to search the documents with
+func (s *OpenAIService) PlanQueries(ctx context.Context, conversation []types.Message, variants int) (*types.QueryPlan, error) {
+	var transcript strings.Builder
+	for _, msg := range conversation {
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, msg.Content)
+	}
+	resp, err := s.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: s.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: fmt.Sprintf(queryPlanPrompt, variants)},
+			{Role: openai.ChatMessageRoleUser, Content: transcript.String()},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+		Temperature:    0.2,
 	})
-	resp, err := s.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Messages: openaiMessages,
-			// Tools:    s.tools,
-			Model: s.model,
-		})
 	if err != nil {
-		return openai.ChatCompletionResponse{}, err
+		return nil, err
 	}
+	s.recordUsage(ctx, resp)
 	if len(resp.Choices) == 0 {
-		return openai.ChatCompletionResponse{}, errors.New("no response generated")
+		return nil, errors.New("no response generated")
+	}
+	content := strings.TrimSpace(resp.Choices[0].Message.Content)
+	// Some models wrap JSON in a code fence even in JSON mode
+	content = strings.TrimPrefix(strings.TrimPrefix(content, "```json"), "```")
+	content = strings.TrimSuffix(content, "```")
+	var plan types.QueryPlan
+	if err := json.Unmarshal([]byte(content), &plan); err != nil {
+		return nil, fmt.Errorf("invalid query plan %q: %w", content, err)
+	}
+	if len(plan.Queries) > variants {
+		plan.Queries = plan.Queries[:variants]
 	}
-	return resp, nil
+	return &plan, nil
 }
 
-func (s *OpenAIService) handleFunctionCall(ctx context.Context, openaiMessages []openai.ChatCompletionMessage, resp openai.ChatCompletionResponse) (openai.ChatCompletionResponse, error) {
-	openaiMessages = append(openaiMessages, resp.Choices[0].Message)
-	for _, toolCall := range resp.Choices[0].Message.ToolCalls {
-		if toolCall.Type == openai.ToolTypeFunction {
-			handler := s.functionsCall[toolCall.Function.Name]
-			if handler == nil {
-				return openai.ChatCompletionResponse{}, errors.New("no handler found for function call")
-			}
-			result, err := handler(ctx, []byte(toolCall.Function.Arguments))
-			if err != nil {
-				return openai.ChatCompletionResponse{}, err
-			}
-			openaiMessages = append(openaiMessages, openai.ChatCompletionMessage{
-				Role:       openai.ChatMessageRoleTool,
-				Content:    result.(string),
-				Name:       toolCall.Function.Name,
-				ToolCallID: toolCall.ID,
-			})
-		}
+// matchFAQ looks the question up in the FAQ of the caller's workspace. Lookup failures
+// only fall back to the documents.
+func matchFAQ(ctx context.Context, faq FAQService, question string) *types.FAQMatch {
+	if faq == nil {
+		return nil
 	}
-	resp, err := s.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Messages: openaiMessages,
-			// Tools:    s.tools,
-			Model: s.model,
-		},
-	)
+	workspace := ""
+	if claims, ok := utils.UserClaimsFromContext(ctx); ok {
+		workspace = claims.Workspace
+	}
+	match, err := faq.MatchFAQ(ctx, question, workspace)
 	if err != nil {
-		return openai.ChatCompletionResponse{}, err
+		log.Printf("FAQ lookup failed: %v", err)
+		return nil
 	}
-	if len(resp.Choices) == 0 {
-		return openai.ChatCompletionResponse{}, errors.New("no response generated")
+	return match
+}
+
+// faqMessage gives the FAQ answer verbatim, in the faq prompt of the caller's workspace
+func faqMessage(ctx context.Context, prompts PromptService, match *types.FAQMatch) *types.Message {
+	return &types.Message{
+		Role:    "assistant",
+		FAQID:   match.FAQID,
+		Content: faqPrompt(ctx, prompts, match),
 	}
-	if resp.Choices[0].FinishReason == openai.FinishReasonToolCalls {
-		return s.handleFunctionCall(ctx, openaiMessages, resp)
+}
+
+// faqToolResponse hands an FAQ entry to the model when the chat does not end with it
+func faqToolResponse(match *types.FAQMatch) map[string]any {
+	return map[string]any{
+		"instruction": "This official FAQ entry answers the question, quote its answer verbatim and say it comes from the FAQ",
+		"question":    match.Question,
+		"answer":      match.Answer,
+	}
+}
+
+func faqToolContent(match *types.FAQMatch) string {
+	content, _ := json.Marshal(faqToolResponse(match))
+	return string(content)
+}
+
+// recordUsage accounts the tokens of every completion, including the intermediate tool call rounds
+func (s *OpenAIService) recordUsage(ctx context.Context, resp openai.ChatCompletionResponse) {
+	s.chatTools.recordUsage(ctx, s.model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+}
+
+// conversationMessages converts the client conversation. Clients only send user and
+// assistant messages, any other role is treated as the user's.
+func conversationMessages(messages []types.Message) []openai.ChatCompletionMessage {
+	openaiMessages := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for _, msg := range messages {
+		role := openai.ChatMessageRoleUser
+		if msg.Role == openai.ChatMessageRoleAssistant {
+			role = openai.ChatMessageRoleAssistant
+		}
+		openaiMessages = append(openaiMessages, openai.ChatCompletionMessage{
+			Role:    role,
+			Content: msg.Content,
+		})
 	}
-	return resp, nil
+	return openaiMessages
 }
 
-func createRetrieveDocumentPrompt(ctx, question string) string {
-	return fmt.Sprintf(`
-Use the following CONTEXT to answer the QUESTION at the end.
-If you don't know the answer, just say that you don't know, don't try to make up an answer.
-Use an unbiased and journalistic tone.
+// toolError is the tool message content reporting a failed tool call
+func toolError(err error) string {
+	content, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(content)
+}
 
-CONTEXT: %s
+// toolResultContent turns a function call result into the tool message content
+func toolResultContent(result any) (string, error) {
+	if content, ok := result.(string); ok {
+		return content, nil
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
 
-QUESTION: %s`, ctx, question)
+// currentDateMessage lets the model resolve relative dates like "by Friday"
+func currentDateMessage() openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: currentDate(),
+	}
 }
+
+func currentDate() string {
+	now := time.Now()
+	return fmt.Sprintf("Today is %s, %s.", now.Weekday(), now.Format("2006-01-02"))
+}
+
+const queryPlanPrompt = `You prepare searches in the technical documentation of the X52 factory.
+Read the conversation and reply with a JSON object only, without any other text:
+{"question": "...", "queries": ["...", "..."]}
+- "question" is the last question of the user rewritten so that it can be understood without the conversation, in the user's language.
+- "queries" are %d short search queries for that question: paraphrases, with at least one in Vietnamese and one in English, keeping equipment names, codes and numbers unchanged.`
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// openAIStub answers the chat completions with the scripted replies in turn, the last
+// one over and over, and records the requests
+type openAIStub struct {
+	mu       sync.Mutex
+	requests []openai.ChatCompletionRequest
+	replies  []openai.ChatCompletionMessage
+}
+
+func newOpenAIStub(t *testing.T, replies ...openai.ChatCompletionMessage) (*openAIStub, *OpenAIService) {
+	t.Helper()
+	stub := &openAIStub{replies: replies}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		var request openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		stub.requests = append(stub.requests, request)
+		reply := stub.replies[min(len(stub.requests), len(stub.replies))-1]
+		stub.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model:   request.Model,
+			Choices: []openai.ChatCompletionChoice{{Message: reply, FinishReason: openai.FinishReasonStop}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return stub, NewOpenAIService(server.URL, "test-key", "test-model", nil)
+}
+
+// toolCalls is an assistant message calling the functions with empty arguments
+func toolCalls(content string, names ...string) openai.ChatCompletionMessage {
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}
+	for i, name := range names {
+		message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+			ID:       "call_" + string(rune('a'+i)),
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: name, Arguments: "{}"},
+		})
+	}
+	return message
+}
+
+func answer(content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}
+}
+
+var askTasks = []types.Message{{Role: "user", Content: "Tạo task báo cáo quý và cho biết còn bao nhiêu task"}}
+
+func TestOpenAIChatRunsToolCallsInParallel(t *testing.T) {
+	stub, s := newOpenAIStub(t, toolCalls("", "create_task", "count_tasks"), answer("Đã tạo task, còn 3 task mở."))
+
+	// Each function waits for the other, calls run one after the other would time out
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	bothArrived := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(bothArrived)
+	}()
+	await := func() error {
+		arrived.Done()
+		select {
+		case <-bothArrived:
+			return nil
+		case <-time.After(2 * time.Second):
+			return errors.New("the other tool call did not run in parallel")
+		}
+	}
+	s.RegisterFunctionCall("create_task", "Create a task", jsonschema.Definition{Type: "object"}, func(ctx context.Context, args []byte) (any, error) {
+		return "created t1", await()
+	})
+	s.RegisterFunctionCall("count_tasks", "Count open tasks", jsonschema.Definition{Type: "object"}, func(ctx context.Context, args []byte) (any, error) {
+		return map[string]int{"open": 3}, await()
+	})
+
+	reply, err := s.Chat(context.Background(), askTasks)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if reply.Content != "Đã tạo task, còn 3 task mở." {
+		t.Errorf("answer %q", reply.Content)
+	}
+	if len(stub.requests) != 2 || len(stub.requests[0].Tools) != 2 {
+		t.Fatalf("%d requests, want 2 offering both tools", len(stub.requests))
+	}
+
+	// The second request answers both calls with tool messages, non-string results as JSON
+	messages := stub.requests[1].Messages
+	tail := messages[len(messages)-3:]
+	if tail[0].Role != openai.ChatMessageRoleAssistant || len(tail[0].ToolCalls) != 2 {
+		t.Fatalf("assistant message %+v", tail[0])
+	}
+	want := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleTool, Name: "create_task", ToolCallID: "call_a", Content: "created t1"},
+		{Role: openai.ChatMessageRoleTool, Name: "count_tasks", ToolCallID: "call_b", Content: `{"open":3}`},
+	}
+	for i, message := range tail[1:] {
+		if message.Role != want[i].Role || message.Name != want[i].Name || message.ToolCallID != want[i].ToolCallID || message.Content != want[i].Content {
+			t.Errorf("tool message %d = %+v, want %+v", i, message, want[i])
+		}
+	}
+}
+
+func TestOpenAIChatStopsOfferingToolsAfterMaxIterations(t *testing.T) {
+	tests := []struct {
+		name    string
+		last    openai.ChatCompletionMessage
+		want    string
+		wantErr string
+	}{
+		{name: "answer with the last calls", last: toolCalls("Chưa tìm được kết quả.", "noop"), want: "Chưa tìm được kết quả."},
+		{name: "no answer", last: toolCalls("", "noop"), wantErr: "no answer after 5 rounds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies := make([]openai.ChatCompletionMessage, maxToolIterations, maxToolIterations+1)
+			for i := range replies {
+				replies[i] = toolCalls("", "noop")
+			}
+			stub, s := newOpenAIStub(t, append(replies, tt.last)...)
+			calls := 0
+			s.RegisterFunctionCall("noop", "Do nothing", jsonschema.Definition{Type: "object"}, func(ctx context.Context, args []byte) (any, error) {
+				calls++
+				return nil, nil
+			})
+
+			reply, err := s.Chat(context.Background(), askTasks)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Chat = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil || reply.Content != tt.want {
+				t.Fatalf("Chat = %+v, %v; want %q", reply, err, tt.want)
+			}
+			if len(stub.requests) != maxToolIterations+1 || calls != maxToolIterations {
+				t.Fatalf("%d requests and %d calls, want %d and %d", len(stub.requests), calls, maxToolIterations+1, maxToolIterations)
+			}
+			for i, request := range stub.requests {
+				if offered := len(request.Tools) > 0; offered != (i < maxToolIterations) {
+					t.Errorf("request %d offers tools: %v", i, offered)
+				}
+			}
+		})
+	}
+}
+
+// fixedFAQ matches every question with its entry
+type fixedFAQ struct {
+	FAQService
+	match *types.FAQMatch
+}
+
+func (f fixedFAQ) MatchFAQ(ctx context.Context, question, workspace string) (*types.FAQMatch, error) {
+	return f.match, nil
+}
+
+func TestOpenAIChatFAQMatch(t *testing.T) {
+	match := &types.FAQMatch{FAQID: "f1", Question: "Làm sao đặt lại mật khẩu?", Answer: "Liên hệ IT."}
+
+	t.Run("retrieval only", func(t *testing.T) {
+		stub, s := newOpenAIStub(t, toolCalls("", ragFunctionName), answer("unused"))
+		s.RegisterRAGFunctionCall()
+		s.SetFAQService(fixedFAQ{match: match})
+		reply, err := s.Chat(context.Background(), []types.Message{{Role: "user", Content: "quên mật khẩu"}})
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		if reply.FAQID != "f1" || !strings.HasSuffix(reply.Content, "Liên hệ IT.") || len(stub.requests) != 1 {
+			t.Errorf("reply %+v after %d requests, want the FAQ answer after 1", reply, len(stub.requests))
+		}
+	})
+
+	t.Run("with another function", func(t *testing.T) {
+		// The task was created in the same round, the model must tell about it
+		stub, s := newOpenAIStub(t, toolCalls("", ragFunctionName, "create_task"), answer("Đã tạo task. Theo FAQ: Liên hệ IT."))
+		s.RegisterRAGFunctionCall()
+		s.SetFAQService(fixedFAQ{match: match})
+		created := 0
+		s.RegisterFunctionCall("create_task", "Create a task", jsonschema.Definition{Type: "object"}, func(ctx context.Context, args []byte) (any, error) {
+			created++
+			return "created t1", nil
+		})
+		reply, err := s.Chat(context.Background(), askTasks)
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		if reply.FAQID != "" || reply.Content != "Đã tạo task. Theo FAQ: Liên hệ IT." || created != 1 {
+			t.Fatalf("reply %+v, %d tasks created", reply, created)
+		}
+		messages := stub.requests[1].Messages
+		results := map[string]string{}
+		for _, message := range messages[len(messages)-2:] {
+			results[message.Name] = message.Content
+		}
+		if results["create_task"] != "created t1" || !strings.Contains(results[ragFunctionName], "Liên hệ IT.") {
+			t.Errorf("tool results %v", results)
+		}
+	})
+}
+
+// newOpenAIStreamStub streams the scripted chunks of each turn as server-sent events, the
+// last turn over and over, and records the requests
+func newOpenAIStreamStub(t *testing.T, turns ...[]openai.ChatCompletionStreamResponse) (*openAIStub, *OpenAIService) {
+	t.Helper()
+	stub := &openAIStub{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !request.Stream {
+			http.Error(w, "want a streamed completion", http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		stub.requests = append(stub.requests, request)
+		turn := turns[min(len(stub.requests), len(turns))-1]
+		stub.mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range turn {
+			data, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return stub, NewOpenAIService(server.URL, "test-key", "test-model", nil)
+}
+
+// toolCallChunk is a stream chunk carrying tool call fragments
+func toolCallChunk(fragments ...openai.ToolCall) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{{
+		Delta: openai.ChatCompletionStreamChoiceDelta{ToolCalls: fragments},
+	}}}
+}
+
+func contentChunk(content string) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{{
+		Delta: openai.ChatCompletionStreamChoiceDelta{Content: content},
+	}}}
+}
+
+// fragment is a piece of a streamed tool call, without an index when index is negative
+func fragment(index int, id, name, arguments string) openai.ToolCall {
+	call := openai.ToolCall{ID: id, Function: openai.FunctionCall{Name: name, Arguments: arguments}}
+	if index >= 0 {
+		call.Index = &index
+	}
+	return call
+}
+
+func TestOpenAIChatStreamAssemblesToolCalls(t *testing.T) {
+	answerTurn := []openai.ChatCompletionStreamResponse{contentChunk("Đã "), contentChunk("xong.")}
+	tests := []struct {
+		name string
+		turn []openai.ChatCompletionStreamResponse
+	}{
+		{name: "interleaved indexes", turn: []openai.ChatCompletionStreamResponse{
+			toolCallChunk(fragment(0, "call_1", "create_task", `{"title":`)),
+			toolCallChunk(fragment(1, "call_2", "count_tasks", `{"status"`)),
+			toolCallChunk(fragment(0, "", "", `"Báo cáo"}`)),
+			toolCallChunk(fragment(1, "", "", `:"open"}`)),
+		}},
+		{name: "no indexes", turn: []openai.ChatCompletionStreamResponse{
+			toolCallChunk(fragment(-1, "call_1", "create_", "")),
+			toolCallChunk(fragment(-1, "", "task", `{"title":`)),
+			toolCallChunk(fragment(-1, "", "", `"Báo cáo"}`)),
+			toolCallChunk(fragment(-1, "call_2", "count_tasks", `{"status":"open"}`)),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, s := newOpenAIStreamStub(t, tt.turn, answerTurn)
+			var mu sync.Mutex
+			args := map[string]string{}
+			record := func(name string) types.FunctionHandler {
+				return func(ctx context.Context, raw []byte) (any, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					args[name] = string(raw)
+					return "ok", nil
+				}
+			}
+			s.RegisterFunctionCall("create_task", "Create a task", jsonschema.Definition{Type: "object"}, record("create_task"))
+			s.RegisterFunctionCall("count_tasks", "Count tasks", jsonschema.Definition{Type: "object"}, record("count_tasks"))
+
+			var events []types.StreamEvent
+			reply, err := s.ChatStream(context.Background(), askTasks, func(event types.StreamEvent) {
+				events = append(events, event)
+			})
+			if err != nil {
+				t.Fatalf("ChatStream: %v", err)
+			}
+			if reply.Content != "Đã xong." {
+				t.Errorf("answer %q", reply.Content)
+			}
+			if args["create_task"] != `{"title":"Báo cáo"}` || args["count_tasks"] != `{"status":"open"}` {
+				t.Errorf("function arguments %v", args)
+			}
+			statuses, deltas := 0, ""
+			for _, event := range events {
+				switch event.Type {
+				case types.STREAM_EVENT_STATUS:
+					statuses++
+				case types.STREAM_EVENT_DELTA:
+					deltas += event.Content
+				}
+			}
+			if statuses != 2 || deltas != "Đã xong." {
+				t.Errorf("%d status events and deltas %q", statuses, deltas)
+			}
+
+			// The calls are sent back by ID, without the index of the stream
+			messages := stub.requests[1].Messages
+			calls := messages[len(messages)-3].ToolCalls
+			if len(calls) != 2 || calls[0].ID != "call_1" || calls[1].ID != "call_2" || calls[0].Index != nil {
+				t.Fatalf("assistant tool calls %+v", calls)
+			}
+			if tool := messages[len(messages)-1]; tool.ToolCallID != "call_2" || tool.Name != "count_tasks" {
+				t.Errorf("last tool message %+v", tool)
+			}
+		})
+	}
+}
+
+func TestOpenAIChatStreamRejectsToolCallIndexOutOfOrder(t *testing.T) {
+	for _, index := range []int{-1, 2, 1 << 30} {
+		// After call 0 only call 1 may start, a negative index or a gap is refused
+		turn := []openai.ChatCompletionStreamResponse{
+			toolCallChunk(fragment(0, "call_1", "count_tasks", "{}")),
+			toolCallChunk(openai.ToolCall{Index: &index, ID: "call_x", Function: openai.FunctionCall{Name: "count_tasks"}}),
+		}
+		_, s := newOpenAIStreamStub(t, turn)
+		ran := false
+		s.RegisterFunctionCall("count_tasks", "Count tasks", jsonschema.Definition{Type: "object"}, func(ctx context.Context, args []byte) (any, error) {
+			ran = true
+			return "ok", nil
+		})
+		_, err := s.ChatStream(context.Background(), askTasks, func(types.StreamEvent) {})
+		if err == nil || !strings.Contains(err.Error(), "out of order") {
+			t.Errorf("index %d: ChatStream = %v, want an out of order error", index, err)
+		}
+		if ran {
+			t.Errorf("index %d: a function ran", index)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+// PendingActionStore keeps destructive tool calls until the user confirms them.
+// Actions live in memory only and expire after ttl.
+type PendingActionStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	actions map[string]*types.PendingAction
+}
+
+func NewPendingActionStore(ttl time.Duration) *PendingActionStore {
+	return &PendingActionStore{
+		ttl:     ttl,
+		actions: make(map[string]*types.PendingAction),
+	}
+}
+
+// Add stores the action under a random ID, the user confirms it with that ID
+func (s *PendingActionStore) Add(userID, tool, summary string, args []byte) (*types.PendingAction, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate action id: %w", err)
+	}
+	now := time.Now()
+	action := &types.PendingAction{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Tool:      tool,
+		Summary:   summary,
+		Args:      args,
+		CreateAt:  now.Unix(),
+		ExpiresAt: now.Add(s.ttl).Unix(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(now.Unix())
+	s.actions[action.ID] = action
+	return action, nil
+}
+
+// Take removes and returns the user's action; it returns false for unknown, expired or foreign actions
+func (s *PendingActionStore) Take(userID, id string) (*types.PendingAction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(time.Now().Unix())
+	action, ok := s.actions[id]
+	if !ok || action.UserID != userID {
+		return nil, false
+	}
+	delete(s.actions, id)
+	return action, true
+}
+
+// Discard drops the user's action without running it
+func (s *PendingActionStore) Discard(userID, id string) bool {
+	_, ok := s.Take(userID, id)
+	return ok
+}
+
+// ListForUser returns the user's actions created at or after since
+func (s *PendingActionStore) ListForUser(userID string, since int64) []*types.PendingAction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(time.Now().Unix())
+	actions := make([]*types.PendingAction, 0)
+	for _, action := range s.actions {
+		if action.UserID == userID && action.CreateAt >= since {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+func (s *PendingActionStore) purge(now int64) {
+	for id, action := range s.actions {
+		if action.ExpiresAt < now {
+			delete(s.actions, id)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingActionStore(t *testing.T) {
+	store := NewPendingActionStore(time.Minute)
+	first, err := store.Add("user-1", "update_task_status", "Cancel task", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := store.Add("user-1", "update_task_status", "Cancel task", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.ID) != 24 || first.ID == second.ID {
+		t.Fatalf("action ids %q and %q, want distinct random ids", first.ID, second.ID)
+	}
+	if _, ok := store.Take("user-2", first.ID); ok {
+		t.Error("another user took the action")
+	}
+	if _, ok := store.Take("user-1", first.ID); !ok {
+		t.Error("the owner could not take the action")
+	}
+	if _, ok := store.Take("user-1", first.ID); ok {
+		t.Error("the action was taken twice")
+	}
+
+	expired := NewPendingActionStore(-time.Second)
+	action, err := expired.Add("user-1", "update_task_status", "Cancel task", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := expired.Take("user-1", action.ID); ok {
+		t.Error("an expired action was taken")
+	}
+}
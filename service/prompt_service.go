@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// DefaultPromptLanguage is the answer language of templates saved without one
+const DefaultPromptLanguage = "Vietnamese"
+
+// defaultPrompts are used for the kinds without any saved template
+var defaultPrompts = map[string]string{
+	types.PROMPT_KIND_SYSTEM: `You are an AI technical assistant for the X52 factory (Nhà máy X52). Your task is to support and answer technical questions related to the operation, maintenance, repair, and optimization of equipment and production processes in the factory.
+
+You always respond in {{.Language}} with accurate, clear, and concise answers. If in-depth information is available, you can provide detailed explanations to help users understand the issue thoroughly.
+
+If a question falls outside your area of expertise or there is not enough data to answer, politely inform the user instead of making assumptions.
+
+Always maintain a professional, polite, and helpful approach when assisting users.
+{{if .Name}}
+You are talking with {{.Name}}{{if .Role}}, {{.Role}}{{end}}{{if .Workspace}} of the {{.Workspace}} department{{end}}.
+{{end}}`,
+	types.PROMPT_KIND_RETRIEVAL: `
+Use the following CONTEXT to answer the QUESTION at the end.
+If you don't know the answer, just say that you don't know, don't try to make up an answer.
+Use an unbiased and journalistic tone.
+
+CONTEXT: {{.Context}}
+
+QUESTION: {{.Question}}`,
+	types.PROMPT_KIND_ASK_AI: `You are an intelligent AI assistant. Below is relevant information retrieved from a RAG system:
+[CONTEXT]
+Title: {title}  
+Content: {content}  
+[/CONTEXT]  
+Based on the information above, answer the user's question accurately and concisely. If the provided information is not sufficient to answer, state that you don't have enough data instead of guessing. You answer by {{.Language}}.
+User's question: {{.Question}}`,
+	types.PROMPT_KIND_FAQ: `{{if eq .Language "Vietnamese"}}Câu trả lời dưới đây được trích nguyên văn từ mục Hỏi đáp (FAQ) chính thức cho câu hỏi "{{.Question}}":{{else}}The answer below is quoted verbatim from the official FAQ for the question "{{.Question}}":{{end}}
+
+{{.Context}}`,
+}
+
+type PromptService interface {
+	// SavePrompt adds a version to the template of the kind and workspace
+	SavePrompt(ctx context.Context, req types.PromptTemplateRequest, by string) (*types.PromptTemplate, error)
+	GetPrompt(ctx context.Context, id string) (*types.PromptTemplate, error)
+	ListPrompts(ctx context.Context, filter types.PromptTemplateFilter, opts types.ListOptions) ([]*types.PromptTemplate, types.PageInfo, error)
+	// CurrentPrompt returns the template members of the workspace get: the workspace one, else
+	// the default one, else the built-in one with version 0
+	CurrentPrompt(ctx context.Context, kind, workspace string) (*types.PromptTemplate, error)
+	// RestorePrompt saves an old version again as the latest one
+	RestorePrompt(ctx context.Context, id, by string) (*types.PromptTemplate, error)
+	PreviewPrompt(ctx context.Context, req types.PromptPreviewRequest) (string, error)
+	// Render renders the current template of the kind for the workspace of data
+	Render(ctx context.Context, kind string, data types.PromptData) (string, error)
+}
+
+type promptService struct {
+	promptRepo       repository.PromptRepo
+	workspaceService WorkspaceService
+}
+
+func NewPromptService(promptRepo repository.PromptRepo, workspaceService WorkspaceService) PromptService {
+	return &promptService{
+		promptRepo:       promptRepo,
+		workspaceService: workspaceService,
+	}
+}
+
+func (s *promptService) validate(ctx context.Context, req *types.PromptTemplateRequest) error {
+	if !slices.Contains(types.PromptKinds, req.Kind) {
+		return fmt.Errorf("%w: kind must be one of %s", ErrInvalidArgument, strings.Join(types.PromptKinds, ", "))
+	}
+	req.Language = strings.TrimSpace(req.Language)
+	if req.Language == "" {
+		req.Language = DefaultPromptLanguage
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		return fmt.Errorf("%w: content is required", ErrInvalidArgument)
+	}
+	// Rendering a sample catches unknown variables, which parsing alone does not
+	if _, err := renderPrompt(req.Content, samplePromptData(req.Workspace, req.Language)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	return s.workspaceService.ValidateMembership(ctx, req.Workspace, "")
+}
+
+func (s *promptService) SavePrompt(ctx context.Context, req types.PromptTemplateRequest, by string) (*types.PromptTemplate, error) {
+	if err := s.validate(ctx, &req); err != nil {
+		return nil, err
+	}
+	prompt := &types.PromptTemplate{
+		Kind:      req.Kind,
+		Workspace: req.Workspace,
+		Language:  req.Language,
+		Content:   req.Content,
+		Note:      req.Note,
+		CreatedBy: by,
+		CreateAt:  time.Now().Unix(),
+	}
+	if err := s.promptRepo.CreatePrompt(ctx, prompt); err != nil {
+		return nil, err
+	}
+	return prompt, nil
+}
+
+func (s *promptService) GetPrompt(ctx context.Context, id string) (*types.PromptTemplate, error) {
+	prompt, err := s.promptRepo.GetPrompt(ctx, id)
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	return prompt, err
+}
+
+func (s *promptService) ListPrompts(ctx context.Context, filter types.PromptTemplateFilter, opts types.ListOptions) ([]*types.PromptTemplate, types.PageInfo, error) {
+	return s.promptRepo.ListPrompts(ctx, filter, opts)
+}
+
+func (s *promptService) CurrentPrompt(ctx context.Context, kind, workspace string) (*types.PromptTemplate, error) {
+	content, ok := defaultPrompts[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown prompt kind %q", ErrInvalidArgument, kind)
+	}
+	workspaces := []string{""}
+	if workspace != "" {
+		workspaces = []string{workspace, ""}
+	}
+	for _, ws := range workspaces {
+		prompt, err := s.promptRepo.LatestPrompt(ctx, kind, ws)
+		if err == nil {
+			return prompt, nil
+		}
+		if !isNotFound(err) {
+			return nil, err
+		}
+	}
+	return &types.PromptTemplate{
+		Kind:     kind,
+		Language: DefaultPromptLanguage,
+		Content:  content,
+	}, nil
+}
+
+func (s *promptService) RestorePrompt(ctx context.Context, id, by string) (*types.PromptTemplate, error) {
+	old, err := s.GetPrompt(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.SavePrompt(ctx, types.PromptTemplateRequest{
+		Kind:      old.Kind,
+		Workspace: old.Workspace,
+		Language:  old.Language,
+		Content:   old.Content,
+		Note:      fmt.Sprintf("restored from version %d", old.Version),
+	}, by)
+}
+
+func (s *promptService) PreviewPrompt(ctx context.Context, req types.PromptPreviewRequest) (string, error) {
+	if req.Content == "" {
+		current, err := s.CurrentPrompt(ctx, req.Kind, req.Workspace)
+		if err != nil {
+			return "", err
+		}
+		req.Content = current.Content
+		if req.Language == "" {
+			req.Language = current.Language
+		}
+	}
+	if req.Language == "" {
+		req.Language = DefaultPromptLanguage
+	}
+	data := samplePromptData(req.Workspace, req.Language)
+	if req.FullName != "" || req.Username != "" {
+		data.Name = promptName(req.FullName, req.Username)
+		data.Username = req.Username
+		data.Role = req.WorkspaceRole
+	}
+	if req.Question != "" {
+		data.Question = req.Question
+	}
+	if req.Context != "" {
+		data.Context = req.Context
+	}
+	content, err := renderPrompt(req.Content, data)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	return content, nil
+}
+
+func (s *promptService) Render(ctx context.Context, kind string, data types.PromptData) (string, error) {
+	prompt, err := s.CurrentPrompt(ctx, kind, data.Workspace)
+	if err != nil {
+		return "", err
+	}
+	data.Language = prompt.Language
+	content, err := renderPrompt(prompt.Content, data)
+	if err != nil {
+		return "", fmt.Errorf("%s prompt version %d: %w", kind, prompt.Version, err)
+	}
+	return content, nil
+}
+
+// PromptDataFromContext fills the prompt variables of the user of the request
+func PromptDataFromContext(ctx context.Context) types.PromptData {
+	now := time.Now()
+	data := types.PromptData{
+		Language: DefaultPromptLanguage,
+		Date:     now.Format("2006-01-02"),
+		Weekday:  now.Weekday().String(),
+	}
+	if claims, ok := utils.UserClaimsFromContext(ctx); ok {
+		data.Name = promptName(claims.FullName, claims.Username)
+		data.Username = claims.Username
+		data.Role = claims.WorkspaceRole
+		data.Workspace = claims.Workspace
+	}
+	return data
+}
+
+// promptFor renders the prompt template of the caller's workspace, falling back to
+// the built-in one when the templates cannot be loaded or prompts is nil
+func promptFor(ctx context.Context, prompts PromptService, kind string, data types.PromptData) string {
+	if prompts != nil {
+		content, err := prompts.Render(ctx, kind, data)
+		if err == nil {
+			return content
+		}
+		log.Printf("Failed to render the %s prompt: %v", kind, err)
+	}
+	return renderDefaultPrompt(kind, data)
+}
+
+func systemPrompt(ctx context.Context, prompts PromptService) string {
+	return promptFor(ctx, prompts, types.PROMPT_KIND_SYSTEM, PromptDataFromContext(ctx))
+}
+
+func retrievalPrompt(ctx context.Context, prompts PromptService, documents, question string) string {
+	data := PromptDataFromContext(ctx)
+	data.Context = documents
+	data.Question = question
+	return promptFor(ctx, prompts, types.PROMPT_KIND_RETRIEVAL, data)
+}
+
+// faqPrompt quotes the answer of an FAQ entry, introduced so the user knows where it comes from
+func faqPrompt(ctx context.Context, prompts PromptService, match *types.FAQMatch) string {
+	data := PromptDataFromContext(ctx)
+	data.Context = match.Answer
+	data.Question = match.Question
+	return promptFor(ctx, prompts, types.PROMPT_KIND_FAQ, data)
+}
+
+// renderDefaultPrompt renders the built-in template of the kind, for when the saved ones are unavailable
+func renderDefaultPrompt(kind string, data types.PromptData) string {
+	if data.Language == "" {
+		data.Language = DefaultPromptLanguage
+	}
+	content, err := renderPrompt(defaultPrompts[kind], data)
+	if err != nil {
+		// The built-in templates only use known variables
+		log.Printf("Failed to render the built-in %s prompt: %v", kind, err)
+	}
+	return content
+}
+
+func renderPrompt(content string, data types.PromptData) (string, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func samplePromptData(workspace, language string) types.PromptData {
+	now := time.Now()
+	return types.PromptData{
+		Name:      "Nguyễn Văn A",
+		Username:  "nguyenvana",
+		Role:      types.USER_WORKSPACE_ROLE_STAFF,
+		Workspace: workspace,
+		Language:  language,
+		Date:      now.Format("2006-01-02"),
+		Weekday:   now.Weekday().String(),
+		Context:   "[sample documents]",
+		Question:  "[sample question]",
+	}
+}
+
+func promptName(fullName, username string) string {
+	if fullName != "" {
+		return fullName
+	}
+	return username
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+func TestFAQMessageUsesTheFAQPromptOfTheWorkspace(t *testing.T) {
+	repo := &fakePromptRepo{}
+	prompts := NewPromptService(repo, fakeWorkspaceService{workspaces: []string{"DepartmentTechnical"}})
+	match := &types.FAQMatch{FAQID: "f1", Question: "How do I reset my VPN token?", Answer: "Ask IT."}
+	technical := utils.ContextWithUserClaims(context.Background(), &utils.UserClaims{Workspace: "DepartmentTechnical"})
+
+	// The built-in template answers in the default language
+	message := faqMessage(technical, prompts, match)
+	if message.FAQID != "f1" || !strings.HasPrefix(message.Content, "Câu trả lời dưới đây") || !strings.HasSuffix(message.Content, "\n\nAsk IT.") {
+		t.Errorf("built-in FAQ message %+v", message)
+	}
+
+	// A workspace answering in English gets the English preface of the built-in content
+	_, err := prompts.SavePrompt(context.Background(), types.PromptTemplateRequest{
+		Kind: types.PROMPT_KIND_FAQ, Workspace: "DepartmentTechnical", Language: "English", Content: defaultPrompts[types.PROMPT_KIND_FAQ],
+	}, "admin")
+	if err != nil {
+		t.Fatalf("SavePrompt: %v", err)
+	}
+	message = faqMessage(technical, prompts, match)
+	want := "The answer below is quoted verbatim from the official FAQ for the question \"How do I reset my VPN token?\":\n\nAsk IT."
+	if message.Content != want {
+		t.Errorf("FAQ message of the English workspace %q, want %q", message.Content, want)
+	}
+	if other := faqMessage(context.Background(), prompts, match); !strings.HasPrefix(other.Content, "Câu trả lời") {
+		t.Errorf("FAQ message outside the workspace %q", other.Content)
+	}
+}
+
+func TestCurrentPromptFallsBackFromWorkspaceToDefaultToBuiltIn(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakePromptRepo{}
+	prompts := NewPromptService(repo, fakeWorkspaceService{workspaces: []string{types.DepartmentTechnical}})
+
+	prompt, err := prompts.CurrentPrompt(ctx, types.PROMPT_KIND_SYSTEM, types.DepartmentTechnical)
+	if err != nil || prompt.Version != 0 || prompt.Content != defaultPrompts[types.PROMPT_KIND_SYSTEM] || prompt.Language != DefaultPromptLanguage {
+		t.Fatalf("CurrentPrompt without templates = %+v, %v; want the built-in one", prompt, err)
+	}
+
+	save := func(workspace, content string) {
+		t.Helper()
+		if _, err := prompts.SavePrompt(ctx, types.PromptTemplateRequest{Kind: types.PROMPT_KIND_SYSTEM, Workspace: workspace, Content: content}, "admin"); err != nil {
+			t.Fatalf("SavePrompt: %v", err)
+		}
+	}
+	save("", "default v1")
+	save("", "default v2")
+	for _, workspace := range []string{types.DepartmentTechnical, ""} {
+		if prompt, err := prompts.CurrentPrompt(ctx, types.PROMPT_KIND_SYSTEM, workspace); err != nil || prompt.Content != "default v2" || prompt.Version != 2 {
+			t.Errorf("CurrentPrompt for %q = %+v, %v; want the latest default", workspace, prompt, err)
+		}
+	}
+
+	save(types.DepartmentTechnical, "technical")
+	if prompt, err := prompts.CurrentPrompt(ctx, types.PROMPT_KIND_SYSTEM, types.DepartmentTechnical); err != nil || prompt.Content != "technical" {
+		t.Errorf("CurrentPrompt of the workspace = %+v, %v", prompt, err)
+	}
+	if prompt, err := prompts.CurrentPrompt(ctx, types.PROMPT_KIND_SYSTEM, types.DepartmentQuality); err != nil || prompt.Content != "default v2" {
+		t.Errorf("CurrentPrompt of another workspace = %+v, %v", prompt, err)
+	}
+	if _, err := prompts.CurrentPrompt(ctx, "persona", ""); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("CurrentPrompt of an unknown kind = %v, want ErrInvalidArgument", err)
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	data := types.PromptData{Name: "Lan", Language: "English", Question: "q?"}
+	content, err := renderPrompt("{{.Name}} in {{.Language}}{{if .Workspace}} of {{.Workspace}}{{end}}: {{.Question}}", data)
+	if err != nil || content != "Lan in English: q?" {
+		t.Errorf("renderPrompt = %q, %v", content, err)
+	}
+	for _, invalid := range []string{"{{.Unknown}}", "{{.Name"} {
+		if _, err := renderPrompt(invalid, data); err == nil {
+			t.Errorf("renderPrompt(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestPromptForFallsBackToBuiltIn(t *testing.T) {
+	repo := &fakePromptRepo{}
+	prompts := NewPromptService(repo, fakeWorkspaceService{})
+	ctx := context.Background()
+	if _, err := prompts.SavePrompt(ctx, types.PromptTemplateRequest{Kind: types.PROMPT_KIND_RETRIEVAL, Language: "English", Content: "{{.Language}}: {{.Context}} / {{.Question}}"}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if prompt := retrievalPrompt(ctx, prompts, "docs", "q?"); prompt != "English: docs / q?" {
+		t.Errorf("retrieval prompt %q", prompt)
+	}
+
+	// The built-in template is used when the saved ones cannot be loaded
+	repo.err = errors.New("database down")
+	want := renderDefaultPrompt(types.PROMPT_KIND_RETRIEVAL, types.PromptData{Context: "docs", Question: "q?"})
+	if prompt := retrievalPrompt(ctx, prompts, "docs", "q?"); prompt != want || !strings.Contains(prompt, "CONTEXT: docs") {
+		t.Errorf("retrieval prompt without templates %q", prompt)
+	}
+	if prompt := retrievalPrompt(ctx, nil, "docs", "q?"); prompt != want {
+		t.Errorf("retrieval prompt without prompt service %q", prompt)
+	}
+}
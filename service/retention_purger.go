@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/repository"
+)
+
+// RetentionPurger permanently removes users and documents that have been
+// soft-deleted for longer than the retention period
+type RetentionPurger struct {
+	userRepo        repository.UserRepo
+	documentService DocumentService
+	retention       time.Duration
+	interval        time.Duration
+}
+
+func NewRetentionPurger(userRepo repository.UserRepo, documentService DocumentService, retention, interval time.Duration) *RetentionPurger {
+	return &RetentionPurger{
+		userRepo:        userRepo,
+		documentService: documentService,
+		retention:       retention,
+		interval:        interval,
+	}
+}
+
+// Start purges right away and then every interval until ctx is cancelled
+func (p *RetentionPurger) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			if err := p.Purge(ctx); err != nil {
+				log.Printf("Retention purge failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *RetentionPurger) Purge(ctx context.Context) error {
+	before := time.Now().Add(-p.retention).Unix()
+	users, err := p.userRepo.PurgeDeletedUsers(ctx, before)
+	if err != nil {
+		return err
+	}
+	documents, err := p.documentService.PurgeDocuments(ctx, before)
+	if users > 0 || documents > 0 {
+		log.Printf("Purged %d deleted users and %d deleted documents", users, documents)
+	}
+	return err
+}
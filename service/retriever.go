@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/database"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// QueryPlanner condenses a conversation into a standalone question and search queries
+type QueryPlanner interface {
+	PlanQueries(ctx context.Context, conversation []types.Message, variants int) (*types.QueryPlan, error)
+}
+
+// Retriever searches the knowledge base with several queries per question and
+// merges the results with reciprocal rank fusion
+type Retriever struct {
+	planner  QueryPlanner
+	vectorDB database.VectorDatabase
+	config   config.RetrievalConfig
+}
+
+func NewRetriever(planner QueryPlanner, vectorDB database.VectorDatabase, config config.RetrievalConfig) *Retriever {
+	return &Retriever{
+		planner:  planner,
+		vectorDB: vectorDB,
+		config:   config,
+	}
+}
+
+// Plan returns the query plan of the conversation. When planning fails or takes longer
+// than the plan timeout the last user message is searched as is, retrieval never fails
+// because of the planner.
+func (r *Retriever) Plan(ctx context.Context, conversation []types.Message) *types.QueryPlan {
+	question := lastUserMessage(conversation)
+	if r.config.PlanTimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(r.config.PlanTimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	plan, err := r.planner.PlanQueries(ctx, conversation, r.config.QueryVariants)
+	if err != nil {
+		log.Printf("Query planning failed, searching the question as is: %v", err)
+		return &types.QueryPlan{Question: question, Queries: []string{question}}
+	}
+	if strings.TrimSpace(plan.Question) == "" {
+		plan.Question = question
+	}
+	plan.Queries = uniqueQueries(append([]string{plan.Question}, plan.Queries...))
+	return plan
+}
+
+// VisibleWorkspaces returns the workspaces whose documents the caller may retrieve: the
+// global documents and those of their own workspace. Global users and callers without
+// user claims, such as admins, search every workspace and get nil.
+func VisibleWorkspaces(ctx context.Context) []string {
+	claims, ok := utils.UserClaimsFromContext(ctx)
+	if !ok || claims.IsGlobal() {
+		return nil
+	}
+	if claims.Workspace == "" {
+		return []string{""}
+	}
+	return []string{claims.Workspace, ""}
+}
+
+// Retrieve plans the conversation and searches the planned queries together with extraQueries
+func (r *Retriever) Retrieve(ctx context.Context, conversation []types.Message, extraQueries []string, metadata types.Metadata, limit int) (*types.QueryPlan, []types.Document, error) {
+	plan := r.Plan(ctx, conversation)
+	plan.Queries = uniqueQueries(append(plan.Queries, extraQueries...))
+	docs, err := r.Search(ctx, plan.Queries, metadata, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan, docs, nil
+}
+
+// Search runs every query on its own and fuses the rankings, a chunk found by several
+// queries ranks above one found by a single query
+func (r *Retriever) Search(ctx context.Context, queries []string, metadata types.Metadata, limit int) ([]types.Document, error) {
+	rankings := make([][]types.Document, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		go func(i int, query string) {
+			defer wg.Done()
+			rankings[i], _, errs[i] = r.vectorDB.SearchSimilarWithMetadata(ctx, []string{query}, metadata, r.config.CandidatesPerQuery)
+		}(i, query)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			log.Printf("Search for query %q failed: %v", queries[i], err)
+		}
+	}
+	if failed > 0 && failed == len(queries) {
+		return nil, fmt.Errorf("all %d searches failed: %w", failed, errs[0])
+	}
+	return fuseRankings(rankings, r.config.RRFK, limit), nil
+}
+
+// fuseRankings merges rankings with reciprocal rank fusion, scoring each chunk with
+// the sum of 1/(k+rank) over the rankings it appears in
+func fuseRankings(rankings [][]types.Document, k, limit int) []types.Document {
+	type fused struct {
+		doc   types.Document
+		score float64
+		first int
+	}
+	byKey := make(map[string]*fused)
+	order := 0
+	for _, ranking := range rankings {
+		for rank, doc := range ranking {
+			key := doc.ID
+			if key == "" {
+				key = doc.Content
+			}
+			entry, ok := byKey[key]
+			if !ok {
+				entry = &fused{doc: doc, first: order}
+				byKey[key] = entry
+				order++
+			}
+			entry.score += 1 / float64(k+rank+1)
+		}
+	}
+	merged := make([]*fused, 0, len(byKey))
+	for _, entry := range byKey {
+		merged = append(merged, entry)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].score != merged[j].score {
+			return merged[i].score > merged[j].score
+		}
+		return merged[i].first < merged[j].first
+	})
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+	docs := make([]types.Document, 0, len(merged))
+	for _, entry := range merged {
+		if entry.doc.Metadata.Custom == nil {
+			entry.doc.Metadata.Custom = make(map[string]string)
+		}
+		entry.doc.Metadata.Custom["rrf_score"] = fmt.Sprintf("%f", entry.score)
+		docs = append(docs, entry.doc)
+	}
+	return docs
+}
+
+// uniqueQueries drops blank and repeated queries, keeping the first occurrence
+func uniqueQueries(queries []string) []string {
+	seen := make(map[string]bool, len(queries))
+	unique := make([]string, 0, len(queries))
+	for _, query := range queries {
+		query = strings.TrimSpace(query)
+		key := strings.ToLower(query)
+		if query == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, query)
+	}
+	return unique
+}
+
+func lastUserMessage(messages []types.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
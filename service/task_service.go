@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// taskActor decides whether the caller may perform a transition on the task
+type taskActor func(caller *utils.UserClaims, task *types.Task) bool
+
+func taskAssignee(caller *utils.UserClaims, task *types.Task) bool {
+	return task.Assignee != "" && caller.ID == task.Assignee
+}
+
+func taskReporter(caller *utils.UserClaims, task *types.Task) bool {
+	return caller.ID == task.Reporter
+}
+
+func taskManager(caller *utils.UserClaims, task *types.Task) bool {
+	return caller.Role == types.USER_ROLE_ADMIN || caller.ID == task.Reporter || caller.ID == task.Creator
+}
+
+// taskTransitions is the task state machine: open -> doing -> review -> completed/close.
+// The reporter approves or rejects a review, and a task can be cancelled from any non-terminal state.
+var taskTransitions = map[string]map[string]taskActor{
+	types.TASK_STATUS_OPEN: {
+		types.TASK_STATUS_DOING:  taskAssignee,
+		types.TASK_STATUS_CANCEL: taskManager,
+	},
+	types.TASK_STATUS_DOING: {
+		types.TASK_STATUS_REVIEW: taskAssignee,
+		types.TASK_STATUS_CANCEL: taskManager,
+	},
+	types.TASK_STATUS_REVIEW: {
+		types.TASK_STATUS_COMPLETED: taskReporter,
+		types.TASK_STATUS_CLOSE:     taskReporter,
+		types.TASK_STATUS_DOING:     taskReporter,
+		types.TASK_STATUS_CANCEL:    taskManager,
+	},
+}
+
+var taskStatuses = map[string]bool{
+	types.TASK_STATUS_OPEN:      true,
+	types.TASK_STATUS_DOING:     true,
+	types.TASK_STATUS_REVIEW:    true,
+	types.TASK_STATUS_COMPLETED: true,
+	types.TASK_STATUS_CLOSE:     true,
+	types.TASK_STATUS_CANCEL:    true,
+}
+
+// IsTaskTerminal reports whether no further transitions are possible from the status
+func IsTaskTerminal(status string) bool {
+	_, ok := taskTransitions[status]
+	return !ok
+}
+
+type TaskService interface {
+	CreateTask(ctx context.Context, caller *utils.UserClaims, req types.CreateTaskRequest) (*types.Task, error)
+	GetTask(ctx context.Context, caller *utils.UserClaims, id string) (*types.Task, error)
+	ListTasks(ctx context.Context, caller *utils.UserClaims, filter types.TaskFilter, opts types.ListOptions) ([]*types.Task, types.PageInfo, error)
+	AssignTask(ctx context.Context, caller *utils.UserClaims, id, assignee string) (*types.Task, error)
+	ReportTask(ctx context.Context, caller *utils.UserClaims, id, report string) (*types.Task, error)
+	TransitionTask(ctx context.Context, caller *utils.UserClaims, id, status string) (*types.Task, error)
+	AddComment(ctx context.Context, caller *utils.UserClaims, id string, req types.CreateTaskCommentRequest) (*types.TaskComment, error)
+	ListComments(ctx context.Context, caller *utils.UserClaims, id string) ([]*types.TaskComment, error)
+}
+
+type taskService struct {
+	taskRepo    repository.TaskRepo
+	commentRepo repository.TaskCommentRepo
+	userRepo    repository.UserRepo
+}
+
+func NewTaskService(taskRepo repository.TaskRepo, commentRepo repository.TaskCommentRepo, userRepo repository.UserRepo) TaskService {
+	return &taskService{
+		taskRepo:    taskRepo,
+		commentRepo: commentRepo,
+		userRepo:    userRepo,
+	}
+}
+
+func (s *taskService) CreateTask(ctx context.Context, caller *utils.UserClaims, req types.CreateTaskRequest) (*types.Task, error) {
+	if strings.TrimSpace(req.Title) == "" {
+		return nil, fmt.Errorf("%w: title is required", ErrInvalidArgument)
+	}
+	workspace := req.Workspace
+	if workspace == "" {
+		workspace = caller.Workspace
+	}
+	if !caller.CanAccessWorkspace(workspace) {
+		return nil, ErrPermissionDenied
+	}
+	now := time.Now().Unix()
+	task := &types.Task{
+		Title:       req.Title,
+		Description: req.Description,
+		Workspace:   workspace,
+		Creator:     caller.ID,
+		Reporter:    caller.ID,
+		Deadline:    req.Deadline,
+		Status:      types.TASK_STATUS_OPEN,
+		CreateAt:    now,
+		UpdateAt:    now,
+		History: []types.TaskHistory{{
+			Actor:    caller.ID,
+			Action:   types.TASK_HISTORY_ACTION_CREATE,
+			CreateAt: now,
+		}},
+	}
+	if req.Assignee != "" {
+		if err := s.checkAssignee(ctx, caller, task, req.Assignee); err != nil {
+			return nil, err
+		}
+		task.Assignee = req.Assignee
+	}
+	if err := s.taskRepo.CreateTask(ctx, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (s *taskService) GetTask(ctx context.Context, caller *utils.UserClaims, id string) (*types.Task, error) {
+	task, err := s.taskRepo.GetTask(ctx, id)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	// Tasks of other workspaces are reported as missing rather than forbidden
+	if !caller.CanAccessWorkspace(task.Workspace) {
+		return nil, ErrNotFound
+	}
+	return task, nil
+}
+
+func (s *taskService) ListTasks(ctx context.Context, caller *utils.UserClaims, filter types.TaskFilter, opts types.ListOptions) ([]*types.Task, types.PageInfo, error) {
+	if filter.Workspace == "" && !caller.IsGlobal() {
+		filter.Workspace = caller.Workspace
+	}
+	if !caller.CanAccessWorkspace(filter.Workspace) && filter.Workspace != "" {
+		return nil, types.PageInfo{}, ErrPermissionDenied
+	}
+	return s.taskRepo.ListTasks(ctx, filter, opts)
+}
+
+func (s *taskService) AssignTask(ctx context.Context, caller *utils.UserClaims, id, assignee string) (*types.Task, error) {
+	task, err := s.GetTask(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if IsTaskTerminal(task.Status) {
+		return nil, fmt.Errorf("%w: task is %s", ErrInvalidArgument, task.Status)
+	}
+	if err := s.checkAssignee(ctx, caller, task, assignee); err != nil {
+		return nil, err
+	}
+	if err := s.updateField(ctx, caller, task, "assignee", task.Assignee, assignee); err != nil {
+		return nil, err
+	}
+	task.Assignee = assignee
+	return task, nil
+}
+
+func (s *taskService) ReportTask(ctx context.Context, caller *utils.UserClaims, id, report string) (*types.Task, error) {
+	task, err := s.GetTask(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if task.Assignee != caller.ID {
+		return nil, ErrPermissionDenied
+	}
+	if IsTaskTerminal(task.Status) {
+		return nil, fmt.Errorf("%w: task is %s", ErrInvalidArgument, task.Status)
+	}
+	if err := s.updateField(ctx, caller, task, "report", task.Report, report); err != nil {
+		return nil, err
+	}
+	task.Report = report
+	return task, nil
+}
+
+func (s *taskService) TransitionTask(ctx context.Context, caller *utils.UserClaims, id, status string) (*types.Task, error) {
+	if !taskStatuses[status] {
+		return nil, fmt.Errorf("%w: unknown task status %q", ErrInvalidArgument, status)
+	}
+	task, err := s.GetTask(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	actor, ok := taskTransitions[task.Status][status]
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot move task from %s to %s", ErrInvalidArgument, task.Status, status)
+	}
+	if !actor(caller, task) {
+		return nil, ErrPermissionDenied
+	}
+	history := types.TaskHistory{
+		Actor:    caller.ID,
+		Action:   types.TASK_HISTORY_ACTION_STATUS,
+		Field:    "status",
+		From:     task.Status,
+		To:       status,
+		CreateAt: time.Now().Unix(),
+	}
+	if err := s.taskRepo.UpdateTaskStatus(ctx, task.ID, task.Status, status, history); err != nil {
+		if errors.Is(err, repository.ErrTaskConflict) {
+			return nil, fmt.Errorf("%w: %v", ErrConflict, err)
+		}
+		return nil, err
+	}
+	task.Status = status
+	task.UpdateAt = history.CreateAt
+	task.History = append(task.History, history)
+	return task, nil
+}
+
+func (s *taskService) AddComment(ctx context.Context, caller *utils.UserClaims, id string, req types.CreateTaskCommentRequest) (*types.TaskComment, error) {
+	if strings.TrimSpace(req.Content) == "" {
+		return nil, fmt.Errorf("%w: content is required", ErrInvalidArgument)
+	}
+	task, err := s.GetTask(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.ParentID != "" {
+		parent, err := s.commentRepo.GetComment(ctx, req.ParentID)
+		if err != nil {
+			if isNotFound(err) {
+				return nil, fmt.Errorf("%w: parent comment not found", ErrInvalidArgument)
+			}
+			return nil, err
+		}
+		if parent.TaskID != task.ID {
+			return nil, fmt.Errorf("%w: parent comment belongs to another task", ErrInvalidArgument)
+		}
+	}
+	comment := &types.TaskComment{
+		TaskID:   task.ID,
+		ParentID: req.ParentID,
+		Author:   caller.ID,
+		Content:  req.Content,
+		CreateAt: time.Now().Unix(),
+	}
+	if err := s.commentRepo.CreateComment(ctx, comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// ListComments returns the task's comments as threads, replies nested under their parent
+func (s *taskService) ListComments(ctx context.Context, caller *utils.UserClaims, id string) ([]*types.TaskComment, error) {
+	task, err := s.GetTask(ctx, caller, id)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := s.commentRepo.ListComments(ctx, task.ID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*types.TaskComment, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+	threads := make([]*types.TaskComment, 0)
+	for _, comment := range comments {
+		if parent, ok := byID[comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+			continue
+		}
+		threads = append(threads, comment)
+	}
+	return threads, nil
+}
+
+func (s *taskService) updateField(ctx context.Context, caller *utils.UserClaims, task *types.Task, field, from, to string) error {
+	now := time.Now().Unix()
+	history := types.TaskHistory{
+		Actor:    caller.ID,
+		Action:   types.TASK_HISTORY_ACTION_UPDATE,
+		Field:    field,
+		From:     from,
+		To:       to,
+		CreateAt: now,
+	}
+	if err := s.taskRepo.UpdateTask(ctx, task.ID, map[string]interface{}{field: to, "updated_at": now}, history); err != nil {
+		return err
+	}
+	task.UpdateAt = now
+	task.History = append(task.History, history)
+	return nil
+}
+
+// checkAssignee allows self-assignment, otherwise the assignee must be in the task's
+// workspace and rank below the caller
+func (s *taskService) checkAssignee(ctx context.Context, caller *utils.UserClaims, task *types.Task, assignee string) error {
+	if assignee == caller.ID {
+		return nil
+	}
+	user, err := s.userRepo.GetUser(ctx, assignee)
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: assignee not found", ErrInvalidArgument)
+		}
+		return err
+	}
+	if user.Workspace != task.Workspace {
+		return fmt.Errorf("%w: assignee is not in workspace %s", ErrInvalidArgument, task.Workspace)
+	}
+	if caller.Role != types.USER_ROLE_ADMIN && user.ManagementLevel >= caller.ManagementLevel {
+		return ErrPermissionDenied
+	}
+	return nil
+}
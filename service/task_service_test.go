@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+var (
+	taskAssigneeCaller = &utils.UserClaims{ID: "u-assignee", Workspace: types.DepartmentTechnical}
+	taskReporterCaller = &utils.UserClaims{ID: "u-reporter", Workspace: types.DepartmentTechnical}
+	taskCreatorCaller  = &utils.UserClaims{ID: "u-creator", Workspace: types.DepartmentTechnical}
+	taskAdminCaller    = &utils.UserClaims{ID: "u-admin", Role: types.USER_ROLE_ADMIN}
+	taskOtherCaller    = &utils.UserClaims{ID: "u-other", Workspace: types.DepartmentTechnical}
+
+	taskCallers = map[string]*utils.UserClaims{
+		"assignee": taskAssigneeCaller,
+		"reporter": taskReporterCaller,
+		"creator":  taskCreatorCaller,
+		"admin":    taskAdminCaller,
+		"other":    taskOtherCaller,
+	}
+	allTaskStatuses = []string{
+		types.TASK_STATUS_OPEN, types.TASK_STATUS_DOING, types.TASK_STATUS_REVIEW,
+		types.TASK_STATUS_COMPLETED, types.TASK_STATUS_CLOSE, types.TASK_STATUS_CANCEL,
+	}
+	// allowedTaskTransitions lists who may move a task from a status to another, every
+	// other transition is invalid
+	allowedTaskTransitions = map[[2]string][]string{
+		{types.TASK_STATUS_OPEN, types.TASK_STATUS_DOING}:       {"assignee"},
+		{types.TASK_STATUS_OPEN, types.TASK_STATUS_CANCEL}:      {"reporter", "creator", "admin"},
+		{types.TASK_STATUS_DOING, types.TASK_STATUS_REVIEW}:     {"assignee"},
+		{types.TASK_STATUS_DOING, types.TASK_STATUS_CANCEL}:     {"reporter", "creator", "admin"},
+		{types.TASK_STATUS_REVIEW, types.TASK_STATUS_COMPLETED}: {"reporter"},
+		{types.TASK_STATUS_REVIEW, types.TASK_STATUS_CLOSE}:     {"reporter"},
+		{types.TASK_STATUS_REVIEW, types.TASK_STATUS_DOING}:     {"reporter"},
+		{types.TASK_STATUS_REVIEW, types.TASK_STATUS_CANCEL}:    {"reporter", "creator", "admin"},
+	}
+)
+
+func newTestTask(status string) *types.Task {
+	return &types.Task{
+		ID:        "t1",
+		Status:    status,
+		Workspace: types.DepartmentTechnical,
+		Assignee:  "u-assignee",
+		Reporter:  "u-reporter",
+		Creator:   "u-creator",
+	}
+}
+
+func TestTransitionTaskPerActor(t *testing.T) {
+	for _, from := range allTaskStatuses {
+		for _, to := range allTaskStatuses {
+			for name, caller := range taskCallers {
+				t.Run(fmt.Sprintf("%s to %s by %s", from, to, name), func(t *testing.T) {
+					repo := &fakeTaskRepo{tasks: []*types.Task{newTestTask(from)}}
+					tasks := NewTaskService(repo, nil, nil)
+					task, err := tasks.TransitionTask(context.Background(), caller, "t1", to)
+
+					actors, valid := allowedTaskTransitions[[2]string{from, to}]
+					switch {
+					case !valid:
+						if !errors.Is(err, ErrInvalidArgument) {
+							t.Fatalf("TransitionTask = %v, want ErrInvalidArgument", err)
+						}
+					case !slices.Contains(actors, name):
+						if !errors.Is(err, ErrPermissionDenied) {
+							t.Fatalf("TransitionTask = %v, want ErrPermissionDenied", err)
+						}
+					default:
+						if err != nil {
+							t.Fatalf("TransitionTask: %v", err)
+						}
+						history := task.History[len(task.History)-1]
+						if task.Status != to || history.Actor != caller.ID || history.From != from || history.To != to {
+							t.Errorf("moved to %s with history %+v", task.Status, history)
+						}
+						if stored := repo.tasks[0]; stored.Status != to || len(stored.History) != 1 {
+							t.Errorf("stored %s with %d history entries", stored.Status, len(stored.History))
+						}
+						return
+					}
+					if stored := repo.tasks[0]; stored.Status != from || len(stored.History) != 0 {
+						t.Errorf("refused transition stored %s with %d history entries", stored.Status, len(stored.History))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestTransitionTaskHidesOtherWorkspaces(t *testing.T) {
+	repo := &fakeTaskRepo{tasks: []*types.Task{newTestTask(types.TASK_STATUS_OPEN)}}
+	outsider := &utils.UserClaims{ID: "u-assignee", Workspace: types.DepartmentQuality}
+	_, err := NewTaskService(repo, nil, nil).TransitionTask(context.Background(), outsider, "t1", types.TASK_STATUS_DOING)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("TransitionTask from another workspace = %v, want ErrNotFound", err)
+	}
+}
+
+func TestTransitionTaskRejectsUnknownStatus(t *testing.T) {
+	repo := &fakeTaskRepo{tasks: []*types.Task{newTestTask(types.TASK_STATUS_OPEN)}}
+	_, err := NewTaskService(repo, nil, nil).TransitionTask(context.Background(), taskAssigneeCaller, "t1", "started")
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("TransitionTask to an unknown status = %v, want ErrInvalidArgument", err)
+	}
+}
+
+// movingTaskRepo moves the task to another status between reading and updating it, like
+// a concurrent transition
+type movingTaskRepo struct {
+	*fakeTaskRepo
+	to string
+}
+
+func (r *movingTaskRepo) GetTask(ctx context.Context, id string) (*types.Task, error) {
+	task, err := r.fakeTaskRepo.GetTask(ctx, id)
+	r.tasks[0].Status = r.to
+	return task, err
+}
+
+func TestTransitionTaskConflictsWithConcurrentTransition(t *testing.T) {
+	repo := &movingTaskRepo{fakeTaskRepo: &fakeTaskRepo{tasks: []*types.Task{newTestTask(types.TASK_STATUS_REVIEW)}}, to: types.TASK_STATUS_CANCEL}
+	_, err := NewTaskService(repo, nil, nil).TransitionTask(context.Background(), taskReporterCaller, "t1", types.TASK_STATUS_COMPLETED)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("TransitionTask = %v, want ErrConflict", err)
+	}
+	if stored := repo.tasks[0]; stored.Status != types.TASK_STATUS_CANCEL || len(stored.History) != 0 {
+		t.Errorf("the cancelled task was moved to %s", stored.Status)
+	}
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// destructiveTaskStatuses are the transitions the assistant may only prepare;
+// they run once the user confirms them
+var destructiveTaskStatuses = map[string]bool{
+	types.TASK_STATUS_CANCEL: true,
+	types.TASK_STATUS_CLOSE:  true,
+}
+
+type listMyTasksArgs struct {
+	Role   string   `json:"role"`
+	Status []string `json:"status"`
+	Limit  int64    `json:"limit"`
+}
+
+type createTaskArgs struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Assignee    string `json:"assignee"`
+	Deadline    string `json:"deadline"`
+}
+
+type updateTaskStatusArgs struct {
+	TaskID string `json:"task_id"`
+	Status string `json:"status"`
+}
+
+// taskToolResult is the compact view of a task handed back to the model
+type taskToolResult struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Status   string `json:"status"`
+	Assignee string `json:"assignee,omitempty"`
+	Deadline string `json:"deadline,omitempty"`
+}
+
+// TaskTools exposes the task service to the assistant as function calls.
+// Every call runs with the claims of the user the chat request is made for.
+type TaskTools struct {
+	taskService TaskService
+	userRepo    repository.UserRepo
+	pending     *PendingActionStore
+}
+
+func NewTaskTools(taskService TaskService, userRepo repository.UserRepo, pending *PendingActionStore) *TaskTools {
+	return &TaskTools{
+		taskService: taskService,
+		userRepo:    userRepo,
+		pending:     pending,
+	}
+}
+
+func (t *TaskTools) Register(ai FunctionRegistry) error {
+	statuses := []string{
+		types.TASK_STATUS_OPEN, types.TASK_STATUS_DOING, types.TASK_STATUS_REVIEW,
+		types.TASK_STATUS_COMPLETED, types.TASK_STATUS_CLOSE, types.TASK_STATUS_CANCEL,
+	}
+	if err := ai.RegisterFunctionCall("list_my_tasks",
+		"List the tasks of the current user, either assigned to them or reported by them",
+		jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"role": {
+					Type:        jsonschema.String,
+					Description: "assignee for tasks the user has to do, reporter for tasks the user follows up",
+					Enum:        []string{"assignee", "reporter"},
+				},
+				"status": {
+					Type:        jsonschema.Array,
+					Description: "Only return tasks in these statuses",
+					Items:       &jsonschema.Definition{Type: jsonschema.String, Enum: statuses},
+				},
+				"limit": {
+					Type:        jsonschema.Integer,
+					Description: "Maximum number of tasks, default 20",
+				},
+			},
+		}, t.listMyTasks); err != nil {
+		return err
+	}
+	if err := ai.RegisterFunctionCall("create_task",
+		"Create a task in the current user's workspace",
+		jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"title":       {Type: jsonschema.String, Description: "Short title of the task"},
+				"description": {Type: jsonschema.String, Description: "Details of the work to do"},
+				"assignee": {
+					Type:        jsonschema.String,
+					Description: "Username or full name of the colleague who does the task, empty to assign it to the current user",
+				},
+				"deadline": {
+					Type:        jsonschema.String,
+					Description: "Deadline as YYYY-MM-DD or RFC 3339, resolved from the current date",
+				},
+			},
+			Required: []string{"title"},
+		}, t.createTask); err != nil {
+		return err
+	}
+	return ai.RegisterFunctionCall("update_task_status",
+		"Move a task to another status. Cancelling or closing a task only takes effect after the user confirms it.",
+		jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"task_id": {Type: jsonschema.String, Description: "ID of the task"},
+				"status":  {Type: jsonschema.String, Enum: statuses},
+			},
+			Required: []string{"task_id", "status"},
+		}, t.updateTaskStatus)
+}
+
+// ConfirmAction runs a pending action prepared by the assistant
+func (t *TaskTools) ConfirmAction(ctx context.Context, caller *utils.UserClaims, id string) (any, error) {
+	action, ok := t.pending.Take(caller.ID, id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	switch action.Tool {
+	case "update_task_status":
+		var args updateTaskStatusArgs
+		if err := json.Unmarshal(action.Args, &args); err != nil {
+			return nil, err
+		}
+		return t.taskService.TransitionTask(ctx, caller, args.TaskID, args.Status)
+	}
+	return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidArgument, action.Tool)
+}
+
+// DiscardAction drops a pending action without running it
+func (t *TaskTools) DiscardAction(caller *utils.UserClaims, id string) error {
+	if !t.pending.Discard(caller.ID, id) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (t *TaskTools) PendingActions(caller *utils.UserClaims, since int64) []*types.PendingAction {
+	return t.pending.ListForUser(caller.ID, since)
+}
+
+func (t *TaskTools) listMyTasks(ctx context.Context, raw []byte) (any, error) {
+	caller, err := toolCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var args listMyTasksArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	filter := types.TaskFilter{Status: args.Status}
+	if args.Role == "reporter" {
+		filter.Reporter = caller.ID
+	} else {
+		filter.Assignee = caller.ID
+	}
+	if args.Limit <= 0 || args.Limit > 50 {
+		args.Limit = 20
+	}
+	tasks, page, err := t.taskService.ListTasks(ctx, caller, filter, types.ListOptions{Limit: args.Limit, Sort: "deadline"})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]taskToolResult, 0, len(tasks))
+	for _, task := range tasks {
+		results = append(results, newTaskToolResult(task))
+	}
+	return map[string]any{"total": page.Total, "tasks": results}, nil
+}
+
+func (t *TaskTools) createTask(ctx context.Context, raw []byte) (any, error) {
+	caller, err := toolCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var args createTaskArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	req := types.CreateTaskRequest{
+		Title:       args.Title,
+		Description: args.Description,
+	}
+	if args.Deadline != "" {
+		deadline, err := parseToolDeadline(args.Deadline)
+		if err != nil {
+			return nil, err
+		}
+		req.Deadline = deadline
+	}
+	if args.Assignee != "" {
+		assignee, err := t.resolveAssignee(ctx, caller, args.Assignee)
+		if err != nil {
+			return nil, err
+		}
+		req.Assignee = assignee.ID
+	}
+	task, err := t.taskService.CreateTask(ctx, caller, req)
+	if err != nil {
+		return nil, err
+	}
+	return newTaskToolResult(task), nil
+}
+
+func (t *TaskTools) updateTaskStatus(ctx context.Context, raw []byte) (any, error) {
+	caller, err := toolCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var args updateTaskStatusArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	if !destructiveTaskStatuses[args.Status] {
+		task, err := t.taskService.TransitionTask(ctx, caller, args.TaskID, args.Status)
+		if err != nil {
+			return nil, err
+		}
+		return newTaskToolResult(task), nil
+	}
+
+	// Check the task is visible and the transition allowed before asking for confirmation
+	task, err := t.taskService.GetTask(ctx, caller, args.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := taskTransitions[task.Status][args.Status]; !ok {
+		return nil, fmt.Errorf("%w: cannot move task from %s to %s", ErrInvalidArgument, task.Status, args.Status)
+	}
+	action, err := t.pending.Add(caller.ID, "update_task_status",
+		fmt.Sprintf("Move task %q from %s to %s", task.Title, task.Status, args.Status), raw)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"status":    "confirmation_required",
+		"action_id": action.ID,
+		"summary":   action.Summary,
+		"message":   "Nothing has changed yet. Ask the user to confirm the action in the app.",
+	}, nil
+}
+
+// resolveAssignee finds a colleague of the caller's workspace by username or full name
+func (t *TaskTools) resolveAssignee(ctx context.Context, caller *utils.UserClaims, name string) (*types.User, error) {
+	users, err := t.userRepo.GetUserByWorkspace(ctx, caller.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	var matches []*types.User
+	for _, user := range users {
+		if strings.EqualFold(user.Username, name) {
+			return user, nil
+		}
+		if strings.EqualFold(user.FullName, name) || containsWord(user.FullName, name) {
+			matches = append(matches, user)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: no colleague named %q in workspace %s", ErrInvalidArgument, name, caller.Workspace)
+	case 1:
+		return matches[0], nil
+	}
+	candidates := make([]string, 0, len(matches))
+	for _, user := range matches {
+		candidates = append(candidates, fmt.Sprintf("%s (%s)", user.FullName, user.Username))
+	}
+	return nil, fmt.Errorf("%w: %q matches several colleagues: %s", ErrInvalidArgument, name, strings.Join(candidates, ", "))
+}
+
+// containsWord reports whether name is one of the words of fullName, e.g. "Minh" in "Nguyen Van Minh"
+func containsWord(fullName, name string) bool {
+	for _, word := range strings.Fields(fullName) {
+		if strings.EqualFold(word, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseToolDeadline accepts a date, taken as the end of that day in local time, or an RFC 3339 timestamp
+func parseToolDeadline(value string) (int64, error) {
+	if day, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return day.Add(24*time.Hour - time.Second).Unix(), nil
+	}
+	deadline, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid deadline %q, expected YYYY-MM-DD", ErrInvalidArgument, value)
+	}
+	return deadline.Unix(), nil
+}
+
+func toolCaller(ctx context.Context) (*utils.UserClaims, error) {
+	caller, ok := utils.UserClaimsFromContext(ctx)
+	if !ok {
+		return nil, errors.New("task tools require an authenticated user")
+	}
+	return caller, nil
+}
+
+func newTaskToolResult(task *types.Task) taskToolResult {
+	result := taskToolResult{
+		ID:       task.ID,
+		Title:    task.Title,
+		Status:   task.Status,
+		Assignee: task.Assignee,
+	}
+	if task.Deadline > 0 {
+		result.Deadline = time.Unix(task.Deadline, 0).Format("2006-01-02 15:04")
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+// usageWriteTimeout bounds how long recording usage may delay a chat answer
+const usageWriteTimeout = 5 * time.Second
+
+// QuotaExceededError is returned when the caller has used up a token quota
+type QuotaExceededError struct {
+	Period     string // types.USAGE_PERIOD_DAILY or types.USAGE_PERIOD_MONTHLY
+	Limit      int64
+	RetryAfter int64 // Seconds until the period ends
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s token quota of %d exceeded, retry after %d seconds", e.Period, e.Limit, e.RetryAfter)
+}
+
+type UsageService interface {
+	// Record adds the tokens of a completion to the caller identified by the claims in ctx.
+	// Failures are logged and never fail the chat.
+	Record(ctx context.Context, model string, promptTokens, completionTokens int)
+	// CheckQuota returns a *QuotaExceededError once the caller reached a quota
+	CheckQuota(ctx context.Context) error
+	Report(ctx context.Context, filter types.UsageReportFilter) ([]*types.UsageReportRow, error)
+}
+
+type usageService struct {
+	usageRepo repository.UsageRepo
+	config    config.UsageConfig
+}
+
+func NewUsageService(usageRepo repository.UsageRepo, config config.UsageConfig) UsageService {
+	return &usageService{
+		usageRepo: usageRepo,
+		config:    config,
+	}
+}
+
+func (s *usageService) Record(ctx context.Context, model string, promptTokens, completionTokens int) {
+	claims, ok := utils.UserClaimsFromContext(ctx)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	record := &types.UsageRecord{
+		UserID:           claims.ID,
+		Username:         claims.Username,
+		Workspace:        claims.Workspace,
+		Model:            model,
+		Day:              now.Format(types.UsageDayLayout),
+		Month:            now.Format(types.UsageMonthLayout),
+		PromptTokens:     int64(promptTokens),
+		CompletionTokens: int64(completionTokens),
+		TotalTokens:      int64(promptTokens + completionTokens),
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), usageWriteTimeout)
+	defer cancel()
+	if err := s.usageRepo.AddUsage(ctx, record); err != nil {
+		log.Printf("Failed to record usage of %s: %v", claims.Username, err)
+	}
+}
+
+func (s *usageService) CheckQuota(ctx context.Context) error {
+	claims, ok := utils.UserClaimsFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	quota := s.config.QuotaFor(claims.Workspace)
+	if quota.DailyTokens <= 0 && quota.MonthlyTokens <= 0 {
+		return nil
+	}
+	now := time.Now()
+	daily, monthly, err := s.usageRepo.UserTokens(ctx, claims.ID, now.Format(types.UsageDayLayout), now.Format(types.UsageMonthLayout))
+	if err != nil {
+		return err
+	}
+	if quota.MonthlyTokens > 0 && monthly >= quota.MonthlyTokens {
+		nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+		return &QuotaExceededError{
+			Period:     types.USAGE_PERIOD_MONTHLY,
+			Limit:      quota.MonthlyTokens,
+			RetryAfter: int64(nextMonth.Sub(now).Seconds()) + 1,
+		}
+	}
+	if quota.DailyTokens > 0 && daily >= quota.DailyTokens {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		return &QuotaExceededError{
+			Period:     types.USAGE_PERIOD_DAILY,
+			Limit:      quota.DailyTokens,
+			RetryAfter: int64(tomorrow.Sub(now).Seconds()) + 1,
+		}
+	}
+	return nil
+}
+
+func (s *usageService) Report(ctx context.Context, filter types.UsageReportFilter) ([]*types.UsageReportRow, error) {
+	for _, day := range []string{filter.From, filter.To} {
+		if day == "" {
+			continue
+		}
+		if _, err := time.Parse(types.UsageDayLayout, day); err != nil {
+			return nil, fmt.Errorf("%w: invalid day %q, expected YYYY-MM-DD", ErrInvalidArgument, day)
+		}
+	}
+	return s.usageRepo.Report(ctx, filter)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
+)
+
+var testUsageConfig = config.UsageConfig{
+	DailyTokens:   100,
+	MonthlyTokens: 1000,
+	Workspaces: []config.WorkspaceQuota{
+		{Workspace: types.DepartmentTechnical, DailyTokens: 500},
+		{Workspace: types.DepartmentQuality},
+	},
+}
+
+// usageContext is the context of a chat of a member of the workspace
+func usageContext(workspace string) context.Context {
+	return utils.ContextWithUserClaims(context.Background(), &utils.UserClaims{ID: "u-" + workspace, Username: "user", Workspace: workspace})
+}
+
+// checkRetryAfter checks that the error ends with the period starting at end
+func checkRetryAfter(t *testing.T, err error, period string, limit int64, end time.Time) {
+	t.Helper()
+	var quotaErr *QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("CheckQuota = %v, want a %s quota error", err, period)
+	}
+	want := int64(time.Until(end).Seconds()) + 1
+	if quotaErr.Period != period || quotaErr.Limit != limit || quotaErr.RetryAfter < want-2 || quotaErr.RetryAfter > want+2 {
+		t.Errorf("quota error %+v, want %s of %d retrying after %d seconds", quotaErr, period, limit, want)
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	now := time.Now()
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+	lastMonth := now.AddDate(0, 0, -now.Day()).Format(types.UsageMonthLayout)
+
+	t.Run("default daily quota", func(t *testing.T) {
+		usage := NewUsageService(&fakeUsageRepo{}, testUsageConfig)
+		ctx := usageContext(types.DepartmentMaterial)
+		usage.Record(ctx, "local", 60, 39)
+		if err := usage.CheckQuota(ctx); err != nil {
+			t.Fatalf("CheckQuota under the quota = %v", err)
+		}
+		usage.Record(ctx, "local", 1, 0)
+		checkRetryAfter(t, usage.CheckQuota(ctx), types.USAGE_PERIOD_DAILY, 100, tomorrow)
+		// Other users have their own counters
+		other := utils.ContextWithUserClaims(context.Background(), &utils.UserClaims{ID: "u-other", Workspace: types.DepartmentMaterial})
+		if err := usage.CheckQuota(other); err != nil {
+			t.Errorf("CheckQuota of another user = %v", err)
+		}
+	})
+
+	t.Run("monthly quota before daily", func(t *testing.T) {
+		repo := &fakeUsageRepo{}
+		usage := NewUsageService(repo, testUsageConfig)
+		ctx := usageContext(types.DepartmentMaterial)
+		// Earlier days of the month and the previous month
+		repo.AddUsage(ctx, &types.UsageRecord{UserID: "u-" + types.DepartmentMaterial, Day: "earlier", Month: now.Format(types.UsageMonthLayout), TotalTokens: 950})
+		repo.AddUsage(ctx, &types.UsageRecord{UserID: "u-" + types.DepartmentMaterial, Day: "last month", Month: lastMonth, TotalTokens: 5000})
+		if err := usage.CheckQuota(ctx); err != nil {
+			t.Fatalf("CheckQuota under the monthly quota = %v", err)
+		}
+		usage.Record(ctx, "local", 100, 0)
+		checkRetryAfter(t, usage.CheckQuota(ctx), types.USAGE_PERIOD_MONTHLY, 1000, nextMonth)
+	})
+
+	t.Run("workspace override", func(t *testing.T) {
+		usage := NewUsageService(&fakeUsageRepo{}, testUsageConfig)
+		ctx := usageContext(types.DepartmentTechnical)
+		usage.Record(ctx, "local", 400, 0)
+		if err := usage.CheckQuota(ctx); err != nil {
+			t.Fatalf("CheckQuota under the daily quota of the workspace = %v", err)
+		}
+		usage.Record(ctx, "local", 100, 0)
+		checkRetryAfter(t, usage.CheckQuota(ctx), types.USAGE_PERIOD_DAILY, 500, tomorrow)
+	})
+
+	t.Run("unlimited workspace", func(t *testing.T) {
+		usage := NewUsageService(&fakeUsageRepo{}, testUsageConfig)
+		ctx := usageContext(types.DepartmentQuality)
+		usage.Record(ctx, "local", 5000, 5000)
+		if err := usage.CheckQuota(ctx); err != nil {
+			t.Errorf("CheckQuota of a workspace without quotas = %v", err)
+		}
+	})
+
+	t.Run("without caller", func(t *testing.T) {
+		usage := NewUsageService(&fakeUsageRepo{}, testUsageConfig)
+		usage.Record(context.Background(), "local", 5000, 0)
+		if err := usage.CheckQuota(context.Background()); err != nil {
+			t.Errorf("CheckQuota without claims = %v", err)
+		}
+	})
+}
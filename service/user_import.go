@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// UserImportColumns are the spreadsheet columns read by ImportUsers, in the order
+// of the import template. Unknown columns are ignored, so an export can be re-imported.
+var UserImportColumns = []string{"username", "full_name", "email", "password", "workspace", "workspace_role", "management_level", "role"}
+
+// UserExportColumns never include the password
+var UserExportColumns = []string{"username", "full_name", "email", "workspace", "workspace_role", "management_level", "role", "auth_source"}
+
+// userImportRecord is one row to import. Empty fields leave an existing user unchanged.
+type userImportRecord struct {
+	Row  int
+	User types.User
+}
+
+func (s *userService) ImportUsers(ctx context.Context, rows [][]string, dryRun bool) (*types.ImportUsersResult, error) {
+	// Rows above the header are skipped, rows[i] stays sheet row i+1 for the error report
+	header := 0
+	for header < len(rows) && isBlankRow(rows[header]) {
+		header++
+	}
+	if header == len(rows) {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidArgument)
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[header] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, fmt.Errorf("%w: missing username column, expected columns %s", ErrInvalidArgument, strings.Join(UserImportColumns, ", "))
+	}
+	cell := func(row []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	result := &types.ImportUsersResult{DryRun: dryRun, Errors: make([]types.ImportRowError, 0)}
+	records := make([]userImportRecord, 0, len(rows)-header-1)
+	for i, row := range rows[header+1:] {
+		number := header + i + 2
+		if isBlankRow(row) {
+			continue
+		}
+		record := userImportRecord{
+			Row: number,
+			User: types.User{
+				Username:      cell(row, "username"),
+				FullName:      cell(row, "full_name"),
+				Email:         cell(row, "email"),
+				Password:      cell(row, "password"),
+				Workspace:     cell(row, "workspace"),
+				WorkspaceRole: cell(row, "workspace_role"),
+				Role:          cell(row, "role"),
+			},
+		}
+		if level := cell(row, "management_level"); level != "" {
+			n, err := strconv.Atoi(level)
+			if err != nil {
+				result.Total++
+				result.AddError(number, record.User.Username, fmt.Sprintf("management_level %q is not a number", level))
+				continue
+			}
+			record.User.ManagementLevel = n
+		}
+		records = append(records, record)
+	}
+	if err := s.importRecords(ctx, records, dryRun, true, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// importRecords validates every record and creates or, with upsert, updates the user
+// with the same username. Invalid records are reported and do not stop the import.
+func (s *userService) importRecords(ctx context.Context, records []userImportRecord, dryRun, upsert bool, result *types.ImportUsersResult) error {
+	seen := make(map[string]int)
+	for _, record := range records {
+		result.Total++
+		user := record.User
+		if first, ok := seen[strings.ToLower(user.Username)]; ok {
+			result.AddError(record.Row, user.Username, fmt.Sprintf("duplicate of row %d", first))
+			continue
+		}
+		if user.Username != "" {
+			seen[strings.ToLower(user.Username)] = record.Row
+		}
+		if err := s.validateImportUser(ctx, &user); err != nil {
+			result.AddError(record.Row, user.Username, importErrorMessage(err))
+			continue
+		}
+
+		existing, err := s.repo.GetUserByUsername(ctx, user.Username)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+		if err == nil {
+			if !upsert {
+				result.AddError(record.Row, user.Username, "username already exists")
+				continue
+			}
+			if existing.AuthSource == types.USER_AUTH_SOURCE_LDAP {
+				result.AddError(record.Row, user.Username, "user is managed by the directory")
+				continue
+			}
+			mergeUser(existing, &user)
+			if !dryRun {
+				if err := s.repo.UpdateUser(ctx, existing.ID, existing); err != nil {
+					result.AddError(record.Row, user.Username, err.Error())
+					continue
+				}
+			}
+			result.Updated++
+			continue
+		}
+
+		if user.FullName == "" || user.Password == "" {
+			result.AddError(record.Row, user.Username, "full_name and password are required for new users")
+			continue
+		}
+		if user.ManagementLevel == 0 {
+			user.ManagementLevel = types.WorkspaceRoleLevels[user.WorkspaceRole]
+		}
+		user.AuthSource = types.USER_AUTH_SOURCE_LOCAL
+		user.CreateAt = time.Now().Unix()
+		user.UpdateAt = user.CreateAt
+		if dryRun {
+			// Nothing is inserted, so the username of a deleted user is looked up instead
+			_, err := s.repo.GetDeletedUserByUsername(ctx, user.Username)
+			if err == nil {
+				result.AddError(record.Row, user.Username, importErrorMessage(s.usernameConflict(ctx, user.Username)))
+				continue
+			}
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				return err
+			}
+		} else {
+			if err := s.repo.CreateUser(ctx, &user); err != nil {
+				if mongo.IsDuplicateKeyError(err) {
+					result.AddError(record.Row, user.Username, importErrorMessage(s.usernameConflict(ctx, user.Username)))
+					continue
+				}
+				result.AddError(record.Row, user.Username, err.Error())
+				continue
+			}
+		}
+		result.Created++
+	}
+	return nil
+}
+
+func (s *userService) validateImportUser(ctx context.Context, user *types.User) error {
+	if user.Username == "" || strings.ContainsAny(user.Username, " \t\r\n") {
+		return fmt.Errorf("%w: username is required and must not contain spaces", ErrInvalidArgument)
+	}
+	if user.Role != "" && user.Role != types.USER_ROLE_ADMIN {
+		return fmt.Errorf("%w: unknown role %q", ErrInvalidArgument, user.Role)
+	}
+	if user.ManagementLevel < 0 || user.ManagementLevel > types.USER_MANAGEMENT_LEVEL_EXECUTIVE {
+		return fmt.Errorf("%w: management_level must be between 0 and %d", ErrInvalidArgument, types.USER_MANAGEMENT_LEVEL_EXECUTIVE)
+	}
+	return s.workspaceService.ValidateMembership(ctx, user.Workspace, user.WorkspaceRole)
+}
+
+// ExportUsers returns the users matching the filter as spreadsheet rows, header first
+func (s *userService) ExportUsers(ctx context.Context, filter types.UserFilter) ([][]string, error) {
+	rows := [][]string{UserExportColumns}
+	opts := types.ListOptions{Limit: 200, Sort: "username"}
+	for {
+		users, page, err := s.repo.ListUsers(ctx, filter, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			rows = append(rows, []string{
+				user.Username,
+				user.FullName,
+				user.Email,
+				user.Workspace,
+				user.WorkspaceRole,
+				strconv.Itoa(user.ManagementLevel),
+				user.Role,
+				user.AuthSource,
+			})
+		}
+		if page.NextCursor == "" {
+			return rows, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// mergeUser copies the non-empty fields of update onto user
+func mergeUser(user, update *types.User) {
+	if update.FullName != "" {
+		user.FullName = update.FullName
+	}
+	if update.Email != "" {
+		user.Email = update.Email
+	}
+	if update.Password != "" {
+		user.Password = update.Password
+	}
+	if update.Workspace != "" {
+		user.Workspace = update.Workspace
+	}
+	if update.WorkspaceRole != "" {
+		user.WorkspaceRole = update.WorkspaceRole
+	}
+	if update.ManagementLevel != 0 {
+		user.ManagementLevel = update.ManagementLevel
+	}
+	if update.Role != "" {
+		user.Role = update.Role
+	}
+	user.UpdateAt = time.Now().Unix()
+}
+
+func importErrorMessage(err error) string {
+	message := strings.TrimPrefix(err.Error(), ErrInvalidArgument.Error()+": ")
+	return strings.TrimPrefix(message, ErrConflict.Error()+": ")
+}
+
+func isBlankRow(row []string) bool {
+	for _, value := range row {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+func TestImportUsersReportsSheetRowNumbers(t *testing.T) {
+	repo := newFakeUserRepo(&types.User{Username: "dave", FullName: "Dave", AuthSource: types.USER_AUTH_SOURCE_LDAP})
+	users := NewUserService(repo, NewWorkspaceService(nil, repo))
+	// As read from a sheet whose blank rows are left out, with the header on row 3
+	rows := [][]string{
+		nil,
+		nil,
+		{"username", "full_name", "email", "password", "role"},
+		{"alice", "Alice Nguyen", "alice.nguyen@x52.vn", "secret"},
+		nil,
+		nil,
+		{"bob", "Bob", "", "secret", "owner"},
+		{"dave", "Dave Tran"},
+	}
+	result, err := users.ImportUsers(context.Background(), rows, true)
+	if err != nil {
+		t.Fatalf("ImportUsers: %v", err)
+	}
+	if result.Created != 1 || result.Failed != 2 {
+		t.Errorf("created %d, failed %d; want 1 and 2", result.Created, result.Failed)
+	}
+	var failedRows []int
+	for _, rowError := range result.Errors {
+		failedRows = append(failedRows, rowError.Row)
+	}
+	if want := []int{7, 8}; !reflect.DeepEqual(failedRows, want) {
+		t.Errorf("errors on rows %v, want %v: %+v", failedRows, want, result.Errors)
+	}
+}
+
+func TestImportUsersDryRunReportsDeletedUsername(t *testing.T) {
+	repo := newFakeUserRepo(&types.User{Username: "carol", FullName: "Carol", DeletedAt: 1})
+	users := NewUserService(repo, NewWorkspaceService(nil, repo))
+	rows := [][]string{
+		{"username", "full_name", "password"},
+		{"carol", "Carol Le", "secret"},
+	}
+	// The dry run reports what the import then does
+	for _, dryRun := range []bool{true, false} {
+		result, err := users.ImportUsers(context.Background(), rows, dryRun)
+		if err != nil {
+			t.Fatalf("ImportUsers(dry run %v): %v", dryRun, err)
+		}
+		if result.Created != 0 || len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Message, "deleted user") {
+			t.Errorf("dry run %v: created %d, errors %+v", dryRun, result.Created, result.Errors)
+		}
+	}
+}
@@ -2,46 +2,71 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/tieubaoca/chatbot-be/repository"
 	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type UserService interface {
 	CreateUser(ctx context.Context, user *types.User) error
-	BatchCreateUser(ctx context.Context, users []*types.User) error
+	// BatchCreateUser creates the users that are valid and reports the others; existing usernames are rejected
+	BatchCreateUser(ctx context.Context, users []*types.User) (*types.ImportUsersResult, error)
+	// ImportUsers upserts users by username from spreadsheet rows, the first row naming the columns
+	ImportUsers(ctx context.Context, rows [][]string, dryRun bool) (*types.ImportUsersResult, error)
+	ExportUsers(ctx context.Context, filter types.UserFilter) ([][]string, error)
 	GetUser(ctx context.Context, id string) (*types.User, error)
 	GetUserByWorkspace(ctx context.Context, workspace string) ([]*types.User, error)
 	UpdateUser(ctx context.Context, id string, user *types.User) error
-	DeleteUser(ctx context.Context, id string) error
-	PaginateUser(ctx context.Context, page int64, limit int64) ([]*types.User, int64, error)
+	// DeleteUser soft-deletes the user; they can no longer log in and are hidden until restored or purged
+	DeleteUser(ctx context.Context, id, deletedBy string) error
+	RestoreUser(ctx context.Context, id string) error
+	ListDeletedUsers(ctx context.Context, opts types.ListOptions) ([]*types.User, types.PageInfo, error)
+	ListUsers(ctx context.Context, filter types.UserFilter, opts types.ListOptions) ([]*types.User, types.PageInfo, error)
 	GetUserByUsername(ctx context.Context, username string) (*types.User, error)
 }
 
 type userService struct {
-	repo repository.UserRepo
+	repo             repository.UserRepo
+	workspaceService WorkspaceService
 }
 
-func NewUserService(repo repository.UserRepo) UserService {
+func NewUserService(repo repository.UserRepo, workspaceService WorkspaceService) UserService {
 	return &userService{
-		repo: repo,
+		repo:             repo,
+		workspaceService: workspaceService,
 	}
 }
 
 func (s *userService) CreateUser(ctx context.Context, user *types.User) error {
+	if err := s.workspaceService.ValidateMembership(ctx, user.Workspace, user.WorkspaceRole); err != nil {
+		return err
+	}
 	user.CreateAt = time.Now().Unix()
 	user.UpdateAt = time.Now().Unix()
 
-	return s.repo.CreateUser(ctx, user)
+	if err := s.repo.CreateUser(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return s.usernameConflict(ctx, user.Username)
+		}
+		return err
+	}
+	return nil
 }
 
-func (s *userService) BatchCreateUser(ctx context.Context, users []*types.User) error {
-	for _, user := range users {
-		user.CreateAt = time.Now().Unix()
-		user.UpdateAt = time.Now().Unix()
+func (s *userService) BatchCreateUser(ctx context.Context, users []*types.User) (*types.ImportUsersResult, error) {
+	records := make([]userImportRecord, 0, len(users))
+	for i, user := range users {
+		records = append(records, userImportRecord{Row: i + 1, User: *user})
+	}
+	result := &types.ImportUsersResult{Errors: make([]types.ImportRowError, 0)}
+	if err := s.importRecords(ctx, records, false, false, result); err != nil {
+		return nil, err
 	}
-	return s.repo.BatchCreateUser(ctx, users)
+	return result, nil
 }
 
 func (s *userService) GetUser(ctx context.Context, id string) (*types.User, error) {
@@ -55,9 +80,15 @@ func (s *userService) GetUserByWorkspace(ctx context.Context, workspace string)
 func (s *userService) UpdateUser(ctx context.Context, id string, user *types.User) error {
 	dbUser, err := s.repo.GetUser(ctx, id)
 	if err != nil {
+		if isNotFound(err) {
+			return ErrNotFound
+		}
 		return err
 	}
-	user.UpdateAt = time.Now().Unix()
+	if err := s.workspaceService.ValidateMembership(ctx, user.Workspace, user.WorkspaceRole); err != nil {
+		return err
+	}
+	dbUser.UpdateAt = time.Now().Unix()
 	if user.Username != "" {
 		dbUser.Username = user.Username
 	}
@@ -67,9 +98,15 @@ func (s *userService) UpdateUser(ctx context.Context, id string, user *types.Use
 	if user.FullName != "" {
 		dbUser.FullName = user.FullName
 	}
+	if user.Email != "" {
+		dbUser.Email = user.Email
+	}
 	if user.Workspace != "" {
 		dbUser.Workspace = user.Workspace
 	}
+	if user.Role != "" {
+		dbUser.Role = user.Role
+	}
 	if user.WorkspaceRole != "" {
 		dbUser.WorkspaceRole = user.WorkspaceRole
 	}
@@ -77,15 +114,46 @@ func (s *userService) UpdateUser(ctx context.Context, id string, user *types.Use
 		dbUser.ManagementLevel = user.ManagementLevel
 	}
 
-	return s.repo.UpdateUser(ctx, id, dbUser)
+	if err := s.repo.UpdateUser(ctx, id, dbUser); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return s.usernameConflict(ctx, dbUser.Username)
+		}
+		return err
+	}
+	return nil
+}
+
+// usernameConflict explains a duplicate username. The unique index also covers deleted
+// users, whose username stays reserved until they are purged so they can be restored.
+func (s *userService) usernameConflict(ctx context.Context, username string) error {
+	if _, err := s.repo.GetUserByUsername(ctx, username); errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w: username %s belongs to a deleted user, restore it instead", ErrConflict, username)
+	}
+	return fmt.Errorf("%w: username %s already exists", ErrConflict, username)
+}
+
+func (s *userService) DeleteUser(ctx context.Context, id, deletedBy string) error {
+	err := s.repo.DeleteUser(ctx, id, deletedBy)
+	if isNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *userService) RestoreUser(ctx context.Context, id string) error {
+	err := s.repo.RestoreUser(ctx, id)
+	if isNotFound(err) {
+		return ErrNotFound
+	}
+	return err
 }
 
-func (s *userService) DeleteUser(ctx context.Context, id string) error {
-	return s.repo.DeleteUser(ctx, id)
+func (s *userService) ListDeletedUsers(ctx context.Context, opts types.ListOptions) ([]*types.User, types.PageInfo, error) {
+	return s.repo.ListDeletedUsers(ctx, opts)
 }
 
-func (s *userService) PaginateUser(ctx context.Context, page int64, limit int64) ([]*types.User, int64, error) {
-	return s.repo.PaginateUser(ctx, page, limit)
+func (s *userService) ListUsers(ctx context.Context, filter types.UserFilter, opts types.ListOptions) ([]*types.User, types.PageInfo, error) {
+	return s.repo.ListUsers(ctx, filter, opts)
 }
 
 func (s *userService) GetUserByUsername(ctx context.Context, username string) (*types.User, error) {
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+func TestCreateUserReportsDeletedUsername(t *testing.T) {
+	repo := newFakeUserRepo(
+		&types.User{Username: "alice", DeletedAt: 1700000000},
+		&types.User{Username: "bob"},
+	)
+	users := NewUserService(repo, NewWorkspaceService(nil, repo))
+	tests := map[string]string{
+		"alice": "conflict: username alice belongs to a deleted user, restore it instead",
+		"bob":   "conflict: username bob already exists",
+	}
+	for username, want := range tests {
+		err := users.CreateUser(context.Background(), &types.User{Username: username})
+		if !errors.Is(err, ErrConflict) || err.Error() != want {
+			t.Errorf("CreateUser(%s) = %v, want %q", username, err, want)
+		}
+	}
+}
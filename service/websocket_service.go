@@ -3,22 +3,35 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/tieubaoca/chatbot-be/types"
+	"github.com/tieubaoca/chatbot-be/utils"
 )
 
 type WebSocketService struct {
-	ai       *OpenAIService
-	upgrader websocket.Upgrader
+	ai        *ModelRouter
+	taskTools *TaskTools
+	hub       *NotificationHub
+	audit     AuditService
+	feedback  FeedbackService
+	upgrader  websocket.Upgrader
 }
 
-func NewWebSocketService(ai *OpenAIService) *WebSocketService {
+func NewWebSocketService(ai *ModelRouter, taskTools *TaskTools, hub *NotificationHub, audit AuditService, feedback FeedbackService) *WebSocketService {
 	return &WebSocketService{
-		ai: ai,
+		ai:        ai,
+		taskTools: taskTools,
+		hub:       hub,
+		audit:     audit,
+		feedback:  feedback,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins (adjust for production)
@@ -47,41 +60,70 @@ func (s *WebSocketService) HandleChat(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
+	// gorilla/websocket allows a single concurrent writer, notifications are pushed from another goroutine
+	var writeMu sync.Mutex
+	writeJSON := func(v interface{}) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteJSON(v)
+	}
+	writeMessage := func(messageType int, data []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteMessage(messageType, data)
+	}
+
 	// Channel để thông báo khi connection đóng
 	done := make(chan struct{})
+	defer close(done)
 
-	// Goroutine xử lý đóng kết nối
-	go func() {
-		defer close(done)
-		for {
-			_, _, err := conn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("WebSocket read error: %v", err)
+	// Push the user's notifications while the connection is open
+	if claims, ok := utils.UserClaimsFromContext(r.Context()); ok && s.hub != nil {
+		notifications, unsubscribe := s.hub.Subscribe(claims.ID)
+		defer unsubscribe()
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case notification, ok := <-notifications:
+					if !ok {
+						return
+					}
+					if err := writeJSON(types.WebSocketResponse{
+						Type:    types.TypeWebsocketNotification,
+						Payload: notification,
+					}); err != nil {
+						log.Println("Write error:", err)
+					}
 				}
-				return
 			}
-		}
-	}()
+		}()
+	}
+
 	for {
 		select {
-		case <-done:
+		case <-ctx.Done():
 			return
 		default:
 			// Read message from client
 			messageType, p, err := conn.ReadMessage()
 			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+					log.Printf("WebSocket read error: %v", err)
+				}
 				return
 			}
+			conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 			var req types.WebsocketRequest
 			if err := json.Unmarshal(p, &req); err != nil {
-				conn.WriteMessage(messageType, []byte("Error processing message"))
+				writeMessage(messageType, []byte("Error processing message"))
 				log.Println("Unmarshal error:", err)
 				continue
 			}
 			payloadBytes, err := json.Marshal(req.Payload)
 			if err != nil {
-				conn.WriteMessage(messageType, []byte("Error processing message"))
+				writeMessage(messageType, []byte("Error processing message"))
 				log.Println("Marshal error:", err)
 				continue
 			}
@@ -94,26 +136,94 @@ func (s *WebSocketService) HandleChat(w http.ResponseWriter, r *http.Request) {
 
 					if err != nil {
 						log.Println("Unmarshal error:", err)
-						conn.WriteMessage(messageType, []byte("Error processing message"))
+						writeMessage(messageType, []byte("Error processing message"))
 						continue
 					}
 					// Stream AI responses back to client
-					res, err := s.ai.Chat(ctx, payload.Messages)
+					startedAt := time.Now().Unix()
+					res, err := s.ai.Chat(ctx, payload.Model, payload.Messages)
+					s.audit.Record(ctx, NewChatAuditEvent(r.Context(), requestIP(r), r.UserAgent(), payload.Messages, err))
+					var quotaErr *QuotaExceededError
+					if errors.As(err, &quotaErr) {
+						writeMessage(messageType, []byte(fmt.Sprintf("You have used up your %s token quota", quotaErr.Period)))
+						continue
+					}
 					if err != nil {
 						log.Println("AI error:", err)
-						conn.WriteMessage(messageType, []byte("Error processing message"))
+						writeMessage(messageType, []byte("Error processing message"))
 						continue
 					}
+					if claims, ok := utils.UserClaimsFromContext(r.Context()); ok {
+						if err := s.feedback.RecordAnswer(ctx, claims, payload.ChatId, payload.Messages, res); err != nil {
+							log.Printf("Failed to record answer for %s: %v", claims.Username, err)
+						}
+					}
 					botMessage := types.WebSocketResponse{
 						Type:    types.TypeWebsocketChat,
-						Payload: types.WebSocketChatResponse{Message: res.Content},
+						Payload: s.chatResponse(r, res, startedAt),
 					}
-					if err := conn.WriteJSON(botMessage); err != nil {
+					if err := writeJSON(botMessage); err != nil {
 						log.Println("Write error:", err)
 						continue
 					}
 
 				}
+			case types.TypeWebsocketChatStream:
+				{
+					var payload types.WebSocketChatPayload
+					if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+						log.Println("Unmarshal error:", err)
+						writeMessage(messageType, []byte("Error processing message"))
+						continue
+					}
+					writeError := func(message string) {
+						if err := writeJSON(types.WebSocketResponse{
+							Type:    types.TypeWebsocketError,
+							Payload: types.WebSocketErrorResponse{Message: message},
+						}); err != nil {
+							log.Println("Write error:", err)
+						}
+					}
+					startedAt := time.Now().Unix()
+					res, err := s.ai.ChatStream(ctx, payload.Model, payload.Messages, func(event types.StreamEvent) {
+						response := types.WebSocketResponse{
+							Type:    types.TypeWebsocketChatDelta,
+							Payload: types.WebSocketChatDeltaResponse{Content: event.Content},
+						}
+						if event.Type == types.STREAM_EVENT_STATUS {
+							response = types.WebSocketResponse{
+								Type:    types.TypeWebsocketProcessing,
+								Payload: types.WebSocketProcessingResponse{Message: event.Content},
+							}
+						}
+						if err := writeJSON(response); err != nil {
+							log.Println("Write error:", err)
+						}
+					})
+					s.audit.Record(ctx, NewChatAuditEvent(r.Context(), requestIP(r), r.UserAgent(), payload.Messages, err))
+					var quotaErr *QuotaExceededError
+					if errors.As(err, &quotaErr) {
+						writeError(fmt.Sprintf("You have used up your %s token quota", quotaErr.Period))
+						continue
+					}
+					if err != nil {
+						log.Println("AI error:", err)
+						writeError("The answer could not be completed, please try again")
+						continue
+					}
+					if claims, ok := utils.UserClaimsFromContext(r.Context()); ok {
+						if err := s.feedback.RecordAnswer(ctx, claims, payload.ChatId, payload.Messages, res); err != nil {
+							log.Printf("Failed to record answer for %s: %v", claims.Username, err)
+						}
+					}
+					// The final message carries the whole answer with the IDs to rate it
+					if err := writeJSON(types.WebSocketResponse{
+						Type:    types.TypeWebsocketChat,
+						Payload: s.chatResponse(r, res, startedAt),
+					}); err != nil {
+						log.Println("Write error:", err)
+					}
+				}
 			case types.TypeWebsocketPing:
 				{
 					// Send a pong message back to the client
@@ -121,7 +231,7 @@ func (s *WebSocketService) HandleChat(w http.ResponseWriter, r *http.Request) {
 						Type:    types.TypeWebsocketPong,
 						Payload: nil,
 					}
-					if err := conn.WriteJSON(pongRes); err != nil {
+					if err := writeJSON(pongRes); err != nil {
 						log.Println("Write error:", err)
 					}
 					continue
@@ -143,3 +253,25 @@ func (s *WebSocketService) Health() http.Handler {
 		w.Write([]byte("OK"))
 	})
 }
+
+// requestIP returns the client IP resolved by middleware.ClientIP, or the connection address
+func requestIP(r *http.Request) string {
+	if ip, ok := utils.ClientIPFromContext(r.Context()); ok {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// chatResponse is the final message of an answer, with the actions the chat prepared
+// since startedAt that wait for the user's confirmation
+func (s *WebSocketService) chatResponse(r *http.Request, res *types.Message, startedAt int64) types.WebSocketChatResponse {
+	response := types.WebSocketChatResponse{Message: res.Content, MessageID: res.ID, ChunkIDs: res.ChunkIDs, Model: res.Model}
+	if claims, ok := utils.UserClaimsFromContext(r.Context()); ok {
+		response.PendingActions = s.taskTools.PendingActions(claims, startedAt)
+	}
+	return response
+}
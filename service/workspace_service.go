@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tieubaoca/chatbot-be/repository"
+	"github.com/tieubaoca/chatbot-be/types"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// workspaceIDPattern keeps workspace IDs in the style of the department constants
+var workspaceIDPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{1,63}$`)
+
+type WorkspaceService interface {
+	CreateWorkspace(ctx context.Context, req types.CreateWorkspaceRequest) (*types.Workspace, error)
+	GetWorkspace(ctx context.Context, id string) (*types.Workspace, error)
+	ListWorkspaces(ctx context.Context) ([]*types.Workspace, error)
+	UpdateWorkspace(ctx context.Context, id string, req types.UpdateWorkspaceRequest) (*types.Workspace, error)
+	DeleteWorkspace(ctx context.Context, id string) error
+	// EnsureDepartments creates the workspaces of the department constants if they are missing
+	EnsureDepartments(ctx context.Context) error
+	// ValidateMembership checks that the workspace exists and the role is known
+	ValidateMembership(ctx context.Context, workspace, workspaceRole string) error
+	ListMembers(ctx context.Context, id string) ([]*types.WorkspaceMember, error)
+	AssignMember(ctx context.Context, id string, req types.AssignMemberRequest) (*types.WorkspaceMember, error)
+}
+
+type workspaceService struct {
+	workspaceRepo repository.WorkspaceRepo
+	userRepo      repository.UserRepo
+}
+
+func NewWorkspaceService(workspaceRepo repository.WorkspaceRepo, userRepo repository.UserRepo) WorkspaceService {
+	return &workspaceService{
+		workspaceRepo: workspaceRepo,
+		userRepo:      userRepo,
+	}
+}
+
+func (s *workspaceService) CreateWorkspace(ctx context.Context, req types.CreateWorkspaceRequest) (*types.Workspace, error) {
+	if !workspaceIDPattern.MatchString(req.ID) {
+		return nil, fmt.Errorf("%w: workspace id must start with a letter and contain only letters, digits, - and _", ErrInvalidArgument)
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidArgument)
+	}
+	now := time.Now().Unix()
+	workspace := &types.Workspace{
+		ID:          req.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		CreateAt:    now,
+		UpdateAt:    now,
+	}
+	if err := s.workspaceRepo.CreateWorkspace(ctx, workspace); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("%w: workspace %s already exists", ErrConflict, req.ID)
+		}
+		return nil, err
+	}
+	return workspace, nil
+}
+
+func (s *workspaceService) GetWorkspace(ctx context.Context, id string) (*types.Workspace, error) {
+	workspace, err := s.workspaceRepo.GetWorkspace(ctx, id)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return workspace, nil
+}
+
+func (s *workspaceService) ListWorkspaces(ctx context.Context) ([]*types.Workspace, error) {
+	return s.workspaceRepo.ListWorkspaces(ctx)
+}
+
+func (s *workspaceService) UpdateWorkspace(ctx context.Context, id string, req types.UpdateWorkspaceRequest) (*types.Workspace, error) {
+	fields := map[string]interface{}{"updated_at": time.Now().Unix()}
+	if strings.TrimSpace(req.Name) != "" {
+		fields["name"] = req.Name
+	}
+	if req.Description != "" {
+		fields["description"] = req.Description
+	}
+	if err := s.workspaceRepo.UpdateWorkspace(ctx, id, fields); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return s.GetWorkspace(ctx, id)
+}
+
+// DeleteWorkspace refuses to delete a workspace that still has members
+func (s *workspaceService) DeleteWorkspace(ctx context.Context, id string) error {
+	members, err := s.userRepo.GetUserByWorkspace(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(members) > 0 {
+		return fmt.Errorf("%w: workspace %s still has %d members", ErrConflict, id, len(members))
+	}
+	if err := s.workspaceRepo.DeleteWorkspace(ctx, id); err != nil {
+		if isNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *workspaceService) EnsureDepartments(ctx context.Context) error {
+	now := time.Now().Unix()
+	departments := make([]types.Workspace, 0, len(types.Departments))
+	for _, department := range types.Departments {
+		department.CreateAt = now
+		department.UpdateAt = now
+		departments = append(departments, department)
+	}
+	return s.workspaceRepo.EnsureWorkspaces(ctx, departments)
+}
+
+func (s *workspaceService) ValidateMembership(ctx context.Context, workspace, workspaceRole string) error {
+	if workspaceRole != "" {
+		if _, ok := types.WorkspaceRoleLevels[workspaceRole]; !ok {
+			return fmt.Errorf("%w: unknown workspace role %q", ErrInvalidArgument, workspaceRole)
+		}
+	}
+	if workspace == "" {
+		return nil
+	}
+	if _, err := s.workspaceRepo.GetWorkspace(ctx, workspace); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: workspace %s does not exist", ErrInvalidArgument, workspace)
+		}
+		return err
+	}
+	return nil
+}
+
+// ListMembers returns the roster of the workspace, highest management level first
+func (s *workspaceService) ListMembers(ctx context.Context, id string) ([]*types.WorkspaceMember, error) {
+	if _, err := s.GetWorkspace(ctx, id); err != nil {
+		return nil, err
+	}
+	users, err := s.userRepo.GetUserByWorkspace(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		if users[i].ManagementLevel != users[j].ManagementLevel {
+			return users[i].ManagementLevel > users[j].ManagementLevel
+		}
+		return users[i].FullName < users[j].FullName
+	})
+	members := make([]*types.WorkspaceMember, 0, len(users))
+	for _, user := range users {
+		members = append(members, newWorkspaceMember(user))
+	}
+	return members, nil
+}
+
+// AssignMember moves a user into the workspace. A workspace has at most one head,
+// so assigning a new head requires the current one to be reassigned first.
+func (s *workspaceService) AssignMember(ctx context.Context, id string, req types.AssignMemberRequest) (*types.WorkspaceMember, error) {
+	if req.WorkspaceRole == "" {
+		req.WorkspaceRole = types.USER_WORKSPACE_ROLE_STAFF
+	}
+	if err := s.ValidateMembership(ctx, id, req.WorkspaceRole); err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetUser(ctx, req.UserID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if req.WorkspaceRole == types.USER_WORKSPACE_ROLE_HEAD {
+		members, err := s.userRepo.GetUserByWorkspace(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if member.ID != user.ID && member.WorkspaceRole == types.USER_WORKSPACE_ROLE_HEAD {
+				return nil, fmt.Errorf("%w: %s is already head of %s", ErrConflict, member.Username, id)
+			}
+		}
+	}
+	if req.ManagementLevel == 0 {
+		req.ManagementLevel = types.WorkspaceRoleLevels[req.WorkspaceRole]
+	}
+	user.Workspace = id
+	user.WorkspaceRole = req.WorkspaceRole
+	user.ManagementLevel = req.ManagementLevel
+	user.UpdateAt = time.Now().Unix()
+	if err := s.userRepo.UpdateUser(ctx, user.ID, user); err != nil {
+		return nil, err
+	}
+	return newWorkspaceMember(user), nil
+}
+
+func newWorkspaceMember(user *types.User) *types.WorkspaceMember {
+	return &types.WorkspaceMember{
+		ID:              user.ID,
+		Username:        user.Username,
+		FullName:        user.FullName,
+		Email:           user.Email,
+		Role:            user.Role,
+		WorkspaceRole:   user.WorkspaceRole,
+		ManagementLevel: user.ManagementLevel,
+	}
+}
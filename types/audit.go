@@ -0,0 +1,66 @@
+package types
+
+const (
+	AUDIT_ACTOR_USER      = "user"
+	AUDIT_ACTOR_ADMIN     = "admin"
+	AUDIT_ACTOR_ANONYMOUS = "anonymous"
+
+	AUDIT_OUTCOME_SUCCESS = "success"
+	AUDIT_OUTCOME_FAILURE = "failure"
+	AUDIT_OUTCOME_DENIED  = "denied"
+
+	AUDIT_ACTION_LOGIN            = "auth.login"
+	AUDIT_ACTION_USER_CREATE      = "user.create"
+	AUDIT_ACTION_USER_BATCH       = "user.batch_create"
+	AUDIT_ACTION_USER_IMPORT      = "user.import"
+	AUDIT_ACTION_USER_EXPORT      = "user.export"
+	AUDIT_ACTION_USER_UPDATE      = "user.update"
+	AUDIT_ACTION_USER_DELETE      = "user.delete"
+	AUDIT_ACTION_USER_RESTORE     = "user.restore"
+	AUDIT_ACTION_DOCUMENT_UPLOAD  = "document.upload"
+	AUDIT_ACTION_DOCUMENT_DELETE  = "document.delete"
+	AUDIT_ACTION_DOCUMENT_RESTORE = "document.restore"
+	AUDIT_ACTION_CHAT_ASK         = "chat.ask"
+	AUDIT_ACTION_FEEDBACK_REVIEW  = "feedback.review"
+	AUDIT_ACTION_FEEDBACK_INGEST  = "feedback.ingest"
+	AUDIT_ACTION_FAQ_CREATE       = "faq.create"
+	AUDIT_ACTION_FAQ_UPDATE       = "faq.update"
+	AUDIT_ACTION_FAQ_DELETE       = "faq.delete"
+	AUDIT_ACTION_PROMPT_SAVE      = "prompt.save"
+	AUDIT_ACTION_PROMPT_RESTORE   = "prompt.restore"
+	AUDIT_ACTION_AUDIT_EXPORT     = "audit.export"
+
+	AUDIT_TARGET_USER     = "user"
+	AUDIT_TARGET_DOCUMENT = "document"
+	AUDIT_TARGET_ANSWER   = "answer"
+	AUDIT_TARGET_FAQ      = "faq"
+	AUDIT_TARGET_PROMPT   = "prompt"
+)
+
+// AuditEvent is an entry of the append-only audit log
+type AuditEvent struct {
+	ID         string            `json:"id" bson:"_id,omitempty"`
+	ActorType  string            `json:"actor_type" bson:"actor_type"`
+	ActorID    string            `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	Actor      string            `json:"actor" bson:"actor"`
+	Workspace  string            `json:"workspace,omitempty" bson:"workspace,omitempty"`
+	Action     string            `json:"action" bson:"action"`
+	TargetType string            `json:"target_type,omitempty" bson:"target_type,omitempty"`
+	TargetID   string            `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	IP         string            `json:"ip" bson:"ip"`
+	UserAgent  string            `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Outcome    string            `json:"outcome" bson:"outcome"`
+	Message    string            `json:"message,omitempty" bson:"message,omitempty"`
+	Details    map[string]string `json:"details,omitempty" bson:"details,omitempty"`
+	CreateAt   int64             `json:"created_at" bson:"created_at"`
+}
+
+// AuditFilter selects audit events; From and To are unix timestamps, both inclusive
+type AuditFilter struct {
+	From     int64  `form:"from"`
+	To       int64  `form:"to"`
+	Actor    string `form:"actor"`
+	Action   string `form:"action"`
+	Outcome  string `form:"outcome"`
+	TargetID string `form:"target_id"`
+}
@@ -3,9 +3,34 @@ package types
 type ChatRequest struct {
 	ChatId   string    `json:"chat_id"`
 	Messages []Message `json:"messages"`
+	// Model asks for a model by name instead of the routing policy
+	Model string `json:"model,omitempty"`
+}
+
+// ModelInfo is a chat model clients can ask for
+type ModelInfo struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	// Available is false while the model is skipped after repeated failures
+	Available bool `json:"available"`
 }
 
 type ChatResponse struct {
 	ChatId  string   `json:"chat_id"`
 	Message *Message `json:"message"`
+	// PendingActions are destructive tool calls waiting for the user's confirmation
+	PendingActions []*PendingAction `json:"pending_actions,omitempty"`
+}
+
+// PendingAction is a tool call the assistant prepared but which only runs once
+// the user confirms it through the confirm endpoint
+type PendingAction struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	Tool      string `json:"tool"`
+	Summary   string `json:"summary"`
+	Args      []byte `json:"-"`
+	CreateAt  int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
 }
@@ -21,7 +21,28 @@ type DocumentServiceConfig struct {
 }
 
 type UploadRequest struct {
-	Title  string   `json:"title"`
-	Source string   `json:"source"`
-	Tags   []string `json:"tags"`
+	Title     string   `json:"title"`
+	Source    string   `json:"source"`
+	Tags      []string `json:"tags"`
+	Workspace string   `json:"workspace"`
+}
+
+// DocumentRecord is an uploaded file. Its chunks in the vector store carry its ID,
+// so soft-deleting the record hides them from search.
+type DocumentRecord struct {
+	ID        string   `json:"id" bson:"_id,omitempty"`
+	Title     string   `json:"title" bson:"title"`
+	Source    string   `json:"source" bson:"source"`
+	Tags      []string `json:"tags" bson:"tags"`
+	Workspace string   `json:"workspace" bson:"workspace"`
+	File      string   `json:"file" bson:"file"`
+	Chunks    int      `json:"chunks" bson:"chunks"`
+	CreateAt  int64    `json:"created_at" bson:"created_at"`
+	DeletedAt int64    `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy string   `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+}
+
+type DocumentFilter struct {
+	Workspace string `form:"workspace"`
+	Tag       string `form:"tag"`
 }
@@ -0,0 +1,35 @@
+package types
+
+// FAQ is an authoritative answer, given verbatim when a user question matches its question
+type FAQ struct {
+	ID       string   `json:"id" bson:"_id,omitempty"`
+	Question string   `json:"question" bson:"question"`
+	Answer   string   `json:"answer" bson:"answer"`
+	Tags     []string `json:"tags" bson:"tags"`
+	// Workspace restricts the entry to the members of a workspace, empty for everyone
+	Workspace string `json:"workspace" bson:"workspace"`
+	CreatedBy string `json:"created_by" bson:"created_by"`
+	UpdatedBy string `json:"updated_by" bson:"updated_by"`
+	CreateAt  int64  `json:"created_at" bson:"created_at"`
+	UpdateAt  int64  `json:"updated_at" bson:"updated_at"`
+}
+
+type FAQRequest struct {
+	Question  string   `json:"question"`
+	Answer    string   `json:"answer"`
+	Tags      []string `json:"tags"`
+	Workspace string   `json:"workspace"`
+}
+
+type FAQFilter struct {
+	Workspace string `form:"workspace"`
+	Tag       string `form:"tag"`
+}
+
+// FAQMatch is the FAQ entry nearest to a user question
+type FAQMatch struct {
+	FAQID    string  `json:"faq_id"`
+	Question string  `json:"question"`
+	Answer   string  `json:"answer"`
+	Distance float32 `json:"distance"`
+}
@@ -0,0 +1,63 @@
+package types
+
+const (
+	FEEDBACK_RATING_UP   = "up"
+	FEEDBACK_RATING_DOWN = "down"
+
+	FEEDBACK_REVIEW_PENDING  = "pending"
+	FEEDBACK_REVIEW_ACCEPTED = "accepted"
+	FEEDBACK_REVIEW_REJECTED = "rejected"
+
+	// CURATED_TAG marks the Q&A documents ingested from accepted corrections
+	CURATED_TAG = "curated"
+)
+
+// ChatAnswer is an assistant message kept so that its user can rate it later
+type ChatAnswer struct {
+	ID        string   `json:"id" bson:"_id,omitempty"`
+	ChatID    string   `json:"chat_id" bson:"chat_id"`
+	UserID    string   `json:"user_id" bson:"user_id"`
+	Username  string   `json:"username" bson:"username"`
+	Workspace string   `json:"workspace" bson:"workspace"`
+	Question  string   `json:"question" bson:"question"`
+	Answer    string   `json:"answer" bson:"answer"`
+	ChunkIDs  []string `json:"chunk_ids" bson:"chunk_ids"`
+	// Model is the model that answered
+	Model    string `json:"model,omitempty" bson:"model,omitempty"`
+	CreateAt int64  `json:"created_at" bson:"created_at"`
+	// Feedback is nil until the user rates the answer
+	Feedback *AnswerFeedback `json:"feedback,omitempty" bson:"feedback,omitempty"`
+}
+
+type AnswerFeedback struct {
+	Rating     string `json:"rating" bson:"rating"`
+	Comment    string `json:"comment,omitempty" bson:"comment,omitempty"`
+	Correction string `json:"correction,omitempty" bson:"correction,omitempty"`
+	RatedAt    int64  `json:"rated_at" bson:"rated_at"`
+	// ReviewStatus is pending for negative ratings until an admin reviews them
+	ReviewStatus string `json:"review_status,omitempty" bson:"review_status,omitempty"`
+	ReviewedBy   string `json:"reviewed_by,omitempty" bson:"reviewed_by,omitempty"`
+	ReviewedAt   int64  `json:"reviewed_at,omitempty" bson:"reviewed_at,omitempty"`
+	ReviewNote   string `json:"review_note,omitempty" bson:"review_note,omitempty"`
+	// CuratedDocumentID is the DocumentRecord the correction was ingested as
+	CuratedDocumentID string `json:"curated_document_id,omitempty" bson:"curated_document_id,omitempty"`
+}
+
+type AnswerFeedbackRequest struct {
+	Rating     string `json:"rating"`
+	Comment    string `json:"comment"`
+	Correction string `json:"correction"`
+}
+
+type AnswerReviewRequest struct {
+	Status string `json:"status"`
+	// Correction replaces the user's correction when set
+	Correction string `json:"correction"`
+	Note       string `json:"note"`
+}
+
+// AnswerReviewFilter selects the review queue; Status defaults to pending
+type AnswerReviewFilter struct {
+	Status    string `form:"status"`
+	Workspace string `form:"workspace"`
+}
@@ -0,0 +1,37 @@
+package types
+
+const (
+	LOGIN_RESULT_SUCCESS             = "success"
+	LOGIN_RESULT_INVALID_CREDENTIALS = "invalid_credentials"
+	LOGIN_RESULT_LOCKED              = "locked"
+	LOGIN_RESULT_ERROR               = "error"
+)
+
+// LoginAttempt is the audit record kept for every login attempt
+type LoginAttempt struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	Username  string `json:"username" bson:"username"`
+	IP        string `json:"ip" bson:"ip"`
+	UserAgent string `json:"user_agent" bson:"user_agent"`
+	Result    string `json:"result" bson:"result"`
+	CreateAt  int64  `json:"created_at" bson:"created_at"`
+}
+
+// LoginThrottle tracks consecutive failures for a throttle key ("user:<name>" or "ip:<addr>")
+type LoginThrottle struct {
+	Key           string `json:"key" bson:"_id"`
+	Failures      int    `json:"failures" bson:"failures"`
+	LastFailureAt int64  `json:"last_failure_at" bson:"last_failure_at"`
+	LockedUntil   int64  `json:"locked_until" bson:"locked_until"`
+}
+
+// LoginThrottleConfig contains the brute-force protection settings.
+// After MaxFailures failures within FailureWindow seconds the key is locked for
+// BaseLockout seconds, doubling with every further failure up to MaxLockout.
+type LoginThrottleConfig struct {
+	MaxUserFailures int   // Failures per username before lockout
+	MaxIPFailures   int   // Failures per client IP before lockout
+	FailureWindow   int64 // Seconds after which the failure counter starts over
+	BaseLockout     int64 // First lockout duration in seconds
+	MaxLockout      int64 // Upper bound for the lockout duration in seconds
+}
@@ -3,6 +3,10 @@ package types
 const (
 	USER_ROLE_ADMIN = "admin"
 )
+const (
+	USER_AUTH_SOURCE_LOCAL = "local"
+	USER_AUTH_SOURCE_LDAP  = "ldap"
+)
 const (
 	USER_WORKSPACE_ROLE_EXECUTIVE = "executive"
 	USER_WORKSPACE_ROLE_HEAD      = "head"
@@ -35,6 +39,23 @@ const (
 	DepartmentMaterial       = "DepartmentMaterial"
 )
 
+// Departments are the workspaces every installation starts with
+var Departments = []Workspace{
+	{ID: DepartmentTechnical, Name: "Technical Department"},
+	{ID: DepartmentProductionPlan, Name: "Production Planning Department"},
+	{ID: DepartmentQuality, Name: "Quality Department"},
+	{ID: DepartmentMaterial, Name: "Material Department"},
+}
+
+// WorkspaceRoleLevels is the management level a workspace role implies
+var WorkspaceRoleLevels = map[string]int{
+	USER_WORKSPACE_ROLE_EXECUTIVE: USER_MANAGEMENT_LEVEL_EXECUTIVE,
+	USER_WORKSPACE_ROLE_HEAD:      USER_MANAGEMENT_LEVEL_HEAD,
+	USER_WORKSPACE_ROLE_DHEAD:     USER_MANAGEMENT_LEVEL_DHEAD,
+	USER_WORKSPACE_ROLE_ASSISTANT: USER_MANAGEMENT_LEVEL_ASSISTANT,
+	USER_WORKSPACE_ROLE_STAFF:     USER_MANAGEMENT_LEVEL_STAFF,
+}
+
 type Admin struct {
 	ID       string `json:"id" bson:"_id,omitempty"`
 	Username string `json:"username" bson:"username"`
@@ -47,16 +68,36 @@ type User struct {
 	Username        string `json:"username" bson:"username"`
 	Password        string `json:"password" bson:"password"`
 	FullName        string `json:"full_name" bson:"full_name"`
+	Email           string `json:"email,omitempty" bson:"email,omitempty"`
 	ManagementLevel int    `json:"management_level" bson:"management_level"`
+	Role            string `json:"role" bson:"role"`
 	WorkspaceRole   string `json:"workspace_role" bson:"workspace_role"`
 	Workspace       string `json:"workspace" bson:"workspace"`
+	AuthSource      string `json:"auth_source" bson:"auth_source"`
 	CreateAt        int64  `json:"created_at" bson:"created_at"`
 	UpdateAt        int64  `json:"updated_at" bson:"updated_at"`
+	DeletedAt       int64  `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy       string `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
 }
 
+// Workspace is a department. Its ID is the code stored in User.Workspace, e.g. DepartmentTechnical.
 type Workspace struct {
-	ID   string `json:"id" bson:"_id,omitempty"`
-	Name string `json:"name" bson:"name"`
+	ID          string `json:"id" bson:"_id,omitempty"`
+	Name        string `json:"name" bson:"name"`
+	Description string `json:"description" bson:"description"`
+	CreateAt    int64  `json:"created_at" bson:"created_at"`
+	UpdateAt    int64  `json:"updated_at" bson:"updated_at"`
+}
+
+// WorkspaceMember is a roster entry, the user without credentials
+type WorkspaceMember struct {
+	ID              string `json:"id"`
+	Username        string `json:"username"`
+	FullName        string `json:"full_name"`
+	Email           string `json:"email,omitempty"`
+	Role            string `json:"role"`
+	WorkspaceRole   string `json:"workspace_role"`
+	ManagementLevel int    `json:"management_level"`
 }
 
 type Task struct {
@@ -72,4 +113,43 @@ type Task struct {
 	CreateAt    int64  `json:"created_at" bson:"created_at"`
 	UpdateAt    int64  `json:"updated_at" bson:"updated_at"`
 	Report      string `json:"report" bson:"report"`
+	// History is append-only, entries are only ever pushed
+	History []TaskHistory `json:"history" bson:"history"`
+}
+
+const (
+	TASK_HISTORY_ACTION_CREATE = "create"
+	TASK_HISTORY_ACTION_UPDATE = "update"
+	TASK_HISTORY_ACTION_STATUS = "status"
+)
+
+type TaskHistory struct {
+	Actor    string `json:"actor" bson:"actor"`
+	Action   string `json:"action" bson:"action"`
+	Field    string `json:"field,omitempty" bson:"field,omitempty"`
+	From     string `json:"from,omitempty" bson:"from,omitempty"`
+	To       string `json:"to,omitempty" bson:"to,omitempty"`
+	CreateAt int64  `json:"created_at" bson:"created_at"`
+}
+
+// TaskComment is a comment on a task; ParentID links replies into threads
+type TaskComment struct {
+	ID       string `json:"id" bson:"_id,omitempty"`
+	TaskID   string `json:"task_id" bson:"task_id"`
+	ParentID string `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	Author   string `json:"author" bson:"author"`
+	Content  string `json:"content" bson:"content"`
+	CreateAt int64  `json:"created_at" bson:"created_at"`
+	// Replies is filled when comments are returned as threads, it is not stored
+	Replies []*TaskComment `json:"replies,omitempty" bson:"-"`
+}
+
+// TaskFilter narrows TaskRepo.ListTasks; zero values are ignored
+type TaskFilter struct {
+	Workspace      string
+	Assignee       string
+	Reporter       string
+	Status         []string
+	CreateFromTime int64
+	Deadline       int64 // Tasks due at or before this time
 }
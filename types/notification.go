@@ -0,0 +1,20 @@
+package types
+
+const (
+	NOTIFICATION_TYPE_TASK_DUE_SOON = "task_due_soon"
+	NOTIFICATION_TYPE_TASK_OVERDUE  = "task_overdue"
+)
+
+// Notification is an in-app notification. Key identifies what it is about,
+// e.g. "<task id>:task_overdue:<deadline>", so a scan never notifies twice.
+type Notification struct {
+	ID       string `json:"id" bson:"_id,omitempty"`
+	UserID   string `json:"user_id" bson:"user_id"`
+	Type     string `json:"type" bson:"type"`
+	Key      string `json:"-" bson:"key"`
+	TaskID   string `json:"task_id,omitempty" bson:"task_id,omitempty"`
+	Title    string `json:"title" bson:"title"`
+	Message  string `json:"message" bson:"message"`
+	Read     bool   `json:"read" bson:"read"`
+	CreateAt int64  `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,47 @@
+package types
+
+const (
+	PermissionChat             = "chat:use"
+	PermissionDocumentsRead    = "documents:read"
+	PermissionDocumentsUpload  = "documents:upload"
+	PermissionDocumentsDelete  = "documents:delete"
+	PermissionDocumentsManage  = "documents:manage"
+	PermissionUsersRead        = "users:read"
+	PermissionUsersManage      = "users:manage"
+	PermissionWorkspacesManage = "workspaces:manage"
+)
+
+// BasePermissions are granted to every authenticated user
+var BasePermissions = []string{
+	PermissionChat,
+	PermissionDocumentsRead,
+}
+
+// WorkspaceRolePermissions are granted by the role a user holds in their workspace.
+// Unless the user also holds a global permission, they only apply to that workspace.
+var WorkspaceRolePermissions = map[string][]string{
+	USER_WORKSPACE_ROLE_EXECUTIVE: {PermissionDocumentsUpload, PermissionDocumentsDelete, PermissionUsersRead},
+	USER_WORKSPACE_ROLE_HEAD:      {PermissionDocumentsUpload, PermissionDocumentsDelete, PermissionUsersRead},
+	USER_WORKSPACE_ROLE_DHEAD:     {PermissionDocumentsUpload, PermissionUsersRead},
+	USER_WORKSPACE_ROLE_ASSISTANT: {},
+	USER_WORKSPACE_ROLE_STAFF:     {},
+}
+
+// ManagementLevelPermissions are granted to users whose management level is at least the key
+var ManagementLevelPermissions = map[int][]string{
+	USER_MANAGEMENT_LEVEL_DHEAD: {PermissionDocumentsUpload, PermissionUsersRead},
+	USER_MANAGEMENT_LEVEL_HEAD:  {PermissionDocumentsDelete},
+}
+
+// GlobalPermissions are granted to users with USER_ROLE_ADMIN and to admin tokens.
+// PermissionDocumentsManage lets a user act on any workspace's corpus.
+var GlobalPermissions = []string{
+	PermissionChat,
+	PermissionDocumentsRead,
+	PermissionDocumentsUpload,
+	PermissionDocumentsDelete,
+	PermissionDocumentsManage,
+	PermissionUsersRead,
+	PermissionUsersManage,
+	PermissionWorkspacesManage,
+}
@@ -0,0 +1,73 @@
+package types
+
+const (
+	// PROMPT_KIND_SYSTEM is the persona of the chat assistant
+	PROMPT_KIND_SYSTEM = "system"
+	// PROMPT_KIND_RETRIEVAL wraps the retrieved documents given to the model, with {{.Context}} and {{.Question}}
+	PROMPT_KIND_RETRIEVAL = "retrieval"
+	// PROMPT_KIND_ASK_AI is the generative search prompt of ask-ai, Weaviate fills {title} and {content}
+	PROMPT_KIND_ASK_AI = "ask_ai"
+	// PROMPT_KIND_FAQ is the answer quoting an FAQ entry, with its {{.Question}} and its answer as {{.Context}}
+	PROMPT_KIND_FAQ = "faq"
+)
+
+var PromptKinds = []string{PROMPT_KIND_SYSTEM, PROMPT_KIND_RETRIEVAL, PROMPT_KIND_ASK_AI, PROMPT_KIND_FAQ}
+
+// PromptTemplate is a version of a text/template prompt. Versions are never edited,
+// saving a template adds a version and the latest version of a kind and workspace is used.
+type PromptTemplate struct {
+	ID   string `json:"id" bson:"_id,omitempty"`
+	Kind string `json:"kind" bson:"kind"`
+	// Workspace is the workspace whose members get the template, empty for the default of every workspace
+	Workspace string `json:"workspace" bson:"workspace"`
+	Version   int    `json:"version" bson:"version"`
+	// Language is the answer language, the template reads it as {{.Language}}
+	Language  string `json:"language" bson:"language"`
+	Content   string `json:"content" bson:"content"`
+	Note      string `json:"note" bson:"note"`
+	CreatedBy string `json:"created_by" bson:"created_by"`
+	CreateAt  int64  `json:"created_at" bson:"created_at"`
+}
+
+type PromptTemplateRequest struct {
+	Kind      string `json:"kind"`
+	Workspace string `json:"workspace"`
+	Language  string `json:"language"`
+	Content   string `json:"content"`
+	Note      string `json:"note"`
+}
+
+type PromptTemplateFilter struct {
+	Kind      string `form:"kind"`
+	Workspace string `form:"workspace"`
+}
+
+// PromptPreviewRequest renders a template for a sample user. Without content the
+// template in effect for the kind and workspace is rendered.
+type PromptPreviewRequest struct {
+	PromptTemplateRequest
+	FullName      string `json:"full_name"`
+	Username      string `json:"username"`
+	WorkspaceRole string `json:"workspace_role"`
+	Question      string `json:"question"`
+	Context       string `json:"context"`
+}
+
+type PromptPreviewResponse struct {
+	Content string `json:"content"`
+}
+
+// PromptData holds the variables of the prompt templates
+type PromptData struct {
+	// Name is the full name of the user, or the username when it is unknown
+	Name      string
+	Username  string
+	Role      string
+	Workspace string
+	Language  string
+	Date      string
+	Weekday   string
+	// Context and Question are only set for the retrieval, ask_ai and faq prompts
+	Context  string
+	Question string
+}
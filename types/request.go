@@ -4,6 +4,7 @@ type CreateUserRequest struct {
 	Username        string `json:"username"`
 	Password        string `json:"password"`
 	FullName        string `json:"full_name"`
+	Email           string `json:"email"`
 	ManagementLevel int    `json:"management_level"`
 	Role            string `json:"role"`
 	WorkspaceRole   string `json:"workspace_role"`
@@ -19,6 +20,7 @@ type UpdateUserRequest struct {
 	Username        string `json:"username"`
 	Password        string `json:"password"`
 	FullName        string `json:"full_name"`
+	Email           string `json:"email"`
 	ManagementLevel int    `json:"management_level"`
 	Role            string `json:"role"`
 	WorkspaceRole   string `json:"workspace_role"`
@@ -33,12 +35,70 @@ type GetUserRequest struct {
 	ID string `json:"id"`
 }
 
-type PaginateUserRequest struct {
-	Page  int64 `json:"page"`
-	Limit int64 `json:"limit"`
+// ListOptions are the paging, sorting and search parameters shared by list endpoints.
+// Sort is a field name, prefixed with - for descending order. When Cursor is set
+// Page is ignored and the page following the cursor is returned.
+type ListOptions struct {
+	Page   int64  `form:"page"`
+	Limit  int64  `form:"limit"`
+	Sort   string `form:"sort"`
+	Cursor string `form:"cursor"`
+	Search string `form:"q"`
+}
+
+type UserFilter struct {
+	Workspace       string `form:"workspace"`
+	Role            string `form:"role"`
+	WorkspaceRole   string `form:"workspace_role"`
+	ManagementLevel int    `form:"level"`
+	MinLevel        int    `form:"min_level"`
+	MaxLevel        int    `form:"max_level"`
 }
 
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
+
+type CreateTaskRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Workspace   string `json:"workspace"`
+	Deadline    int64  `json:"deadline"`
+	Assignee    string `json:"assignee"`
+}
+
+type AssignTaskRequest struct {
+	Assignee string `json:"assignee"`
+}
+
+type ReportTaskRequest struct {
+	Report string `json:"report"`
+}
+
+type TransitionTaskRequest struct {
+	Status string `json:"status"`
+}
+
+type CreateTaskCommentRequest struct {
+	Content  string `json:"content"`
+	ParentID string `json:"parent_id"`
+}
+
+type CreateWorkspaceRequest struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type UpdateWorkspaceRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AssignMemberRequest moves a user into the workspace; a zero management level is derived from the role
+type AssignMemberRequest struct {
+	UserID          string `json:"user_id"`
+	WorkspaceRole   string `json:"workspace_role"`
+	ManagementLevel int    `json:"management_level"`
+}
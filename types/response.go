@@ -6,15 +6,37 @@ type DataResponse struct {
 	Data    interface{} `json:"data"`
 }
 
+// PaginateResponse is the Data of every list endpoint
 type PaginateResponse struct {
 	Total    int64       `json:"total"`
 	Elements interface{} `json:"elements"`
 	Page     int64       `json:"page"`
 	Limit    int64       `json:"limit"`
+	// NextCursor fetches the following page when passed as cursor, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// PageInfo describes the page a repository list call returned
+type PageInfo struct {
+	Total      int64
+	Page       int64
+	Limit      int64
+	NextCursor string
+}
+
+func NewPaginateResponse(elements interface{}, page PageInfo) PaginateResponse {
+	return PaginateResponse{
+		Total:      page.Total,
+		Elements:   elements,
+		Page:       page.Page,
+		Limit:      page.Limit,
+		NextCursor: page.NextCursor,
+	}
 }
 
 type UploadResponse struct {
 	OriginalName string `json:"original_name,omitempty"`
+	DocumentID   string `json:"document_id,omitempty"`
 }
 
 type ProcessingDocumentStatus struct {
@@ -28,3 +50,26 @@ type ProcessingDocumentStatus struct {
 type LoginResponse struct {
 	AccessToken string `json:"access_token"`
 }
+
+// ImportUsersResult reports a user import. Rows are numbered as in the
+// spreadsheet, the header being row 1.
+type ImportUsersResult struct {
+	DryRun  bool             `json:"dry_run"`
+	Total   int              `json:"total"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Failed  int              `json:"failed"`
+	Errors  []ImportRowError `json:"errors"`
+}
+
+type ImportRowError struct {
+	Row      int    `json:"row"`
+	Username string `json:"username,omitempty"`
+	Message  string `json:"message"`
+}
+
+// AddError records a rejected row
+func (r *ImportUsersResult) AddError(row int, username, message string) {
+	r.Failed++
+	r.Errors = append(r.Errors, ImportRowError{Row: row, Username: username, Message: message})
+}
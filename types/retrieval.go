@@ -0,0 +1,7 @@
+package types
+
+// QueryPlan is the standalone question of a conversation and the search queries derived from it
+type QueryPlan struct {
+	Question string   `json:"question"`
+	Queries  []string `json:"queries"`
+}
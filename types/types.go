@@ -5,11 +5,16 @@ import (
 )
 
 const (
-	TypeWebsocketPing       = "ping"
-	TypeWebsocketPong       = "pong"
-	TypeWebsocketChat       = "chat"
+	TypeWebsocketPing = "ping"
+	TypeWebsocketPong = "pong"
+	TypeWebsocketChat = "chat"
+	// TypeWebsocketChatStream streams the answer as chat_delta and processing messages, then a chat message
+	TypeWebsocketChatStream = "chat_stream"
+	TypeWebsocketChatDelta  = "chat_delta"
 	TypeWebsocketProcessing = "processing"
 	TypeWebsocketError      = "error"
+	// TypeWebsocketNotification is pushed by the server, its payload is a Notification
+	TypeWebsocketNotification = "notification"
 )
 
 type WebsocketRequest struct {
@@ -18,7 +23,10 @@ type WebsocketRequest struct {
 }
 
 type WebSocketChatPayload struct {
+	ChatId   string    `json:"chat_id"`
 	Messages []Message `json:"messages"`
+	// Model asks for a model by name instead of the routing policy
+	Model string `json:"model,omitempty"`
 }
 
 type WebSocketResponse struct {
@@ -28,16 +36,39 @@ type WebSocketResponse struct {
 
 type WebSocketChatResponse struct {
 	Message string `json:"message"`
+	// MessageID identifies the stored answer for feedback, empty when it could not be stored
+	MessageID string   `json:"message_id,omitempty"`
+	ChunkIDs  []string `json:"chunk_ids,omitempty"`
+	// Model is the model that answered
+	Model string `json:"model,omitempty"`
+	// PendingActions are destructive tool calls waiting for the user's confirmation
+	PendingActions []*PendingAction `json:"pending_actions,omitempty"`
 }
 
 type WebSocketProcessingResponse struct {
 	Message string `json:"message"`
 }
 
+type WebSocketChatDeltaResponse struct {
+	Content string `json:"content"`
+}
+
+type WebSocketErrorResponse struct {
+	Message string `json:"message"`
+}
+
 // Message represents a single message in the conversation
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ID identifies a stored assistant answer, the user rates it with this ID
+	ID string `json:"id,omitempty"`
+	// ChunkIDs are the vector store chunks retrieved to write an assistant answer
+	ChunkIDs []string `json:"chunk_ids,omitempty"`
+	// FAQID is set when the answer is an FAQ answer given verbatim
+	FAQID string `json:"faq_id,omitempty"`
+	// Model is the model that wrote an assistant answer
+	Model string `json:"model,omitempty"`
 }
 
 // FunctionHandler is a type for handling function calls
@@ -46,6 +77,22 @@ type FunctionHandler func(ctx context.Context, args []byte) (any, error)
 // Handle stream responses
 type StreamHandler func(response string)
 
+const (
+	// STREAM_EVENT_DELTA carries the next piece of the answer
+	STREAM_EVENT_DELTA = "delta"
+	// STREAM_EVENT_STATUS tells what the assistant does before it goes on answering
+	STREAM_EVENT_STATUS = "status"
+)
+
+// StreamEvent is an event of a streamed chat answer
+type StreamEvent struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+// StreamEventHandler receives the events of a streamed chat answer
+type StreamEventHandler func(event StreamEvent)
+
 type AskAIWithRAGRequest struct {
 	Question      string        `json:"question"`
 	SearchRequest SearchRequest `json:"search_request"`
@@ -57,6 +104,16 @@ type SearchRequest struct {
 	Limit   int      `json:"limit,omitempty"`
 }
 
+// PlannedSearchRequest searches the queries planned from Question, Queries are searched as well
+type PlannedSearchRequest struct {
+	Question string   `json:"question" binding:"required"`
+	Queries  []string `json:"queries,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Limit    int      `json:"limit,omitempty"`
+}
+
 type SearchResponse struct {
 	Documents []Document `json:"documents"`
+	// Queries are the searched queries when they were planned by the server
+	Queries []string `json:"queries,omitempty"`
 }
@@ -0,0 +1,45 @@
+package types
+
+const (
+	USAGE_PERIOD_DAILY   = "daily"
+	USAGE_PERIOD_MONTHLY = "monthly"
+
+	// UsageDayLayout formats the day and month keys of usage records, in server local time
+	UsageDayLayout   = "2006-01-02"
+	UsageMonthLayout = "2006-01"
+)
+
+// UsageRecord accumulates the tokens one user spent on one model during one day
+type UsageRecord struct {
+	ID               string `json:"id" bson:"_id,omitempty"`
+	UserID           string `json:"user_id" bson:"user_id"`
+	Username         string `json:"username" bson:"username"`
+	Workspace        string `json:"workspace" bson:"workspace"`
+	Model            string `json:"model" bson:"model"`
+	Day              string `json:"day" bson:"day"`
+	Month            string `json:"month" bson:"month"`
+	PromptTokens     int64  `json:"prompt_tokens" bson:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens" bson:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens" bson:"total_tokens"`
+	Requests         int64  `json:"requests" bson:"requests"`
+	UpdateAt         int64  `json:"updated_at" bson:"updated_at"`
+}
+
+// UsageReportRow is the usage of a workspace during a day
+type UsageReportRow struct {
+	Day              string `json:"day" bson:"day"`
+	Workspace        string `json:"workspace" bson:"workspace"`
+	Users            int64  `json:"users" bson:"users"`
+	Requests         int64  `json:"requests" bson:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens" bson:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens" bson:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens" bson:"total_tokens"`
+}
+
+// UsageReportFilter selects the days of the report; From and To are YYYY-MM-DD, both inclusive
+type UsageReportFilter struct {
+	From      string `form:"from"`
+	To        string `form:"to"`
+	Workspace string `form:"workspace"`
+	Model     string `form:"model"`
+}
@@ -10,8 +10,14 @@ type Document struct {
 
 // Metadata contains additional document information
 type Metadata struct {
-	Title  string            `bson:"title" json:"title"`
-	Source string            `bson:"source" json:"source"`
-	Tags   []string          `bson:"tags" json:"tags"`
-	Custom map[string]string `bson:"custom" json:"custom"`
+	Title     string            `bson:"title" json:"title"`
+	Source    string            `bson:"source" json:"source"`
+	Tags      []string          `bson:"tags" json:"tags"`
+	Workspace string            `bson:"workspace" json:"workspace"`
+	Custom    map[string]string `bson:"custom" json:"custom"`
+	// DocumentID is the DocumentRecord the chunk was ingested from
+	DocumentID string `bson:"document_id,omitempty" json:"document_id,omitempty"`
+	// Workspaces, when not nil, limits a search to the chunks of these workspaces, "" standing
+	// for the global chunks without workspace. It is a search option and never stored.
+	Workspaces []string `bson:"-" json:"-"`
 }
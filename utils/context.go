@@ -0,0 +1,40 @@
+package utils
+
+import "context"
+
+type contextKey string
+
+const (
+	userClaimsContextKey  contextKey = "user"
+	adminClaimsContextKey contextKey = "admin"
+	clientIPContextKey    contextKey = "client_ip"
+)
+
+func ContextWithUserClaims(ctx context.Context, claims *UserClaims) context.Context {
+	return context.WithValue(ctx, userClaimsContextKey, claims)
+}
+
+func ContextWithAdminClaims(ctx context.Context, claims *AdminClaims) context.Context {
+	return context.WithValue(ctx, adminClaimsContextKey, claims)
+}
+
+// UserClaimsFromContext returns the claims of the user the request is made for
+func UserClaimsFromContext(ctx context.Context) (*UserClaims, bool) {
+	claims, ok := ctx.Value(userClaimsContextKey).(*UserClaims)
+	return claims, ok
+}
+
+func AdminClaimsFromContext(ctx context.Context) (*AdminClaims, bool) {
+	claims, ok := ctx.Value(adminClaimsContextKey).(*AdminClaims)
+	return claims, ok
+}
+
+// ContextWithClientIP keeps the client address resolved from the trusted proxies
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey, ip)
+}
+
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPContextKey).(string)
+	return ip, ok
+}
@@ -1,14 +1,28 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/tieubaoca/chatbot-be/config"
 	"github.com/tieubaoca/chatbot-be/types"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var ErrNoJWTKeys = errors.New("jwt keys are not configured")
+
 type UserClaims struct {
 	ID              string `json:"id"`
 	Username        string `json:"username"`
@@ -26,19 +40,254 @@ type AdminClaims struct {
 	jwt.RegisteredClaims
 }
 
-func GenerateUserToken(user *types.User) (string, error) {
-	// Get secret from environment variable
-	secret := os.Getenv("JWT_SECRET_USER")
-	if secret == "" {
-		secret = "default_secret" // Fallback secret, should be changed in production
+// jwtKey is a single key of a key set. signKey is nil for verify-only keys.
+type jwtKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// jwtKeySet signs with its first key and verifies with any key matching the token kid
+type jwtKeySet struct {
+	signing *jwtKey
+	keys    map[string]*jwtKey
+}
+
+// JWK is the public part of an asymmetric key, published so other services can verify our tokens
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+var (
+	jwtMu        sync.RWMutex
+	userKeySet   *jwtKeySet
+	adminKeySet  *jwtKeySet
+	jwtPublicSet []JWK
+)
+
+// SetupJWT validates the JWT config and loads the signing keys.
+// In release mode it refuses missing or default secrets; otherwise an ephemeral
+// random secret is generated so tokens never fall back to a well-known value.
+func SetupJWT(cfg config.JWTConfig) error {
+	release := config.IsReleaseMode()
+	if err := cfg.Validate(release); err != nil {
+		return err
+	}
+	userKeys, err := loadJWTKeySet("user", cfg.UserKeys)
+	if err != nil {
+		return err
+	}
+	adminKeys, err := loadJWTKeySet("admin", cfg.AdminKeys)
+	if err != nil {
+		return err
+	}
+
+	var jwks []JWK
+	for _, set := range []*jwtKeySet{userKeys, adminKeys} {
+		for _, key := range set.keys {
+			if jwk, ok := publicJWK(key); ok {
+				jwks = append(jwks, jwk)
+			}
+		}
 	}
 
+	jwtMu.Lock()
+	defer jwtMu.Unlock()
+	userKeySet = userKeys
+	adminKeySet = adminKeys
+	jwtPublicSet = jwks
+	return nil
+}
+
+// PublicJWKS returns the public keys of all asymmetric signing keys
+func PublicJWKS() []JWK {
+	jwtMu.RLock()
+	defer jwtMu.RUnlock()
+	return jwtPublicSet
+}
+
+func loadJWTKeySet(name string, keys []config.JWTKeyConfig) (*jwtKeySet, error) {
+	if len(keys) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		log.Printf("WARNING: no %s jwt keys configured, using an ephemeral secret; tokens will not survive a restart", name)
+		keys = []config.JWTKeyConfig{{KID: "ephemeral", Algorithm: config.JWTAlgorithmHS256, Secret: hex.EncodeToString(secret)}}
+	}
+	set := &jwtKeySet{keys: make(map[string]*jwtKey)}
+	for i, keyCfg := range keys {
+		key, err := loadJWTKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s jwt key %q: %w", name, keyCfg.KID, err)
+		}
+		if i == 0 {
+			set.signing = key
+		}
+		set.keys[key.kid] = key
+	}
+	return set, nil
+}
+
+func loadJWTKey(cfg config.JWTKeyConfig) (*jwtKey, error) {
+	key := &jwtKey{kid: cfg.KID}
+	switch cfg.Algorithm {
+	case config.JWTAlgorithmHS256:
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(cfg.Secret)
+		key.verifyKey = []byte(cfg.Secret)
+	case config.JWTAlgorithmRS256:
+		key.method = jwt.SigningMethodRS256
+		if cfg.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(cfg.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = privateKey
+			key.verifyKey = &privateKey.PublicKey
+		}
+		if cfg.PublicKeyFile != "" {
+			pem, err := os.ReadFile(cfg.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			if !matchesPrivateKey(key, publicKey) {
+				return nil, errors.New("public_key_file does not match private_key_file")
+			}
+			key.verifyKey = publicKey
+		}
+	case config.JWTAlgorithmEdDSA:
+		key.method = jwt.SigningMethodEdDSA
+		if cfg.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(cfg.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			privateKey, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = privateKey
+			key.verifyKey = privateKey.(ed25519.PrivateKey).Public()
+		}
+		if cfg.PublicKeyFile != "" {
+			pem, err := os.ReadFile(cfg.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			publicKey, err := jwt.ParseEdPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			if !matchesPrivateKey(key, publicKey) {
+				return nil, errors.New("public_key_file does not match private_key_file")
+			}
+			key.verifyKey = publicKey
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+	return key, nil
+}
+
+// matchesPrivateKey tells whether publicKey belongs to the private key of the key, if it
+// has one. A mismatch would fail the verification of every token the key signs.
+func matchesPrivateKey(key *jwtKey, publicKey crypto.PublicKey) bool {
+	if key.signKey == nil {
+		return true
+	}
+	public, ok := publicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && public.Equal(key.verifyKey)
+}
+
+func publicJWK(key *jwtKey) (JWK, bool) {
+	switch pub := key.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: key.kid,
+			Use: "sig",
+			Alg: key.method.Alg(),
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: key.kid,
+			Use: "sig",
+			Alg: key.method.Alg(),
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	}
+	return JWK{}, false
+}
+
+func getKeySet(admin bool) (*jwtKeySet, error) {
+	jwtMu.RLock()
+	defer jwtMu.RUnlock()
+	set := userKeySet
+	if admin {
+		set = adminKeySet
+	}
+	if set == nil {
+		return nil, ErrNoJWTKeys
+	}
+	return set, nil
+}
+
+func signToken(admin bool, claims jwt.Claims) (string, error) {
+	set, err := getKeySet(admin)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(set.signing.method, claims)
+	token.Header["kid"] = set.signing.kid
+	return token.SignedString(set.signing.signKey)
+}
+
+// keyFunc picks the verification key from the token kid and rejects any
+// algorithm other than the one configured for that key.
+// Tokens without a kid were issued before rotation and are checked against the signing key.
+func (s *jwtKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := s.signing
+	if kid, ok := token.Header["kid"].(string); ok {
+		key, ok = s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown jwt kid %q", kid)
+		}
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+func GenerateUserToken(user *types.User) (string, error) {
 	// Create claims
 	claims := UserClaims{
 		ID:              user.ID,
 		Username:        user.Username,
 		FullName:        user.FullName,
 		ManagementLevel: user.ManagementLevel,
+		Role:            user.Role,
 		WorkspaceRole:   user.WorkspaceRole,
 		Workspace:       user.Workspace,
 		RegisteredClaims: jwt.RegisteredClaims{
@@ -49,24 +298,10 @@ func GenerateUserToken(user *types.User) (string, error) {
 		},
 	}
 
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign and get the complete encoded token as a string
-	tokenString, err := token.SignedString([]byte(secret))
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
+	return signToken(false, claims)
 }
 
 func GenerateAdminToken(admin *types.Admin) (string, error) {
-	// Get secret from environment variable
-	secret := os.Getenv("JWT_SECRET_ADMIN")
-	if secret == "" {
-		secret = "default_admin_secret" // Fallback secret, should be changed in production
-	}
 	claims := AdminClaims{
 		ID:   admin.ID,
 		Role: admin.Role,
@@ -77,24 +312,16 @@ func GenerateAdminToken(admin *types.Admin) (string, error) {
 			Subject:   admin.ID,
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
-	if err != nil {
-		return "", err
-	}
-	return tokenString, nil
+	return signToken(true, claims)
 }
 
 func ParseUserToken(tokenString string) (*UserClaims, error) {
-	// Get secret from environment variable
-	secret := os.Getenv("JWT_SECRET_USER")
-	if secret == "" {
-		secret = "default_secret"
+	set, err := getKeySet(false)
+	if err != nil {
+		return nil, err
 	}
 	// Parse token
-	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, set.keyFunc)
 	if err != nil {
 		return nil, err
 	}
@@ -106,14 +333,11 @@ func ParseUserToken(tokenString string) (*UserClaims, error) {
 }
 
 func ParseAdminToken(tokenString string) (*AdminClaims, error) {
-	// Get secret from environment variable
-	secret := os.Getenv("JWT_SECRET_ADMIN")
-	if secret == "" {
-		secret = "default_admin_secret"
-	}
-	token, err := jwt.ParseWithClaims(tokenString, &AdminClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+	set, err := getKeySet(true)
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &AdminClaims{}, set.keyFunc)
 	if err != nil {
 		return nil, err
 	}
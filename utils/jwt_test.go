@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tieubaoca/chatbot-be/config"
+	"github.com/tieubaoca/chatbot-be/types"
+)
+
+const (
+	testSecretOld = "an old secret of at least thirty-two bytes"
+	testSecretNew = "a new secret of at least thirty-two bytes!"
+)
+
+// writePEM writes the private or public key as a PEM file and returns its path
+func writePEM(t *testing.T, name string, key any) string {
+	t.Helper()
+	var block *pem.Block
+	if public, ok := key.(crypto.PublicKey); ok && !isPrivateKey(key) {
+		der, err := x509.MarshalPKIXPublicKey(public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func isPrivateKey(key any) bool {
+	_, ok := key.(crypto.Signer)
+	return ok
+}
+
+func setupTestJWT(t *testing.T, userKeys ...config.JWTKeyConfig) error {
+	t.Helper()
+	return SetupJWT(config.JWTConfig{
+		UserKeys:  userKeys,
+		AdminKeys: []config.JWTKeyConfig{{KID: "admin", Algorithm: config.JWTAlgorithmHS256, Secret: testSecretOld}},
+	})
+}
+
+func TestSetupJWTRefusesPublicKeyOfAnotherPrivateKey(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	otherEdPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSAPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		algorithm string
+		private   any
+		public    any
+		matching  bool
+	}{
+		{"EdDSA pair", config.JWTAlgorithmEdDSA, edPrivate, edPublic, true},
+		{"EdDSA mismatch", config.JWTAlgorithmEdDSA, edPrivate, otherEdPublic, false},
+		{"RS256 pair", config.JWTAlgorithmRS256, rsaPrivate, &rsaPrivate.PublicKey, true},
+		{"RS256 mismatch", config.JWTAlgorithmRS256, rsaPrivate, &otherRSAPrivate.PublicKey, false},
+		{"RS256 with an EdDSA public key", config.JWTAlgorithmRS256, rsaPrivate, edPublic, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setupTestJWT(t, config.JWTKeyConfig{
+				KID:            "k1",
+				Algorithm:      tt.algorithm,
+				PrivateKeyFile: writePEM(t, "private.pem", tt.private),
+				PublicKeyFile:  writePEM(t, "public.pem", tt.public),
+			})
+			if !tt.matching {
+				if err == nil {
+					t.Fatal("SetupJWT accepted a public key of another private key")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetupJWT: %v", err)
+			}
+			token, err := GenerateUserToken(&types.User{ID: "u1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims, err := ParseUserToken(token); err != nil || claims.ID != "u1" {
+				t.Errorf("ParseUserToken = %+v, %v", claims, err)
+			}
+		})
+	}
+}
+
+func TestParseUserTokenSelectsKeyByKid(t *testing.T) {
+	oldKey := config.JWTKeyConfig{KID: "k1", Algorithm: config.JWTAlgorithmHS256, Secret: testSecretOld}
+	newKey := config.JWTKeyConfig{KID: "k2", Algorithm: config.JWTAlgorithmHS256, Secret: testSecretNew}
+	if err := setupTestJWT(t, oldKey); err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := GenerateUserToken(&types.User{ID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After the rotation new tokens are signed with the new key, the old ones still verify
+	if err := setupTestJWT(t, newKey, oldKey); err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := GenerateUserToken(&types.User{ID: "u2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := new(jwt.Parser).ParseUnverified(newToken, &UserClaims{})
+	if err != nil || parsed.Header["kid"] != "k2" {
+		t.Fatalf("new token kid %v, %v", parsed.Header["kid"], err)
+	}
+	for token, id := range map[string]string{oldToken: "u1", newToken: "u2"} {
+		if claims, err := ParseUserToken(token); err != nil || claims.ID != id {
+			t.Errorf("ParseUserToken of %s = %+v, %v", id, claims, err)
+		}
+	}
+
+	claims := UserClaims{ID: "u3", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+	sign := func(kid any, secret string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	// Tokens issued before the rotation without a kid are checked against the signing key
+	if _, err := ParseUserToken(sign(nil, testSecretNew)); err != nil {
+		t.Errorf("token without kid signed with the signing key: %v", err)
+	}
+	if _, err := ParseUserToken(sign(nil, testSecretOld)); err == nil {
+		t.Error("accepted a token without kid signed with a verify-only key")
+	}
+	if _, err := ParseUserToken(sign("k3", testSecretNew)); err == nil || !strings.Contains(err.Error(), "unknown jwt kid") {
+		t.Errorf("token with an unknown kid: %v", err)
+	}
+	// The kid picks the key, the secret of another key does not verify
+	if _, err := ParseUserToken(sign("k1", testSecretNew)); err == nil {
+		t.Error("accepted a token of kid k1 signed with the key of k2")
+	}
+}
+
+func TestParseUserTokenEnforcesTheAlgorithmOfTheKey(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	err := setupTestJWT(t,
+		config.JWTKeyConfig{KID: "hs", Algorithm: config.JWTAlgorithmHS256, Secret: testSecretNew},
+		config.JWTKeyConfig{KID: "ed", Algorithm: config.JWTAlgorithmEdDSA, PrivateKeyFile: writePEM(t, "private.pem", edPrivate)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := UserClaims{ID: "u1", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	if _, err := ParseUserToken(sign(jwt.SigningMethodEdDSA, "ed", edPrivate)); err != nil {
+		t.Fatalf("token of the EdDSA key: %v", err)
+	}
+	for name, token := range map[string]string{
+		"HS384 with the HS256 secret": sign(jwt.SigningMethodHS384, "hs", []byte(testSecretNew)),
+		// The public key is known to anyone, it must not be usable as an HMAC secret
+		"HS256 with the EdDSA public key": sign(jwt.SigningMethodHS256, "ed", []byte(edPublic)),
+		"none":                            sign(jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType),
+	} {
+		if _, err := ParseUserToken(token); err == nil {
+			t.Errorf("accepted a token signed %s", name)
+		}
+	}
+}
+
+func TestSetupJWTFailsClosedInReleaseMode(t *testing.T) {
+	t.Setenv("GIN_MODE", "release")
+	admin := []config.JWTKeyConfig{{KID: "admin", Algorithm: config.JWTAlgorithmHS256, Secret: testSecretOld}}
+	for name, userKeys := range map[string][]config.JWTKeyConfig{
+		"no keys":        nil,
+		"default secret": {{KID: "k1", Algorithm: config.JWTAlgorithmHS256, Secret: "changeme"}},
+		"short secret":   {{KID: "k1", Algorithm: config.JWTAlgorithmHS256, Secret: "too short"}},
+		"duplicate kid":  {{KID: "k1", Algorithm: config.JWTAlgorithmHS256, Secret: testSecretOld}, {KID: "k1", Algorithm: config.JWTAlgorithmHS256, Secret: testSecretNew}},
+		"no private key": {{KID: "k1", Algorithm: config.JWTAlgorithmEdDSA, PublicKeyFile: "public.pem"}},
+	} {
+		if err := SetupJWT(config.JWTConfig{UserKeys: userKeys, AdminKeys: admin}); err == nil {
+			t.Errorf("SetupJWT accepted %s in release mode", name)
+		}
+	}
+
+	// Outside release mode missing keys are replaced by an ephemeral secret
+	t.Setenv("GIN_MODE", "debug")
+	if err := SetupJWT(config.JWTConfig{}); err != nil {
+		t.Fatalf("SetupJWT without keys in debug mode: %v", err)
+	}
+	token, err := GenerateUserToken(&types.User{ID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseUserToken(token); err != nil {
+		t.Errorf("ParseUserToken with the ephemeral secret: %v", err)
+	}
+}
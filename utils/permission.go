@@ -0,0 +1,43 @@
+package utils
+
+import "github.com/tieubaoca/chatbot-be/types"
+
+// PermissionsFor builds the permission set from the global role, the workspace role and the management level
+func PermissionsFor(role, workspaceRole string, managementLevel int) map[string]bool {
+	permissions := make(map[string]bool)
+	if role == types.USER_ROLE_ADMIN {
+		for _, p := range types.GlobalPermissions {
+			permissions[p] = true
+		}
+		return permissions
+	}
+	for _, p := range types.BasePermissions {
+		permissions[p] = true
+	}
+	for _, p := range types.WorkspaceRolePermissions[workspaceRole] {
+		permissions[p] = true
+	}
+	for level, levelPermissions := range types.ManagementLevelPermissions {
+		if managementLevel < level {
+			continue
+		}
+		for _, p := range levelPermissions {
+			permissions[p] = true
+		}
+	}
+	return permissions
+}
+
+func (c *UserClaims) HasPermission(permission string) bool {
+	return PermissionsFor(c.Role, c.WorkspaceRole, c.ManagementLevel)[permission]
+}
+
+// IsGlobal reports whether the user may act outside their own workspace
+func (c *UserClaims) IsGlobal() bool {
+	return c.Role == types.USER_ROLE_ADMIN || c.WorkspaceRole == types.USER_WORKSPACE_ROLE_EXECUTIVE
+}
+
+// CanAccessWorkspace reports whether workspace-scoped permissions apply to the given workspace
+func (c *UserClaims) CanAccessWorkspace(workspace string) bool {
+	return c.IsGlobal() || (workspace != "" && workspace == c.Workspace)
+}
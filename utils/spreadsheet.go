@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrUnsupportedSpreadsheet = errors.New("unsupported spreadsheet format, expected .csv or .xlsx")
+
+const (
+	// xlsxSheetPath is the only sheet of the workbooks written by WriteSpreadsheet
+	xlsxSheetPath = "xl/worksheets/sheet1.xml"
+	// xlsxMaxSheetSize bounds the uncompressed size of the sheet read
+	xlsxMaxSheetSize = 64 << 20
+)
+
+// errXLSXNotExported refuses the workbooks not written by WriteSpreadsheet
+var errXLSXNotExported = errors.New("invalid xlsx file: only workbooks exported by this server can be read, save other workbooks as CSV")
+
+// ReadSpreadsheet reads the rows of a CSV file or of an XLSX workbook written by
+// WriteSpreadsheet, the format is picked from the file name extension. Workbooks saved
+// by spreadsheet programs are refused, they can be saved as CSV instead.
+func ReadSpreadsheet(filename string, r io.Reader) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		// Spreadsheet programs often save CSV with a UTF-8 byte order mark
+		if len(rows) > 0 && len(rows[0]) > 0 {
+			rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+		}
+		return rows, nil
+	case ".xlsx":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return readXLSX(data)
+	}
+	return nil, ErrUnsupportedSpreadsheet
+}
+
+// WriteSpreadsheet writes rows as CSV or as a single-sheet XLSX workbook
+func WriteSpreadsheet(format string, w io.Writer, rows [][]string) error {
+	switch strings.TrimPrefix(strings.ToLower(format), ".") {
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.WriteAll(rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	case "xlsx":
+		return writeXLSX(w, rows)
+	}
+	return ErrUnsupportedSpreadsheet
+}
+
+// xlsxSheet is the sheet written by writeXLSX, every cell an inline string
+type xlsxSheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX reads a workbook written by writeXLSX, with every row and cell in its place
+func readXLSX(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+	var sheetFile *zip.File
+	for _, file := range archive.File {
+		if file.Name == xlsxSheetPath {
+			sheetFile = file
+		}
+	}
+	if sheetFile == nil {
+		return nil, errXLSXNotExported
+	}
+	// The zip reader fails on parts longer than their declared size
+	if sheetFile.UncompressedSize64 > xlsxMaxSheetSize {
+		return nil, fmt.Errorf("invalid xlsx file: the sheet is larger than %d MB", xlsxMaxSheetSize>>20)
+	}
+	rc, err := sheetFile.Open()
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+	defer rc.Close()
+	var sheet xlsxSheet
+	if err := xml.NewDecoder(rc).Decode(&sheet); err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for i, row := range sheet.Rows {
+		if row.Number != i+1 {
+			return nil, errXLSXNotExported
+		}
+		values := make([]string, len(row.Cells))
+		for j, cell := range row.Cells {
+			if cell.Type != "inlineStr" || cell.Ref != xlsxColumnName(j)+strconv.Itoa(i+1) {
+				return nil, errXLSXNotExported
+			}
+			values[j] = cell.Inline
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+func xlsxColumnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+// writeXLSX writes a minimal workbook with one sheet of inline string cells
+func writeXLSX(w io.Writer, rows [][]string) error {
+	archive := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbookXML},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, value := range row {
+			fmt.Fprintf(&b, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, xlsxColumnName(j), i+1)
+			if err := xml.EscapeText(&b, []byte(value)); err != nil {
+				return err
+			}
+			b.WriteString(`</t></is></c>`)
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	if _, err := sheet.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return archive.Close()
+}
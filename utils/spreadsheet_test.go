@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildXLSX zips a workbook around the given sheetData content
+func buildXLSX(t *testing.T, sheetData string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	parts := map[string]string{
+		"[Content_Types].xml":        xlsxContentTypes,
+		"_rels/.rels":                xlsxRootRels,
+		"xl/workbook.xml":            xlsxWorkbookXML,
+		"xl/_rels/workbook.xml.rels": xlsxWorkbookRels,
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			sheetData + `</sheetData></worksheet>`,
+	}
+	for name, content := range parts {
+		f, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSpreadsheetRoundTrip(t *testing.T) {
+	rows := [][]string{
+		{"username", "full_name", "workspace"},
+		{"alice", "Nguyễn Thị <Alice> & co", "DepartmentTechnical"},
+		{"bob", "", "DepartmentFinance"},
+	}
+	for _, format := range []string{"csv", "xlsx"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteSpreadsheet(format, &buf, rows); err != nil {
+				t.Fatalf("WriteSpreadsheet: %v", err)
+			}
+			got, err := ReadSpreadsheet("users."+format, &buf)
+			if err != nil {
+				t.Fatalf("ReadSpreadsheet: %v", err)
+			}
+			if !reflect.DeepEqual(got, rows) {
+				t.Errorf("read %q, want %q", got, rows)
+			}
+		})
+	}
+}
+
+func TestReadXLSXRefusesWorkbooksNotExported(t *testing.T) {
+	tests := map[string]string{
+		"shared string":    `<row r="1"><c r="A1" t="s"><v>0</v></c></row>`,
+		"number":           `<row r="1"><c r="A1"><v>42</v></c></row>`,
+		"missing row":      `<row r="1"><c r="A1" t="inlineStr"><is><t>a</t></is></c></row><row r="3"><c r="A3" t="inlineStr"><is><t>b</t></is></c></row>`,
+		"row without r":    `<row><c r="A1" t="inlineStr"><is><t>a</t></is></c></row>`,
+		"skipped cell":     `<row r="1"><c r="B1" t="inlineStr"><is><t>a</t></is></c></row>`,
+		"cell of a row":    `<row r="1"><c r="A2" t="inlineStr"><is><t>a</t></is></c></row>`,
+		"cell without ref": `<row r="1"><c t="inlineStr"><is><t>a</t></is></c></row>`,
+	}
+	for name, sheetData := range tests {
+		t.Run(name, func(t *testing.T) {
+			rows, err := readXLSX(buildXLSX(t, sheetData))
+			if err == nil || !strings.Contains(err.Error(), "save other workbooks as CSV") {
+				t.Fatalf("readXLSX = %q, %v; want a not exported error", rows, err)
+			}
+		})
+	}
+}
+
+func TestReadXLSXWithoutSheet(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	archive.Create("xl/workbook.xml")
+	archive.Close()
+	if _, err := readXLSX(buf.Bytes()); err == nil || !strings.Contains(err.Error(), "invalid xlsx file") {
+		t.Fatalf("readXLSX = %v, want an invalid xlsx error", err)
+	}
+	if _, err := readXLSX([]byte("not a zip")); err == nil || !strings.Contains(err.Error(), "invalid xlsx file") {
+		t.Fatalf("readXLSX = %v, want an invalid xlsx error", err)
+	}
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 16383: "XFD"}
+	for index, want := range tests {
+		if name := xlsxColumnName(index); name != want {
+			t.Errorf("xlsxColumnName(%d) = %q, want %q", index, name, want)
+		}
+	}
+}